@@ -18,6 +18,12 @@ type MetricMaker interface {
 	MakeMetric(metric telegraf.Metric) telegraf.Metric
 }
 
+// errorRecorder is implemented by the metric makers keeping track of the
+// errors of their plugin.
+type errorRecorder interface {
+	RecordError(err error)
+}
+
 type accumulator struct {
 	maker     MetricMaker
 	metrics   chan<- telegraf.Metric
@@ -111,6 +117,9 @@ func (ac *accumulator) AddError(err error) {
 		return
 	}
 	NErrors.Incr(1)
+	if r, ok := ac.maker.(errorRecorder); ok {
+		r.RecordError(err)
+	}
 	log.Printf("E! [%s] Error in plugin: %v", ac.maker.LogName(), err)
 }
 
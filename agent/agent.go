@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"runtime"
+	"strconv"
 	"sync"
 	"time"
 
@@ -12,12 +13,17 @@ import (
 	"github.com/influxdata/telegraf/internal"
 	"github.com/influxdata/telegraf/internal/config"
 	"github.com/influxdata/telegraf/internal/models"
+	"github.com/influxdata/telegraf/internal/persister"
 	"github.com/influxdata/telegraf/plugins/serializers/influx"
+	"github.com/influxdata/telegraf/selfstat"
 )
 
 // Agent runs a set of plugins.
 type Agent struct {
 	Config *config.Config
+
+	// chains are the processors applied by each processor worker.
+	chains []models.RunningProcessors
 }
 
 // NewAgent returns an Agent for the given Config.
@@ -45,6 +51,17 @@ func (a *Agent) Run(ctx context.Context) error {
 		return err
 	}
 
+	var states *persister.Persister
+	if a.Config.Agent.Statefile != "" {
+		log.Printf("D! [agent] Restoring plugin states")
+		states, err = a.restoreStates()
+		if err != nil {
+			return err
+		}
+	}
+
+	a.setStatusFuncs()
+
 	log.Printf("D! [agent] Connecting outputs")
 	err = a.connectOutputs(ctx)
 	if err != nil {
@@ -57,14 +74,33 @@ func (a *Agent) Run(ctx context.Context) error {
 
 	startTime := time.Now()
 
+	log.Printf("D! [agent] Starting service processors")
+	stopProcessors, err := a.startServiceProcessors(procC)
+	if err != nil {
+		return err
+	}
+
 	log.Printf("D! [agent] Starting service inputs")
 	err = a.startServiceInputs(ctx, inputC)
 	if err != nil {
+		stopProcessors()
 		return err
 	}
 
 	var wg sync.WaitGroup
 
+	// Persist the states periodically while running, in addition to the
+	// final store on shutdown.
+	var storeWg sync.WaitGroup
+	stopStore := make(chan struct{})
+	if states != nil && a.Config.Agent.StatefileInterval.Duration > 0 {
+		storeWg.Add(1)
+		go func() {
+			defer storeWg.Done()
+			a.storeStates(states, stopStore)
+		}()
+	}
+
 	src := inputC
 	dst := inputC
 
@@ -97,6 +133,10 @@ func (a *Agent) Run(ctx context.Context) error {
 			if err != nil {
 				log.Printf("E! [agent] Error running processors: %v", err)
 			}
+
+			log.Printf("D! [agent] Stopping service processors")
+			stopProcessors()
+
 			close(dst)
 			log.Printf("D! [agent] Processor channel closed")
 		}(src, dst)
@@ -133,10 +173,19 @@ func (a *Agent) Run(ctx context.Context) error {
 	}(src)
 
 	wg.Wait()
+	close(stopStore)
+	storeWg.Wait()
 
 	log.Printf("D! [agent] Closing outputs")
 	a.closeOutputs()
 
+	if states != nil {
+		log.Printf("D! [agent] Persisting plugin states")
+		if err := states.Store(); err != nil {
+			log.Printf("E! [agent] Error persisting plugin states: %v", err)
+		}
+	}
+
 	log.Printf("D! [agent] Stopped Successfully")
 	return nil
 }
@@ -267,6 +316,11 @@ func (a *Agent) runInputs(
 		go func(input *models.RunningInput) {
 			defer wg.Done()
 
+			if input.Config.Schedule != nil {
+				a.gatherOnSchedule(ctx, acc, input, jitter)
+				return
+			}
+
 			if a.Config.Agent.RoundInterval {
 				err := internal.SleepContext(
 					ctx, internal.AlignDuration(startTime, interval))
@@ -297,19 +351,87 @@ func (a *Agent) gatherOnInterval(
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
+	a.gatherLoop(ctx, acc, input, ticker.C, jitter)
+}
+
+// gatherOnSchedule runs an input's gather function at the times of its
+// schedule until the context is done.
+func (a *Agent) gatherOnSchedule(
+	ctx context.Context,
+	acc telegraf.Accumulator,
+	input *models.RunningInput,
+	jitter time.Duration,
+) {
+	defer panicRecover(input)
+
+	ticker := NewScheduleTicker(input.Config.Schedule)
+	defer ticker.Stop()
+
+	select {
+	case <-ticker.C:
+	case <-ctx.Done():
+		return
+	}
+	a.gatherLoop(ctx, acc, input, ticker.C, jitter)
+}
+
+// gatherLoop runs an input's gather function, then again on each tick until
+// the context is done.  A gather due while the previous one is still running
+// is queued until it completes, or skipped with the skip overlap policy.
+func (a *Agent) gatherLoop(
+	ctx context.Context,
+	acc telegraf.Accumulator,
+	input *models.RunningInput,
+	ticks <-chan time.Time,
+	jitter time.Duration,
+) {
+	// done is closed when the running gather completes, nil when no gather is
+	// running.
+	var done <-chan struct{}
+	defer func() {
+		if done != nil {
+			<-done
+		}
+	}()
+
 	for {
 		err := internal.SleepContext(ctx, internal.RandomDuration(jitter))
 		if err != nil {
 			return
 		}
 
-		err = a.gatherOnce(acc, input, interval)
-		if err != nil {
-			acc.AddError(err)
+		if done != nil {
+			select {
+			case <-done:
+				done = nil
+			default:
+			}
+		}
+
+		switch {
+		case done == nil:
+			done = a.gatherOnce(ctx, acc, input)
+		case input.Config.GatherOverlap == models.GatherOverlapSkip:
+			input.GathersSkipped.Incr(1)
+			log.Printf("W! [agent] [%s] did not complete within its interval, skipping gather",
+				input.LogName())
+		default:
+			for done != nil {
+				log.Printf("W! [agent] [%s] did not complete within its interval",
+					input.LogName())
+				select {
+				case <-done:
+					done = nil
+				case <-ticks:
+				case <-ctx.Done():
+					return
+				}
+			}
+			done = a.gatherOnce(ctx, acc, input)
 		}
 
 		select {
-		case <-ticker.C:
+		case <-ticks:
 			continue
 		case <-ctx.Done():
 			return
@@ -317,52 +439,157 @@ func (a *Agent) gatherOnInterval(
 	}
 }
 
-// gatherOnce runs the input's Gather function once, logging a warning each
-// interval it fails to complete before.
+// gatherOnce starts a gather of the input and returns a channel closed when
+// it completes.  A gather running longer than the gather timeout of the input
+// is reported and cancelled; inputs not implementing telegraf.ContextInput
+// keep running until their Gather returns.
 func (a *Agent) gatherOnce(
+	ctx context.Context,
 	acc telegraf.Accumulator,
 	input *models.RunningInput,
-	timeout time.Duration,
-) error {
-	ticker := time.NewTicker(timeout)
-	defer ticker.Stop()
+) <-chan struct{} {
+	ctx, cancel := context.WithCancel(ctx)
+
+	var timer *time.Timer
+	if timeout := input.Config.GatherTimeout; timeout > 0 {
+		timer = time.AfterFunc(timeout, func() {
+			input.GatherTimeouts.Incr(1)
+			acc.AddError(fmt.Errorf("did not complete within its gather timeout of %s",
+				timeout))
+			cancel()
+		})
+	}
 
-	done := make(chan error)
+	done := make(chan struct{})
 	go func() {
-		done <- input.Gather(acc)
-	}()
+		defer close(done)
+		defer cancel()
 
-	for {
-		select {
-		case err := <-done:
-			return err
-		case <-ticker.C:
-			log.Printf("W! [agent] [%s] did not complete within its interval",
-				input.LogName())
+		err := input.Gather(ctx, acc)
+		if timer != nil {
+			timer.Stop()
 		}
-	}
+		// cancellation by a timeout is already reported
+		if err != nil && err != ctx.Err() {
+			acc.AddError(err)
+		}
+	}()
+	return done
 }
 
 // runProcessors applies processors to metrics.
+//
+// When more than one processor worker is configured, metrics are partitioned
+// between the workers by series so that the order within a series is kept.
 func (a *Agent) runProcessors(
 	src <-chan telegraf.Metric,
 	agg chan<- telegraf.Metric,
 ) error {
-	for metric := range src {
-		metrics := a.applyProcessors(metric)
+	chains := a.chains
+	workers := len(chains)
+	if workers <= 1 {
+		for metric := range src {
+			metrics := a.applyProcessors(metric)
 
-		for _, metric := range metrics {
-			agg <- metric
+			for _, metric := range metrics {
+				agg <- metric
+			}
 		}
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	queues := make([]chan telegraf.Metric, workers)
+	depths := make([]selfstat.Stat, workers)
+	for i := range queues {
+		queues[i] = make(chan telegraf.Metric, 100)
+		depths[i] = selfstat.Register("agent", "processor_queue_depth",
+			map[string]string{"worker": strconv.Itoa(i)})
+
+		wg.Add(1)
+		go func(queue <-chan telegraf.Metric, depth selfstat.Stat, chain models.RunningProcessors) {
+			defer wg.Done()
+			for metric := range queue {
+				depth.Set(int64(len(queue)))
+
+				metrics := applyProcessors(chain, metric)
+				for _, metric := range metrics {
+					agg <- metric
+				}
+			}
+		}(queues[i], depths[i], chains[i])
 	}
 
+	for metric := range src {
+		i := metric.HashID() % uint64(workers)
+		queues[i] <- metric
+		depths[i].Set(int64(len(queues[i])))
+	}
+
+	for _, queue := range queues {
+		close(queue)
+	}
+	wg.Wait()
+
 	return nil
 }
 
+// processorChains returns a chain of processors for each worker.  The first
+// worker uses the configured processors, the others use separate instances
+// of the processors that can be partitioned and share the other ones.
+func (a *Agent) processorChains(workers int) ([]models.RunningProcessors, error) {
+	if workers < 1 {
+		workers = 1
+	}
+	chains := make([]models.RunningProcessors, workers)
+	chains[0] = a.Config.Processors
+	for i := 1; i < workers; i++ {
+		chain := make(models.RunningProcessors, 0, len(a.Config.Processors))
+		for _, processor := range a.Config.Processors {
+			if !partitionable(processor) {
+				chain = append(chain, processor)
+				continue
+			}
+
+			clone, err := processor.Clone()
+			if err != nil {
+				return nil, fmt.Errorf("could not create processor %s: %v",
+					processor.Config.Name, err)
+			}
+			if clone != processor {
+				if err := clone.Init(); err != nil {
+					return nil, fmt.Errorf("could not initialize processor %s: %v",
+						processor.Config.Name, err)
+				}
+			}
+			chain = append(chain, clone)
+		}
+		chains[i] = chain
+	}
+	return chains, nil
+}
+
+// partitionable returns true if the processor can be replaced by a separate
+// instance for each worker.  Stateful and service processors may combine the
+// metrics of different series, such as topk, and their state is persisted for
+// a single instance, so all workers share one instance of them.
+func partitionable(processor *models.RunningProcessor) bool {
+	switch processor.Processor.(type) {
+	case telegraf.StatefulPlugin, telegraf.ServiceProcessor:
+		return false
+	}
+	return true
+}
+
 // applyProcessors applies all processors to a metric.
 func (a *Agent) applyProcessors(m telegraf.Metric) []telegraf.Metric {
+	return applyProcessors(a.Config.Processors, m)
+}
+
+// applyProcessors applies a chain of processors to a metric.
+func applyProcessors(processors models.RunningProcessors, m telegraf.Metric) []telegraf.Metric {
 	metrics := []telegraf.Metric{m}
-	for _, processor := range a.Config.Processors {
+	for _, processor := range processors {
 		metrics = processor.Apply(metrics...)
 	}
 
@@ -475,7 +702,7 @@ func (a *Agent) push(
 			aggregator.Push(acc)
 			break
 		case <-ctx.Done():
-			aggregator.Push(acc)
+			aggregator.PushFinal(acc)
 			return
 		}
 	}
@@ -633,6 +860,11 @@ func (a *Agent) initPlugins() error {
 				processor.Config.Name, err)
 		}
 	}
+	chains, err := a.processorChains(a.Config.Agent.ProcessorWorkers)
+	if err != nil {
+		return err
+	}
+	a.chains = chains
 	for _, aggregator := range a.Config.Aggregators {
 		err := aggregator.Init()
 		if err != nil {
@@ -650,6 +882,142 @@ func (a *Agent) initPlugins() error {
 	return nil
 }
 
+// setStatusFuncs gives the outputs implementing models.StatusReporter access
+// to the status of the other plugins.
+func (a *Agent) setStatusFuncs() {
+	for _, output := range a.Config.Outputs {
+		if sr, ok := output.Output.(models.StatusReporter); ok {
+			sr.SetStatusFunc(a.status)
+		}
+	}
+}
+
+// status returns the status of all inputs and outputs, with the agent
+// intervals filled in for the plugins not overriding them.
+func (a *Agent) status() models.AgentStatus {
+	var status models.AgentStatus
+	for _, output := range a.Config.Outputs {
+		s := output.Status()
+		if s.FlushInterval == 0 {
+			s.FlushInterval = a.Config.Agent.FlushInterval.Duration
+		}
+		status.Outputs = append(status.Outputs, s)
+	}
+	for _, input := range a.Config.Inputs {
+		s := input.Status()
+		if input.Config.Schedule != nil {
+			// the gathers of scheduled inputs have no fixed interval
+			s.Interval = 0
+		} else if s.Interval == 0 {
+			s.Interval = a.Config.Agent.Interval.Duration
+		}
+		status.Inputs = append(status.Inputs, s)
+	}
+	return status
+}
+
+// restoreStates registers all plugins implementing telegraf.StatefulPlugin
+// with a persister and restores their state from the state file.
+func (a *Agent) restoreStates() (*persister.Persister, error) {
+	p := persister.NewPersister(a.Config.Agent.Statefile)
+	seen := make(map[string]int)
+
+	register := func(kind, name, alias string, plugin interface{}, locker sync.Locker) error {
+		sp, ok := plugin.(telegraf.StatefulPlugin)
+		if !ok {
+			return nil
+		}
+		if locker != nil {
+			sp = &lockedState{Locker: locker, plugin: sp}
+		}
+		return p.Register(stateID(kind, name, alias, seen), sp)
+	}
+
+	// Inputs and outputs synchronize the access to their state themselves,
+	// processors and aggregators are only called under the lock of their
+	// running plugin.  The processor workers share the instance of stateful
+	// processors, so only the configured processors are registered.
+	for _, input := range a.Config.Inputs {
+		if err := register("inputs", input.Config.Name, input.Config.Alias, input.Input, nil); err != nil {
+			return nil, err
+		}
+	}
+	for _, processor := range a.Config.Processors {
+		if err := register("processors", processor.Config.Name, processor.Config.Alias, processor.Processor, processor); err != nil {
+			return nil, err
+		}
+	}
+	for _, aggregator := range a.Config.Aggregators {
+		if err := register("aggregators", aggregator.Config.Name, aggregator.Config.Alias, aggregator.Aggregator, aggregator); err != nil {
+			return nil, err
+		}
+	}
+	for _, output := range a.Config.Outputs {
+		if err := register("outputs", output.Config.Name, output.Config.Alias, output.Output, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.Load(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// lockedState holds the lock of a running plugin while accessing the state
+// of the plugin, so it can be persisted while the plugin runs.
+type lockedState struct {
+	sync.Locker
+	plugin telegraf.StatefulPlugin
+}
+
+func (l *lockedState) GetState() interface{} {
+	l.Lock()
+	defer l.Unlock()
+	return l.plugin.GetState()
+}
+
+func (l *lockedState) SetState(state interface{}) error {
+	l.Lock()
+	defer l.Unlock()
+	return l.plugin.SetState(state)
+}
+
+// storeStates persists the plugin states every statefile_interval until
+// stopped.
+func (a *Agent) storeStates(states *persister.Persister, stop <-chan struct{}) {
+	ticker := time.NewTicker(a.Config.Agent.StatefileInterval.Duration)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := states.Store(); err != nil {
+				log.Printf("E! [agent] Error persisting plugin states: %v", err)
+			}
+		}
+	}
+}
+
+// stateID returns an identifier for a plugin that is stable as long as the
+// configuration is unchanged.  Plugins with an alias are identified by it,
+// otherwise by their position among plugins of the same name.
+func stateID(kind, name, alias string, seen map[string]int) string {
+	id := kind + "." + name
+	if alias != "" {
+		return id + "::" + alias
+	}
+
+	n := seen[id]
+	seen[id]++
+	if n == 0 {
+		return id
+	}
+	return fmt.Sprintf("%s#%d", id, n)
+}
+
 // connectOutputs connects to all outputs.
 func (a *Agent) connectOutputs(ctx context.Context) error {
 	for _, output := range a.Config.Outputs {
@@ -716,6 +1084,61 @@ func (a *Agent) startServiceInputs(
 	return nil
 }
 
+// startServiceProcessors starts the service processors of each processor
+// worker.  The metrics they add are applied to the processors following them
+// and sent to dst.  The returned function stops them, it must be called once
+// no more metrics are applied.
+func (a *Agent) startServiceProcessors(
+	dst chan<- telegraf.Metric,
+) (func(), error) {
+	var wg sync.WaitGroup
+	var started []telegraf.ServiceProcessor
+	var queues []chan telegraf.Metric
+	seen := make(map[*models.RunningProcessor]bool)
+	stop := func() {
+		for _, sp := range started {
+			sp.Stop()
+		}
+		for _, queue := range queues {
+			close(queue)
+		}
+		wg.Wait()
+	}
+
+	for _, chain := range a.chains {
+		for i, processor := range chain {
+			sp, ok := processor.Processor.(telegraf.ServiceProcessor)
+			if !ok || seen[processor] {
+				continue
+			}
+			seen[processor] = true
+
+			queue := make(chan telegraf.Metric, 100)
+			queues = append(queues, queue)
+			wg.Add(1)
+			go func(next models.RunningProcessors) {
+				defer wg.Done()
+				for metric := range queue {
+					for _, metric := range applyProcessors(next, metric) {
+						dst <- metric
+					}
+				}
+			}(chain[i+1:])
+
+			err := sp.Start(NewAccumulator(processor, queue))
+			if err != nil {
+				log.Printf("E! [agent] Service for [%s] failed to start: %v",
+					processor.LogName(), err)
+				stop()
+				return nil, err
+			}
+			started = append(started, sp)
+		}
+	}
+
+	return stop, nil
+}
+
 // stopServiceInputs stops all service inputs.
 func (a *Agent) stopServiceInputs() {
 	for _, input := range a.Config.Inputs {
@@ -1,12 +1,23 @@
 package agent
 
 import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/internal/config"
+	"github.com/influxdata/telegraf/internal/models"
+	"github.com/influxdata/telegraf/plugins/aggregators/basicstats"
 	_ "github.com/influxdata/telegraf/plugins/inputs/all"
 	_ "github.com/influxdata/telegraf/plugins/outputs/all"
+	"github.com/influxdata/telegraf/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -166,3 +177,351 @@ func TestWindow(t *testing.T) {
 		})
 	}
 }
+
+func TestAgent_StateID(t *testing.T) {
+	seen := make(map[string]int)
+	assert.Equal(t, "aggregators.basicstats", stateID("aggregators", "basicstats", "", seen))
+	assert.Equal(t, "aggregators.basicstats#1", stateID("aggregators", "basicstats", "", seen))
+	assert.Equal(t, "aggregators.basicstats::cpu", stateID("aggregators", "basicstats", "cpu", seen))
+	assert.Equal(t, "processors.basicstats", stateID("processors", "basicstats", "", seen))
+}
+
+// seqProcessor adds the number of metrics it has seen in the series as a
+// field, and the instance it belongs to as a tag.
+type seqProcessor struct {
+	instance string
+	seen     map[uint64]int64
+}
+
+func (p *seqProcessor) SampleConfig() string { return "" }
+func (p *seqProcessor) Description() string  { return "" }
+func (p *seqProcessor) Apply(in ...telegraf.Metric) []telegraf.Metric {
+	for _, m := range in {
+		id := m.HashID()
+		p.seen[id]++
+		m.AddField("seen", p.seen[id])
+		m.AddTag("instance", p.instance)
+	}
+	return in
+}
+
+func TestAgent_ProcessorWorkers(t *testing.T) {
+	var instances int
+	creator := func() (telegraf.Processor, error) {
+		instances++
+		return &seqProcessor{instance: strconv.Itoa(instances), seen: make(map[uint64]int64)}, nil
+	}
+	processor, _ := creator()
+
+	rp := models.NewRunningProcessor(processor, &models.ProcessorConfig{Name: "seq"})
+	rp.Creator = creator
+
+	c := config.NewConfig()
+	c.Agent.ProcessorWorkers = 4
+	c.Processors = models.RunningProcessors{rp}
+	a, err := NewAgent(c)
+	require.NoError(t, err)
+	require.NoError(t, a.initPlugins())
+
+	src := make(chan telegraf.Metric, 200)
+	dst := make(chan telegraf.Metric, 200)
+	for i := 0; i < 20; i++ {
+		for series := 0; series < 10; series++ {
+			src <- testutil.MustMetric("cpu",
+				map[string]string{"series": strconv.Itoa(series)},
+				map[string]interface{}{"value": int64(i)},
+				time.Unix(0, 0))
+		}
+	}
+	close(src)
+
+	require.NoError(t, a.runProcessors(src, dst))
+	close(dst)
+	require.Equal(t, 4, instances)
+
+	// Each series must be handled by a single processor instance, in order.
+	instance := make(map[string]string)
+	for m := range dst {
+		series, _ := m.GetTag("series")
+		inst, _ := m.GetTag("instance")
+		if prev, ok := instance[series]; ok {
+			require.Equal(t, prev, inst)
+		}
+		instance[series] = inst
+
+		value, _ := m.GetField("value")
+		seen, _ := m.GetField("seen")
+		require.Equal(t, value.(int64)+1, seen)
+	}
+	require.Len(t, instance, 10)
+}
+
+func TestAgent_ProcessorWorkersCreateError(t *testing.T) {
+	processor := &seqProcessor{seen: make(map[uint64]int64)}
+	rp := models.NewRunningProcessor(processor, &models.ProcessorConfig{Name: "seq"})
+	rp.Creator = func() (telegraf.Processor, error) {
+		return nil, errors.New("no more instances")
+	}
+
+	c := config.NewConfig()
+	c.Agent.ProcessorWorkers = 2
+	c.Processors = models.RunningProcessors{rp}
+	a, err := NewAgent(c)
+	require.NoError(t, err)
+	require.Error(t, a.initPlugins())
+}
+
+// statefulSeqProcessor is a seqProcessor persisting the metrics it has seen.
+type statefulSeqProcessor struct {
+	seqProcessor
+}
+
+func (p *statefulSeqProcessor) GetState() interface{} {
+	state := make(map[uint64]int64, len(p.seen))
+	for id, n := range p.seen {
+		state[id] = n
+	}
+	return state
+}
+
+func (p *statefulSeqProcessor) SetState(state interface{}) error {
+	p.seen = state.(map[uint64]int64)
+	return nil
+}
+
+func TestAgent_ProcessorWorkersShareStateful(t *testing.T) {
+	var instances int
+	creator := func() (telegraf.Processor, error) {
+		instances++
+		return &statefulSeqProcessor{seqProcessor{instance: strconv.Itoa(instances), seen: make(map[uint64]int64)}}, nil
+	}
+	processor, _ := creator()
+	rp := models.NewRunningProcessor(processor, &models.ProcessorConfig{Name: "seq"})
+	rp.Creator = creator
+
+	sp := &startProcessor{}
+	rsp := models.NewRunningProcessor(sp, &models.ProcessorConfig{Name: "start"})
+	rsp.Creator = func() (telegraf.Processor, error) {
+		return &startProcessor{}, nil
+	}
+
+	c := config.NewConfig()
+	c.Agent.ProcessorWorkers = 4
+	c.Processors = models.RunningProcessors{rsp, rp}
+	a, err := NewAgent(c)
+	require.NoError(t, err)
+	require.NoError(t, a.initPlugins())
+	require.Equal(t, 1, instances)
+	for _, chain := range a.chains {
+		require.Equal(t, models.RunningProcessors{rsp, rp}, chain)
+	}
+
+	// the shared service processor is started once
+	dst := make(chan telegraf.Metric, 10)
+	stop, err := a.startServiceProcessors(dst)
+	require.NoError(t, err)
+	require.Equal(t, "started", (<-dst).Name())
+	stop()
+	close(dst)
+	require.Empty(t, dst)
+
+	src := make(chan telegraf.Metric, 20)
+	dst = make(chan telegraf.Metric, 20)
+	for series := 0; series < 10; series++ {
+		src <- testutil.MustMetric("cpu",
+			map[string]string{"series": strconv.Itoa(series)},
+			map[string]interface{}{"value": int64(0)},
+			time.Unix(0, 0))
+	}
+	close(src)
+	require.NoError(t, a.runProcessors(src, dst))
+	close(dst)
+
+	// all series, and the started metric, are seen by the single instance of
+	// the stateful processor
+	for m := range dst {
+		inst, _ := m.GetTag("instance")
+		require.Equal(t, "1", inst)
+	}
+	require.Len(t, processor.(*statefulSeqProcessor).seen, 11)
+}
+
+func TestAgent_AggregatorStateRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "telegraf")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	statefile := filepath.Join(dir, "state.json")
+
+	// run starts an agent with a basicstats aggregator, adds the metrics and
+	// stops it, returning the count pushed on shutdown.
+	run := func(metrics ...telegraf.Metric) interface{} {
+		bs := basicstats.NewBasicStats()
+		bs.Stats = []string{"count"}
+		c := config.NewConfig()
+		c.Agent.Statefile = statefile
+		c.Aggregators = []*models.RunningAggregator{
+			models.NewRunningAggregator(bs, &models.AggregatorConfig{
+				Name:         "basicstats",
+				Period:       time.Hour,
+				DropOriginal: true,
+			}),
+		}
+		a, err := NewAgent(c)
+		require.NoError(t, err)
+		require.NoError(t, a.initPlugins())
+		states, err := a.restoreStates()
+		require.NoError(t, err)
+
+		src := make(chan telegraf.Metric, 10)
+		dst := make(chan telegraf.Metric, 10)
+		for _, m := range metrics {
+			src <- m
+		}
+		close(src)
+		require.NoError(t, a.runAggregators(time.Now(), src, dst))
+		close(dst)
+		require.NoError(t, states.Store())
+
+		m := <-dst
+		require.NotNil(t, m)
+		count, _ := m.GetField("value_count")
+		return count
+	}
+
+	cpu := func() telegraf.Metric {
+		return testutil.MustMetric("cpu", map[string]string{},
+			map[string]interface{}{"value": 1.0}, time.Now())
+	}
+	require.Equal(t, float64(1), run(cpu()))
+	require.Equal(t, float64(2), run(cpu()))
+}
+
+// startProcessor adds a metric when started.
+type startProcessor struct {
+	stopped bool
+}
+
+func (p *startProcessor) SampleConfig() string { return "" }
+func (p *startProcessor) Description() string  { return "" }
+func (p *startProcessor) Apply(in ...telegraf.Metric) []telegraf.Metric {
+	return in
+}
+
+func (p *startProcessor) Start(acc telegraf.Accumulator) error {
+	acc.AddFields("started", map[string]interface{}{"value": 1}, nil, time.Unix(0, 0))
+	return nil
+}
+
+func (p *startProcessor) Stop() {
+	p.stopped = true
+}
+
+func TestAgent_ServiceProcessor(t *testing.T) {
+	sp := &startProcessor{}
+	seq := &seqProcessor{instance: "1", seen: make(map[uint64]int64)}
+
+	c := config.NewConfig()
+	c.Processors = models.RunningProcessors{
+		models.NewRunningProcessor(sp, &models.ProcessorConfig{Name: "start"}),
+		models.NewRunningProcessor(seq, &models.ProcessorConfig{Name: "seq"}),
+	}
+	a, err := NewAgent(c)
+	require.NoError(t, err)
+	require.NoError(t, a.initPlugins())
+
+	dst := make(chan telegraf.Metric, 10)
+	stop, err := a.startServiceProcessors(dst)
+	require.NoError(t, err)
+
+	// the metrics added by the processor are applied to the next ones
+	m := <-dst
+	require.Equal(t, "started", m.Name())
+	require.True(t, m.HasTag("instance"))
+
+	stop()
+	require.True(t, sp.stopped)
+}
+
+// blockingInput counts its gathers, and blocks each gather until the context
+// is done or release is closed.
+type blockingInput struct {
+	gathers int32
+	release chan struct{}
+}
+
+func (i *blockingInput) SampleConfig() string { return "" }
+func (i *blockingInput) Description() string  { return "" }
+func (i *blockingInput) Gather(acc telegraf.Accumulator) error {
+	return i.GatherContext(context.Background(), acc)
+}
+
+func (i *blockingInput) GatherContext(ctx context.Context, acc telegraf.Accumulator) error {
+	atomic.AddInt32(&i.gathers, 1)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-i.release:
+		return nil
+	}
+}
+
+func TestAgent_GatherTimeout(t *testing.T) {
+	input := &blockingInput{release: make(chan struct{})}
+	ri := models.NewRunningInput(input, &models.InputConfig{
+		Name:          "gather_timeout",
+		GatherTimeout: 20 * time.Millisecond,
+	})
+	// the stats are shared by the inputs with the same name
+	timeouts := ri.GatherTimeouts.Get()
+	skipped := ri.GathersSkipped.Get()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	var acc testutil.Accumulator
+	a := &Agent{}
+	a.gatherOnInterval(ctx, &acc, ri, 50*time.Millisecond, 0)
+
+	// each gather is cancelled at the timeout, except maybe the last one
+	// cancelled when stopping, so none is skipped
+	timeouts = ri.GatherTimeouts.Get() - timeouts
+	gathers := int64(atomic.LoadInt32(&input.gathers))
+	require.True(t, timeouts >= 3, "timeouts: %d", timeouts)
+	require.True(t, gathers-timeouts <= 1, "gathers: %d, timeouts: %d", gathers, timeouts)
+	require.Len(t, acc.Errors, int(timeouts))
+	require.Equal(t, skipped, ri.GathersSkipped.Get())
+}
+
+func TestAgent_GatherOverlapSkip(t *testing.T) {
+	input := &blockingInput{release: make(chan struct{})}
+	// hide GatherContext, so that the gather cannot be cancelled
+	ri := models.NewRunningInput(struct{ telegraf.Input }{input}, &models.InputConfig{
+		Name:          "gather_overlap_skip",
+		GatherTimeout: 20 * time.Millisecond,
+		GatherOverlap: models.GatherOverlapSkip,
+	})
+	timeouts := ri.GatherTimeouts.Get()
+	skipped := ri.GathersSkipped.Get()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var acc testutil.Accumulator
+	a := &Agent{}
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		a.gatherOnInterval(ctx, &acc, ri, 20*time.Millisecond, 0)
+	}()
+
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+	select {
+	case <-stopped:
+		t.Fatal("stopped before the gather completed")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(input.release)
+	<-stopped
+
+	require.Equal(t, int32(1), atomic.LoadInt32(&input.gathers))
+	require.Equal(t, int64(1), ri.GatherTimeouts.Get()-timeouts)
+	require.True(t, ri.GathersSkipped.Get()-skipped >= 3)
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/internal/cron"
 )
 
 type Ticker struct {
@@ -55,3 +56,59 @@ func (t *Ticker) relayTime(ctx context.Context) {
 		}
 	}
 }
+
+// ScheduleTicker delivers the activation times of a cron schedule.  Like
+// time.Ticker, it drops the ticks of a slow receiver.
+type ScheduleTicker struct {
+	C          chan time.Time
+	schedule   *cron.Schedule
+	wg         sync.WaitGroup
+	cancelFunc context.CancelFunc
+}
+
+func NewScheduleTicker(schedule *cron.Schedule) *ScheduleTicker {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	t := &ScheduleTicker{
+		C:          make(chan time.Time, 1),
+		schedule:   schedule,
+		cancelFunc: cancel,
+	}
+
+	t.wg.Add(1)
+	go t.relayTime(ctx)
+
+	return t
+}
+
+func (t *ScheduleTicker) Stop() {
+	t.cancelFunc()
+	t.wg.Wait()
+}
+
+func (t *ScheduleTicker) relayTime(ctx context.Context) {
+	defer t.wg.Done()
+	var last time.Time
+	for {
+		// the clock may be slightly behind the last activation time
+		now := time.Now()
+		if now.Before(last) {
+			now = last
+		}
+		next := t.schedule.Next(now)
+		if next.IsZero() {
+			return
+		}
+
+		err := internal.SleepContext(ctx, time.Until(next))
+		if err != nil {
+			return
+		}
+		last = next
+
+		select {
+		case t.C <- next:
+		default:
+		}
+	}
+}
@@ -1,5 +1,7 @@
 package telegraf
 
+import "context"
+
 type Input interface {
 	// SampleConfig returns the default configuration of the Input
 	SampleConfig() string
@@ -12,6 +14,16 @@ type Input interface {
 	Gather(Accumulator) error
 }
 
+// ContextInput is an Input whose gather can be cancelled.  When an input
+// implements it, the agent calls GatherContext instead of Gather.
+type ContextInput interface {
+	Input
+
+	// GatherContext is like Gather, but returns early when the context is
+	// done, such as when the gather times out or the agent stops.
+	GatherContext(ctx context.Context, acc Accumulator) error
+}
+
 type ServiceInput interface {
 	Input
 
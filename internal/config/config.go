@@ -20,6 +20,7 @@ import (
 
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/internal/cron"
 	"github.com/influxdata/telegraf/internal/models"
 	"github.com/influxdata/telegraf/plugins/aggregators"
 	"github.com/influxdata/telegraf/plugins/inputs"
@@ -170,6 +171,19 @@ type AgentConfig struct {
 
 	Hostname     string
 	OmitHostname bool
+
+	// ProcessorWorkers is the number of goroutines applying processors to
+	// metrics.  Metrics are partitioned between the workers by series, so
+	// the order of metrics within a series is preserved.
+	ProcessorWorkers int `toml:"processor_workers"`
+
+	// Statefile is the path of the file used to persist the state of plugins
+	// across restarts.  When empty the state is not persisted.
+	Statefile string `toml:"statefile"`
+
+	// StatefileInterval is the interval at which the state is persisted
+	// while running.  When zero the state is only persisted on shutdown.
+	StatefileInterval internal.Duration `toml:"statefile_interval"`
 }
 
 // Inputs returns a list of strings of the configured inputs.
@@ -321,6 +335,20 @@ var agentConfig = `
   ## If set to true, do no set the "host" tag in the telegraf agent.
   omit_hostname = false
 
+  ## Number of workers applying processors to metrics in parallel.  Metrics
+  ## are assigned to workers by series, preserving the order within each
+  ## series.  Stateful processors such as topk are shared by all workers.
+  # processor_workers = 1
+
+  ## Path of the file used to persist the state of supporting plugins, such
+  ## as aggregator caches, across restarts.  The state is written on shutdown
+  ## and restored on startup.  If empty the state is not persisted.
+  # statefile = ""
+
+  ## Interval at which the state is also written while running, so that it
+  ## survives a crash.  If zero the state is only written on shutdown.
+  # statefile_interval = "0s"
+
 `
 
 var outputHeader = `
@@ -941,6 +969,13 @@ func (c *Config) addProcessor(name string, table *ast.Table) error {
 	}
 
 	rf := models.NewRunningProcessor(processor, processorConfig)
+	rf.Creator = func() (telegraf.Processor, error) {
+		processor := creator()
+		if err := toml.UnmarshalTable(table, processor); err != nil {
+			return nil, err
+		}
+		return processor, nil
+	}
 
 	c.Processors = append(c.Processors, rf)
 	return nil
@@ -967,6 +1002,10 @@ func (c *Config) addOutput(name string, table *ast.Table) error {
 		t.SetSerializer(serializer)
 	}
 
+	if t, ok := output.(outputs.GlobalTagsOutput); ok {
+		t.SetGlobalTags(c.Tags)
+	}
+
 	outputConfig, err := buildOutput(name, table)
 	if err != nil {
 		return err
@@ -1344,6 +1383,50 @@ func buildInput(name string, tbl *ast.Table) (*models.InputConfig, error) {
 		}
 	}
 
+	if node, ok := tbl.Fields["schedule"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				schedule, err := cron.Parse(str.Value)
+				if err != nil {
+					return nil, err
+				}
+
+				cp.Schedule = schedule
+			}
+		}
+	}
+
+	if cp.Schedule != nil && cp.Interval != 0 {
+		return nil, fmt.Errorf("interval and schedule cannot be set together")
+	}
+
+	if node, ok := tbl.Fields["gather_timeout"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				dur, err := time.ParseDuration(str.Value)
+				if err != nil {
+					return nil, err
+				}
+
+				cp.GatherTimeout = dur
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["gather_overlap"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				switch str.Value {
+				case models.GatherOverlapQueue, models.GatherOverlapSkip:
+					cp.GatherOverlap = str.Value
+				default:
+					return nil, fmt.Errorf("invalid gather_overlap %q, must be %q or %q",
+						str.Value, models.GatherOverlapQueue, models.GatherOverlapSkip)
+				}
+			}
+		}
+	}
+
 	if node, ok := tbl.Fields["name_prefix"]; ok {
 		if kv, ok := node.(*ast.KeyValue); ok {
 			if str, ok := kv.Value.(*ast.String); ok {
@@ -1390,6 +1473,9 @@ func buildInput(name string, tbl *ast.Table) (*models.InputConfig, error) {
 	delete(tbl.Fields, "name_override")
 	delete(tbl.Fields, "alias")
 	delete(tbl.Fields, "interval")
+	delete(tbl.Fields, "schedule")
+	delete(tbl.Fields, "gather_timeout")
+	delete(tbl.Fields, "gather_overlap")
 	delete(tbl.Fields, "tags")
 	var err error
 	cp.Filter, err = buildFilter(tbl)
@@ -257,3 +257,25 @@ func TestConfig_BadOrdering(t *testing.T) {
 	require.Error(t, err, "bad ordering")
 	assert.Equal(t, "Error parsing ./testdata/non_slice_slice.toml, line 4: cannot unmarshal TOML array into string (need slice)", err.Error())
 }
+
+func TestConfig_GatherOptions(t *testing.T) {
+	c := NewConfig()
+	err := c.LoadConfig("./testdata/gather_options.toml")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(c.Inputs))
+
+	config := c.Inputs[0].Config
+	require.NotNil(t, config.Schedule)
+	assert.Equal(t, "CRON_TZ=UTC */15 9-17 * * mon-fri", config.Schedule.String())
+	assert.Equal(t, 30*time.Second, config.GatherTimeout)
+	assert.Equal(t, models.GatherOverlapSkip, config.GatherOverlap)
+
+	c = NewConfig()
+	err = c.LoadConfig("./testdata/invalid_schedule.toml")
+	require.Error(t, err)
+
+	c = NewConfig()
+	err = c.LoadConfig("./testdata/schedule_and_interval.toml")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "interval and schedule cannot be set together")
+}
@@ -0,0 +1,90 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		spec     string
+		from     string
+		expected string
+	}{
+		{"* * * * *", "2020-03-10T10:15:30Z", "2020-03-10T10:16:00Z"},
+		{"* * * * *", "2020-03-10T10:15:00Z", "2020-03-10T10:16:00Z"},
+		{"0 2 * * *", "2020-03-10T10:15:00Z", "2020-03-11T02:00:00Z"},
+		{"0 2 * * *", "2020-03-10T01:59:59Z", "2020-03-10T02:00:00Z"},
+		{"*/15 9-17 * * mon-fri", "2020-03-13T17:50:00Z", "2020-03-16T09:00:00Z"},
+		{"*/15 9-17 * * 1-5", "2020-03-10T10:15:00Z", "2020-03-10T10:30:00Z"},
+		{"5/20 * * * *", "2020-03-10T10:50:00Z", "2020-03-10T11:05:00Z"},
+		{"0 0 29 2 *", "2020-03-01T00:00:00Z", "2024-02-29T00:00:00Z"},
+		{"0 0 1,15 * *", "2020-03-02T00:00:00Z", "2020-03-15T00:00:00Z"},
+		{"0 0 31 * *", "2020-04-01T00:00:00Z", "2020-05-31T00:00:00Z"},
+		{"0 12 * dec *", "2020-12-31T12:00:00Z", "2021-12-01T12:00:00Z"},
+		{"0 0 * * 7", "2020-03-10T00:00:00Z", "2020-03-15T00:00:00Z"},
+		// either the day of month or the day of week
+		{"0 0 1 * sun", "2020-03-10T00:00:00Z", "2020-03-15T00:00:00Z"},
+		{"0 0 13 * fri", "2020-03-14T00:00:00Z", "2020-03-20T00:00:00Z"},
+		{"@hourly", "2020-03-10T10:15:00Z", "2020-03-10T11:00:00Z"},
+		{"@daily", "2020-03-10T10:15:00Z", "2020-03-11T00:00:00Z"},
+		{"@weekly", "2020-03-10T10:15:00Z", "2020-03-15T00:00:00Z"},
+		{"@monthly", "2020-03-10T10:15:00Z", "2020-04-01T00:00:00Z"},
+		{"@yearly", "2020-03-10T10:15:00Z", "2021-01-01T00:00:00Z"},
+		{"CRON_TZ=Asia/Tokyo 0 2 * * *", "2020-03-10T10:15:00Z", "2020-03-10T17:00:00Z"},
+		{"TZ=America/New_York 30 1 * * *", "2020-03-10T00:00:00Z", "2020-03-10T05:30:00Z"},
+		// 02:30 does not exist on the daylight saving change of New York
+		{"CRON_TZ=America/New_York 30 2 * * *", "2020-03-08T00:00:00Z", "2020-03-09T06:30:00Z"},
+		{"0 0 30 2 *", "2020-03-10T00:00:00Z", "0001-01-01T00:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := Parse(tt.spec)
+			require.NoError(t, err)
+			from, err := time.Parse(time.RFC3339, tt.from)
+			require.NoError(t, err)
+			expected, err := time.Parse(time.RFC3339, tt.expected)
+			require.NoError(t, err)
+			require.Equal(t, expected.UTC(), s.Next(from).UTC())
+			require.Equal(t, tt.spec, s.String())
+		})
+	}
+}
+
+func TestNextLocation(t *testing.T) {
+	s, err := Parse("CRON_TZ=UTC 0 2 * * *")
+	require.NoError(t, err)
+
+	loc := time.FixedZone("test", 3600)
+	next := s.Next(time.Date(2020, 3, 10, 0, 0, 0, 0, loc))
+	require.Equal(t, loc, next.Location())
+	require.Equal(t, time.Date(2020, 3, 10, 3, 0, 0, 0, loc), next)
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*-5 * * * *",
+		"1-2-3 * * * *",
+		"1/2/3 * * * *",
+		"a * * * *",
+		"* * * foo *",
+		"@every",
+		"CRON_TZ=Nowhere/Nothing * * * * *",
+		"CRON_TZ=UTC",
+	} {
+		_, err := Parse(spec)
+		require.Error(t, err, spec)
+	}
+}
@@ -193,6 +193,41 @@ func (b *Buffer) Reject(batch []telegraf.Metric) {
 		return
 	}
 
+	b.reject(batch)
+}
+
+// PartialReject marks the metrics of the batch, acquired from Batch(), as
+// successfully written except for the failed ones, which are returned to the
+// buffer and marked as unsent.
+func (b *Buffer) PartialReject(batch []telegraf.Metric, failed []telegraf.Metric) {
+	b.Lock()
+	defer b.Unlock()
+
+	isFailed := make(map[telegraf.Metric]bool, len(failed))
+	for _, m := range failed {
+		isFailed[m] = true
+	}
+
+	rejected := make([]telegraf.Metric, 0, len(failed))
+	for _, m := range batch {
+		if isFailed[m] {
+			rejected = append(rejected, m)
+		} else {
+			b.metricWritten(m)
+		}
+	}
+
+	if len(rejected) == 0 {
+		b.resetBatch()
+		b.BufferSize.Set(int64(b.length()))
+		return
+	}
+
+	b.reject(rejected)
+}
+
+// reject returns the metrics to the buffer, the caller must hold the lock.
+func (b *Buffer) reject(batch []telegraf.Metric) {
 	older := b.dist(b.first, b.batchFirst)
 	free := b.cap - b.size
 	restore := min(len(batch), free+older)
@@ -231,6 +231,38 @@ func TestBuffer_RejectWithRoom(t *testing.T) {
 		}, batch)
 }
 
+func TestBuffer_PartialReject(t *testing.T) {
+	b := setup(NewBuffer("test", "", 5))
+	b.Add(MetricTime(1))
+	b.Add(MetricTime(2))
+	b.Add(MetricTime(3))
+	batch := b.Batch(3)
+	b.Add(MetricTime(4))
+	b.PartialReject(batch, []telegraf.Metric{batch[0], batch[2]})
+
+	require.Equal(t, int64(0), b.MetricsDropped.Get())
+	require.Equal(t, int64(1), b.MetricsWritten.Get())
+
+	batch = b.Batch(5)
+	testutil.RequireMetricsEqual(t,
+		[]telegraf.Metric{
+			MetricTime(4),
+			MetricTime(3),
+			MetricTime(1),
+		}, batch)
+}
+
+func TestBuffer_PartialRejectNothingFailed(t *testing.T) {
+	b := setup(NewBuffer("test", "", 5))
+	b.Add(MetricTime(1))
+	b.Add(MetricTime(2))
+	batch := b.Batch(2)
+	b.PartialReject(batch, nil)
+
+	require.Equal(t, int64(2), b.MetricsWritten.Get())
+	require.Equal(t, 0, b.Len())
+}
+
 func TestBuffer_RejectNothingNewFull(t *testing.T) {
 	b := setup(NewBuffer("test", "", 5))
 	b.Add(MetricTime(1))
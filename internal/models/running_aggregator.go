@@ -170,6 +170,15 @@ func (r *RunningAggregator) Push(acc telegraf.Accumulator) {
 	r.Aggregator.Reset()
 }
 
+// PushFinal pushes the aggregates of the current period without resetting
+// the aggregator, so its state can still be persisted on shutdown.
+func (r *RunningAggregator) PushFinal(acc telegraf.Accumulator) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.push(acc)
+}
+
 func (r *RunningAggregator) push(acc telegraf.Accumulator) {
 	start := time.Now()
 	r.Aggregator.Push(acc)
@@ -1,9 +1,11 @@
 package models
 
 import (
+	"context"
 	"time"
 
 	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal/cron"
 	"github.com/influxdata/telegraf/selfstat"
 )
 
@@ -15,9 +17,12 @@ type RunningInput struct {
 
 	log         telegraf.Logger
 	defaultTags map[string]string
+	status      *pluginStatus
 
 	MetricsGathered selfstat.Stat
 	GatherTime      selfstat.Stat
+	GatherTimeouts  selfstat.Stat
+	GathersSkipped  selfstat.Stat
 }
 
 func NewRunningInput(input telegraf.Input, config *InputConfig) *RunningInput {
@@ -45,15 +50,45 @@ func NewRunningInput(input telegraf.Input, config *InputConfig) *RunningInput {
 			"gather_time_ns",
 			tags,
 		),
-		log: logger,
+		GatherTimeouts: selfstat.Register(
+			"gather",
+			"gather_timeouts",
+			tags,
+		),
+		GathersSkipped: selfstat.Register(
+			"gather",
+			"gathers_skipped",
+			tags,
+		),
+		log:    logger,
+		status: newPluginStatus(),
 	}
 }
 
+// Policies for a gather due while the previous gather of the input is still
+// running.
+const (
+	// GatherOverlapQueue runs the gather once the previous one completes.
+	GatherOverlapQueue = "queue"
+	// GatherOverlapSkip skips the gather.
+	GatherOverlapSkip = "skip"
+)
+
 // InputConfig is the common config for all inputs.
 type InputConfig struct {
 	Name     string
 	Alias    string
 	Interval time.Duration
+	// Schedule runs the gathers at the times of a cron schedule instead of
+	// on the interval.
+	Schedule *cron.Schedule
+
+	// GatherTimeout is the time after which a gather is cancelled, none
+	// when zero.
+	GatherTimeout time.Duration
+	// GatherOverlap is the policy for a gather due while the previous gather
+	// is still running, GatherOverlapQueue when empty.
+	GatherOverlap string
 
 	NameOverride      string
 	MeasurementPrefix string
@@ -105,14 +140,43 @@ func (r *RunningInput) MakeMetric(metric telegraf.Metric) telegraf.Metric {
 	return m
 }
 
-func (r *RunningInput) Gather(acc telegraf.Accumulator) error {
+// Gather runs a gather of the input.  The context is passed to the inputs
+// implementing telegraf.ContextInput.
+func (r *RunningInput) Gather(ctx context.Context, acc telegraf.Accumulator) error {
+	r.status.started()
 	start := time.Now()
-	err := r.Input.Gather(acc)
+	var err error
+	if input, ok := r.Input.(telegraf.ContextInput); ok {
+		err = input.GatherContext(ctx, acc)
+	} else {
+		err = r.Input.Gather(acc)
+	}
 	elapsed := time.Since(start)
 	r.GatherTime.Incr(elapsed.Nanoseconds())
+	r.status.completed()
 	return err
 }
 
+// RecordError records an error reported by the input for its status.
+func (r *RunningInput) RecordError(err error) {
+	r.status.failed(err)
+}
+
+// Status returns a snapshot of the state of the input.
+func (r *RunningInput) Status() InputStatus {
+	r.status.Lock()
+	defer r.status.Unlock()
+	return InputStatus{
+		Name:          r.Config.Name,
+		Alias:         r.Config.Alias,
+		Interval:      r.Config.Interval,
+		GatherStart:   r.status.start,
+		LastGather:    r.status.last,
+		LastError:     r.status.lastError,
+		LastErrorTime: r.status.lastErrorTime,
+	}
+}
+
 func (r *RunningInput) SetDefaultTags(tags map[string]string) {
 	r.defaultTags = tags
 }
@@ -47,6 +47,7 @@ type RunningOutput struct {
 
 	buffer *Buffer
 	log    telegraf.Logger
+	status *pluginStatus
 
 	aggMutex sync.Mutex
 }
@@ -99,7 +100,8 @@ func NewRunningOutput(
 			"write_time_ns",
 			tags,
 		),
-		log: logger,
+		log:    logger,
+		status: newPluginStatus(),
 	}
 
 	return ro
@@ -185,11 +187,13 @@ func (ro *RunningOutput) Write() error {
 
 		err := ro.write(batch)
 		if err != nil {
-			ro.buffer.Reject(batch)
+			ro.reject(batch, err)
+			ro.status.failed(err)
 			return err
 		}
 		ro.buffer.Accept(batch)
 	}
+	ro.status.completed()
 	return nil
 }
 
@@ -197,15 +201,18 @@ func (ro *RunningOutput) Write() error {
 func (ro *RunningOutput) WriteBatch() error {
 	batch := ro.buffer.Batch(ro.MetricBatchSize)
 	if len(batch) == 0 {
+		ro.status.completed()
 		return nil
 	}
 
 	err := ro.write(batch)
 	if err != nil {
-		ro.buffer.Reject(batch)
+		ro.reject(batch, err)
+		ro.status.failed(err)
 		return err
 	}
 	ro.buffer.Accept(batch)
+	ro.status.completed()
 
 	return nil
 }
@@ -217,6 +224,16 @@ func (r *RunningOutput) Close() {
 	}
 }
 
+// reject returns the batch to the buffer after a failed write, only the
+// failed metrics are kept if the output reports a partial write.
+func (r *RunningOutput) reject(batch []telegraf.Metric, err error) {
+	if partial, ok := err.(*telegraf.PartialWriteError); ok {
+		r.buffer.PartialReject(batch, partial.Failed)
+		return
+	}
+	r.buffer.Reject(batch)
+}
+
 func (r *RunningOutput) write(metrics []telegraf.Metric) error {
 	dropped := atomic.LoadInt64(&r.droppedMetrics)
 	if dropped > 0 {
@@ -235,6 +252,22 @@ func (r *RunningOutput) write(metrics []telegraf.Metric) error {
 	return err
 }
 
+// Status returns a snapshot of the state of the output.
+func (r *RunningOutput) Status() OutputStatus {
+	r.status.Lock()
+	defer r.status.Unlock()
+	return OutputStatus{
+		Name:          r.Config.Name,
+		Alias:         r.Config.Alias,
+		FlushInterval: r.Config.FlushInterval,
+		LastWrite:     r.status.last,
+		LastError:     r.status.lastError,
+		LastErrorTime: r.status.lastErrorTime,
+		BufferSize:    r.buffer.Len(),
+		BufferLimit:   r.MetricBufferLimit,
+	}
+}
+
 func (r *RunningOutput) LogBufferStatus() {
 	nBuffer := r.buffer.Len()
 	r.log.Debugf("Buffer fullness: %d / %d metrics", nBuffer, r.MetricBufferLimit)
@@ -270,6 +270,41 @@ func TestRunningOutputWriteFail(t *testing.T) {
 	assert.Len(t, m.Metrics(), 10)
 }
 
+func TestRunningOutputStatus(t *testing.T) {
+	conf := &OutputConfig{
+		Name:   "test",
+		Filter: Filter{},
+	}
+
+	m := &mockOutput{}
+	m.failWrite = true
+	ro := NewRunningOutput("test", m, conf, 4, 12)
+	created := ro.Status().LastWrite
+
+	for _, metric := range first5 {
+		ro.AddMetric(metric)
+	}
+
+	err := ro.Write()
+	require.Error(t, err)
+
+	status := ro.Status()
+	require.Equal(t, "test", status.Name)
+	require.Equal(t, created, status.LastWrite)
+	require.Equal(t, "Failed Write!", status.LastError)
+	require.False(t, status.LastErrorTime.IsZero())
+	require.Equal(t, 5, status.BufferSize)
+	require.Equal(t, 12, status.BufferLimit)
+
+	m.failWrite = false
+	err = ro.Write()
+	require.NoError(t, err)
+
+	status = ro.Status()
+	require.False(t, status.LastWrite.Before(status.LastErrorTime))
+	require.Equal(t, 0, status.BufferSize)
+}
+
 // Verify that the order of points is preserved during a write failure.
 func TestRunningOutputWriteFailOrder(t *testing.T) {
 	conf := &OutputConfig{
@@ -412,6 +447,34 @@ func TestRunningOutputWriteFailOrder3(t *testing.T) {
 	assert.Equal(t, expected, m.Metrics())
 }
 
+// Verify that only the failed metrics are retried after a partial write.
+func TestRunningOutputWritePartialFail(t *testing.T) {
+	conf := &OutputConfig{
+		Filter: Filter{},
+	}
+
+	m := &mockOutput{}
+	m.failPartial = true
+	ro := NewRunningOutput("test", m, conf, 5, 1000)
+
+	for _, metric := range first5 {
+		ro.AddMetric(metric)
+	}
+
+	err := ro.Write()
+	require.Error(t, err)
+	assert.Equal(t, []telegraf.Metric{first5[4], first5[2], first5[0]}, m.Metrics())
+	require.Equal(t, 2, ro.Status().BufferSize)
+
+	m.failPartial = false
+	err = ro.Write()
+	require.NoError(t, err)
+
+	expected := []telegraf.Metric{first5[4], first5[2], first5[0], first5[3], first5[1]}
+	assert.Equal(t, expected, m.Metrics())
+	require.Equal(t, 0, ro.Status().BufferSize)
+}
+
 type mockOutput struct {
 	sync.Mutex
 
@@ -419,6 +482,9 @@ type mockOutput struct {
 
 	// if true, mock a write failure
 	failWrite bool
+
+	// if true, mock a failure writing every other metric
+	failPartial bool
 }
 
 func (m *mockOutput) Connect() error {
@@ -448,9 +514,17 @@ func (m *mockOutput) Write(metrics []telegraf.Metric) error {
 		m.metrics = []telegraf.Metric{}
 	}
 
-	for _, metric := range metrics {
+	var failed []telegraf.Metric
+	for i, metric := range metrics {
+		if m.failPartial && i%2 == 1 {
+			failed = append(failed, metric)
+			continue
+		}
 		m.metrics = append(m.metrics, metric)
 	}
+	if len(failed) > 0 {
+		return &telegraf.PartialWriteError{Err: fmt.Errorf("Failed Write!"), Failed: failed}
+	}
 	return nil
 }
 
@@ -2,6 +2,7 @@ package models
 
 import (
 	"sync"
+	"time"
 
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/selfstat"
@@ -12,6 +13,12 @@ type RunningProcessor struct {
 	log       telegraf.Logger
 	Processor telegraf.Processor
 	Config    *ProcessorConfig
+
+	// Creator returns a new, identically configured instance of the
+	// processor.  When nil the processor cannot be duplicated.
+	Creator func() (telegraf.Processor, error)
+
+	ApplyTime selfstat.Stat
 }
 
 type RunningProcessors []*RunningProcessor
@@ -44,9 +51,37 @@ func NewRunningProcessor(processor telegraf.Processor, config *ProcessorConfig)
 		Processor: processor,
 		Config:    config,
 		log:       logger,
+		ApplyTime: selfstat.RegisterTiming("process", "apply_time_ns", tags),
 	}
 }
 
+// Clone returns a RunningProcessor with a separate instance of the processor
+// created by Creator, sharing the configuration of rp.  If the processor
+// cannot be duplicated rp itself is returned.
+func (rp *RunningProcessor) Clone() (*RunningProcessor, error) {
+	if rp.Creator == nil {
+		return rp, nil
+	}
+
+	processor, err := rp.Creator()
+	if err != nil {
+		return nil, err
+	}
+
+	clone := NewRunningProcessor(processor, rp.Config)
+	clone.Creator = rp.Creator
+	return clone, nil
+}
+
+func (rp *RunningProcessor) LogName() string {
+	return logName("processors", rp.Config.Name, rp.Config.Alias)
+}
+
+// MakeMetric returns the metrics added by a service processor unmodified.
+func (rp *RunningProcessor) MakeMetric(metric telegraf.Metric) telegraf.Metric {
+	return metric
+}
+
 func (rp *RunningProcessor) metricFiltered(metric telegraf.Metric) {
 	metric.Drop()
 }
@@ -92,7 +127,11 @@ func (rp *RunningProcessor) Apply(in ...telegraf.Metric) []telegraf.Metric {
 
 		// This metric should pass through the filter, so call the filter Apply
 		// function and append results to the output slice.
+		start := time.Now()
 		ret = append(ret, rp.Processor.Apply(metric)...)
+		if rp.ApplyTime != nil {
+			rp.ApplyTime.Incr(time.Since(start).Nanoseconds())
+		}
 	}
 
 	return ret
@@ -187,3 +187,25 @@ func TestRunningProcessor_Order(t *testing.T) {
 		RunningProcessors{rp1, rp2, rp3},
 		procs)
 }
+
+func TestRunningProcessor_Clone(t *testing.T) {
+	rp := NewRunningProcessor(TagProcessor("apply", "true"), &ProcessorConfig{Name: "tag"})
+
+	clone, err := rp.Clone()
+	require.NoError(t, err)
+	require.True(t, rp == clone)
+
+	rp.Creator = func() (telegraf.Processor, error) {
+		return TagProcessor("apply", "clone"), nil
+	}
+	clone, err = rp.Clone()
+	require.NoError(t, err)
+	require.False(t, rp == clone)
+	require.True(t, rp.Config == clone.Config)
+
+	m := testutil.MustMetric("cpu", map[string]string{}, map[string]interface{}{"value": 42.0}, time.Unix(0, 0))
+	actual := clone.Apply(m)
+	require.Len(t, actual, 1)
+	tag, _ := actual[0].GetTag("apply")
+	require.Equal(t, "clone", tag)
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"sync"
+	"time"
+)
+
+// StatusReporter is implemented by outputs reporting on the health of the
+// other plugins of the agent.  The agent sets the function returning the
+// current status before the outputs are connected.
+type StatusReporter interface {
+	SetStatusFunc(func() AgentStatus)
+}
+
+// AgentStatus is a snapshot of the state of the running plugins.
+type AgentStatus struct {
+	Outputs []OutputStatus
+	Inputs  []InputStatus
+}
+
+// OutputStatus is a snapshot of the state of a running output.
+type OutputStatus struct {
+	Name          string
+	Alias         string
+	FlushInterval time.Duration
+
+	// LastWrite is the time of the last successful write, or the time the
+	// output was created if it never wrote successfully.
+	LastWrite     time.Time
+	LastError     string
+	LastErrorTime time.Time
+
+	BufferSize  int
+	BufferLimit int
+}
+
+// InputStatus is a snapshot of the state of a running input.
+type InputStatus struct {
+	Name     string
+	Alias    string
+	Interval time.Duration
+
+	// GatherStart is the time the last gather started.  LastGather is the
+	// time the last gather completed, or the time the input was created if
+	// it never completed a gather.
+	GatherStart   time.Time
+	LastGather    time.Time
+	LastError     string
+	LastErrorTime time.Time
+}
+
+// pluginStatus tracks the outcome of the writes or gathers of a plugin.
+type pluginStatus struct {
+	sync.Mutex
+	start         time.Time
+	last          time.Time
+	lastError     string
+	lastErrorTime time.Time
+}
+
+func newPluginStatus() *pluginStatus {
+	return &pluginStatus{last: time.Now()}
+}
+
+func (s *pluginStatus) started() {
+	s.Lock()
+	s.start = time.Now()
+	s.Unlock()
+}
+
+func (s *pluginStatus) completed() {
+	s.Lock()
+	s.last = time.Now()
+	s.Unlock()
+}
+
+func (s *pluginStatus) failed(err error) {
+	s.Lock()
+	s.lastError = err.Error()
+	s.lastErrorTime = time.Now()
+	s.Unlock()
+}
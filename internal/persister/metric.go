@@ -0,0 +1,98 @@
+package persister
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+)
+
+// Metric is a JSON serializable representation of a telegraf.Metric that
+// preserves the types of the field values.
+type Metric struct {
+	Name   string             `json:"name"`
+	Tags   map[string]string  `json:"tags,omitempty"`
+	Fields []Field            `json:"fields"`
+	Time   time.Time          `json:"time"`
+	Type   telegraf.ValueType `json:"type,omitempty"`
+}
+
+// Field is a single typed field of a Metric.
+type Field struct {
+	Key   string          `json:"key"`
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+// FromMetric converts a telegraf.Metric into its serializable form.
+func FromMetric(m telegraf.Metric) (Metric, error) {
+	s := Metric{
+		Name: m.Name(),
+		Tags: m.Tags(),
+		Time: m.Time(),
+		Type: m.Type(),
+	}
+
+	for _, field := range m.FieldList() {
+		var typ string
+		switch field.Value.(type) {
+		case float64:
+			typ = "float"
+		case int64:
+			typ = "int"
+		case uint64:
+			typ = "uint"
+		case string:
+			typ = "string"
+		case bool:
+			typ = "bool"
+		default:
+			return Metric{}, fmt.Errorf("unsupported type %T for field %q", field.Value, field.Key)
+		}
+
+		value, err := json.Marshal(field.Value)
+		if err != nil {
+			return Metric{}, fmt.Errorf("field %q: %v", field.Key, err)
+		}
+		s.Fields = append(s.Fields, Field{Key: field.Key, Type: typ, Value: value})
+	}
+	return s, nil
+}
+
+// ToMetric converts the serialized form back into a telegraf.Metric.
+func (s Metric) ToMetric() (telegraf.Metric, error) {
+	fields := make(map[string]interface{}, len(s.Fields))
+	for _, field := range s.Fields {
+		var err error
+		switch field.Type {
+		case "float":
+			var v float64
+			err = json.Unmarshal(field.Value, &v)
+			fields[field.Key] = v
+		case "int":
+			var v int64
+			err = json.Unmarshal(field.Value, &v)
+			fields[field.Key] = v
+		case "uint":
+			var v uint64
+			err = json.Unmarshal(field.Value, &v)
+			fields[field.Key] = v
+		case "string":
+			var v string
+			err = json.Unmarshal(field.Value, &v)
+			fields[field.Key] = v
+		case "bool":
+			var v bool
+			err = json.Unmarshal(field.Value, &v)
+			fields[field.Key] = v
+		default:
+			err = fmt.Errorf("unsupported type %q", field.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %v", field.Key, err)
+		}
+	}
+	return metric.New(s.Name, s.Tags, fields, s.Time, s.Type)
+}
@@ -0,0 +1,124 @@
+package persister
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+
+	"github.com/influxdata/telegraf"
+)
+
+// Persister stores the state of plugins implementing telegraf.StatefulPlugin
+// in a file, so it can be restored after a restart.
+type Persister struct {
+	Filename string
+
+	mu      sync.Mutex
+	plugins map[string]telegraf.StatefulPlugin
+}
+
+// NewPersister returns a Persister storing state in the given file.
+func NewPersister(filename string) *Persister {
+	return &Persister{
+		Filename: filename,
+		plugins:  make(map[string]telegraf.StatefulPlugin),
+	}
+}
+
+// Register adds a plugin under an id that must be stable across restarts.
+func (p *Persister) Register(id string, plugin telegraf.StatefulPlugin) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.plugins[id]; ok {
+		return fmt.Errorf("plugin id %q already registered", id)
+	}
+	p.plugins[id] = plugin
+	return nil
+}
+
+// Load restores the state of all registered plugins from the state file.  A
+// missing state file is not an error; plugins without stored state are left
+// unchanged.
+func (p *Persister) Load() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	buf, err := ioutil.ReadFile(p.Filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var states map[string]json.RawMessage
+	if err := json.Unmarshal(buf, &states); err != nil {
+		return fmt.Errorf("parsing state file %q: %v", p.Filename, err)
+	}
+
+	for id, plugin := range p.plugins {
+		raw, ok := states[id]
+		if !ok {
+			continue
+		}
+
+		// Decode into a new value of the same type as the current state.
+		current := plugin.GetState()
+		if current == nil {
+			continue
+		}
+		ptr := reflect.New(reflect.TypeOf(current))
+		if err := json.Unmarshal(raw, ptr.Interface()); err != nil {
+			return fmt.Errorf("decoding state of %q: %v", id, err)
+		}
+		if err := plugin.SetState(ptr.Elem().Interface()); err != nil {
+			return fmt.Errorf("restoring state of %q: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// Store writes the state of all registered plugins to the state file,
+// replacing it atomically.  The state of a plugin that cannot be encoded, for
+// example because it contains a NaN, is logged and left out so the state of
+// the other plugins is still stored.
+func (p *Persister) Store() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	states := make(map[string]json.RawMessage, len(p.plugins))
+	for id, plugin := range p.plugins {
+		state, err := json.Marshal(plugin.GetState())
+		if err != nil {
+			log.Printf("E! [persister] Error encoding state of %q, it is not persisted: %v", id, err)
+			continue
+		}
+		states[id] = state
+	}
+
+	buf, err := json.Marshal(states)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(p.Filename), filepath.Base(p.Filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(buf); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), p.Filename)
+}
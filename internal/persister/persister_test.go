@@ -0,0 +1,113 @@
+package persister
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+type counterState struct {
+	Count  int
+	Labels map[string]string
+}
+
+type statefulCounter struct {
+	state counterState
+}
+
+func (c *statefulCounter) GetState() interface{} {
+	return c.state
+}
+
+func (c *statefulCounter) SetState(state interface{}) error {
+	c.state = state.(counterState)
+	return nil
+}
+
+func TestStoreLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "persister")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "state.json")
+
+	p := NewPersister(filename)
+	c := &statefulCounter{state: counterState{Count: 42, Labels: map[string]string{"a": "b"}}}
+	require.NoError(t, p.Register("aggregators.counter", c))
+	require.Error(t, p.Register("aggregators.counter", c))
+	require.NoError(t, p.Store())
+
+	p = NewPersister(filename)
+	restored := &statefulCounter{}
+	other := &statefulCounter{state: counterState{Count: 7}}
+	require.NoError(t, p.Register("aggregators.counter", restored))
+	require.NoError(t, p.Register("aggregators.other", other))
+	require.NoError(t, p.Load())
+
+	require.Equal(t, c.state, restored.state)
+	require.Equal(t, 7, other.state.Count)
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	p := NewPersister(filepath.Join(os.TempDir(), "does-not-exist", "state.json"))
+	require.NoError(t, p.Register("processors.counter", &statefulCounter{}))
+	require.NoError(t, p.Load())
+}
+
+func TestMetricRoundTrip(t *testing.T) {
+	m := testutil.MustMetric("cpu",
+		map[string]string{"host": "a"},
+		map[string]interface{}{
+			"float":  42.5,
+			"int":    int64(-42),
+			"uint":   uint64(18446744073709551615),
+			"string": "forty two",
+			"bool":   true,
+		},
+		time.Unix(1580000000, 123),
+		telegraf.Counter,
+	)
+
+	s, err := FromMetric(m)
+	require.NoError(t, err)
+
+	actual, err := s.ToMetric()
+	require.NoError(t, err)
+	testutil.RequireMetricEqual(t, m, actual)
+	require.Equal(t, telegraf.Counter, actual.Type())
+}
+
+type nanState struct{}
+
+func (s *nanState) GetState() interface{} {
+	return math.NaN()
+}
+
+func (s *nanState) SetState(state interface{}) error {
+	return nil
+}
+
+func TestStoreSkipsInvalidState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "persister")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "state.json")
+
+	p := NewPersister(filename)
+	c := &statefulCounter{state: counterState{Count: 42}}
+	require.NoError(t, p.Register("aggregators.counter", c))
+	require.NoError(t, p.Register("aggregators.nan", &nanState{}))
+	require.NoError(t, p.Store())
+
+	p = NewPersister(filename)
+	restored := &statefulCounter{}
+	require.NoError(t, p.Register("aggregators.counter", restored))
+	require.NoError(t, p.Load())
+	require.Equal(t, c.state, restored.state)
+}
@@ -1,5 +1,17 @@
 package telegraf
 
+// PartialWriteError is returned by the Write function of an Output when only
+// some of the metrics could not be written.  The metrics that were written
+// are removed from the buffer and only the Failed metrics are retried.
+type PartialWriteError struct {
+	Err    error
+	Failed []Metric
+}
+
+func (e *PartialWriteError) Error() string {
+	return e.Err.Error()
+}
+
 type Output interface {
 	// Connect to the Output
 	Connect() error
@@ -28,3 +28,18 @@ type Logger interface {
 	// Info logs an information message, patterned after log.Print.
 	Info(args ...interface{})
 }
+
+// StatefulPlugin is an interface that plugins can optionally implement to
+// persist their state across restarts and reloads.
+type StatefulPlugin interface {
+	// GetState returns the current state of the plugin.  The state must be
+	// serializable as JSON; its type is used when decoding the stored state.
+	// It may be called while the plugin is running, and the state is encoded
+	// after the plugin is unlocked, so it must not share maps or slices the
+	// plugin keeps modifying.
+	GetState() interface{}
+
+	// SetState restores the state of the plugin before it is started.  The
+	// state has the same type as the value returned by GetState.
+	SetState(state interface{}) error
+}
@@ -1,6 +1,7 @@
 package basicstats
 
 import (
+	"fmt"
 	"math"
 
 	"github.com/influxdata/telegraf"
@@ -247,6 +248,73 @@ func (b *BasicStats) Reset() {
 	b.cache = make(map[uint64]aggregate)
 }
 
+// aggregateState is the persisted form of an aggregate.
+type aggregateState struct {
+	Name   string                     `json:"name"`
+	Tags   map[string]string          `json:"tags"`
+	Fields map[string]basicstatsState `json:"fields"`
+}
+
+type basicstatsState struct {
+	Count float64 `json:"count"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Sum   float64 `json:"sum"`
+	Mean  float64 `json:"mean"`
+	Diff  float64 `json:"diff"`
+	M2    float64 `json:"m2"`
+	Last  float64 `json:"last"`
+}
+
+// GetState returns the cached aggregates so they can be persisted.
+func (b *BasicStats) GetState() interface{} {
+	state := make(map[uint64]aggregateState, len(b.cache))
+	for id, a := range b.cache {
+		fields := make(map[string]basicstatsState, len(a.fields))
+		for k, v := range a.fields {
+			fields[k] = basicstatsState{
+				Count: v.count,
+				Min:   v.min,
+				Max:   v.max,
+				Sum:   v.sum,
+				Mean:  v.mean,
+				Diff:  v.diff,
+				M2:    v.M2,
+				Last:  v.LAST,
+			}
+		}
+		state[id] = aggregateState{Name: a.name, Tags: a.tags, Fields: fields}
+	}
+	return state
+}
+
+// SetState restores the cached aggregates.
+func (b *BasicStats) SetState(state interface{}) error {
+	s, ok := state.(map[uint64]aggregateState)
+	if !ok {
+		return fmt.Errorf("invalid state type %T", state)
+	}
+
+	b.cache = make(map[uint64]aggregate, len(s))
+	for id, a := range s {
+		fields := make(map[string]basicstats, len(a.Fields))
+		for k, v := range a.Fields {
+			fields[k] = basicstats{
+				count: v.Count,
+				min:   v.Min,
+				max:   v.Max,
+				sum:   v.Sum,
+				mean:  v.Mean,
+				diff:  v.Diff,
+				M2:    v.M2,
+				LAST:  v.Last,
+			}
+		}
+		b.cache[id] = aggregate{name: a.Name, tags: a.Tags, fields: fields}
+	}
+	return nil
+}
+
 func convert(in interface{}) (float64, bool) {
 	switch v := in.(type) {
 	case float64:
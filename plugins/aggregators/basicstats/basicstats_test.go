@@ -1,13 +1,18 @@
 package basicstats
 
 import (
+	"io/ioutil"
 	"math"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/influxdata/telegraf/internal/persister"
 	"github.com/influxdata/telegraf/metric"
 	"github.com/influxdata/telegraf/testutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var m1, _ = metric.New("m1",
@@ -647,3 +652,35 @@ func TestBasicStatsWithDefaultStats(t *testing.T) {
 	assert.True(t, acc.HasField("m1", "a_s2"))
 	assert.False(t, acc.HasField("m1", "a_sum"))
 }
+
+// Test that the state survives a round trip through the persister
+func TestBasicStatsState(t *testing.T) {
+	aggregator := NewBasicStats()
+	aggregator.Log = testutil.Logger{}
+	aggregator.getConfiguredStats()
+	aggregator.Add(m1)
+
+	dir, err := ioutil.TempDir("", "basicstats")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	p := persister.NewPersister(filepath.Join(dir, "state.json"))
+	require.NoError(t, p.Register("aggregators.basicstats", aggregator))
+	require.NoError(t, p.Store())
+
+	restored := NewBasicStats()
+	restored.Log = testutil.Logger{}
+	restored.getConfiguredStats()
+	p = persister.NewPersister(filepath.Join(dir, "state.json"))
+	require.NoError(t, p.Register("aggregators.basicstats", restored))
+	require.NoError(t, p.Load())
+
+	aggregator.Add(m2)
+	restored.Add(m2)
+
+	expected := testutil.Accumulator{}
+	aggregator.Push(&expected)
+	actual := testutil.Accumulator{}
+	restored.Push(&actual)
+	testutil.RequireMetricsEqual(t, expected.GetTelegrafMetrics(), actual.GetTelegrafMetrics(), testutil.IgnoreTime())
+}
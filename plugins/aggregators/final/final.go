@@ -1,10 +1,12 @@
 package final
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/internal/persister"
 	"github.com/influxdata/telegraf/plugins/aggregators"
 )
 
@@ -21,6 +23,7 @@ var sampleConfig = `
 
 type Final struct {
 	SeriesTimeout internal.Duration `toml:"series_timeout"`
+	Log           telegraf.Logger   `toml:"-"`
 
 	// The last metric for all series which are active
 	metricCache map[uint64]telegraf.Metric
@@ -65,6 +68,39 @@ func (m *Final) Push(acc telegraf.Accumulator) {
 func (m *Final) Reset() {
 }
 
+// GetState returns the last metric of all active series so they can be
+// persisted.
+func (m *Final) GetState() interface{} {
+	state := make([]persister.Metric, 0, len(m.metricCache))
+	for _, metric := range m.metricCache {
+		s, err := persister.FromMetric(metric)
+		if err != nil {
+			m.Log.Warnf("Metric %q is not persisted: %v", metric.Name(), err)
+			continue
+		}
+		state = append(state, s)
+	}
+	return state
+}
+
+// SetState restores the last metric of the active series.
+func (m *Final) SetState(state interface{}) error {
+	s, ok := state.([]persister.Metric)
+	if !ok {
+		return fmt.Errorf("invalid state type %T", state)
+	}
+
+	m.metricCache = make(map[uint64]telegraf.Metric, len(s))
+	for _, sm := range s {
+		metric, err := sm.ToMetric()
+		if err != nil {
+			return err
+		}
+		m.metricCache[metric.HashID()] = metric
+	}
+	return nil
+}
+
 func init() {
 	aggregators.Add("final", func() telegraf.Aggregator {
 		return NewFinal()
@@ -1,13 +1,17 @@
 package final
 
 import (
+	"encoding/json"
+	"math"
 	"testing"
 	"time"
 
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/internal/persister"
 	"github.com/influxdata/telegraf/metric"
 	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSimple(t *testing.T) {
@@ -142,3 +146,43 @@ func TestLongDifference(t *testing.T) {
 	}
 	testutil.RequireMetricsEqual(t, expected, acc.GetTelegrafMetrics(), testutil.SortMetrics())
 }
+
+func TestState(t *testing.T) {
+	acc := testutil.Accumulator{}
+	final := NewFinal()
+	final.Log = testutil.Logger{}
+
+	m1, _ := metric.New("m1",
+		map[string]string{"foo": "bar"},
+		map[string]interface{}{"a": int64(1)},
+		time.Unix(1530939936, 0))
+	final.Add(m1)
+
+	// metrics that cannot be encoded are left out of the state
+	m2, _ := metric.New("m2",
+		map[string]string{"foo": "bar"},
+		map[string]interface{}{"a": math.NaN()},
+		time.Unix(1530939936, 0))
+	final.Add(m2)
+
+	buf, err := json.Marshal(final.GetState())
+	require.NoError(t, err)
+	var state []persister.Metric
+	require.NoError(t, json.Unmarshal(buf, &state))
+
+	restored := NewFinal()
+	require.NoError(t, restored.SetState(state))
+	restored.Push(&acc)
+
+	expected := []telegraf.Metric{
+		testutil.MustMetric(
+			"m1",
+			map[string]string{"foo": "bar"},
+			map[string]interface{}{
+				"a_final": int64(1),
+			},
+			time.Unix(1530939936, 0),
+		),
+	}
+	testutil.RequireMetricsEqual(t, expected, acc.GetTelegrafMetrics())
+}
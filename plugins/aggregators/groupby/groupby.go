@@ -0,0 +1,239 @@
+package groupby
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/filter"
+	"github.com/influxdata/telegraf/plugins/aggregators"
+	"github.com/influxdata/telegraf/plugins/common/stats"
+)
+
+var sampleConfig = `
+  ## General Aggregator Arguments:
+  ## The period on which to flush & clear the aggregator.
+  period = "30s"
+
+  ## If true, the original metric will be dropped by the
+  ## aggregator and will not get sent to the output plugins.
+  drop_original = false
+
+  ## Tags to remove before grouping; series which only differ by these tags
+  ## are collapsed into a single group.  Glob patterns are supported.
+  ## Only one of drop_tags or keep_tags may be set.
+  drop_tags = ["cpu"]
+
+  ## Tags to keep when grouping; all other tags are removed.
+  # keep_tags = ["service"]
+
+  ## Statistics computed across the series of each group.  Supported values
+  ## are "sum", "avg", "min", "max", "count" and "quantile".
+  # stats = ["sum", "avg", "min", "max", "count"]
+
+  ## Quantiles to compute when the "quantile" statistic is enabled; each is
+  ## emitted as "<field>_p<quantile*100>".
+  # quantiles = [0.5, 0.9, 0.99]
+`
+
+var validStats = map[string]bool{
+	"sum":      true,
+	"avg":      true,
+	"min":      true,
+	"max":      true,
+	"count":    true,
+	"quantile": true,
+}
+
+// GroupBy aggregates the latest value of each series across all series
+// sharing the same measurement and remaining tags.
+type GroupBy struct {
+	DropTags  []string  `toml:"drop_tags"`
+	KeepTags  []string  `toml:"keep_tags"`
+	Stats     []string  `toml:"stats"`
+	Quantiles []float64 `toml:"quantiles"`
+
+	dropFilter filter.Filter
+	keepFilter filter.Filter
+	stats      map[string]bool
+
+	cache map[uint64]*group
+}
+
+type group struct {
+	name string
+	tags map[string]string
+	// latest field values of each series in the group, keyed by series id
+	series map[uint64]map[string]float64
+}
+
+func NewGroupBy() *GroupBy {
+	g := &GroupBy{
+		Stats:     []string{"sum", "avg", "min", "max", "count"},
+		Quantiles: []float64{0.5, 0.9, 0.99},
+	}
+	g.Reset()
+	return g
+}
+
+func (g *GroupBy) SampleConfig() string {
+	return sampleConfig
+}
+
+func (g *GroupBy) Description() string {
+	return "Aggregate fields across series that differ only by the dropped tags."
+}
+
+func (g *GroupBy) Init() error {
+	if len(g.DropTags) > 0 && len(g.KeepTags) > 0 {
+		return fmt.Errorf("only one of drop_tags or keep_tags may be set")
+	}
+
+	var err error
+	g.dropFilter, err = filter.Compile(g.DropTags)
+	if err != nil {
+		return fmt.Errorf("error compiling drop_tags: %v", err)
+	}
+	g.keepFilter, err = filter.Compile(g.KeepTags)
+	if err != nil {
+		return fmt.Errorf("error compiling keep_tags: %v", err)
+	}
+
+	g.stats = make(map[string]bool, len(g.Stats))
+	for _, s := range g.Stats {
+		if !validStats[s] {
+			return fmt.Errorf("unsupported stat %q", s)
+		}
+		g.stats[s] = true
+	}
+
+	for _, q := range g.Quantiles {
+		if q < 0 || q > 1 || math.IsNaN(q) {
+			return fmt.Errorf("quantile %v out of range [0,1]", q)
+		}
+	}
+	return nil
+}
+
+func (g *GroupBy) dropTag(key string) bool {
+	if g.keepFilter != nil {
+		return !g.keepFilter.Match(key)
+	}
+	if g.dropFilter != nil {
+		return g.dropFilter.Match(key)
+	}
+	return false
+}
+
+func (g *GroupBy) Add(in telegraf.Metric) {
+	h := fnv.New64a()
+	h.Write([]byte(in.Name()))
+	h.Write([]byte("\n"))
+	tags := make(map[string]string)
+	for _, tag := range in.TagList() {
+		if g.dropTag(tag.Key) {
+			continue
+		}
+		tags[tag.Key] = tag.Value
+		h.Write([]byte(tag.Key))
+		h.Write([]byte("\n"))
+		h.Write([]byte(tag.Value))
+		h.Write([]byte("\n"))
+	}
+	id := h.Sum64()
+
+	grp, ok := g.cache[id]
+	if !ok {
+		grp = &group{
+			name:   in.Name(),
+			tags:   tags,
+			series: make(map[uint64]map[string]float64),
+		}
+		g.cache[id] = grp
+	}
+
+	sid := in.HashID()
+	fields, ok := grp.series[sid]
+	if !ok {
+		fields = make(map[string]float64)
+		grp.series[sid] = fields
+	}
+	for _, field := range in.FieldList() {
+		if fv, ok := stats.ToFloat(field.Value); ok {
+			fields[field.Key] = fv
+		}
+	}
+}
+
+func (g *GroupBy) Push(acc telegraf.Accumulator) {
+	for _, grp := range g.cache {
+		values := make(map[string][]float64)
+		for _, fields := range grp.series {
+			for k, v := range fields {
+				values[k] = append(values[k], v)
+			}
+		}
+
+		fields := make(map[string]interface{})
+		for k, vs := range values {
+			g.addStats(fields, k, vs)
+		}
+		if len(fields) > 0 {
+			acc.AddFields(grp.name, fields, grp.tags)
+		}
+	}
+}
+
+func (g *GroupBy) addStats(fields map[string]interface{}, key string, values []float64) {
+	sort.Float64s(values)
+
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+
+	if g.stats["sum"] {
+		fields[key+"_sum"] = sum
+	}
+	if g.stats["avg"] {
+		fields[key+"_avg"] = sum / float64(len(values))
+	}
+	if g.stats["min"] {
+		fields[key+"_min"] = values[0]
+	}
+	if g.stats["max"] {
+		fields[key+"_max"] = values[len(values)-1]
+	}
+	if g.stats["count"] {
+		fields[key+"_count"] = int64(len(values))
+	}
+	if g.stats["quantile"] {
+		for _, q := range g.Quantiles {
+			fields[key+"_"+stats.QuantileSuffix(q)] = quantile(values, q)
+		}
+	}
+}
+
+func (g *GroupBy) Reset() {
+	g.cache = make(map[uint64]*group)
+}
+
+// quantile computes the q-th quantile of the sorted values by linear
+// interpolation between the closest ranks.
+func quantile(sorted []float64, q float64) float64 {
+	pos := q * float64(len(sorted)-1)
+	lower := int(math.Floor(pos))
+	upper := int(math.Ceil(pos))
+	if lower == upper {
+		return sorted[lower]
+	}
+	return sorted[lower] + (pos-float64(lower))*(sorted[upper]-sorted[lower])
+}
+
+func init() {
+	aggregators.Add("groupby", func() telegraf.Aggregator {
+		return NewGroupBy()
+	})
+}
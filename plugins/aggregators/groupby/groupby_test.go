@@ -0,0 +1,115 @@
+package groupby
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func newCPU(cpu string, host string, usage float64) telegraf.Metric {
+	return testutil.MustMetric("cpu",
+		map[string]string{"cpu": cpu, "host": host},
+		map[string]interface{}{"usage": usage, "name": "ignored"},
+		time.Unix(0, 0),
+	)
+}
+
+func TestInitErrors(t *testing.T) {
+	g := NewGroupBy()
+	g.DropTags = []string{"cpu"}
+	g.KeepTags = []string{"host"}
+	require.Error(t, g.Init())
+
+	g = NewGroupBy()
+	g.Stats = []string{"median"}
+	require.Error(t, g.Init())
+
+	g = NewGroupBy()
+	g.Quantiles = []float64{2}
+	require.Error(t, g.Init())
+}
+
+func TestDropTags(t *testing.T) {
+	g := NewGroupBy()
+	g.DropTags = []string{"cpu"}
+	require.NoError(t, g.Init())
+
+	g.Add(newCPU("cpu0", "a", 10))
+	g.Add(newCPU("cpu1", "a", 30))
+	// only the latest value of a series is used
+	g.Add(newCPU("cpu1", "a", 20))
+	g.Add(newCPU("cpu0", "b", 5))
+
+	acc := testutil.Accumulator{}
+	g.Push(&acc)
+
+	expected := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "a"},
+			map[string]interface{}{
+				"usage_sum":   30.0,
+				"usage_avg":   15.0,
+				"usage_min":   10.0,
+				"usage_max":   20.0,
+				"usage_count": int64(2),
+			},
+			time.Unix(0, 0),
+		),
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "b"},
+			map[string]interface{}{
+				"usage_sum":   5.0,
+				"usage_avg":   5.0,
+				"usage_min":   5.0,
+				"usage_max":   5.0,
+				"usage_count": int64(1),
+			},
+			time.Unix(0, 0),
+		),
+	}
+	testutil.RequireMetricsEqual(t, expected, acc.GetTelegrafMetrics(),
+		testutil.SortMetrics(), testutil.IgnoreTime())
+}
+
+func TestKeepTagsCollapseAll(t *testing.T) {
+	g := NewGroupBy()
+	g.KeepTags = []string{"region"}
+	g.Stats = []string{"sum", "quantile"}
+	g.Quantiles = []float64{0.5}
+	require.NoError(t, g.Init())
+
+	g.Add(newCPU("cpu0", "a", 10))
+	g.Add(newCPU("cpu1", "a", 20))
+	g.Add(newCPU("cpu0", "b", 40))
+	g.Add(newCPU("cpu1", "b", 30))
+
+	acc := testutil.Accumulator{}
+	g.Push(&acc)
+
+	expected := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{},
+			map[string]interface{}{
+				"usage_sum": 100.0,
+				"usage_p50": 25.0,
+			},
+			time.Unix(0, 0),
+		),
+	}
+	testutil.RequireMetricsEqual(t, expected, acc.GetTelegrafMetrics(), testutil.IgnoreTime())
+}
+
+func TestReset(t *testing.T) {
+	g := NewGroupBy()
+	require.NoError(t, g.Init())
+
+	g.Add(newCPU("cpu0", "a", 10))
+	g.Reset()
+
+	acc := testutil.Accumulator{}
+	g.Push(&acc)
+	require.Empty(t, acc.Metrics)
+}
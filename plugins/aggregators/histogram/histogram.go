@@ -1,6 +1,7 @@
 package histogram
 
 import (
+	"fmt"
 	"sort"
 	"strconv"
 
@@ -221,6 +222,56 @@ func (h *HistogramAggregator) resetCache() {
 	h.cache = make(map[uint64]metricHistogramCollection)
 }
 
+// histogramState is the persisted form of a metricHistogramCollection
+type histogramState struct {
+	Name   string             `json:"name"`
+	Tags   map[string]string  `json:"tags"`
+	Counts map[string][]int64 `json:"counts"`
+}
+
+// GetState returns the bucket counts so they can be persisted.  The counts
+// are copied, the state is stored while the aggregator keeps counting.
+func (h *HistogramAggregator) GetState() interface{} {
+	state := make(map[uint64]histogramState, len(h.cache))
+	for id, agr := range h.cache {
+		counts := make(map[string][]int64, len(agr.histogramCollection))
+		for field, c := range agr.histogramCollection {
+			counts[field] = append([]int64(nil), c...)
+		}
+		state[id] = histogramState{Name: agr.name, Tags: agr.tags, Counts: counts}
+	}
+	return state
+}
+
+// SetState restores the bucket counts.  Counts of fields whose buckets have
+// changed since the state was stored are discarded.
+func (h *HistogramAggregator) SetState(state interface{}) error {
+	s, ok := state.(map[uint64]histogramState)
+	if !ok {
+		return fmt.Errorf("invalid state type %T", state)
+	}
+
+	h.resetCache()
+	for id, hs := range s {
+		agr := metricHistogramCollection{
+			name:                hs.Name,
+			tags:                hs.Tags,
+			histogramCollection: make(map[string]counts),
+		}
+		for field, c := range hs.Counts {
+			buckets := h.getBuckets(hs.Name, field)
+			if buckets == nil || len(buckets)+1 != len(c) {
+				continue
+			}
+			agr.histogramCollection[field] = c
+		}
+		if len(agr.histogramCollection) > 0 {
+			h.cache[id] = agr
+		}
+	}
+	return nil
+}
+
 // getBuckets finds buckets and returns them
 func (h *HistogramAggregator) getBuckets(metric string, field string) []float64 {
 	if buckets, ok := h.buckets[metric][field]; ok {
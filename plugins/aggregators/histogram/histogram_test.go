@@ -1,6 +1,7 @@
 package histogram
 
 import (
+	"encoding/json"
 	"fmt"
 	"testing"
 	"time"
@@ -9,6 +10,7 @@ import (
 	"github.com/influxdata/telegraf/metric"
 	"github.com/influxdata/telegraf/testutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // NewTestHistogram creates new test histogram aggregation with specified config
@@ -233,3 +235,51 @@ func assertContainsTaggedField(t *testing.T, acc *testutil.Accumulator, metricNa
 
 	assert.Fail(t, fmt.Sprintf("unknown measurement '%s' with tags: %v, fields: %v", metricName, map[string]string{"le": le}, fields))
 }
+
+// TestHistogramState tests that counts are restored and that counts of
+// fields with changed buckets are discarded
+func TestHistogramState(t *testing.T) {
+	var cfg []config
+	cfg = append(cfg, config{Metric: "first_metric_name", Buckets: []float64{0.0, 20.0, 40.0}})
+	histogram := NewTestHistogram(cfg, false).(*HistogramAggregator)
+	histogram.Add(firstMetric1)
+	histogram.Add(firstMetric2)
+
+	buf, err := json.Marshal(histogram.GetState())
+	require.NoError(t, err)
+	var state map[uint64]histogramState
+	require.NoError(t, json.Unmarshal(buf, &state))
+
+	cfg = []config{
+		{Metric: "first_metric_name", Fields: []string{"a"}, Buckets: []float64{0.0, 20.0, 40.0}},
+		{Metric: "first_metric_name", Fields: []string{"b"}, Buckets: []float64{0.0, 40.0}},
+	}
+	restored := NewTestHistogram(cfg, false).(*HistogramAggregator)
+	require.NoError(t, restored.SetState(state))
+
+	acc := &testutil.Accumulator{}
+	restored.Push(acc)
+
+	assertContainsTaggedField(t, acc, "first_metric_name", map[string]interface{}{"a_bucket": int64(0)}, "0")
+	assertContainsTaggedField(t, acc, "first_metric_name", map[string]interface{}{"a_bucket": int64(2)}, "20")
+	assertContainsTaggedField(t, acc, "first_metric_name", map[string]interface{}{"a_bucket": int64(2)}, "40")
+	assertContainsTaggedField(t, acc, "first_metric_name", map[string]interface{}{"a_bucket": int64(2)}, bucketInf)
+	assert.False(t, acc.HasField("first_metric_name", "b_bucket"))
+	assert.False(t, acc.HasField("first_metric_name", "c_bucket"))
+}
+
+// TestHistogramStateCopy tests that the state is not changed by the metrics
+// added after it is taken
+func TestHistogramStateCopy(t *testing.T) {
+	var cfg []config
+	cfg = append(cfg, config{Metric: "first_metric_name", Buckets: []float64{0.0, 20.0, 40.0}})
+	histogram := NewTestHistogram(cfg, false).(*HistogramAggregator)
+	histogram.Add(firstMetric1)
+
+	state := histogram.GetState().(map[uint64]histogramState)
+	histogram.Add(firstMetric2)
+
+	for _, hs := range state {
+		assert.Equal(t, []int64{0, 1, 0, 0}, hs.Counts["a"])
+	}
+}
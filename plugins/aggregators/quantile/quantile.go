@@ -0,0 +1,205 @@
+package quantile
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/caio/go-tdigest"
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/plugins/aggregators"
+	"github.com/influxdata/telegraf/plugins/common/stats"
+)
+
+const sketchSuffix = "_sketch"
+
+// Quantile is an aggregator that estimates quantiles of each numeric field
+// using a mergeable t-digest sketch.
+type Quantile struct {
+	Quantiles     []float64 `toml:"quantiles"`
+	Compression   uint32    `toml:"compression"`
+	EmitSketch    bool      `toml:"emit_sketch"`
+	MergeSketches bool      `toml:"merge_sketches"`
+
+	Log telegraf.Logger `toml:"-"`
+
+	cache  map[uint64]aggregate
+	suffix []string
+}
+
+type aggregate struct {
+	name    string
+	tags    map[string]string
+	digests map[string]*tdigest.TDigest
+}
+
+// NewQuantile creates a quantile aggregator with the default settings.
+func NewQuantile() *Quantile {
+	q := &Quantile{
+		Quantiles:   []float64{0.25, 0.5, 0.75},
+		Compression: 100,
+	}
+	q.Reset()
+	return q
+}
+
+var sampleConfig = `
+  ## General Aggregator Arguments:
+  ## The period on which to flush & clear the aggregator.
+  period = "30s"
+
+  ## If true, the original metric will be dropped by the
+  ## aggregator and will not get sent to the output plugins.
+  drop_original = false
+
+  ## Quantiles to output in the range [0,1]; each quantile is emitted as
+  ## a field named "<field>_p<quantile*100>", e.g. "usage_p99.9".
+  # quantiles = [0.25, 0.5, 0.75]
+
+  ## Compression of the t-digest sketch.  Higher values increase accuracy
+  ## at the cost of memory; each sketch keeps roughly 5 * compression
+  ## centroids regardless of the number of samples added.
+  # compression = 100
+
+  ## If true, emit the serialized sketch of each field as a base64 string
+  ## field named "<field>_sketch" so it can be merged by a downstream agent.
+  # emit_sketch = false
+
+  ## If true, string fields named "<field>_sketch" are decoded as sketches
+  ## and merged into the sketch of "<field>" instead of being ignored.
+  # merge_sketches = false
+`
+
+func (q *Quantile) SampleConfig() string {
+	return sampleConfig
+}
+
+func (q *Quantile) Description() string {
+	return "Keep the aggregate quantiles of each metric passing through."
+}
+
+func (q *Quantile) Init() error {
+	if q.Compression < 1 {
+		return fmt.Errorf("compression must be at least 1, got %d", q.Compression)
+	}
+
+	q.suffix = make([]string, 0, len(q.Quantiles))
+	for _, qtl := range q.Quantiles {
+		if qtl < 0 || qtl > 1 || math.IsNaN(qtl) {
+			return fmt.Errorf("quantile %v out of range [0,1]", qtl)
+		}
+		q.suffix = append(q.suffix, stats.QuantileSuffix(qtl))
+	}
+	return nil
+}
+
+func (q *Quantile) Add(in telegraf.Metric) {
+	id := in.HashID()
+	a, ok := q.cache[id]
+	if !ok {
+		a = aggregate{
+			name:    in.Name(),
+			tags:    in.Tags(),
+			digests: make(map[string]*tdigest.TDigest),
+		}
+		q.cache[id] = a
+	}
+
+	for _, field := range in.FieldList() {
+		if s, ok := field.Value.(string); ok {
+			if q.MergeSketches && strings.HasSuffix(field.Key, sketchSuffix) {
+				q.mergeSketch(a, strings.TrimSuffix(field.Key, sketchSuffix), s)
+			}
+			continue
+		}
+
+		fv, ok := stats.ToFloat(field.Value)
+		if !ok || math.IsNaN(fv) || math.IsInf(fv, 0) {
+			continue
+		}
+
+		td, err := q.digest(a, field.Key)
+		if err != nil {
+			q.Log.Errorf("Creating sketch for field %q: %v", field.Key, err)
+			continue
+		}
+		if err := td.Add(fv); err != nil {
+			q.Log.Errorf("Adding value to sketch for field %q: %v", field.Key, err)
+		}
+	}
+}
+
+func (q *Quantile) mergeSketch(a aggregate, key string, encoded string) {
+	buf, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		q.Log.Errorf("Decoding sketch for field %q: %v", key, err)
+		return
+	}
+
+	other, err := tdigest.FromBytes(bytes.NewReader(buf))
+	if err != nil {
+		q.Log.Errorf("Deserializing sketch for field %q: %v", key, err)
+		return
+	}
+
+	td, err := q.digest(a, key)
+	if err != nil {
+		q.Log.Errorf("Creating sketch for field %q: %v", key, err)
+		return
+	}
+	if err := td.Merge(other); err != nil {
+		q.Log.Errorf("Merging sketch for field %q: %v", key, err)
+	}
+}
+
+func (q *Quantile) digest(a aggregate, key string) (*tdigest.TDigest, error) {
+	if td, ok := a.digests[key]; ok {
+		return td, nil
+	}
+
+	td, err := tdigest.New(tdigest.Compression(q.Compression))
+	if err != nil {
+		return nil, err
+	}
+	a.digests[key] = td
+	return td, nil
+}
+
+func (q *Quantile) Push(acc telegraf.Accumulator) {
+	for _, agg := range q.cache {
+		fields := map[string]interface{}{}
+		for key, td := range agg.digests {
+			if td.Count() == 0 {
+				continue
+			}
+
+			for i, qtl := range q.Quantiles {
+				fields[key+"_"+q.suffix[i]] = td.Quantile(qtl)
+			}
+
+			if q.EmitSketch {
+				buf, err := td.AsBytes()
+				if err != nil {
+					q.Log.Errorf("Serializing sketch for field %q: %v", key, err)
+					continue
+				}
+				fields[key+sketchSuffix] = base64.StdEncoding.EncodeToString(buf)
+			}
+		}
+		if len(fields) > 0 {
+			acc.AddFields(agg.name, fields, agg.tags)
+		}
+	}
+}
+
+func (q *Quantile) Reset() {
+	q.cache = make(map[uint64]aggregate)
+}
+
+func init() {
+	aggregators.Add("quantile", func() telegraf.Aggregator {
+		return NewQuantile()
+	})
+}
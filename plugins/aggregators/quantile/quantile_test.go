@@ -0,0 +1,104 @@
+package quantile
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestQuantile(quantiles []float64) *Quantile {
+	q := NewQuantile()
+	q.Quantiles = quantiles
+	q.Log = testutil.Logger{}
+	return q
+}
+
+func newMetric(value interface{}) telegraf.Metric {
+	m, _ := metric.New("m1",
+		map[string]string{"foo": "bar"},
+		map[string]interface{}{
+			"a":      value,
+			"ignore": "string",
+		},
+		time.Now(),
+	)
+	return m
+}
+
+func TestQuantileInitInvalid(t *testing.T) {
+	q := newTestQuantile([]float64{0.5, 1.5})
+	require.Error(t, q.Init())
+
+	q = newTestQuantile([]float64{0.5})
+	q.Compression = 0
+	require.Error(t, q.Init())
+}
+
+func TestQuantileBasic(t *testing.T) {
+	q := newTestQuantile([]float64{0, 0.5, 1})
+	require.NoError(t, q.Init())
+
+	for i := int64(1); i <= 101; i++ {
+		q.Add(newMetric(i))
+	}
+
+	acc := testutil.Accumulator{}
+	q.Push(&acc)
+
+	require.Len(t, acc.Metrics, 1)
+	m := acc.Metrics[0]
+	require.Equal(t, "m1", m.Measurement)
+	require.Equal(t, map[string]string{"foo": "bar"}, m.Tags)
+	require.Len(t, m.Fields, 3)
+	require.InDelta(t, 1.0, m.Fields["a_p0"], 0.5)
+	require.InDelta(t, 51.0, m.Fields["a_p50"], 1.0)
+	require.InDelta(t, 101.0, m.Fields["a_p100"], 0.5)
+}
+
+func TestQuantileReset(t *testing.T) {
+	q := newTestQuantile([]float64{0.5})
+	require.NoError(t, q.Init())
+
+	q.Add(newMetric(1.0))
+	q.Reset()
+
+	acc := testutil.Accumulator{}
+	q.Push(&acc)
+	require.Empty(t, acc.Metrics)
+}
+
+func TestQuantileSketchRoundTrip(t *testing.T) {
+	upstream := newTestQuantile([]float64{0.5})
+	upstream.EmitSketch = true
+	require.NoError(t, upstream.Init())
+	for i := 1; i <= 100; i++ {
+		upstream.Add(newMetric(float64(i)))
+	}
+
+	acc := testutil.Accumulator{}
+	upstream.Push(&acc)
+	require.Len(t, acc.Metrics, 1)
+	sketch, ok := acc.Metrics[0].Fields["a_sketch"].(string)
+	require.True(t, ok)
+
+	downstream := newTestQuantile([]float64{0.5})
+	downstream.MergeSketches = true
+	require.NoError(t, downstream.Init())
+	for i := 0; i < 2; i++ {
+		m, _ := metric.New("m1",
+			map[string]string{"foo": "bar"},
+			map[string]interface{}{"a_sketch": sketch},
+			time.Now(),
+		)
+		downstream.Add(m)
+	}
+
+	acc = testutil.Accumulator{}
+	downstream.Push(&acc)
+	require.Len(t, acc.Metrics, 1)
+	require.InDelta(t, 50.5, acc.Metrics[0].Fields["a_p50"], 2.0)
+}
@@ -92,6 +92,52 @@ func (vc *ValueCounter) Reset() {
 	vc.cache = make(map[uint64]aggregate)
 }
 
+// aggregateState is the persisted form of an aggregate.
+type aggregateState struct {
+	Name       string            `json:"name"`
+	Tags       map[string]string `json:"tags"`
+	FieldCount map[string]int    `json:"field_count"`
+}
+
+// GetState returns the counters so they can be persisted.  The counters are
+// copied, the state is stored while the aggregator keeps counting.
+func (vc *ValueCounter) GetState() interface{} {
+	state := make(map[uint64]aggregateState, len(vc.cache))
+	for id, agg := range vc.cache {
+		fieldCount := make(map[string]int, len(agg.fieldCount))
+		for k, v := range agg.fieldCount {
+			fieldCount[k] = v
+		}
+		state[id] = aggregateState{
+			Name:       agg.name,
+			Tags:       agg.tags,
+			FieldCount: fieldCount,
+		}
+	}
+	return state
+}
+
+// SetState restores the counters
+func (vc *ValueCounter) SetState(state interface{}) error {
+	s, ok := state.(map[uint64]aggregateState)
+	if !ok {
+		return fmt.Errorf("invalid state type %T", state)
+	}
+
+	vc.cache = make(map[uint64]aggregate, len(s))
+	for id, agg := range s {
+		if agg.FieldCount == nil {
+			agg.FieldCount = make(map[string]int)
+		}
+		vc.cache[id] = aggregate{
+			name:       agg.Name,
+			tags:       agg.Tags,
+			fieldCount: agg.FieldCount,
+		}
+	}
+	return nil
+}
+
 func init() {
 	aggregators.Add("valuecounter", func() telegraf.Aggregator {
 		return NewValueCounter()
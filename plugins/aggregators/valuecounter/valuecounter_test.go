@@ -1,12 +1,14 @@
 package valuecounter
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
 
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/metric"
 	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
 )
 
 // Create a valuecounter with config
@@ -123,3 +125,36 @@ func TestWithReset(t *testing.T) {
 	}
 	acc.AssertContainsTaggedFields(t, "m1", expectedFields, expectedTags)
 }
+
+// Test that counts are restored from the persisted state
+func TestState(t *testing.T) {
+	vc := NewTestValueCounter([]string{"status"}).(*ValueCounter)
+	vc.Add(m1)
+
+	buf, err := json.Marshal(vc.GetState())
+	require.NoError(t, err)
+	var state map[uint64]aggregateState
+	require.NoError(t, json.Unmarshal(buf, &state))
+
+	restored := NewTestValueCounter([]string{"status"}).(*ValueCounter)
+	require.NoError(t, restored.SetState(state))
+	restored.Add(m1)
+
+	// the state is not changed by the metrics added after it is taken
+	stored := vc.GetState().(map[uint64]aggregateState)
+	vc.Add(m1)
+	for _, agg := range stored {
+		require.Equal(t, map[string]int{"status_200": 1}, agg.FieldCount)
+	}
+
+	acc := testutil.Accumulator{}
+	restored.Push(&acc)
+
+	expectedFields := map[string]interface{}{
+		"status_200": 2,
+	}
+	expectedTags := map[string]string{
+		"foo": "bar",
+	}
+	acc.AssertContainsTaggedFields(t, "m1", expectedFields, expectedTags)
+}
@@ -0,0 +1,16 @@
+// +build !windows
+
+package fileoffset
+
+import (
+	"os"
+	"syscall"
+)
+
+func fileID(info os.FileInfo) (inode, device uint64) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0
+	}
+	return uint64(stat.Ino), uint64(stat.Dev)
+}
@@ -0,0 +1,101 @@
+// Package fileoffset records the offset reached when reading a file, with
+// what identifies the file, so that reading can be resumed after a restart
+// unless the file was rotated, truncated or replaced in the meantime.
+package fileoffset
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+)
+
+// fingerprintSize is the maximum number of bytes at the start of the file
+// used as its fingerprint.
+const fingerprintSize = 1024
+
+// Position is the offset reached in a file.
+type Position struct {
+	Offset int64 `json:"offset"`
+	// Inode and Device of the file, not set on platforms without them.
+	Inode  uint64 `json:"inode,omitempty"`
+	Device uint64 `json:"device,omitempty"`
+	// Fingerprint is the hash of the first FingerprintSize bytes of the
+	// file, the bytes already read up to fingerprintSize.
+	Fingerprint     string `json:"fingerprint,omitempty"`
+	FingerprintSize int64  `json:"fingerprint_size,omitempty"`
+}
+
+// New returns the position of the offset in the file.
+func New(filename string, offset int64) (Position, error) {
+	p := Position{Offset: offset}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return p, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return p, err
+	}
+	p.Inode, p.Device = fileID(info)
+
+	p.FingerprintSize = offset
+	if p.FingerprintSize > fingerprintSize {
+		p.FingerprintSize = fingerprintSize
+	}
+	if p.FingerprintSize > 0 {
+		sum, err := fingerprint(f, p.FingerprintSize)
+		if err != nil {
+			return p, err
+		}
+		p.Fingerprint = sum
+	}
+	return p, nil
+}
+
+// Resume returns the offset to resume reading the file at.  It returns false
+// when the file is not the one the position was recorded in: it was rotated,
+// truncated below the offset, or its first bytes changed.
+func (p Position) Resume(filename string) (int64, bool) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, false
+	}
+	if info.Mode().IsRegular() && info.Size() < p.Offset {
+		return 0, false
+	}
+
+	if p.Inode != 0 || p.Device != 0 {
+		inode, device := fileID(info)
+		if inode != p.Inode || device != p.Device {
+			return 0, false
+		}
+	}
+
+	if p.Fingerprint != "" {
+		sum, err := fingerprint(f, p.FingerprintSize)
+		if err != nil || sum != p.Fingerprint {
+			return 0, false
+		}
+	}
+	return p.Offset, true
+}
+
+func fingerprint(f *os.File, size int64) (string, error) {
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, io.NewSectionReader(f, 0, size), size); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,90 @@
+package fileoffset
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fileoffset")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "test.log")
+	require.NoError(t, ioutil.WriteFile(filename, []byte("first line\nsecond line\n"), 0644))
+
+	p, err := New(filename, 11)
+	require.NoError(t, err)
+	require.Equal(t, int64(11), p.Offset)
+	require.Equal(t, int64(11), p.FingerprintSize)
+	require.NotEmpty(t, p.Fingerprint)
+
+	// appended
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteString("third line\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	offset, ok := p.Resume(filename)
+	require.True(t, ok)
+	require.Equal(t, int64(11), offset)
+
+	// truncated
+	require.NoError(t, ioutil.WriteFile(filename, []byte("new\n"), 0644))
+	_, ok = p.Resume(filename)
+	require.False(t, ok)
+
+	// same size, different content
+	require.NoError(t, ioutil.WriteFile(filename, []byte("other line\nsecond line\n"), 0644))
+	_, ok = p.Resume(filename)
+	require.False(t, ok)
+
+	// missing
+	_, ok = p.Resume(filepath.Join(dir, "missing.log"))
+	require.False(t, ok)
+}
+
+func TestResumeRotated(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fileoffset")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "test.log")
+	require.NoError(t, ioutil.WriteFile(filename, []byte("first line\n"), 0644))
+
+	p, err := New(filename, 11)
+	require.NoError(t, err)
+
+	// rotated to a new file with the same content
+	require.NoError(t, os.Rename(filename, filename+".1"))
+	require.NoError(t, ioutil.WriteFile(filename, []byte("first line\n"), 0644))
+
+	_, ok := p.Resume(filename)
+	require.Equal(t, p.Inode == 0 && p.Device == 0, ok)
+
+	offset, ok := p.Resume(filename + ".1")
+	require.True(t, ok)
+	require.Equal(t, int64(11), offset)
+}
+
+func TestNewEmpty(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fileoffset")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "test.log")
+	require.NoError(t, ioutil.WriteFile(filename, nil, 0644))
+
+	p, err := New(filename, 0)
+	require.NoError(t, err)
+	require.Empty(t, p.Fingerprint)
+
+	offset, ok := p.Resume(filename)
+	require.True(t, ok)
+	require.Equal(t, int64(0), offset)
+}
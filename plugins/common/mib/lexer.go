@@ -0,0 +1,92 @@
+package mib
+
+// token is a lexical element of a MIB file.  Quoted strings keep their
+// quotes so that they can not be mistaken for keywords.
+type token struct {
+	text string
+	line int
+}
+
+// tokenize splits the MIB source into tokens, dropping comments.  Comments
+// start with "--" and run to the end of the line.
+func tokenize(data []byte) []token {
+	var tokens []token
+	line := 1
+	for i := 0; i < len(data); {
+		c := data[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f':
+			i++
+		case c == '-' && i+1 < len(data) && data[i+1] == '-':
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+		case c == '"':
+			start, startLine := i, line
+			for i++; i < len(data); i++ {
+				if data[i] == '\n' {
+					line++
+				}
+				if data[i] == '"' {
+					// A doubled quote is an escaped quote.
+					if i+1 < len(data) && data[i+1] == '"' {
+						i++
+						continue
+					}
+					break
+				}
+			}
+			i++
+			tokens = append(tokens, token{text: string(data[start:min(i, len(data))]), line: startLine})
+		case c == '\'':
+			// Binary and hexadecimal strings such as 'FF'H.
+			start := i
+			for i++; i < len(data) && data[i] != '\''; i++ {
+			}
+			i++
+			if i < len(data) && isAlnum(data[i]) {
+				i++
+			}
+			tokens = append(tokens, token{text: string(data[start:min(i, len(data))]), line: line})
+		case c == ':' && i+2 < len(data) && data[i+1] == ':' && data[i+2] == '=':
+			tokens = append(tokens, token{text: "::=", line: line})
+			i += 3
+		case c == '.' && i+1 < len(data) && data[i+1] == '.':
+			tokens = append(tokens, token{text: "..", line: line})
+			i += 2
+		case isAlnum(c) || c == '-' && i+1 < len(data) && isDigit(data[i+1]):
+			start := i
+			for i++; i < len(data); i++ {
+				if data[i] == '-' && i+1 < len(data) && data[i+1] == '-' {
+					break
+				}
+				if !isAlnum(data[i]) && data[i] != '-' && data[i] != '_' {
+					break
+				}
+			}
+			tokens = append(tokens, token{text: string(data[start:i]), line: line})
+		default:
+			tokens = append(tokens, token{text: string(c), line: line})
+			i++
+		}
+	}
+	return tokens
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isAlnum(c byte) bool {
+	return isDigit(c) || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
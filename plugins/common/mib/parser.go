@@ -0,0 +1,366 @@
+package mib
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// module is a parsed MIB module, its objects are resolved into the tree
+// once all the modules are loaded.
+type module struct {
+	name    string
+	file    string
+	imports map[string]string
+	objects []*object
+	types   map[string]*typeDef
+}
+
+// object is an assignment of an OID value, such as an OBJECT-TYPE or an
+// OBJECT IDENTIFIER.
+type object struct {
+	name       string
+	line       int
+	syntax     string
+	access     string
+	index      []string
+	augments   string
+	enterprise string
+	oid        []component
+}
+
+// component is an element of an OID value, for example "internet",
+// "private(4)" or "1".
+type component struct {
+	name      string
+	number    int
+	hasNumber bool
+}
+
+// typeDef is a type assignment, for example a TEXTUAL-CONVENTION.
+type typeDef struct {
+	name   string
+	syntax string
+	tc     bool
+	module *module
+}
+
+type parser struct {
+	file   string
+	tokens []token
+	pos    int
+}
+
+// parse parses the modules defined in a MIB file.
+func parse(file string, data []byte) ([]*module, error) {
+	p := &parser{file: file, tokens: tokenize(data)}
+
+	var modules []*module
+	for p.peek() != "" {
+		m, err := p.parseModule()
+		if err != nil {
+			return nil, err
+		}
+		modules = append(modules, m)
+	}
+	return modules, nil
+}
+
+func (p *parser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos].text
+}
+
+func (p *parser) next() string {
+	t := p.peek()
+	if t != "" {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) line() int {
+	if p.pos >= len(p.tokens) {
+		if len(p.tokens) == 0 {
+			return 0
+		}
+		return p.tokens[len(p.tokens)-1].line
+	}
+	return p.tokens[p.pos].line
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s:%d: %s", p.file, p.line(), fmt.Sprintf(format, args...))
+}
+
+// skipTo consumes the tokens up to and including the given token.
+func (p *parser) skipTo(text string) {
+	for t := p.next(); t != "" && t != text; t = p.next() {
+	}
+}
+
+// skipBalanced consumes a bracketed block, the next token must be the
+// opening bracket.
+func (p *parser) skipBalanced(open, close string) {
+	depth := 0
+	for t := p.next(); t != ""; t = p.next() {
+		switch t {
+		case open:
+			depth++
+		case close:
+			depth--
+		}
+		if depth == 0 {
+			return
+		}
+	}
+}
+
+func (p *parser) parseModule() (*module, error) {
+	name := p.next()
+	if !isIdentifier(name) {
+		return nil, p.errorf("expected module name, got %q", name)
+	}
+	if p.peek() == "{" {
+		p.skipBalanced("{", "}")
+	}
+	if t := p.next(); t != "DEFINITIONS" {
+		return nil, p.errorf("expected DEFINITIONS after %s, got %q", name, t)
+	}
+	p.skipTo("::=")
+	if t := p.next(); t != "BEGIN" {
+		return nil, p.errorf("expected BEGIN in %s, got %q", name, t)
+	}
+
+	m := &module{
+		name:    name,
+		file:    p.file,
+		imports: make(map[string]string),
+		types:   make(map[string]*typeDef),
+	}
+	for {
+		switch t := p.peek(); {
+		case t == "":
+			return nil, p.errorf("missing END of module %s", name)
+		case t == "END":
+			p.next()
+			return m, nil
+		case t == "IMPORTS":
+			p.next()
+			p.parseImports(m)
+		case t == "EXPORTS":
+			p.skipTo(";")
+		case isIdentifier(t):
+			p.parseAssignment(m)
+		default:
+			p.next()
+		}
+	}
+}
+
+func (p *parser) parseImports(m *module) {
+	var symbols []string
+	for {
+		switch t := p.next(); t {
+		case "", ";":
+			return
+		case ",":
+		case "FROM":
+			from := p.next()
+			for _, s := range symbols {
+				m.imports[s] = from
+			}
+			symbols = symbols[:0]
+		default:
+			symbols = append(symbols, t)
+		}
+	}
+}
+
+func (p *parser) parseAssignment(m *module) {
+	line := p.line()
+	name := p.next()
+
+	switch p.peek() {
+	case "MACRO":
+		p.skipTo("END")
+		return
+	case "::=":
+		p.next()
+		if isUpper(name) {
+			p.parseTypeAssignment(m, name)
+			return
+		}
+		// A value without type, net-snmp accepts this for OIDs.
+		p.parseValue(m, &object{name: name, line: line})
+		return
+	}
+
+	if isUpper(name) {
+		return
+	}
+
+	o := &object{name: name, line: line}
+	for {
+		switch t := p.next(); t {
+		case "":
+			return
+		case "END":
+			// Malformed assignment, leave the end of the module.
+			p.pos--
+			return
+		case "::=":
+			p.parseValue(m, o)
+			return
+		case "SYNTAX":
+			if o.syntax == "" {
+				o.syntax = p.parseType()
+			}
+		case "ACCESS", "MAX-ACCESS":
+			o.access = p.next()
+		case "INDEX":
+			o.index = p.parseList()
+		case "AUGMENTS":
+			if augments := p.parseList(); len(augments) > 0 {
+				o.augments = augments[0]
+			}
+		case "ENTERPRISE":
+			o.enterprise = p.next()
+		}
+	}
+}
+
+func (p *parser) parseTypeAssignment(m *module, name string) {
+	td := &typeDef{name: name, module: m}
+	if p.peek() == "TEXTUAL-CONVENTION" {
+		p.next()
+		td.tc = true
+		for t := p.next(); t != "SYNTAX"; t = p.next() {
+			if t == "" || t == "END" {
+				return
+			}
+		}
+	}
+	td.syntax = p.parseType()
+	m.types[name] = td
+}
+
+// parseType parses a type and returns its name, constraints and named
+// numbers are skipped.
+func (p *parser) parseType() string {
+	if p.peek() == "[" {
+		p.skipBalanced("[", "]")
+	}
+	if p.peek() == "IMPLICIT" || p.peek() == "EXPLICIT" {
+		p.next()
+	}
+
+	name := p.next()
+	switch name {
+	case "OCTET", "OBJECT":
+		name += " " + p.next()
+	case "SEQUENCE":
+		if p.peek() == "OF" {
+			p.next()
+			return "SEQUENCE OF " + p.parseType()
+		}
+	}
+
+	for {
+		switch p.peek() {
+		case "{":
+			p.skipBalanced("{", "}")
+		case "(":
+			p.skipBalanced("(", ")")
+		default:
+			return name
+		}
+	}
+}
+
+// parseList parses the identifiers of an INDEX or AUGMENTS clause.
+func (p *parser) parseList() []string {
+	if p.peek() != "{" {
+		return nil
+	}
+	p.next()
+
+	var list []string
+	for {
+		switch t := p.next(); t {
+		case "", "}":
+			return list
+		case ",", "IMPLIED":
+		default:
+			list = append(list, t)
+		}
+	}
+}
+
+func (p *parser) parseValue(m *module, o *object) {
+	if p.peek() != "{" {
+		// TRAP-TYPE values are the specific trap number.
+		value := p.next()
+		if n, err := strconv.Atoi(value); err == nil && o.enterprise != "" {
+			o.oid = []component{
+				{name: o.enterprise},
+				{number: 0, hasNumber: true},
+				{number: n, hasNumber: true},
+			}
+			m.objects = append(m.objects, o)
+		}
+		return
+	}
+	p.next()
+
+	for {
+		t := p.next()
+		switch {
+		case t == "" || t == "}":
+			if len(o.oid) > 0 {
+				m.objects = append(m.objects, o)
+			}
+			return
+		case isNumber(t):
+			n, _ := strconv.Atoi(t)
+			o.oid = append(o.oid, component{number: n, hasNumber: true})
+		case isIdentifier(t):
+			c := component{name: t}
+			if p.peek() == "(" {
+				p.next()
+				if n, err := strconv.Atoi(p.next()); err == nil {
+					c.number = n
+					c.hasNumber = true
+				}
+				p.skipTo(")")
+			}
+			o.oid = append(o.oid, c)
+		default:
+			// Not an OID value.
+			p.skipTo("}")
+			return
+		}
+	}
+}
+
+func isNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isIdentifier(s string) bool {
+	return s != "" && (s[0] >= 'a' && s[0] <= 'z' || s[0] >= 'A' && s[0] <= 'Z')
+}
+
+func isUpper(s string) bool {
+	return s != "" && strings.ToUpper(s[:1]) == s[:1]
+}
@@ -0,0 +1,81 @@
+package mib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenize(t *testing.T) {
+	var texts []string
+	for _, tok := range tokenize([]byte(`foo-bar OBJECT-TYPE -- comment -- still comment
+	SYNTAX INTEGER (-1..10) DEFVAL { 'FF'H }
+	DESCRIPTION "a ""quoted"" -- text"
+	::= { mib-2 1 }`)) {
+		texts = append(texts, tok.text)
+	}
+	require.Equal(t, []string{
+		"foo-bar", "OBJECT-TYPE",
+		"SYNTAX", "INTEGER", "(", "-1", "..", "10", ")", "DEFVAL", "{", "'FF'H", "}",
+		"DESCRIPTION", `"a ""quoted"" -- text"`,
+		"::=", "{", "mib-2", "1", "}",
+	}, texts)
+}
+
+func TestParse(t *testing.T) {
+	modules, err := parse("test.mib", []byte(`
+TEST DEFINITIONS ::= BEGIN
+IMPORTS Counter32 FROM SNMPv2-SMI
+        PhysAddress FROM SNMPv2-TC;
+
+testOID ::= { 1 0 0 }
+
+Address ::= TEXTUAL-CONVENTION
+    DISPLAY-HINT "1x:"
+    STATUS current
+    DESCRIPTION "An address."
+    SYNTAX PhysAddress
+
+testEntry OBJECT-TYPE
+    SYNTAX TestEntry
+    MAX-ACCESS not-accessible
+    STATUS current
+    INDEX { IMPLIED testName }
+    ::= { iso org(3) 5 }
+END
+`))
+	require.NoError(t, err)
+	require.Len(t, modules, 1)
+
+	m := modules[0]
+	require.Equal(t, "TEST", m.name)
+	require.Equal(t, map[string]string{"Counter32": "SNMPv2-SMI", "PhysAddress": "SNMPv2-TC"}, m.imports)
+	require.Equal(t, "PhysAddress", m.types["Address"].syntax)
+	require.True(t, m.types["Address"].tc)
+
+	require.Len(t, m.objects, 2)
+	require.Equal(t, []component{
+		{number: 1, hasNumber: true},
+		{number: 0, hasNumber: true},
+		{number: 0, hasNumber: true},
+	}, m.objects[0].oid)
+
+	entry := m.objects[1]
+	require.Equal(t, "testEntry", entry.name)
+	require.Equal(t, "TestEntry", entry.syntax)
+	require.Equal(t, "not-accessible", entry.access)
+	require.Equal(t, []string{"testName"}, entry.index)
+	require.Equal(t, []component{
+		{name: "iso"},
+		{name: "org", number: 3, hasNumber: true},
+		{number: 5, hasNumber: true},
+	}, entry.oid)
+}
+
+func TestParseErrors(t *testing.T) {
+	_, err := parse("test.mib", []byte("TEST DEFINITIONS ::= BEGIN\nfoo OBJECT IDENTIFIER ::= { iso 1 }\n"))
+	require.EqualError(t, err, "test.mib:2: missing END of module TEST")
+
+	_, err = parse("test.mib", []byte("TEST ::= BEGIN END"))
+	require.Error(t, err)
+}
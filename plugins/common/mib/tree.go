@@ -0,0 +1,461 @@
+// Package mib loads SNMP MIB files and translates between numeric and
+// symbolic OIDs without the net-snmp tools.
+//
+// The parser understands the subset of SMIv1 and SMIv2 needed for
+// translation: OID assignments, the SYNTAX, ACCESS, INDEX and AUGMENTS
+// clauses of object types, and textual conventions.  Everything else is
+// skipped.
+package mib
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Node is an object of the OID tree.
+type Node struct {
+	// Name and Module identify the object, nodes only created as the
+	// parents of other nodes have no name.
+	Name   string
+	Module string
+	// Oid is the numeric OID with a leading dot, for example ".1.3.6.1".
+	Oid string
+	// Syntax is the type of an object type, as written in the MIB.
+	Syntax string
+	// Access is the MAX-ACCESS or ACCESS of an object type.
+	Access string
+	// Index is the INDEX of a table entry.
+	Index []string
+
+	augments string
+	module   *module
+	children map[int]*Node
+}
+
+// child returns the child with the sub-identifier, creating it if needed.
+func (n *Node) child(subid int) *Node {
+	c, ok := n.children[subid]
+	if !ok {
+		c = &Node{
+			Oid:      n.Oid + "." + strconv.Itoa(subid),
+			children: make(map[int]*Node),
+		}
+		n.children[subid] = c
+	}
+	return c
+}
+
+// sortedChildren returns the children ordered by sub-identifier.
+func (n *Node) sortedChildren() []*Node {
+	subids := make([]int, 0, len(n.children))
+	for subid := range n.children {
+		subids = append(subids, subid)
+	}
+	sort.Ints(subids)
+
+	children := make([]*Node, 0, len(subids))
+	for _, subid := range subids {
+		children = append(children, n.children[subid])
+	}
+	return children
+}
+
+// Tree is the OID tree built from a set of MIB files.  It is read only once
+// loaded and safe for concurrent use.
+type Tree struct {
+	// Warnings lists the files that could not be parsed and the objects
+	// that could not be placed in the tree.
+	Warnings []error
+
+	root     *Node
+	modules  map[string]*module
+	byName   map[string]*Node
+	byModule map[string]map[string]*Node
+}
+
+// wellKnown are the nodes defined by the ASN.1 standard and SNMPv2-SMI, so
+// that MIBs can be resolved without SNMPv2-SMI in the MIB directories.  They
+// belong to no module until defined by a loaded MIB.
+var wellKnown = []struct {
+	name   string
+	parent string
+	subid  int
+}{
+	{"ccitt", "", 0},
+	{"iso", "", 1},
+	{"joint-iso-ccitt", "", 2},
+	{"zeroDotZero", "ccitt", 0},
+	{"org", "iso", 3},
+	{"dod", "org", 6},
+	{"internet", "dod", 1},
+	{"directory", "internet", 1},
+	{"mgmt", "internet", 2},
+	{"mib-2", "mgmt", 1},
+	{"transmission", "mib-2", 10},
+	{"experimental", "internet", 3},
+	{"private", "internet", 4},
+	{"enterprises", "private", 1},
+	{"security", "internet", 5},
+	{"snmpV2", "internet", 6},
+	{"snmpDomains", "snmpV2", 1},
+	{"snmpProxys", "snmpV2", 2},
+	{"snmpModules", "snmpV2", 3},
+}
+
+// NewTree returns a tree holding only the well known nodes.
+func NewTree() *Tree {
+	t := &Tree{
+		root:     &Node{children: make(map[int]*Node)},
+		modules:  make(map[string]*module),
+		byName:   make(map[string]*Node),
+		byModule: make(map[string]map[string]*Node),
+	}
+
+	for _, wk := range wellKnown {
+		parent := t.root
+		if wk.parent != "" {
+			parent = t.byName[wk.parent]
+		}
+		n := parent.child(wk.subid)
+		n.Name = wk.name
+		t.register("", n.Name, n)
+	}
+	return t
+}
+
+var (
+	cacheLock sync.Mutex
+	cache     = make(map[string]*Tree)
+)
+
+// LoadDirs loads the MIB files found in the directories.  Files not holding
+// a module definition are ignored, and a module defined in several files is
+// taken from the first directory.  The trees are cached by directory list,
+// so that plugins configured with the same directories share the tree.
+func LoadDirs(dirs []string) (*Tree, error) {
+	key := strings.Join(dirs, string(os.PathListSeparator))
+
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+	if t, ok := cache[key]; ok {
+		return t, nil
+	}
+
+	t := NewTree()
+	for _, dir := range dirs {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, fi := range files {
+			if fi.IsDir() || strings.HasPrefix(fi.Name(), ".") {
+				continue
+			}
+			if err := t.loadFile(filepath.Join(dir, fi.Name())); err != nil {
+				return nil, err
+			}
+		}
+	}
+	t.resolve()
+
+	cache[key] = t
+	return t, nil
+}
+
+func (t *Tree) loadFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(string(data), "DEFINITIONS") {
+		return nil
+	}
+
+	modules, err := parse(path, data)
+	if err != nil {
+		t.Warnings = append(t.Warnings, err)
+		return nil
+	}
+	for _, m := range modules {
+		if _, ok := t.modules[m.name]; ok {
+			continue
+		}
+		t.modules[m.name] = m
+	}
+	return nil
+}
+
+type definition struct {
+	module *module
+	object *object
+}
+
+// resolve places the objects of the loaded modules in the tree.  Objects
+// may refer to objects defined later or in modules loaded later, so the
+// pending objects are retried as long as some are resolved.
+func (t *Tree) resolve() {
+	names := make([]string, 0, len(t.modules))
+	for name := range t.modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var pending []definition
+	for _, name := range names {
+		m := t.modules[name]
+		for _, o := range m.objects {
+			pending = append(pending, definition{module: m, object: o})
+		}
+	}
+
+	for progress := true; progress && len(pending) > 0; {
+		progress = false
+		rest := pending[:0]
+		for _, d := range pending {
+			if t.define(d.module, d.object) {
+				progress = true
+			} else {
+				rest = append(rest, d)
+			}
+		}
+		pending = rest
+	}
+
+	for _, d := range pending {
+		t.Warnings = append(t.Warnings, fmt.Errorf("%s:%d: unknown parent %q of %s::%s",
+			d.module.file, d.object.line, d.object.oid[0].name, d.module.name, d.object.name))
+	}
+}
+
+// define adds the object to the tree, it returns false if the first
+// component of the OID is not known yet.
+func (t *Tree) define(m *module, o *object) bool {
+	first := o.oid[0]
+
+	var n *Node
+	switch {
+	case first.hasNumber:
+		n = t.root.child(first.number)
+		t.name(m, n, first.name)
+	default:
+		n = t.lookupName(m, first.name)
+		if n == nil {
+			return false
+		}
+	}
+
+	for _, c := range o.oid[1:] {
+		if !c.hasNumber {
+			t.Warnings = append(t.Warnings, fmt.Errorf("%s:%d: invalid OID of %s::%s",
+				m.file, o.line, m.name, o.name))
+			return true
+		}
+		n = n.child(c.number)
+		t.name(m, n, c.name)
+	}
+
+	t.name(m, n, o.name)
+	if n.Name == o.name && n.module == nil {
+		n.Module = m.name
+		n.Syntax = o.syntax
+		n.Access = o.access
+		n.Index = o.index
+		n.augments = o.augments
+		n.module = m
+	}
+	return true
+}
+
+// name names the node unless it already has a name, the name is registered
+// in the module either way.
+func (t *Tree) name(m *module, n *Node, name string) {
+	if name == "" {
+		return
+	}
+	if n.Name == "" {
+		n.Name = name
+		n.Module = m.name
+	}
+	t.register(m.name, name, n)
+}
+
+func (t *Tree) register(module, name string, n *Node) {
+	if _, ok := t.byName[name]; !ok {
+		t.byName[name] = n
+	}
+	if t.byModule[module] == nil {
+		t.byModule[module] = make(map[string]*Node)
+	}
+	if _, ok := t.byModule[module][name]; !ok {
+		t.byModule[module][name] = n
+	}
+}
+
+// lookupName finds the node of a name used in the module, looking at the
+// imports first.
+func (t *Tree) lookupName(m *module, name string) *Node {
+	if from, ok := m.imports[name]; ok {
+		if n, ok := t.byModule[from][name]; ok {
+			return n
+		}
+	}
+	if n, ok := t.byModule[m.name][name]; ok {
+		return n
+	}
+	return t.byName[name]
+}
+
+func (t *Tree) lookupType(m *module, name string) *typeDef {
+	if from, ok := m.imports[name]; ok {
+		if fm, ok := t.modules[from]; ok {
+			if td, ok := fm.types[name]; ok {
+				return td
+			}
+		}
+	}
+	if td, ok := m.types[name]; ok {
+		return td
+	}
+
+	modules := make([]string, 0, len(t.modules))
+	for name := range t.modules {
+		modules = append(modules, name)
+	}
+	sort.Strings(modules)
+	for _, mn := range modules {
+		if td, ok := t.modules[mn].types[name]; ok {
+			return td
+		}
+	}
+	return nil
+}
+
+// Lookup resolves a numeric or symbolic OID to the deepest named node and
+// the remaining sub-identifiers.  The node has no module when only a well
+// known node matched.  Symbolic OIDs are either a name or
+// MODULE::name, both optionally followed by sub-identifiers.  For example
+// ".1.3.6.1.2.1.2.2.1.2.3" and "IF-MIB::ifDescr.3" both resolve to ifDescr
+// and ".3".
+func (t *Tree) Lookup(oid string) (*Node, string, error) {
+	var n *Node
+	var rest string
+
+	if i := strings.Index(oid, "::"); i != -1 {
+		name := oid[i+2:]
+		if j := strings.IndexByte(name, '.'); j != -1 {
+			name, rest = name[:j], name[j+1:]
+		}
+		n = t.byModule[oid[:i]][name]
+	} else {
+		oid = strings.TrimPrefix(oid, ".")
+		name := oid
+		if j := strings.IndexByte(oid, '.'); j != -1 {
+			name, rest = oid[:j], oid[j+1:]
+		}
+		if isNumber(name) {
+			n, rest = t.root, oid
+		} else {
+			n = t.byName[name]
+		}
+	}
+	if n == nil {
+		return nil, "", fmt.Errorf("unknown OID %q", oid)
+	}
+
+	var subids []string
+	if rest != "" {
+		subids = strings.Split(rest, ".")
+	}
+
+	// Walk down the tree as far as the nodes exist, remembering the deepest
+	// named node.
+	named, suffix := n, subids
+	for i, s := range subids {
+		subid, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid OID %q", oid)
+		}
+		c, ok := n.children[subid]
+		if !ok {
+			break
+		}
+		n = c
+		if n.Name != "" {
+			named, suffix = n, subids[i+1:]
+		}
+	}
+	if named.Name == "" {
+		return nil, "", fmt.Errorf("unknown OID %q", oid)
+	}
+
+	if len(suffix) == 0 {
+		return named, "", nil
+	}
+	return named, "." + strings.Join(suffix, "."), nil
+}
+
+// TextualConventions returns the textual conventions the syntax of the
+// node is derived from, starting with the one used in the object type.
+func (t *Tree) TextualConventions(n *Node) []string {
+	var tcs []string
+	m, name := n.module, n.Syntax
+	// Bound the depth in case of circular definitions.
+	for i := 0; m != nil && i < 16; i++ {
+		td := t.lookupType(m, name)
+		if td == nil {
+			break
+		}
+		if td.tc {
+			tcs = append(tcs, td.name)
+		}
+		m, name = td.module, td.syntax
+	}
+	return tcs
+}
+
+// Columns returns the accessible columns of a table and the names of the
+// objects indexing its rows.  The node is either the table or its entry.
+func (t *Tree) Columns(n *Node) ([]*Node, []string, error) {
+	entry := n
+	if strings.HasPrefix(n.Syntax, "SEQUENCE OF ") {
+		entry = nil
+		for _, c := range n.sortedChildren() {
+			if c.Name != "" {
+				entry = c
+				break
+			}
+		}
+		if entry == nil {
+			return nil, nil, fmt.Errorf("table %s has no entry", n.Name)
+		}
+	}
+
+	index := entry.Index
+	// An entry augmenting another shares its index.
+	for base, i := entry, 0; base.augments != "" && index == nil && i < 16; i++ {
+		augmented := t.lookupName(base.module, base.augments)
+		if augmented == nil {
+			return nil, nil, fmt.Errorf("unknown entry %q augmented by %s", base.augments, base.Name)
+		}
+		index = augmented.Index
+		base = augmented
+	}
+
+	var columns []*Node
+	for _, c := range entry.sortedChildren() {
+		if c.Name == "" || c.Access == "not-accessible" || c.Access == "accessible-for-notify" {
+			continue
+		}
+		columns = append(columns, c)
+	}
+	if len(columns) == 0 {
+		return nil, nil, fmt.Errorf("could not find any columns in table %s", n.Name)
+	}
+	return columns, index, nil
+}
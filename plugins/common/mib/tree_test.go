@@ -0,0 +1,127 @@
+package mib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func loadTestdata(t *testing.T) *Tree {
+	tree, err := LoadDirs([]string{"testdata"})
+	require.NoError(t, err)
+	require.Empty(t, tree.Warnings)
+	return tree
+}
+
+func TestLookup(t *testing.T) {
+	tree := loadTestdata(t)
+
+	tests := []struct {
+		oid    string
+		module string
+		name   string
+		num    string
+		suffix string
+	}{
+		{".1.3.6.1.4.1.99999.1.1", "TEST-MIB", "testName", ".1.3.6.1.4.1.99999.1.1", ""},
+		{"1.3.6.1.4.1.99999.1.1.0", "TEST-MIB", "testName", ".1.3.6.1.4.1.99999.1.1", ".0"},
+		{".1.3.6.1.4.1.99999.1.2.1.3.7", "TEST-MIB", "testPortAddress", ".1.3.6.1.4.1.99999.1.2.1.3", ".7"},
+		{".1.3.6.1.4.1.99999.42.1", "TEST-MIB", "testMIB", ".1.3.6.1.4.1.99999", ".42.1"},
+		{"TEST-MIB::testName", "TEST-MIB", "testName", ".1.3.6.1.4.1.99999.1.1", ""},
+		{"TEST-MIB::testPortName.1.2", "TEST-MIB", "testPortName", ".1.3.6.1.4.1.99999.1.2.1.2", ".1.2"},
+		{"testPortTable", "TEST-MIB", "testPortTable", ".1.3.6.1.4.1.99999.1.2", ""},
+		{".enterprises.99999.1.1", "TEST-MIB", "testName", ".1.3.6.1.4.1.99999.1.1", ""},
+		{".1.3.6.1.4.1.99999.0.1", "TEST-MIB", "testPortDown", ".1.3.6.1.4.1.99999.0.1", ""},
+		{".1.3.6.1.4.1.99998.0.3", "TEST-V1-MIB", "legacyFailure", ".1.3.6.1.4.1.99998.0.3", ""},
+		{".1.3.6.1.2.1", "", "mib-2", ".1.3.6.1.2.1", ""},
+		{".1.2.3", "", "iso", ".1", ".2.3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.oid, func(t *testing.T) {
+			n, suffix, err := tree.Lookup(tt.oid)
+			require.NoError(t, err)
+			require.Equal(t, tt.module, n.Module)
+			require.Equal(t, tt.name, n.Name)
+			require.Equal(t, tt.num, n.Oid)
+			require.Equal(t, tt.suffix, suffix)
+		})
+	}
+}
+
+func TestLookupUnknown(t *testing.T) {
+	tree := loadTestdata(t)
+
+	for _, oid := range []string{".999", "TEST-MIB::nothing", "nothing.1", "OTHER-MIB::testName", ".1.3.x"} {
+		_, _, err := tree.Lookup(oid)
+		require.Error(t, err, oid)
+	}
+}
+
+func TestTextualConventions(t *testing.T) {
+	tree := loadTestdata(t)
+
+	n, _, err := tree.Lookup("TEST-MIB::testPortAddress")
+	require.NoError(t, err)
+	require.Equal(t, []string{"TestAddress", "PhysAddress"}, tree.TextualConventions(n))
+
+	n, _, err = tree.Lookup("TEST-MIB::testPortInOctets")
+	require.NoError(t, err)
+	require.Empty(t, tree.TextualConventions(n))
+}
+
+func TestColumns(t *testing.T) {
+	tree := loadTestdata(t)
+
+	names := func(nodes []*Node) []string {
+		var s []string
+		for _, n := range nodes {
+			s = append(s, n.Name)
+		}
+		return s
+	}
+
+	n, _, err := tree.Lookup("TEST-MIB::testPortTable")
+	require.NoError(t, err)
+	columns, index, err := tree.Columns(n)
+	require.NoError(t, err)
+	require.Equal(t, []string{"testPortName", "testPortAddress", "testPortEnabled", "testPortInOctets"}, names(columns))
+	require.Equal(t, []string{"testPortIndex", "testPortName"}, index)
+
+	n, _, err = tree.Lookup("TEST-MIB::testPortStatsEntry")
+	require.NoError(t, err)
+	columns, index, err = tree.Columns(n)
+	require.NoError(t, err)
+	require.Equal(t, []string{"testPortErrors"}, names(columns))
+	require.Equal(t, []string{"testPortIndex", "testPortName"}, index)
+
+	n, _, err = tree.Lookup("TEST-MIB::testName")
+	require.NoError(t, err)
+	_, _, err = tree.Columns(n)
+	require.Error(t, err)
+}
+
+func TestLoadDirsCached(t *testing.T) {
+	a, err := LoadDirs([]string{"testdata"})
+	require.NoError(t, err)
+	b, err := LoadDirs([]string{"testdata"})
+	require.NoError(t, err)
+	require.True(t, a == b)
+
+	_, err = LoadDirs([]string{"testdata/missing"})
+	require.Error(t, err)
+}
+
+func TestUnresolvedParent(t *testing.T) {
+	tree := NewTree()
+	modules, err := parse("broken.mib", []byte(`
+BROKEN-MIB DEFINITIONS ::= BEGIN
+orphan OBJECT IDENTIFIER ::= { unknownParent 1 }
+END
+`))
+	require.NoError(t, err)
+	tree.modules[modules[0].name] = modules[0]
+	tree.resolve()
+
+	require.Len(t, tree.Warnings, 1)
+	require.Contains(t, tree.Warnings[0].Error(), `unknown parent "unknownParent" of BROKEN-MIB::orphan`)
+}
@@ -0,0 +1,615 @@
+// Package otlp implements the subset of the OpenTelemetry protocol (OTLP)
+// needed to exchange metrics.  The messages follow the field numbers of the
+// opentelemetry/proto/metrics/v1 and collector/metrics/v1 definitions.
+package otlp
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/influxdata/telegraf/plugins/common/protowire"
+)
+
+// AggregationTemporality defines how a metric aggregator reports aggregated
+// values.
+type AggregationTemporality int32
+
+const (
+	AggregationTemporalityUnspecified AggregationTemporality = 0
+	AggregationTemporalityDelta       AggregationTemporality = 1
+	AggregationTemporalityCumulative  AggregationTemporality = 2
+)
+
+// ExportMetricsServiceRequest is sent by clients to the metrics service.
+type ExportMetricsServiceRequest struct {
+	ResourceMetrics []*ResourceMetrics
+}
+
+// ExportMetricsServiceResponse is returned by the metrics service.  When
+// part of the data was rejected RejectedDataPoints is set.
+type ExportMetricsServiceResponse struct {
+	RejectedDataPoints int64
+	ErrorMessage       string
+}
+
+type ResourceMetrics struct {
+	Resource     Resource
+	ScopeMetrics []*ScopeMetrics
+}
+
+type Resource struct {
+	Attributes []KeyValue
+}
+
+type ScopeMetrics struct {
+	Scope   InstrumentationScope
+	Metrics []*Metric
+}
+
+type InstrumentationScope struct {
+	Name    string
+	Version string
+}
+
+// Metric holds the data points of a single metric, exactly one of Gauge, Sum,
+// Histogram or Summary is set.
+type Metric struct {
+	Name        string
+	Description string
+	Unit        string
+	Gauge       *Gauge
+	Sum         *Sum
+	Histogram   *Histogram
+	Summary     *Summary
+}
+
+type Gauge struct {
+	DataPoints []*NumberDataPoint
+}
+
+type Sum struct {
+	DataPoints             []*NumberDataPoint
+	AggregationTemporality AggregationTemporality
+	IsMonotonic            bool
+}
+
+type Histogram struct {
+	DataPoints             []*HistogramDataPoint
+	AggregationTemporality AggregationTemporality
+}
+
+type Summary struct {
+	DataPoints []*SummaryDataPoint
+}
+
+// NumberDataPoint is a single gauge or sum value, Value is either an int64 or
+// a float64.
+type NumberDataPoint struct {
+	Attributes        []KeyValue
+	StartTimeUnixNano uint64
+	TimeUnixNano      uint64
+	Value             interface{}
+}
+
+// HistogramDataPoint holds the bucket counts of a histogram.  BucketCounts
+// has one more element than ExplicitBounds, the last bucket counts the values
+// above the highest bound.  The counts are not cumulative.
+type HistogramDataPoint struct {
+	Attributes        []KeyValue
+	StartTimeUnixNano uint64
+	TimeUnixNano      uint64
+	Count             uint64
+	Sum               float64
+	BucketCounts      []uint64
+	ExplicitBounds    []float64
+}
+
+type SummaryDataPoint struct {
+	Attributes        []KeyValue
+	StartTimeUnixNano uint64
+	TimeUnixNano      uint64
+	Count             uint64
+	Sum               float64
+	QuantileValues    []ValueAtQuantile
+}
+
+type ValueAtQuantile struct {
+	Quantile float64
+	Value    float64
+}
+
+// KeyValue is an attribute, Value is a string, bool, int64, float64 or
+// []byte.  Array and key-value list values are not supported and decoded
+// as nil.
+type KeyValue struct {
+	Key   string
+	Value interface{}
+}
+
+// Reset, String and ProtoMessage implement the proto.Message interface
+// required by gRPC, Marshal and Unmarshal are used for the encoding.
+
+func (r *ExportMetricsServiceRequest) Reset()         { *r = ExportMetricsServiceRequest{} }
+func (r *ExportMetricsServiceRequest) String() string { return fmt.Sprintf("%+v", *r) }
+func (r *ExportMetricsServiceRequest) ProtoMessage()  {}
+
+func (r *ExportMetricsServiceResponse) Reset()         { *r = ExportMetricsServiceResponse{} }
+func (r *ExportMetricsServiceResponse) String() string { return fmt.Sprintf("%+v", *r) }
+func (r *ExportMetricsServiceResponse) ProtoMessage()  {}
+
+// Marshal encodes the request in the protocol buffer wire format.
+func (r *ExportMetricsServiceRequest) Marshal() ([]byte, error) {
+	var b []byte
+	for _, rm := range r.ResourceMetrics {
+		b = protowire.AppendBytesField(b, 1, rm.marshal())
+	}
+	return b, nil
+}
+
+// Unmarshal decodes a request from the protocol buffer wire format.
+func (r *ExportMetricsServiceRequest) Unmarshal(buf []byte) error {
+	r.Reset()
+	return protowire.DecodeFields(buf, func(d *protowire.Decoder, num, wire int) (bool, error) {
+		if num != 1 {
+			return false, nil
+		}
+		rm := &ResourceMetrics{}
+		r.ResourceMetrics = append(r.ResourceMetrics, rm)
+		return true, protowire.DecodeMessage(d, wire, rm.unmarshal)
+	})
+}
+
+func (r *ExportMetricsServiceResponse) Marshal() ([]byte, error) {
+	if r.RejectedDataPoints == 0 && r.ErrorMessage == "" {
+		return nil, nil
+	}
+	var partial []byte
+	if r.RejectedDataPoints != 0 {
+		partial = protowire.AppendUvarintField(partial, 1, uint64(r.RejectedDataPoints))
+	}
+	if r.ErrorMessage != "" {
+		partial = protowire.AppendStringField(partial, 2, r.ErrorMessage)
+	}
+	return protowire.AppendBytesField(nil, 1, partial), nil
+}
+
+func (r *ExportMetricsServiceResponse) Unmarshal(buf []byte) error {
+	r.Reset()
+	return protowire.DecodeFields(buf, func(d *protowire.Decoder, num, wire int) (bool, error) {
+		if num != 1 || wire != protowire.BytesType {
+			return false, nil
+		}
+		msg, err := d.Bytes()
+		if err != nil {
+			return true, err
+		}
+		return true, protowire.DecodeFields(msg, func(d *protowire.Decoder, num, wire int) (bool, error) {
+			var err error
+			switch {
+			case num == 1 && wire == protowire.VarintType:
+				var v uint64
+				v, err = d.Varint()
+				r.RejectedDataPoints = int64(v)
+			case num == 2 && wire == protowire.BytesType:
+				r.ErrorMessage, err = d.String()
+			default:
+				return false, nil
+			}
+			return true, err
+		})
+	})
+}
+
+func (rm *ResourceMetrics) marshal() []byte {
+	b := protowire.AppendBytesField(nil, 1, rm.Resource.marshal())
+	for _, sm := range rm.ScopeMetrics {
+		b = protowire.AppendBytesField(b, 2, sm.marshal())
+	}
+	return b
+}
+
+func (rm *ResourceMetrics) unmarshal(buf []byte) error {
+	return protowire.DecodeFields(buf, func(d *protowire.Decoder, num, wire int) (bool, error) {
+		switch num {
+		case 1:
+			return true, protowire.DecodeMessage(d, wire, rm.Resource.unmarshal)
+		case 2:
+			sm := &ScopeMetrics{}
+			rm.ScopeMetrics = append(rm.ScopeMetrics, sm)
+			return true, protowire.DecodeMessage(d, wire, sm.unmarshal)
+		}
+		return false, nil
+	})
+}
+
+func (r *Resource) marshal() []byte {
+	return appendAttributes(nil, 1, r.Attributes)
+}
+
+func (r *Resource) unmarshal(buf []byte) error {
+	return protowire.DecodeFields(buf, func(d *protowire.Decoder, num, wire int) (bool, error) {
+		if num != 1 {
+			return false, nil
+		}
+		return true, decodeAttribute(d, wire, &r.Attributes)
+	})
+}
+
+func (sm *ScopeMetrics) marshal() []byte {
+	var scope []byte
+	if sm.Scope.Name != "" {
+		scope = protowire.AppendStringField(scope, 1, sm.Scope.Name)
+	}
+	if sm.Scope.Version != "" {
+		scope = protowire.AppendStringField(scope, 2, sm.Scope.Version)
+	}
+	b := protowire.AppendBytesField(nil, 1, scope)
+	for _, m := range sm.Metrics {
+		b = protowire.AppendBytesField(b, 2, m.marshal())
+	}
+	return b
+}
+
+func (sm *ScopeMetrics) unmarshal(buf []byte) error {
+	return protowire.DecodeFields(buf, func(d *protowire.Decoder, num, wire int) (bool, error) {
+		switch num {
+		case 1:
+			return true, protowire.DecodeMessage(d, wire, func(msg []byte) error {
+				return protowire.DecodeFields(msg, func(d *protowire.Decoder, num, wire int) (bool, error) {
+					var err error
+					switch {
+					case num == 1 && wire == protowire.BytesType:
+						sm.Scope.Name, err = d.String()
+					case num == 2 && wire == protowire.BytesType:
+						sm.Scope.Version, err = d.String()
+					default:
+						return false, nil
+					}
+					return true, err
+				})
+			})
+		case 2:
+			m := &Metric{}
+			sm.Metrics = append(sm.Metrics, m)
+			return true, protowire.DecodeMessage(d, wire, m.unmarshal)
+		}
+		return false, nil
+	})
+}
+
+func (m *Metric) marshal() []byte {
+	var b []byte
+	b = protowire.AppendStringField(b, 1, m.Name)
+	if m.Description != "" {
+		b = protowire.AppendStringField(b, 2, m.Description)
+	}
+	if m.Unit != "" {
+		b = protowire.AppendStringField(b, 3, m.Unit)
+	}
+
+	switch {
+	case m.Gauge != nil:
+		var data []byte
+		for _, dp := range m.Gauge.DataPoints {
+			data = protowire.AppendBytesField(data, 1, dp.marshal())
+		}
+		b = protowire.AppendBytesField(b, 5, data)
+	case m.Sum != nil:
+		var data []byte
+		for _, dp := range m.Sum.DataPoints {
+			data = protowire.AppendBytesField(data, 1, dp.marshal())
+		}
+		if m.Sum.AggregationTemporality != AggregationTemporalityUnspecified {
+			data = protowire.AppendUvarintField(data, 2, uint64(m.Sum.AggregationTemporality))
+		}
+		if m.Sum.IsMonotonic {
+			data = protowire.AppendUvarintField(data, 3, 1)
+		}
+		b = protowire.AppendBytesField(b, 7, data)
+	case m.Histogram != nil:
+		var data []byte
+		for _, dp := range m.Histogram.DataPoints {
+			data = protowire.AppendBytesField(data, 1, dp.marshal())
+		}
+		if m.Histogram.AggregationTemporality != AggregationTemporalityUnspecified {
+			data = protowire.AppendUvarintField(data, 2, uint64(m.Histogram.AggregationTemporality))
+		}
+		b = protowire.AppendBytesField(b, 9, data)
+	case m.Summary != nil:
+		var data []byte
+		for _, dp := range m.Summary.DataPoints {
+			data = protowire.AppendBytesField(data, 1, dp.marshal())
+		}
+		b = protowire.AppendBytesField(b, 11, data)
+	}
+	return b
+}
+
+func (m *Metric) unmarshal(buf []byte) error {
+	return protowire.DecodeFields(buf, func(d *protowire.Decoder, num, wire int) (bool, error) {
+		var err error
+		switch num {
+		case 1:
+			m.Name, err = d.String()
+		case 2:
+			m.Description, err = d.String()
+		case 3:
+			m.Unit, err = d.String()
+		case 5:
+			m.Gauge = &Gauge{}
+			err = protowire.DecodeMessage(d, wire, func(msg []byte) error {
+				return protowire.DecodeFields(msg, func(d *protowire.Decoder, num, wire int) (bool, error) {
+					if num != 1 {
+						return false, nil
+					}
+					dp := &NumberDataPoint{}
+					m.Gauge.DataPoints = append(m.Gauge.DataPoints, dp)
+					return true, protowire.DecodeMessage(d, wire, dp.unmarshal)
+				})
+			})
+		case 7:
+			m.Sum = &Sum{}
+			err = protowire.DecodeMessage(d, wire, func(msg []byte) error {
+				return protowire.DecodeFields(msg, func(d *protowire.Decoder, num, wire int) (bool, error) {
+					var err error
+					switch num {
+					case 1:
+						dp := &NumberDataPoint{}
+						m.Sum.DataPoints = append(m.Sum.DataPoints, dp)
+						err = protowire.DecodeMessage(d, wire, dp.unmarshal)
+					case 2:
+						var v uint64
+						v, err = d.Varint()
+						m.Sum.AggregationTemporality = AggregationTemporality(v)
+					case 3:
+						var v uint64
+						v, err = d.Varint()
+						m.Sum.IsMonotonic = v != 0
+					default:
+						return false, nil
+					}
+					return true, err
+				})
+			})
+		case 9:
+			m.Histogram = &Histogram{}
+			err = protowire.DecodeMessage(d, wire, func(msg []byte) error {
+				return protowire.DecodeFields(msg, func(d *protowire.Decoder, num, wire int) (bool, error) {
+					var err error
+					switch num {
+					case 1:
+						dp := &HistogramDataPoint{}
+						m.Histogram.DataPoints = append(m.Histogram.DataPoints, dp)
+						err = protowire.DecodeMessage(d, wire, dp.unmarshal)
+					case 2:
+						var v uint64
+						v, err = d.Varint()
+						m.Histogram.AggregationTemporality = AggregationTemporality(v)
+					default:
+						return false, nil
+					}
+					return true, err
+				})
+			})
+		case 11:
+			m.Summary = &Summary{}
+			err = protowire.DecodeMessage(d, wire, func(msg []byte) error {
+				return protowire.DecodeFields(msg, func(d *protowire.Decoder, num, wire int) (bool, error) {
+					if num != 1 {
+						return false, nil
+					}
+					dp := &SummaryDataPoint{}
+					m.Summary.DataPoints = append(m.Summary.DataPoints, dp)
+					return true, protowire.DecodeMessage(d, wire, dp.unmarshal)
+				})
+			})
+		default:
+			return false, nil
+		}
+		return true, err
+	})
+}
+
+func (dp *NumberDataPoint) marshal() []byte {
+	var b []byte
+	if dp.StartTimeUnixNano != 0 {
+		b = protowire.AppendFixed64Field(b, 2, dp.StartTimeUnixNano)
+	}
+	b = protowire.AppendFixed64Field(b, 3, dp.TimeUnixNano)
+	switch v := dp.Value.(type) {
+	case float64:
+		b = protowire.AppendDoubleField(b, 4, v)
+	case int64:
+		b = protowire.AppendFixed64Field(b, 6, uint64(v))
+	}
+	return appendAttributes(b, 7, dp.Attributes)
+}
+
+func (dp *NumberDataPoint) unmarshal(buf []byte) error {
+	return protowire.DecodeFields(buf, func(d *protowire.Decoder, num, wire int) (bool, error) {
+		var err error
+		switch num {
+		case 2:
+			dp.StartTimeUnixNano, err = d.Fixed64()
+		case 3:
+			dp.TimeUnixNano, err = d.Fixed64()
+		case 4:
+			dp.Value, err = d.Double()
+		case 6:
+			var v uint64
+			v, err = d.Fixed64()
+			dp.Value = int64(v)
+		case 7:
+			err = decodeAttribute(d, wire, &dp.Attributes)
+		default:
+			return false, nil
+		}
+		return true, err
+	})
+}
+
+func (dp *HistogramDataPoint) marshal() []byte {
+	var b []byte
+	if dp.StartTimeUnixNano != 0 {
+		b = protowire.AppendFixed64Field(b, 2, dp.StartTimeUnixNano)
+	}
+	b = protowire.AppendFixed64Field(b, 3, dp.TimeUnixNano)
+	b = protowire.AppendFixed64Field(b, 4, dp.Count)
+	b = protowire.AppendDoubleField(b, 5, dp.Sum)
+	b = protowire.AppendPackedFixed64(b, 6, dp.BucketCounts)
+	b = protowire.AppendPackedDouble(b, 7, dp.ExplicitBounds)
+	return appendAttributes(b, 9, dp.Attributes)
+}
+
+func (dp *HistogramDataPoint) unmarshal(buf []byte) error {
+	return protowire.DecodeFields(buf, func(d *protowire.Decoder, num, wire int) (bool, error) {
+		var err error
+		switch num {
+		case 2:
+			dp.StartTimeUnixNano, err = d.Fixed64()
+		case 3:
+			dp.TimeUnixNano, err = d.Fixed64()
+		case 4:
+			dp.Count, err = d.Fixed64()
+		case 5:
+			dp.Sum, err = d.Double()
+		case 6:
+			dp.BucketCounts, err = d.Fixed64s(wire, dp.BucketCounts)
+		case 7:
+			dp.ExplicitBounds, err = d.Doubles(wire, dp.ExplicitBounds)
+		case 9:
+			err = decodeAttribute(d, wire, &dp.Attributes)
+		default:
+			return false, nil
+		}
+		return true, err
+	})
+}
+
+func (dp *SummaryDataPoint) marshal() []byte {
+	var b []byte
+	if dp.StartTimeUnixNano != 0 {
+		b = protowire.AppendFixed64Field(b, 2, dp.StartTimeUnixNano)
+	}
+	b = protowire.AppendFixed64Field(b, 3, dp.TimeUnixNano)
+	b = protowire.AppendFixed64Field(b, 4, dp.Count)
+	b = protowire.AppendDoubleField(b, 5, dp.Sum)
+	for _, q := range dp.QuantileValues {
+		var qv []byte
+		qv = protowire.AppendDoubleField(qv, 1, q.Quantile)
+		qv = protowire.AppendDoubleField(qv, 2, q.Value)
+		b = protowire.AppendBytesField(b, 6, qv)
+	}
+	return appendAttributes(b, 7, dp.Attributes)
+}
+
+func (dp *SummaryDataPoint) unmarshal(buf []byte) error {
+	return protowire.DecodeFields(buf, func(d *protowire.Decoder, num, wire int) (bool, error) {
+		var err error
+		switch num {
+		case 2:
+			dp.StartTimeUnixNano, err = d.Fixed64()
+		case 3:
+			dp.TimeUnixNano, err = d.Fixed64()
+		case 4:
+			dp.Count, err = d.Fixed64()
+		case 5:
+			dp.Sum, err = d.Double()
+		case 6:
+			var q ValueAtQuantile
+			err = protowire.DecodeMessage(d, wire, func(msg []byte) error {
+				return protowire.DecodeFields(msg, func(d *protowire.Decoder, num, wire int) (bool, error) {
+					var err error
+					switch num {
+					case 1:
+						q.Quantile, err = d.Double()
+					case 2:
+						q.Value, err = d.Double()
+					default:
+						return false, nil
+					}
+					return true, err
+				})
+			})
+			dp.QuantileValues = append(dp.QuantileValues, q)
+		case 7:
+			err = decodeAttribute(d, wire, &dp.Attributes)
+		default:
+			return false, nil
+		}
+		return true, err
+	})
+}
+
+func appendAttributes(b []byte, num int, attributes []KeyValue) []byte {
+	for _, kv := range attributes {
+		var value []byte
+		switch v := kv.Value.(type) {
+		case string:
+			value = protowire.AppendStringField(value, 1, v)
+		case bool:
+			if v {
+				value = protowire.AppendUvarintField(value, 2, 1)
+			} else {
+				value = protowire.AppendUvarintField(value, 2, 0)
+			}
+		case int64:
+			value = protowire.AppendUvarintField(value, 3, uint64(v))
+		case float64:
+			value = protowire.AppendDoubleField(value, 4, v)
+		case []byte:
+			value = protowire.AppendBytesField(value, 7, v)
+		}
+
+		var attr []byte
+		attr = protowire.AppendStringField(attr, 1, kv.Key)
+		attr = protowire.AppendBytesField(attr, 2, value)
+		b = protowire.AppendBytesField(b, num, attr)
+	}
+	return b
+}
+
+func decodeAttribute(d *protowire.Decoder, wire int, attributes *[]KeyValue) error {
+	var kv KeyValue
+	err := protowire.DecodeMessage(d, wire, func(msg []byte) error {
+		return protowire.DecodeFields(msg, func(d *protowire.Decoder, num, wire int) (bool, error) {
+			var err error
+			switch num {
+			case 1:
+				kv.Key, err = d.String()
+			case 2:
+				err = protowire.DecodeMessage(d, wire, func(msg []byte) error {
+					return protowire.DecodeFields(msg, func(d *protowire.Decoder, num, wire int) (bool, error) {
+						var err error
+						var v uint64
+						switch num {
+						case 1:
+							kv.Value, err = d.String()
+						case 2:
+							v, err = d.Varint()
+							kv.Value = v != 0
+						case 3:
+							v, err = d.Varint()
+							kv.Value = int64(v)
+						case 4:
+							v, err = d.Fixed64()
+							kv.Value = math.Float64frombits(v)
+						case 7:
+							var raw []byte
+							raw, err = d.Bytes()
+							kv.Value = append([]byte{}, raw...)
+						default:
+							return false, nil
+						}
+						return true, err
+					})
+				})
+			default:
+				return false, nil
+			}
+			return true, err
+		})
+	})
+	*attributes = append(*attributes, kv)
+	return err
+}
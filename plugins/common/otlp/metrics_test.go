@@ -0,0 +1,148 @@
+package otlp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestRoundTrip(t *testing.T) {
+	req := &ExportMetricsServiceRequest{
+		ResourceMetrics: []*ResourceMetrics{
+			{
+				Resource: Resource{
+					Attributes: []KeyValue{
+						{Key: "host", Value: "server01"},
+						{Key: "pid", Value: int64(-42)},
+						{Key: "ratio", Value: 0.5},
+						{Key: "enabled", Value: true},
+						{Key: "raw", Value: []byte{0x01, 0x02}},
+					},
+				},
+				ScopeMetrics: []*ScopeMetrics{
+					{
+						Scope: InstrumentationScope{Name: "telegraf", Version: "1.14"},
+						Metrics: []*Metric{
+							{
+								Name: "cpu_usage",
+								Unit: "%",
+								Gauge: &Gauge{
+									DataPoints: []*NumberDataPoint{
+										{
+											Attributes:   []KeyValue{{Key: "cpu", Value: "cpu0"}},
+											TimeUnixNano: 1577836800000000000,
+											Value:        0.0,
+										},
+									},
+								},
+							},
+							{
+								Name:        "requests",
+								Description: "Total requests",
+								Sum: &Sum{
+									DataPoints: []*NumberDataPoint{
+										{
+											StartTimeUnixNano: 1577836700000000000,
+											TimeUnixNano:      1577836800000000000,
+											Value:             int64(42),
+										},
+									},
+									AggregationTemporality: AggregationTemporalityCumulative,
+									IsMonotonic:            true,
+								},
+							},
+							{
+								Name: "latency",
+								Histogram: &Histogram{
+									DataPoints: []*HistogramDataPoint{
+										{
+											TimeUnixNano:   1577836800000000000,
+											Count:          6,
+											Sum:            12.5,
+											BucketCounts:   []uint64{1, 2, 3},
+											ExplicitBounds: []float64{0.5, 1},
+										},
+									},
+									AggregationTemporality: AggregationTemporalityCumulative,
+								},
+							},
+							{
+								Name: "response_size",
+								Summary: &Summary{
+									DataPoints: []*SummaryDataPoint{
+										{
+											TimeUnixNano: 1577836800000000000,
+											Count:        3,
+											Sum:          300,
+											QuantileValues: []ValueAtQuantile{
+												{Quantile: 0.5, Value: 100},
+												{Quantile: 0.99, Value: 180},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	buf, err := req.Marshal()
+	require.NoError(t, err)
+
+	actual := &ExportMetricsServiceRequest{}
+	require.NoError(t, actual.Unmarshal(buf))
+	require.Equal(t, req, actual)
+}
+
+func TestGaugeEncoding(t *testing.T) {
+	m := &Metric{
+		Name: "a",
+		Gauge: &Gauge{
+			DataPoints: []*NumberDataPoint{
+				{TimeUnixNano: 1, Value: int64(2)},
+			},
+		},
+	}
+	expected := []byte{
+		0x0a, 0x01, 'a', // name
+		0x2a, 0x14, // gauge
+		0x0a, 0x12, // data_points
+		0x19, 0x01, 0, 0, 0, 0, 0, 0, 0, // time_unix_nano
+		0x31, 0x02, 0, 0, 0, 0, 0, 0, 0, // as_int
+	}
+	require.Equal(t, expected, m.marshal())
+}
+
+func TestUnknownFieldsAreSkipped(t *testing.T) {
+	// A metric with an unknown varint field 20, an unknown fixed32 field 21
+	// and the name field.
+	buf := []byte{
+		0xa0, 0x01, 0x05,
+		0xad, 0x01, 0x01, 0x02, 0x03, 0x04,
+		0x0a, 0x01, 'a',
+	}
+	m := &Metric{}
+	require.NoError(t, m.unmarshal(buf))
+	require.Equal(t, &Metric{Name: "a"}, m)
+}
+
+func TestTruncatedMessage(t *testing.T) {
+	req := &ExportMetricsServiceRequest{}
+	require.Error(t, req.Unmarshal([]byte{0x0a, 0x05, 0x01}))
+}
+
+func TestResponseRoundTrip(t *testing.T) {
+	resp := &ExportMetricsServiceResponse{
+		RejectedDataPoints: 3,
+		ErrorMessage:       "invalid",
+	}
+	buf, err := resp.Marshal()
+	require.NoError(t, err)
+
+	actual := &ExportMetricsServiceResponse{}
+	require.NoError(t, actual.Unmarshal(buf))
+	require.Equal(t, resp, actual)
+}
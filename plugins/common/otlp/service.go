@@ -0,0 +1,69 @@
+package otlp
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+const (
+	// ExportMethod is the full gRPC method name of the metrics export call.
+	ExportMethod = "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"
+
+	// HTTPPath is the default path of the OTLP/HTTP metrics endpoint.
+	HTTPPath = "/v1/metrics"
+
+	// ContentType is the content type of protobuf encoded OTLP/HTTP requests.
+	ContentType = "application/x-protobuf"
+)
+
+// MetricsServiceServer is implemented by receivers of OTLP metrics.
+type MetricsServiceServer interface {
+	Export(context.Context, *ExportMetricsServiceRequest) (*ExportMetricsServiceResponse, error)
+}
+
+// RegisterMetricsServiceServer registers the metrics service on the gRPC
+// server.
+func RegisterMetricsServiceServer(s *grpc.Server, srv MetricsServiceServer) {
+	s.RegisterService(&metricsServiceDesc, srv)
+}
+
+// Export sends the request to the metrics service of the connection.
+func Export(ctx context.Context, conn *grpc.ClientConn, req *ExportMetricsServiceRequest, opts ...grpc.CallOption) (*ExportMetricsServiceResponse, error) {
+	resp := &ExportMetricsServiceResponse{}
+	if err := conn.Invoke(ctx, ExportMethod, req, resp, opts...); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func exportHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	req := &ExportMetricsServiceRequest{}
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServiceServer).Export(ctx, req)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ExportMethod,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServiceServer).Export(ctx, req.(*ExportMetricsServiceRequest))
+	}
+	return interceptor(ctx, req, info, handler)
+}
+
+var metricsServiceDesc = grpc.ServiceDesc{
+	ServiceName: "opentelemetry.proto.collector.metrics.v1.MetricsService",
+	HandlerType: (*MetricsServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Export",
+			Handler:    exportHandler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "opentelemetry/proto/collector/metrics/v1/metrics_service.proto",
+}
@@ -0,0 +1,252 @@
+// Package protowire encodes and decodes the protocol buffer wire format, for
+// the plugins exchanging protobuf messages without generated code.
+package protowire
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Protocol buffer wire types.
+const (
+	VarintType  = 0
+	Fixed64Type = 1
+	BytesType   = 2
+	Fixed32Type = 5
+)
+
+// ErrTruncated is returned when a message ends in the middle of a field.
+var ErrTruncated = errors.New("unexpected end of message")
+
+// AppendVarint appends v in the base 128 varint encoding.
+func AppendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+// AppendKey appends the key of a field with the given number and wire type.
+func AppendKey(b []byte, num int, wire int) []byte {
+	return AppendVarint(b, uint64(num)<<3|uint64(wire))
+}
+
+// AppendUvarintField appends an unsigned varint field.
+func AppendUvarintField(b []byte, num int, v uint64) []byte {
+	b = AppendKey(b, num, VarintType)
+	return AppendVarint(b, v)
+}
+
+// AppendFixed64Field appends a fixed64 field.
+func AppendFixed64Field(b []byte, num int, v uint64) []byte {
+	b = AppendKey(b, num, Fixed64Type)
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+// AppendDoubleField appends a double field.
+func AppendDoubleField(b []byte, num int, v float64) []byte {
+	return AppendFixed64Field(b, num, math.Float64bits(v))
+}
+
+// AppendBytesField appends a length delimited field, such as an embedded
+// message.
+func AppendBytesField(b []byte, num int, v []byte) []byte {
+	b = AppendKey(b, num, BytesType)
+	b = AppendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// AppendStringField appends a string field.
+func AppendStringField(b []byte, num int, v string) []byte {
+	b = AppendKey(b, num, BytesType)
+	b = AppendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// AppendPackedFixed64 appends a packed repeated fixed64 field.
+func AppendPackedFixed64(b []byte, num int, values []uint64) []byte {
+	if len(values) == 0 {
+		return b
+	}
+	b = AppendKey(b, num, BytesType)
+	b = AppendVarint(b, uint64(8*len(values)))
+	var buf [8]byte
+	for _, v := range values {
+		binary.LittleEndian.PutUint64(buf[:], v)
+		b = append(b, buf[:]...)
+	}
+	return b
+}
+
+// AppendPackedDouble appends a packed repeated double field.
+func AppendPackedDouble(b []byte, num int, values []float64) []byte {
+	raw := make([]uint64, 0, len(values))
+	for _, v := range values {
+		raw = append(raw, math.Float64bits(v))
+	}
+	return AppendPackedFixed64(b, num, raw)
+}
+
+// Decoder reads the fields of a single message.
+type Decoder struct {
+	buf []byte
+}
+
+// NewDecoder returns a Decoder reading the encoded message.
+func NewDecoder(buf []byte) *Decoder {
+	return &Decoder{buf: buf}
+}
+
+// More returns true until the whole message has been read.
+func (d *Decoder) More() bool {
+	return len(d.buf) > 0
+}
+
+// Varint reads a varint value.
+func (d *Decoder) Varint() (uint64, error) {
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		return 0, ErrTruncated
+	}
+	d.buf = d.buf[n:]
+	return v, nil
+}
+
+// Key reads the key of the next field, returning its number and wire type.
+func (d *Decoder) Key() (int, int, error) {
+	v, err := d.Varint()
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(v >> 3), int(v & 7), nil
+}
+
+// Fixed64 reads a fixed64 value.
+func (d *Decoder) Fixed64() (uint64, error) {
+	if len(d.buf) < 8 {
+		return 0, ErrTruncated
+	}
+	v := binary.LittleEndian.Uint64(d.buf)
+	d.buf = d.buf[8:]
+	return v, nil
+}
+
+// Double reads a double value.
+func (d *Decoder) Double() (float64, error) {
+	v, err := d.Fixed64()
+	return math.Float64frombits(v), err
+}
+
+// Bytes reads a length delimited value.  The returned slice shares the
+// buffer of the message.
+func (d *Decoder) Bytes() ([]byte, error) {
+	l, err := d.Varint()
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(d.buf)) < l {
+		return nil, ErrTruncated
+	}
+	v := d.buf[:l]
+	d.buf = d.buf[l:]
+	return v, nil
+}
+
+// String reads a string value.
+func (d *Decoder) String() (string, error) {
+	v, err := d.Bytes()
+	return string(v), err
+}
+
+// Skip discards the value of a field not known to the caller.
+func (d *Decoder) Skip(wire int) error {
+	var err error
+	switch wire {
+	case VarintType:
+		_, err = d.Varint()
+	case Fixed64Type:
+		_, err = d.Fixed64()
+	case BytesType:
+		_, err = d.Bytes()
+	case Fixed32Type:
+		if len(d.buf) < 4 {
+			return ErrTruncated
+		}
+		d.buf = d.buf[4:]
+	default:
+		return fmt.Errorf("unsupported wire type %d", wire)
+	}
+	return err
+}
+
+// Fixed64s reads a repeated fixed64 field, which may be packed or not, and
+// appends its values.
+func (d *Decoder) Fixed64s(wire int, values []uint64) ([]uint64, error) {
+	if wire == Fixed64Type {
+		v, err := d.Fixed64()
+		return append(values, v), err
+	}
+	if wire != BytesType {
+		return values, fmt.Errorf("unexpected wire type %d for repeated fixed64", wire)
+	}
+	packed, err := d.Bytes()
+	if err != nil {
+		return values, err
+	}
+	if len(packed)%8 != 0 {
+		return values, ErrTruncated
+	}
+	for i := 0; i < len(packed); i += 8 {
+		values = append(values, binary.LittleEndian.Uint64(packed[i:]))
+	}
+	return values, nil
+}
+
+// Doubles reads a repeated double field, which may be packed or not, and
+// appends its values.
+func (d *Decoder) Doubles(wire int, values []float64) ([]float64, error) {
+	raw, err := d.Fixed64s(wire, nil)
+	for _, v := range raw {
+		values = append(values, math.Float64frombits(v))
+	}
+	return values, err
+}
+
+// DecodeFields calls fn for each field of the message, fn returns false for
+// fields it does not handle which are then skipped.
+func DecodeFields(buf []byte, fn func(d *Decoder, num, wire int) (bool, error)) error {
+	d := NewDecoder(buf)
+	for d.More() {
+		num, wire, err := d.Key()
+		if err != nil {
+			return err
+		}
+		handled, err := fn(d, num, wire)
+		if err != nil {
+			return err
+		}
+		if !handled {
+			if err := d.Skip(wire); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// DecodeMessage reads a length delimited field and decodes it with fn.
+func DecodeMessage(d *Decoder, wire int, fn func([]byte) error) error {
+	if wire != BytesType {
+		return fmt.Errorf("unexpected wire type %d for message", wire)
+	}
+	msg, err := d.Bytes()
+	if err != nil {
+		return err
+	}
+	return fn(msg)
+}
@@ -0,0 +1,55 @@
+package protowire
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundTrip(t *testing.T) {
+	var b []byte
+	b = AppendUvarintField(b, 1, 300)
+	b = AppendDoubleField(b, 2, 1.5)
+	b = AppendStringField(b, 3, "hello")
+	b = AppendPackedDouble(b, 4, []float64{1, 2})
+	b = AppendBytesField(b, 5, AppendStringField(nil, 1, "nested"))
+
+	var nested string
+	var doubles []float64
+	err := DecodeFields(b, func(d *Decoder, num, wire int) (bool, error) {
+		var err error
+		switch num {
+		case 1:
+			v, err := d.Varint()
+			require.Equal(t, uint64(300), v)
+			return true, err
+		case 2:
+			v, err := d.Double()
+			require.Equal(t, 1.5, v)
+			return true, err
+		case 4:
+			doubles, err = d.Doubles(wire, doubles)
+			return true, err
+		case 5:
+			return true, DecodeMessage(d, wire, func(msg []byte) error {
+				return DecodeFields(msg, func(d *Decoder, num, wire int) (bool, error) {
+					nested, err = d.String()
+					return true, err
+				})
+			})
+		}
+		// field 3 is skipped
+		return false, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []float64{1, 2}, doubles)
+	require.Equal(t, "nested", nested)
+}
+
+func TestTruncated(t *testing.T) {
+	b := AppendStringField(nil, 1, "hello")
+	err := DecodeFields(b[:len(b)-1], func(d *Decoder, num, wire int) (bool, error) {
+		return false, nil
+	})
+	require.Equal(t, ErrTruncated, err)
+}
@@ -0,0 +1,175 @@
+// Package scrape schedules the scrapes of the targets of the inputs polling
+// several endpoints.
+//
+// The targets are scraped concurrently, optionally with a bounded number of
+// scrapes in flight, a timeout per target and start times staggered across
+// the targets.  A metric describing each scrape can be emitted, like the up
+// and scrape_duration_seconds series of Prometheus.
+package scrape
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+)
+
+// Config is embedded into the inputs scraping several targets.
+type Config struct {
+	// Maximum number of targets scraped at the same time, unlimited when
+	// zero.
+	MaxConcurrentScrapes int `toml:"max_concurrent_scrapes"`
+	// Timeout of the scrape of each target, none when zero.
+	ScrapeTimeout internal.Duration `toml:"scrape_timeout"`
+	// The start of the scrapes is spread over this duration.
+	ScrapeStagger internal.Duration `toml:"scrape_stagger"`
+	// Emit a metric for each scrape.
+	ScrapeMetrics bool `toml:"scrape_metrics"`
+}
+
+// Target is an endpoint to scrape.
+type Target struct {
+	// Name identifies the target, it determines the start offset of the
+	// scrape within the stagger.
+	Name string
+	// Tags of the scrape metric.
+	Tags map[string]string
+	// Scrape gathers the metrics of the target, and must return when the
+	// context is done.
+	Scrape func(ctx context.Context, acc telegraf.Accumulator) error
+}
+
+// Scrape scrapes the targets and waits for all the scrapes to finish.  The
+// scrapes are cancelled when the context is done, and the targets still
+// waiting for their start or a free slot are skipped.  The errors of the scrapes
+// are added to the accumulator, and when enabled a metric with the given name
+// is added for each scrape, with the fields:
+//
+//	up                      - 1 if the scrape succeeded, else 0
+//	scrape_duration_seconds - duration of the scrape
+//	scrape_samples          - number of metrics gathered
+func (c *Config) Scrape(ctx context.Context, acc telegraf.Accumulator, measurement string, targets []Target) {
+	var slots chan struct{}
+	if c.MaxConcurrentScrapes > 0 {
+		slots = make(chan struct{}, c.MaxConcurrentScrapes)
+	}
+
+	var wg sync.WaitGroup
+	for _, target := range targets {
+		wg.Add(1)
+		go func(target Target) {
+			defer wg.Done()
+
+			if ctx.Err() != nil {
+				return
+			}
+			if offset := c.offset(target.Name); offset > 0 {
+				if err := internal.SleepContext(ctx, offset); err != nil {
+					return
+				}
+			}
+			if slots != nil {
+				select {
+				case slots <- struct{}{}:
+					defer func() { <-slots }()
+				case <-ctx.Done():
+					return
+				}
+			}
+			c.scrape(ctx, acc, measurement, target)
+		}(target)
+	}
+	wg.Wait()
+}
+
+// offset returns the delay of the scrape of the target within the stagger,
+// stable across the scrapes.
+func (c *Config) offset(name string) time.Duration {
+	if c.ScrapeStagger.Duration <= 0 {
+		return 0
+	}
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return time.Duration(h.Sum64() % uint64(c.ScrapeStagger.Duration))
+}
+
+func (c *Config) scrape(ctx context.Context, acc telegraf.Accumulator, measurement string, target Target) {
+	if c.ScrapeTimeout.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.ScrapeTimeout.Duration)
+		defer cancel()
+	}
+
+	counter := &countingAccumulator{Accumulator: acc}
+	start := time.Now()
+	err := target.Scrape(ctx, counter)
+	duration := time.Since(start)
+	counter.AddError(err)
+
+	if !c.ScrapeMetrics {
+		return
+	}
+
+	up := 1
+	if atomic.LoadInt64(&counter.errors) > 0 {
+		up = 0
+	}
+	tags := make(map[string]string, len(target.Tags))
+	for k, v := range target.Tags {
+		tags[k] = v
+	}
+	acc.AddFields(measurement, map[string]interface{}{
+		"up":                      up,
+		"scrape_duration_seconds": duration.Seconds(),
+		"scrape_samples":          atomic.LoadInt64(&counter.samples),
+	}, tags, start)
+}
+
+// countingAccumulator counts the metrics and errors added during a scrape.
+type countingAccumulator struct {
+	telegraf.Accumulator
+	samples int64
+	errors  int64
+}
+
+func (a *countingAccumulator) AddFields(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	atomic.AddInt64(&a.samples, 1)
+	a.Accumulator.AddFields(measurement, fields, tags, t...)
+}
+
+func (a *countingAccumulator) AddGauge(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	atomic.AddInt64(&a.samples, 1)
+	a.Accumulator.AddGauge(measurement, fields, tags, t...)
+}
+
+func (a *countingAccumulator) AddCounter(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	atomic.AddInt64(&a.samples, 1)
+	a.Accumulator.AddCounter(measurement, fields, tags, t...)
+}
+
+func (a *countingAccumulator) AddSummary(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	atomic.AddInt64(&a.samples, 1)
+	a.Accumulator.AddSummary(measurement, fields, tags, t...)
+}
+
+func (a *countingAccumulator) AddHistogram(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	atomic.AddInt64(&a.samples, 1)
+	a.Accumulator.AddHistogram(measurement, fields, tags, t...)
+}
+
+func (a *countingAccumulator) AddMetric(m telegraf.Metric) {
+	atomic.AddInt64(&a.samples, 1)
+	a.Accumulator.AddMetric(m)
+}
+
+func (a *countingAccumulator) AddError(err error) {
+	if err == nil {
+		return
+	}
+	atomic.AddInt64(&a.errors, 1)
+	a.Accumulator.AddError(err)
+}
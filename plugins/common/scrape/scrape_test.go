@@ -0,0 +1,221 @@
+package scrape
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScrapeMetrics(t *testing.T) {
+	c := &Config{ScrapeMetrics: true}
+	targets := []Target{
+		{
+			Name: "ok",
+			Tags: map[string]string{"url": "ok"},
+			Scrape: func(ctx context.Context, acc telegraf.Accumulator) error {
+				acc.AddFields("m", map[string]interface{}{"value": 1}, nil)
+				acc.AddGauge("m", map[string]interface{}{"value": 2}, nil)
+				acc.AddError(nil)
+				return nil
+			},
+		},
+		{
+			Name: "failed",
+			Tags: map[string]string{"url": "failed"},
+			Scrape: func(ctx context.Context, acc telegraf.Accumulator) error {
+				return errors.New("connection refused")
+			},
+		},
+		{
+			Name: "partial",
+			Tags: map[string]string{"url": "partial"},
+			Scrape: func(ctx context.Context, acc telegraf.Accumulator) error {
+				acc.AddFields("m", map[string]interface{}{"value": 3}, nil)
+				acc.AddError(errors.New("bad line"))
+				return nil
+			},
+		},
+	}
+
+	var acc testutil.Accumulator
+	c.Scrape(context.Background(), &acc, "test_scrape", targets)
+
+	require.Len(t, acc.Errors, 2)
+	for _, tt := range []struct {
+		url     string
+		up      int
+		samples int64
+	}{
+		{"ok", 1, 2},
+		{"failed", 0, 0},
+		{"partial", 0, 1},
+	} {
+		var found bool
+		for _, m := range acc.GetTelegrafMetrics() {
+			if m.Name() != "test_scrape" || m.Tags()["url"] != tt.url {
+				continue
+			}
+			found = true
+			fields := m.Fields()
+			require.Equal(t, int64(tt.up), fields["up"], tt.url)
+			require.Equal(t, tt.samples, fields["scrape_samples"], tt.url)
+			require.IsType(t, float64(0), fields["scrape_duration_seconds"], tt.url)
+		}
+		require.True(t, found, tt.url)
+	}
+}
+
+func TestScrapeWithoutMetrics(t *testing.T) {
+	c := &Config{}
+	var acc testutil.Accumulator
+	c.Scrape(context.Background(), &acc, "test_scrape", []Target{{
+		Name: "ok",
+		Scrape: func(ctx context.Context, acc telegraf.Accumulator) error {
+			acc.AddFields("m", map[string]interface{}{"value": 1}, nil)
+			return nil
+		},
+	}})
+	require.Equal(t, uint64(1), acc.NMetrics())
+	require.False(t, acc.HasMeasurement("test_scrape"))
+}
+
+func TestScrapeTimeout(t *testing.T) {
+	c := &Config{ScrapeTimeout: internal.Duration{Duration: 50 * time.Millisecond}}
+
+	var acc testutil.Accumulator
+	start := time.Now()
+	c.Scrape(context.Background(), &acc, "test_scrape", []Target{
+		{
+			Name: "slow",
+			Scrape: func(ctx context.Context, acc telegraf.Accumulator) error {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(10 * time.Second):
+					return nil
+				}
+			},
+		},
+		{
+			Name: "fast",
+			Scrape: func(ctx context.Context, acc telegraf.Accumulator) error {
+				acc.AddFields("m", map[string]interface{}{"value": 1}, nil)
+				return nil
+			},
+		},
+	})
+	require.True(t, time.Since(start) < 5*time.Second)
+	require.Len(t, acc.Errors, 1)
+	require.Equal(t, context.DeadlineExceeded, acc.Errors[0])
+	require.True(t, acc.HasMeasurement("m"))
+}
+
+func TestScrapeConcurrency(t *testing.T) {
+	c := &Config{MaxConcurrentScrapes: 2}
+
+	var running, max int32
+	var targets []Target
+	for i := 0; i < 10; i++ {
+		targets = append(targets, Target{
+			Name: fmt.Sprintf("target%d", i),
+			Scrape: func(ctx context.Context, acc telegraf.Accumulator) error {
+				n := atomic.AddInt32(&running, 1)
+				defer atomic.AddInt32(&running, -1)
+				for {
+					m := atomic.LoadInt32(&max)
+					if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+						break
+					}
+				}
+				time.Sleep(10 * time.Millisecond)
+				return nil
+			},
+		})
+	}
+
+	var acc testutil.Accumulator
+	c.Scrape(context.Background(), &acc, "test_scrape", targets)
+	require.Equal(t, int32(2), atomic.LoadInt32(&max))
+}
+
+func TestOffset(t *testing.T) {
+	c := &Config{}
+	require.Equal(t, time.Duration(0), c.offset("a"))
+
+	c.ScrapeStagger.Duration = time.Second
+	offsets := make(map[time.Duration]bool)
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprintf("http://host%d:9100/metrics", i)
+		offset := c.offset(name)
+		require.True(t, offset >= 0 && offset < time.Second)
+		require.Equal(t, offset, c.offset(name))
+		offsets[offset] = true
+	}
+	require.True(t, len(offsets) > 1)
+}
+
+func TestScrapeCancel(t *testing.T) {
+	c := &Config{ScrapeStagger: internal.Duration{Duration: time.Hour}, ScrapeMetrics: true}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var acc testutil.Accumulator
+	var scraped int32
+	start := time.Now()
+	c.Scrape(ctx, &acc, "test_scrape", []Target{{
+		Name: "staggered",
+		Scrape: func(ctx context.Context, acc telegraf.Accumulator) error {
+			atomic.AddInt32(&scraped, 1)
+			return nil
+		},
+	}})
+	require.True(t, time.Since(start) < 5*time.Second)
+	// the target is skipped when the context is done during the stagger
+	require.Equal(t, int32(0), atomic.LoadInt32(&scraped))
+	require.Empty(t, acc.Errors)
+	require.Equal(t, uint64(0), acc.NMetrics())
+}
+
+func TestScrapeCancelWaitingForSlot(t *testing.T) {
+	c := &Config{MaxConcurrentScrapes: 1}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var acc testutil.Accumulator
+	var scraped int32
+	scrape := func(ctx context.Context, acc telegraf.Accumulator) error {
+		atomic.AddInt32(&scraped, 1)
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	c.Scrape(ctx, &acc, "test_scrape", []Target{
+		{Name: "first", Scrape: scrape},
+		{Name: "second", Scrape: scrape},
+	})
+	require.Equal(t, int32(1), atomic.LoadInt32(&scraped))
+	require.Len(t, acc.Errors, 1)
+}
+
+func TestScrapeCancelled(t *testing.T) {
+	c := &Config{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var acc testutil.Accumulator
+	c.Scrape(ctx, &acc, "test_scrape", []Target{{
+		Name: "ok",
+		Scrape: func(ctx context.Context, acc telegraf.Accumulator) error {
+			t.Error("scraped with a cancelled context")
+			return nil
+		},
+	}})
+	require.Empty(t, acc.Errors)
+}
@@ -0,0 +1,153 @@
+// Package shard distributes the writes of an output across several
+// endpoints.
+//
+// Three modes are supported:
+//
+//	""                - each batch is written to a random endpoint, the other
+//	                    endpoints are tried in turn when the write fails.
+//	"round-robin"     - each batch is written to the next endpoint, the other
+//	                    endpoints are tried in turn when the write fails.
+//	"consistent-hash" - each series is routed to a stable endpoint chosen on a
+//	                    hash ring, so that the same series always ends up on
+//	                    the same endpoint.
+package shard
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/influxdata/telegraf"
+)
+
+const (
+	ModeFailover       = ""
+	ModeRoundRobin     = "round-robin"
+	ModeConsistentHash = "consistent-hash"
+)
+
+// virtualNodes is the number of points each endpoint has on the hash ring.
+const virtualNodes = 160
+
+// Config is embedded into the outputs supporting sharding.
+type Config struct {
+	ShardMode string `toml:"shard_mode"`
+	ShardTag  string `toml:"shard_tag"`
+}
+
+// Sharder picks the endpoints to write to.
+type Sharder struct {
+	mode  string
+	tag   string
+	count int
+	ring  []point
+	next  uint64
+}
+
+type point struct {
+	hash     uint64
+	endpoint int
+}
+
+// NewSharder creates a sharder for the endpoints.  The position of an
+// endpoint on the hash ring depends only on its name, adding or removing an
+// endpoint moves the series of the neighbouring endpoints only.
+func (c *Config) NewSharder(endpoints []string) (*Sharder, error) {
+	s := &Sharder{
+		mode:  c.ShardMode,
+		tag:   c.ShardTag,
+		count: len(endpoints),
+	}
+
+	switch c.ShardMode {
+	case ModeFailover, ModeRoundRobin:
+	case ModeConsistentHash:
+		s.ring = make([]point, 0, len(endpoints)*virtualNodes)
+		for i, endpoint := range endpoints {
+			for v := 0; v < virtualNodes; v++ {
+				s.ring = append(s.ring, point{
+					hash:     hashString(endpoint + "#" + strconv.Itoa(v)),
+					endpoint: i,
+				})
+			}
+		}
+		sort.Slice(s.ring, func(i, j int) bool {
+			return s.ring[i].hash < s.ring[j].hash
+		})
+	default:
+		return nil, fmt.Errorf("unknown shard_mode %q", c.ShardMode)
+	}
+
+	return s, nil
+}
+
+// Mode returns the shard mode.
+func (s *Sharder) Mode() string {
+	return s.mode
+}
+
+// Order returns the indexes of the endpoints in the order they should be
+// tried when writing a whole batch.
+func (s *Sharder) Order() []int {
+	if s.mode != ModeRoundRobin {
+		return rand.Perm(s.count)
+	}
+
+	start := int((atomic.AddUint64(&s.next, 1) - 1) % uint64(s.count))
+	order := make([]int, 0, s.count)
+	for i := 0; i < s.count; i++ {
+		order = append(order, (start+i)%s.count)
+	}
+	return order
+}
+
+// Endpoint returns the index of the endpoint the metric is routed to in the
+// consistent-hash mode.  The series is identified by the value of the shard
+// tag if it is set on the metric, otherwise by the name and tags.
+func (s *Sharder) Endpoint(m telegraf.Metric) int {
+	var key uint64
+	if value, ok := m.GetTag(s.tag); ok && s.tag != "" {
+		key = hashString(value)
+	} else {
+		key = mix(m.HashID())
+	}
+
+	i := sort.Search(len(s.ring), func(i int) bool {
+		return s.ring[i].hash >= key
+	})
+	if i == len(s.ring) {
+		i = 0
+	}
+	return s.ring[i].endpoint
+}
+
+// Partition splits the metrics by endpoint in the consistent-hash mode, the
+// result has one entry for each endpoint.
+func (s *Sharder) Partition(metrics []telegraf.Metric) [][]telegraf.Metric {
+	parts := make([][]telegraf.Metric, s.count)
+	for _, m := range metrics {
+		i := s.Endpoint(m)
+		parts[i] = append(parts[i], m)
+	}
+	return parts
+}
+
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return mix(h.Sum64())
+}
+
+// mix spreads the FNV hashes of similar keys over the whole ring, using the
+// finalizer of the SplitMix64 generator.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
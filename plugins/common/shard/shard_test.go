@@ -0,0 +1,108 @@
+package shard
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func series(n int) []telegraf.Metric {
+	metrics := make([]telegraf.Metric, 0, n)
+	for i := 0; i < n; i++ {
+		metrics = append(metrics, testutil.MustMetric("cpu",
+			map[string]string{"host": fmt.Sprintf("host%d", i), "cluster": fmt.Sprintf("c%d", i%3)},
+			map[string]interface{}{"value": float64(i)},
+			time.Unix(0, 0)))
+	}
+	return metrics
+}
+
+func TestUnknownMode(t *testing.T) {
+	c := &Config{ShardMode: "random"}
+	_, err := c.NewSharder([]string{"a", "b"})
+	require.Error(t, err)
+}
+
+func TestFailoverOrder(t *testing.T) {
+	c := &Config{}
+	s, err := c.NewSharder([]string{"a", "b", "c"})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []int{0, 1, 2}, s.Order())
+}
+
+func TestRoundRobinOrder(t *testing.T) {
+	c := &Config{ShardMode: ModeRoundRobin}
+	s, err := c.NewSharder([]string{"a", "b", "c"})
+	require.NoError(t, err)
+	require.Equal(t, []int{0, 1, 2}, s.Order())
+	require.Equal(t, []int{1, 2, 0}, s.Order())
+	require.Equal(t, []int{2, 0, 1}, s.Order())
+	require.Equal(t, []int{0, 1, 2}, s.Order())
+}
+
+func TestConsistentHashStable(t *testing.T) {
+	c := &Config{ShardMode: ModeConsistentHash}
+	s, err := c.NewSharder([]string{"a:2003", "b:2003", "c:2003"})
+	require.NoError(t, err)
+
+	metrics := series(300)
+	parts := s.Partition(metrics)
+	require.Len(t, parts, 3)
+
+	total := 0
+	for _, part := range parts {
+		// Each endpoint should receive a reasonable share of the series.
+		require.True(t, len(part) > 50, "unbalanced partition: %d", len(part))
+		total += len(part)
+	}
+	require.Equal(t, len(metrics), total)
+
+	// The endpoints do not depend on the order of configuration.
+	reordered, err := c.NewSharder([]string{"c:2003", "a:2003", "b:2003"})
+	require.NoError(t, err)
+	names := []string{"a:2003", "b:2003", "c:2003"}
+	reorderedNames := []string{"c:2003", "a:2003", "b:2003"}
+	for _, m := range metrics {
+		require.Equal(t, names[s.Endpoint(m)], reorderedNames[reordered.Endpoint(m)])
+	}
+}
+
+func TestConsistentHashAddEndpoint(t *testing.T) {
+	c := &Config{ShardMode: ModeConsistentHash}
+	three, err := c.NewSharder([]string{"a", "b", "c"})
+	require.NoError(t, err)
+	four, err := c.NewSharder([]string{"a", "b", "c", "d"})
+	require.NoError(t, err)
+
+	moved := 0
+	for _, m := range series(400) {
+		e := four.Endpoint(m)
+		if e == 3 {
+			continue
+		}
+		if e != three.Endpoint(m) {
+			moved++
+		}
+	}
+	// Only series taken over by the new endpoint are moved.
+	require.Equal(t, 0, moved)
+}
+
+func TestConsistentHashTag(t *testing.T) {
+	c := &Config{ShardMode: ModeConsistentHash, ShardTag: "cluster"}
+	s, err := c.NewSharder([]string{"a", "b", "c", "d", "e"})
+	require.NoError(t, err)
+
+	endpoints := make(map[string]int)
+	for _, m := range series(30) {
+		cluster, _ := m.GetTag("cluster")
+		if e, ok := endpoints[cluster]; ok {
+			require.Equal(t, e, s.Endpoint(m))
+		}
+		endpoints[cluster] = s.Endpoint(m)
+	}
+}
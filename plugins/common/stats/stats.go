@@ -0,0 +1,29 @@
+// Package stats holds helpers shared by the aggregators computing statistics
+// of the numeric fields.
+package stats
+
+import (
+	"math"
+	"strconv"
+)
+
+// QuantileSuffix formats a quantile as a percentile, e.g. 0.999 -> "p99.9".
+func QuantileSuffix(q float64) string {
+	p := math.Round(q*100*1e6) / 1e6
+	return "p" + strconv.FormatFloat(p, 'f', -1, 64)
+}
+
+// ToFloat converts a numeric field value to a float64, reporting whether the
+// value is numeric.
+func ToFloat(in interface{}) (float64, bool) {
+	switch v := in.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
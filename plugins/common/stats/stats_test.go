@@ -0,0 +1,26 @@
+package stats
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuantileSuffix(t *testing.T) {
+	require.Equal(t, "p50", QuantileSuffix(0.5))
+	require.Equal(t, "p99.9", QuantileSuffix(0.999))
+	require.Equal(t, "p29", QuantileSuffix(0.29))
+	require.Equal(t, "p0", QuantileSuffix(0))
+}
+
+func TestToFloat(t *testing.T) {
+	for _, in := range []interface{}{float64(2), int64(2), uint64(2)} {
+		v, ok := ToFloat(in)
+		require.True(t, ok)
+		require.Equal(t, 2.0, v)
+	}
+	for _, in := range []interface{}{"2", true, nil} {
+		_, ok := ToFloat(in)
+		require.False(t, ok)
+	}
+}
@@ -0,0 +1,148 @@
+// Package topic renders per-metric topic or subject names for the message
+// queue outputs.
+//
+// Templates use the text/template syntax with the metric as data, for
+// example:
+//
+//	telegraf/{{.Tag "site"}}/{{.Name}}
+//
+// A template without actions is used as a constant topic.
+package topic
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// Template renders the topic of a metric.
+type Template struct {
+	text string
+	tmpl *template.Template
+}
+
+// Batch holds the metrics that resolved to the same topic.
+type Batch struct {
+	Topic   string
+	Metrics []telegraf.Metric
+}
+
+var funcs = template.FuncMap{
+	"join":    strings.Join,
+	"lower":   strings.ToLower,
+	"upper":   strings.ToUpper,
+	"replace": strings.Replace,
+}
+
+// NewTemplate parses the template text.
+func NewTemplate(text string) (*Template, error) {
+	t := &Template{text: text}
+	if !strings.Contains(text, "{{") {
+		return t, nil
+	}
+
+	tmpl, err := template.New("topic").Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid topic template %q: %v", text, err)
+	}
+	t.tmpl = tmpl
+	return t, nil
+}
+
+// IsConstant returns true if the template renders to the same topic for all
+// metrics.
+func (t *Template) IsConstant() bool {
+	return t.tmpl == nil
+}
+
+// Execute returns the topic of the metric.  Rendering an empty topic is an
+// error.
+func (t *Template) Execute(m telegraf.Metric) (string, error) {
+	if t.tmpl == nil {
+		return t.text, nil
+	}
+
+	var b strings.Builder
+	if err := t.tmpl.Execute(&b, Metric{metric: m}); err != nil {
+		return "", err
+	}
+	if b.Len() == 0 {
+		return "", errors.New("topic template rendered an empty topic")
+	}
+	return b.String(), nil
+}
+
+// Group splits the metrics into batches by topic, keeping the order of the
+// metrics and of the first occurrence of each topic.  Metrics whose topic
+// cannot be rendered are left out, the first error is returned along with
+// the batches of the remaining metrics.
+func (t *Template) Group(metrics []telegraf.Metric) ([]*Batch, error) {
+	var batches []*Batch
+	var firstErr error
+	index := make(map[string]*Batch)
+	for _, m := range metrics {
+		topic, err := t.Execute(m)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		b, ok := index[topic]
+		if !ok {
+			b = &Batch{Topic: topic}
+			index[topic] = b
+			batches = append(batches, b)
+		}
+		b.Metrics = append(b.Metrics, m)
+	}
+	return batches, firstErr
+}
+
+// Metric is the data passed to the template.
+type Metric struct {
+	metric telegraf.Metric
+}
+
+// Name returns the measurement name.
+func (m Metric) Name() string {
+	return m.metric.Name()
+}
+
+// Tag returns the value of the tag, or an empty string if the tag is not set.
+func (m Metric) Tag(key string) string {
+	v, _ := m.metric.GetTag(key)
+	return v
+}
+
+// HasTag returns true if the tag is set.
+func (m Metric) HasTag(key string) bool {
+	return m.metric.HasTag(key)
+}
+
+// Field returns the value of the field, or nil if the field is not set.
+func (m Metric) Field(key string) interface{} {
+	v, _ := m.metric.GetField(key)
+	return v
+}
+
+// FieldNames returns the sorted names of the fields.
+func (m Metric) FieldNames() []string {
+	names := make([]string, 0, len(m.metric.FieldList()))
+	for _, field := range m.metric.FieldList() {
+		names = append(names, field.Key)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Time returns the timestamp of the metric.
+func (m Metric) Time() time.Time {
+	return m.metric.Time()
+}
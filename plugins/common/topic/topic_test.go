@@ -0,0 +1,85 @@
+package topic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecute(t *testing.T) {
+	m := testutil.MustMetric("cpu",
+		map[string]string{"site": "ams", "host": "web01"},
+		map[string]interface{}{"usage_idle": 98.5, "usage_user": 1.5},
+		time.Unix(0, 0))
+
+	tests := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{"constant", "telegraf", "telegraf"},
+		{"name", "{{.Name}}", "cpu"},
+		{"tag", `site/{{.Tag "site"}}/{{.Name}}`, "site/ams/cpu"},
+		{"missing tag", `{{.Tag "rack"}}/{{.Name}}`, "/cpu"},
+		{"field names", `{{.Name}}/{{join .FieldNames "+"}}`, "cpu/usage_idle+usage_user"},
+		{"field", `{{.Name}}/{{.Field "usage_idle"}}`, "cpu/98.5"},
+		{"conditional", `{{if .HasTag "rack"}}{{.Tag "rack"}}{{else}}default{{end}}`, "default"},
+		{"functions", `{{upper .Name}}/{{replace (.Tag "host") "web" "w" -1}}`, "CPU/w01"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := NewTemplate(tt.template)
+			require.NoError(t, err)
+			topic, err := tmpl.Execute(m)
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, topic)
+		})
+	}
+}
+
+func TestInvalidTemplate(t *testing.T) {
+	_, err := NewTemplate("{{.Name")
+	require.Error(t, err)
+}
+
+func TestEmptyTopic(t *testing.T) {
+	tmpl, err := NewTemplate(`{{.Tag "missing"}}`)
+	require.NoError(t, err)
+	require.False(t, tmpl.IsConstant())
+
+	_, err = tmpl.Execute(testutil.TestMetric(1.0))
+	require.Error(t, err)
+}
+
+func TestGroup(t *testing.T) {
+	tmpl, err := NewTemplate(`{{.Tag "site"}}/{{.Name}}`)
+	require.NoError(t, err)
+
+	ams1 := testutil.MustMetric("cpu", map[string]string{"site": "ams"}, map[string]interface{}{"value": 1.0}, time.Unix(0, 0))
+	fra := testutil.MustMetric("cpu", map[string]string{"site": "fra"}, map[string]interface{}{"value": 2.0}, time.Unix(0, 0))
+	ams2 := testutil.MustMetric("cpu", map[string]string{"site": "ams"}, map[string]interface{}{"value": 3.0}, time.Unix(1, 0))
+	mem := testutil.MustMetric("mem", map[string]string{"site": "ams"}, map[string]interface{}{"value": 4.0}, time.Unix(0, 0))
+
+	batches, err := tmpl.Group([]telegraf.Metric{ams1, fra, ams2, mem})
+	require.NoError(t, err)
+	require.Equal(t, []*Batch{
+		{Topic: "ams/cpu", Metrics: []telegraf.Metric{ams1, ams2}},
+		{Topic: "fra/cpu", Metrics: []telegraf.Metric{fra}},
+		{Topic: "ams/mem", Metrics: []telegraf.Metric{mem}},
+	}, batches)
+}
+
+func TestGroupSkipsFailedMetrics(t *testing.T) {
+	tmpl, err := NewTemplate(`{{.Tag "site"}}`)
+	require.NoError(t, err)
+
+	ams := testutil.MustMetric("cpu", map[string]string{"site": "ams"}, map[string]interface{}{"value": 1.0}, time.Unix(0, 0))
+	none := testutil.MustMetric("cpu", map[string]string{}, map[string]interface{}{"value": 2.0}, time.Unix(0, 0))
+
+	batches, err := tmpl.Group([]telegraf.Metric{none, ams})
+	require.Error(t, err)
+	require.Equal(t, []*Batch{{Topic: "ams", Metrics: []telegraf.Metric{ams}}}, batches)
+}
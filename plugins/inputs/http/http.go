@@ -1,17 +1,19 @@
 package http
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/internal"
 	"github.com/influxdata/telegraf/internal/tls"
+	"github.com/influxdata/telegraf/plugins/common/scrape"
 	"github.com/influxdata/telegraf/plugins/inputs"
 	"github.com/influxdata/telegraf/plugins/parsers"
 )
@@ -33,6 +35,8 @@ type HTTP struct {
 
 	Timeout internal.Duration `toml:"timeout"`
 
+	scrape.Config
+
 	client *http.Client
 
 	// The parser will automatically be set by Telegraf core code because
@@ -76,6 +80,16 @@ var sampleConfig = `
   ## List of success status codes
   # success_status_codes = [200]
 
+  ## Maximum number of URLs read at the same time, unlimited if 0.
+  # max_concurrent_scrapes = 0
+  ## Timeout of the read of each URL, none if 0.
+  # scrape_timeout = "0s"
+  ## Spread the start of the reads of the URLs over this duration.
+  # scrape_stagger = "0s"
+  ## Add a http_scrape metric for each URL, with the up,
+  ## scrape_duration_seconds and scrape_samples fields.
+  # scrape_metrics = false
+
   ## Data format to consume.
   ## Each data format has its own unique set of configuration options, read
   ## more about them here:
@@ -117,22 +131,41 @@ func (h *HTTP) Init() error {
 // Gather takes in an accumulator and adds the metrics that the Input
 // gathers. This is called every "interval"
 func (h *HTTP) Gather(acc telegraf.Accumulator) error {
-	var wg sync.WaitGroup
+	return h.GatherContext(context.Background(), acc)
+}
+
+// GatherContext is Gather, cancelling the requests in flight when the
+// context is done.
+func (h *HTTP) GatherContext(ctx context.Context, acc telegraf.Accumulator) error {
+	targets := make([]scrape.Target, 0, len(h.URLs))
 	for _, u := range h.URLs {
-		wg.Add(1)
-		go func(url string) {
-			defer wg.Done()
-			if err := h.gatherURL(acc, url); err != nil {
-				acc.AddError(fmt.Errorf("[url=%s]: %s", url, err))
-			}
-		}(u)
+		url := u
+		targets = append(targets, scrape.Target{
+			Name: url,
+			Tags: map[string]string{"url": stripUser(url)},
+			Scrape: func(ctx context.Context, acc telegraf.Accumulator) error {
+				if err := h.gatherURL(ctx, acc, url); err != nil {
+					return fmt.Errorf("[url=%s]: %s", url, err)
+				}
+				return nil
+			},
+		})
 	}
-
-	wg.Wait()
+	h.Config.Scrape(ctx, acc, "http_scrape", targets)
 
 	return nil
 }
 
+// stripUser returns the URL without its user and password.
+func stripUser(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return rawURL
+	}
+	u.User = nil
+	return u.String()
+}
+
 // SetParser takes the data_format from the config and finds the right parser for that format
 func (h *HTTP) SetParser(parser parsers.Parser) {
 	h.parser = parser
@@ -140,12 +173,14 @@ func (h *HTTP) SetParser(parser parsers.Parser) {
 
 // Gathers data from a particular URL
 // Parameters:
+//     ctx    : The context of the request
 //     acc    : The telegraf Accumulator to use
 //     url    : endpoint to send request to
 //
 // Returns:
 //     error: Any error that may have occurred
 func (h *HTTP) gatherURL(
+	ctx context.Context,
 	acc telegraf.Accumulator,
 	url string,
 ) error {
@@ -159,6 +194,7 @@ func (h *HTTP) gatherURL(
 	if err != nil {
 		return err
 	}
+	request = request.WithContext(ctx)
 
 	if h.ContentEncoding == "gzip" {
 		request.Header.Set("Content-Encoding", "gzip")
@@ -6,7 +6,9 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	plugin "github.com/influxdata/telegraf/plugins/inputs/http"
 	"github.com/influxdata/telegraf/plugins/parsers"
@@ -252,3 +254,83 @@ func TestBodyAndContentEncoding(t *testing.T) {
 		})
 	}
 }
+
+func TestScrapeTimeout(t *testing.T) {
+	done := make(chan struct{})
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-done:
+			case <-r.Context().Done():
+			}
+			return
+		}
+		_, _ = w.Write([]byte(simpleJSON))
+	}))
+	defer fakeServer.Close()
+	defer close(done)
+
+	plugin := &plugin.HTTP{
+		URLs: []string{fakeServer.URL + "/slow", fakeServer.URL + "/endpoint"},
+	}
+	plugin.ScrapeTimeout.Duration = 100 * time.Millisecond
+	plugin.ScrapeMetrics = true
+
+	p, _ := parsers.NewParser(&parsers.Config{
+		DataFormat: "json",
+		MetricName: "metricName",
+	})
+	plugin.SetParser(p)
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Init())
+	require.Error(t, acc.GatherError(plugin.Gather))
+
+	require.True(t, acc.HasMeasurement("metricName"))
+	var scrapes int
+	for _, m := range acc.GetTelegrafMetrics() {
+		if m.Name() != "http_scrape" {
+			continue
+		}
+		scrapes++
+		up, _ := m.GetField("up")
+		switch m.Tags()["url"] {
+		case fakeServer.URL + "/slow":
+			require.Equal(t, int64(0), up)
+		case fakeServer.URL + "/endpoint":
+			require.Equal(t, int64(1), up)
+		default:
+			t.Fatalf("unexpected url %s", m.Tags()["url"])
+		}
+	}
+	require.Equal(t, 2, scrapes)
+}
+
+func TestScrapeMetricsStripUser(t *testing.T) {
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(simpleJSON))
+	}))
+	defer fakeServer.Close()
+
+	plugin := &plugin.HTTP{
+		URLs: []string{strings.Replace(fakeServer.URL, "http://", "http://user:secret@", 1) + "/endpoint"},
+	}
+	plugin.ScrapeMetrics = true
+
+	p, _ := parsers.NewParser(&parsers.Config{
+		DataFormat: "json",
+		MetricName: "metricName",
+	})
+	plugin.SetParser(p)
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Init())
+	require.NoError(t, acc.GatherError(plugin.Gather))
+
+	require.True(t, acc.HasMeasurement("http_scrape"))
+	for _, m := range acc.GetTelegrafMetrics() {
+		if m.Name() == "http_scrape" {
+			require.Equal(t, fakeServer.URL+"/endpoint", m.Tags()["url"])
+		}
+	}
+}
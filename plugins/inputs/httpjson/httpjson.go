@@ -2,17 +2,18 @@ package httpjson
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/internal"
 	"github.com/influxdata/telegraf/internal/tls"
+	"github.com/influxdata/telegraf/plugins/common/scrape"
 	"github.com/influxdata/telegraf/plugins/inputs"
 	"github.com/influxdata/telegraf/plugins/parsers"
 )
@@ -31,6 +32,7 @@ type HttpJson struct {
 	Parameters      map[string]string
 	Headers         map[string]string
 	tls.ClientConfig
+	scrape.Config
 
 	client HTTPClient
 }
@@ -93,6 +95,16 @@ var sampleConfig = `
   #   "my_tag_2"
   # ]
 
+  ## Maximum number of servers polled at the same time, unlimited if 0.
+  # max_concurrent_scrapes = 0
+  ## Timeout of the poll of each server, none if 0.
+  # scrape_timeout = "0s"
+  ## Spread the start of the polls of the servers over this duration.
+  # scrape_stagger = "0s"
+  ## Add a httpjson_scrape metric for each server, with the up,
+  ## scrape_duration_seconds and scrape_samples fields.
+  # scrape_metrics = false
+
   ## Optional TLS Config
   # tls_ca = "/etc/telegraf/ca.pem"
   # tls_cert = "/etc/telegraf/cert.pem"
@@ -123,8 +135,12 @@ func (h *HttpJson) Description() string {
 
 // Gathers data for all servers.
 func (h *HttpJson) Gather(acc telegraf.Accumulator) error {
-	var wg sync.WaitGroup
+	return h.GatherContext(context.Background(), acc)
+}
 
+// GatherContext is Gather, cancelling the requests in flight when the
+// context is done.
+func (h *HttpJson) GatherContext(ctx context.Context, acc telegraf.Accumulator) error {
 	if h.client.HTTPClient() == nil {
 		tlsCfg, err := h.ClientConfig.TLSConfig()
 		if err != nil {
@@ -141,21 +157,25 @@ func (h *HttpJson) Gather(acc telegraf.Accumulator) error {
 		h.client.SetHTTPClient(client)
 	}
 
-	for _, server := range h.Servers {
-		wg.Add(1)
-		go func(server string) {
-			defer wg.Done()
-			acc.AddError(h.gatherServer(acc, server))
-		}(server)
+	targets := make([]scrape.Target, 0, len(h.Servers))
+	for _, s := range h.Servers {
+		server := s
+		targets = append(targets, scrape.Target{
+			Name: server,
+			Tags: map[string]string{"server": server},
+			Scrape: func(ctx context.Context, acc telegraf.Accumulator) error {
+				return h.gatherServer(ctx, acc, server)
+			},
+		})
 	}
-
-	wg.Wait()
+	h.Config.Scrape(ctx, acc, "httpjson_scrape", targets)
 
 	return nil
 }
 
 // Gathers data from a particular server
 // Parameters:
+//     ctx      : The context of the request
 //     acc      : The telegraf Accumulator to use
 //     serverURL: endpoint to send request to
 //     service  : the service being queried
@@ -163,10 +183,11 @@ func (h *HttpJson) Gather(acc telegraf.Accumulator) error {
 // Returns:
 //     error: Any error that may have occurred
 func (h *HttpJson) gatherServer(
+	ctx context.Context,
 	acc telegraf.Accumulator,
 	serverURL string,
 ) error {
-	resp, responseTime, err := h.sendRequest(serverURL)
+	resp, responseTime, err := h.sendRequest(ctx, serverURL)
 	if err != nil {
 		return err
 	}
@@ -210,12 +231,13 @@ func (h *HttpJson) gatherServer(
 // Sends an HTTP request to the server using the HttpJson object's HTTPClient.
 // This request can be either a GET or a POST.
 // Parameters:
+//     ctx      : The context of the request
 //     serverURL: endpoint to send request to
 //
 // Returns:
 //     string: body of the response
 //     error : Any error that may have occurred
-func (h *HttpJson) sendRequest(serverURL string) (string, float64, error) {
+func (h *HttpJson) sendRequest(ctx context.Context, serverURL string) (string, float64, error) {
 	// Prepare URL
 	requestURL, err := url.Parse(serverURL)
 	if err != nil {
@@ -244,6 +266,7 @@ func (h *HttpJson) sendRequest(serverURL string) (string, float64, error) {
 	if err != nil {
 		return "", -1, err
 	}
+	req = req.WithContext(ctx)
 
 	// Add header parameters
 	for k, v := range h.Headers {
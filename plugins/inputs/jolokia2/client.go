@@ -2,6 +2,7 @@ package jolokia2
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -118,7 +119,7 @@ func NewClient(url string, config *ClientConfig) (*Client, error) {
 	}, nil
 }
 
-func (c *Client) read(requests []ReadRequest) ([]ReadResponse, error) {
+func (c *Client) read(ctx context.Context, requests []ReadRequest) ([]ReadResponse, error) {
 	jrequests := makeJolokiaRequests(requests, c.config.ProxyConfig)
 	requestBody, err := json.Marshal(jrequests)
 	if err != nil {
@@ -131,6 +132,10 @@ func (c *Client) read(requests []ReadRequest) ([]ReadResponse, error) {
 	}
 
 	req, err := http.NewRequest("POST", requestUrl, bytes.NewBuffer(requestBody))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
 	req.Header.Add("Content-type", "application/json")
 
 	resp, err := c.client.Do(req)
@@ -1,6 +1,7 @@
 package jolokia2
 
 import (
+	"context"
 	"fmt"
 	"sort"
 	"strings"
@@ -24,7 +25,7 @@ func NewGatherer(metrics []Metric) *Gatherer {
 
 // Gather adds points to an accumulator from responses returned
 // by a Jolokia agent.
-func (g *Gatherer) Gather(client *Client, acc telegraf.Accumulator) error {
+func (g *Gatherer) Gather(ctx context.Context, client *Client, acc telegraf.Accumulator) error {
 	var tags map[string]string
 
 	if client.config.ProxyConfig != nil {
@@ -34,7 +35,7 @@ func (g *Gatherer) Gather(client *Client, acc telegraf.Accumulator) error {
 	}
 
 	requests := makeReadRequests(g.metrics)
-	responses, err := client.read(requests)
+	responses, err := client.read(ctx, requests)
 	if err != nil {
 		return err
 	}
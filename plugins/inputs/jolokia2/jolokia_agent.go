@@ -1,12 +1,13 @@
 package jolokia2
 
 import (
+	"context"
 	"fmt"
-	"sync"
 
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/internal"
 	"github.com/influxdata/telegraf/internal/tls"
+	"github.com/influxdata/telegraf/plugins/common/scrape"
 )
 
 type JolokiaAgent struct {
@@ -20,6 +21,7 @@ type JolokiaAgent struct {
 	ResponseTimeout internal.Duration `toml:"response_timeout"`
 
 	tls.ClientConfig
+	scrape.Config
 
 	Metrics  []MetricConfig `toml:"metric"`
 	gatherer *Gatherer
@@ -44,6 +46,16 @@ func (ja *JolokiaAgent) SampleConfig() string {
   # tls_key  = "/var/private/client-key.pem"
   # insecure_skip_verify = false
 
+  ## Maximum number of agents queried at the same time, unlimited if 0.
+  # max_concurrent_scrapes = 0
+  ## Timeout of the query of each agent, none if 0.
+  # scrape_timeout = "0s"
+  ## Spread the start of the queries of the agents over this duration.
+  # scrape_stagger = "0s"
+  ## Add a jolokia2_agent_scrape metric for each agent, with the up,
+  ## scrape_duration_seconds and scrape_samples fields.
+  # scrape_metrics = false
+
   ## Add metrics to read
   [[inputs.jolokia2_agent.metric]]
     name  = "java_runtime"
@@ -57,6 +69,12 @@ func (ja *JolokiaAgent) Description() string {
 }
 
 func (ja *JolokiaAgent) Gather(acc telegraf.Accumulator) error {
+	return ja.GatherContext(context.Background(), acc)
+}
+
+// GatherContext is Gather, cancelling the requests in flight when the
+// context is done.
+func (ja *JolokiaAgent) GatherContext(ctx context.Context, acc telegraf.Accumulator) error {
 	if ja.gatherer == nil {
 		ja.gatherer = NewGatherer(ja.createMetrics())
 	}
@@ -74,22 +92,22 @@ func (ja *JolokiaAgent) Gather(acc telegraf.Accumulator) error {
 		}
 	}
 
-	var wg sync.WaitGroup
-
-	for _, client := range ja.clients {
-		wg.Add(1)
-		go func(client *Client) {
-			defer wg.Done()
-
-			err := ja.gatherer.Gather(client, acc)
-			if err != nil {
-				acc.AddError(fmt.Errorf("Unable to gather metrics for %s: %v", client.URL, err))
-			}
-
-		}(client)
+	targets := make([]scrape.Target, 0, len(ja.clients))
+	for _, c := range ja.clients {
+		client := c
+		targets = append(targets, scrape.Target{
+			Name: client.URL,
+			Tags: map[string]string{"jolokia_agent_url": client.URL},
+			Scrape: func(ctx context.Context, acc telegraf.Accumulator) error {
+				err := ja.gatherer.Gather(ctx, client, acc)
+				if err != nil {
+					return fmt.Errorf("Unable to gather metrics for %s: %v", client.URL, err)
+				}
+				return nil
+			},
+		})
 	}
-
-	wg.Wait()
+	ja.Config.Scrape(ctx, acc, "jolokia2_agent_scrape", targets)
 
 	return nil
 }
@@ -1,6 +1,8 @@
 package jolokia2
 
 import (
+	"context"
+
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/internal"
 	"github.com/influxdata/telegraf/internal/tls"
@@ -85,7 +87,7 @@ func (jp *JolokiaProxy) Gather(acc telegraf.Accumulator) error {
 		jp.client = client
 	}
 
-	return jp.gatherer.Gather(jp.client, acc)
+	return jp.gatherer.Gather(context.Background(), jp.client, acc)
 }
 
 func (jp *JolokiaProxy) createMetrics() []Metric {
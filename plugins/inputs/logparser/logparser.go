@@ -11,6 +11,7 @@ import (
 
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/internal/globpath"
+	"github.com/influxdata/telegraf/plugins/common/fileoffset"
 	"github.com/influxdata/telegraf/plugins/inputs"
 	"github.com/influxdata/telegraf/plugins/parsers"
 )
@@ -20,7 +21,7 @@ const (
 )
 
 var (
-	offsets      = make(map[string]int64)
+	offsets      = make(map[string]fileoffset.Position)
 	offsetsMutex = new(sync.Mutex)
 )
 
@@ -49,7 +50,7 @@ type LogParserPlugin struct {
 	Log telegraf.Logger
 
 	tailers map[string]*tail.Tail
-	offsets map[string]int64
+	offsets map[string]fileoffset.Position
 	lines   chan logEntry
 	done    chan struct{}
 	wg      sync.WaitGroup
@@ -63,7 +64,7 @@ type LogParserPlugin struct {
 
 func NewLogParser() *LogParserPlugin {
 	offsetsMutex.Lock()
-	offsetsCopy := make(map[string]int64, len(offsets))
+	offsetsCopy := make(map[string]fileoffset.Position, len(offsets))
 	for k, v := range offsets {
 		offsetsCopy[k] = v
 	}
@@ -186,10 +187,10 @@ func (l *LogParserPlugin) Start(acc telegraf.Accumulator) error {
 	err = l.tailNewfiles(l.FromBeginning)
 
 	// clear offsets
-	l.offsets = make(map[string]int64)
+	l.offsets = make(map[string]fileoffset.Position)
 	// assumption that once Start is called, all parallel plugins have already been initialized
 	offsetsMutex.Lock()
-	offsets = make(map[string]int64)
+	offsets = make(map[string]fileoffset.Position)
 	offsetsMutex.Unlock()
 
 	return err
@@ -220,8 +221,13 @@ func (l *LogParserPlugin) tailNewfiles(fromBeginning bool) error {
 
 			var seek *tail.SeekInfo
 			if !fromBeginning {
-				if offset, ok := l.offsets[file]; ok {
-					l.Log.Debugf("Using offset %d for file: %v", offset, file)
+				if position, ok := l.offsets[file]; ok {
+					offset, ok := position.Resume(file)
+					if ok {
+						l.Log.Debugf("Using offset %d for file: %v", offset, file)
+					} else {
+						l.Log.Debugf("File %v was rotated or truncated, reading from the beginning", file)
+					}
 					seek = &tail.SeekInfo{
 						Whence: 0,
 						Offset: offset,
@@ -329,10 +335,10 @@ func (l *LogParserPlugin) Stop() {
 	for _, t := range l.tailers {
 		if !l.FromBeginning {
 			// store offset for resume
-			offset, err := t.Tell()
+			position, err := l.position(t)
 			if err == nil {
-				l.offsets[t.Filename] = offset
-				l.Log.Debugf("Recording offset %d for file: %v", offset, t.Filename)
+				l.offsets[t.Filename] = position
+				l.Log.Debugf("Recording offset %d for file: %v", position.Offset, t.Filename)
 			} else {
 				l.acc.AddError(fmt.Errorf("error recording offset for file %s", t.Filename))
 			}
@@ -348,6 +354,8 @@ func (l *LogParserPlugin) Stop() {
 	}
 	close(l.done)
 	l.wg.Wait()
+	// the offsets of the stopped tailers are recorded above
+	l.tailers = make(map[string]*tail.Tail)
 
 	// persist offsets
 	offsetsMutex.Lock()
@@ -357,6 +365,55 @@ func (l *LogParserPlugin) Stop() {
 	offsetsMutex.Unlock()
 }
 
+// position returns the position reached by the tailer.
+func (l *LogParserPlugin) position(t *tail.Tail) (fileoffset.Position, error) {
+	offset, err := t.Tell()
+	if err != nil {
+		return fileoffset.Position{}, err
+	}
+	return fileoffset.New(t.Filename, offset)
+}
+
+// GetState returns the positions reached in the files so they can be
+// persisted.  It is called while the files are tailed, and after Stop.
+func (l *LogParserPlugin) GetState() interface{} {
+	l.Lock()
+	defer l.Unlock()
+
+	state := make(map[string]fileoffset.Position, len(l.offsets)+len(l.tailers))
+	for file, position := range l.offsets {
+		state[file] = position
+	}
+	for _, t := range l.tailers {
+		position, err := l.position(t)
+		if err != nil {
+			l.Log.Debugf("Error recording offset for file %s: %v", t.Filename, err)
+			continue
+		}
+		state[t.Filename] = position
+	}
+	return state
+}
+
+// SetState restores the positions in the files, parsing resumes at them
+// unless from_beginning is set or the files were rotated.
+func (l *LogParserPlugin) SetState(state interface{}) error {
+	positions, ok := state.(map[string]fileoffset.Position)
+	if !ok {
+		return fmt.Errorf("invalid state type %T", state)
+	}
+
+	l.Lock()
+	defer l.Unlock()
+	if l.offsets == nil {
+		l.offsets = make(map[string]fileoffset.Position, len(positions))
+	}
+	for file, position := range positions {
+		l.offsets[file] = position
+	}
+	return nil
+}
+
 func init() {
 	inputs.Add("logparser", func() telegraf.Input {
 		return NewLogParser()
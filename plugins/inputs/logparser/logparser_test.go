@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/plugins/common/fileoffset"
 	"github.com/influxdata/telegraf/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -226,3 +227,36 @@ func getCurrentDir() string {
 	_, filename, _, _ := runtime.Caller(1)
 	return strings.Replace(filename, "logparser_test.go", "", 1)
 }
+
+func TestResumeState(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "")
+	require.NoError(t, err)
+	defer os.Remove(tmpfile.Name())
+	defer tmpfile.Close()
+	_, err = tmpfile.WriteString("first 1\nsecond 2\n")
+	require.NoError(t, err)
+
+	position, err := fileoffset.New(tmpfile.Name(), int64(len("first 1\n")))
+	require.NoError(t, err)
+
+	logparser := NewLogParser()
+	logparser.Log = testutil.Logger{}
+	logparser.Files = []string{tmpfile.Name()}
+	logparser.GrokConfig = GrokConfig{
+		Patterns: []string{"%{WORD:word:tag} %{NUMBER:value:int}"},
+	}
+	require.NoError(t, logparser.SetState(map[string]fileoffset.Position{tmpfile.Name(): position}))
+
+	acc := testutil.Accumulator{}
+	require.NoError(t, logparser.Start(&acc))
+	acc.Wait(1)
+	logparser.Stop()
+
+	require.Len(t, acc.Metrics, 1)
+	acc.AssertContainsTaggedFields(t, "logparser",
+		map[string]interface{}{"value": int64(2)},
+		map[string]string{"word": "second", "path": tmpfile.Name()})
+
+	state := logparser.GetState().(map[string]fileoffset.Position)
+	require.Equal(t, int64(len("first 1\nsecond 2\n")), state[tmpfile.Name()].Offset)
+}
@@ -0,0 +1,365 @@
+package opentelemetry
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	tlsint "github.com/influxdata/telegraf/internal/tls"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/plugins/common/otlp"
+	"github.com/influxdata/telegraf/plugins/inputs"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	_ "google.golang.org/grpc/encoding/gzip" // Register the gzip decompressor
+)
+
+// defaultMaxMessageSize is the default maximum size of a request in bytes.
+const defaultMaxMessageSize = 4 * 1024 * 1024
+
+const sampleConfig = `
+  ## Address and port to accept OTLP/gRPC requests on, set to an empty string
+  ## to disable the gRPC receiver.
+  # service_address = ":4317"
+
+  ## Address and port to accept OTLP/HTTP requests with protobuf encoding on,
+  ## set to an empty string to disable the HTTP receiver.  Requests are
+  ## accepted on the /v1/metrics path.
+  # http_service_address = ":4318"
+
+  ## Maximum size of a request.
+  # max_message_size = "4MB"
+
+  ## maximum duration before timing out read of the HTTP request
+  # read_timeout = "10s"
+  ## maximum duration before timing out write of the HTTP response
+  # write_timeout = "10s"
+
+  ## Set one or more allowed client CA certificate file names to
+  ## enable mutually authenticated TLS connections
+  # tls_allowed_cacerts = ["/etc/telegraf/clientca.pem"]
+
+  ## Add service certificate and key
+  # tls_cert = "/etc/telegraf/cert.pem"
+  # tls_key = "/etc/telegraf/key.pem"
+`
+
+// OpenTelemetry receives metrics sent using the OpenTelemetry protocol.
+type OpenTelemetry struct {
+	ServiceAddress     string            `toml:"service_address"`
+	HTTPServiceAddress string            `toml:"http_service_address"`
+	MaxMessageSize     internal.Size     `toml:"max_message_size"`
+	ReadTimeout        internal.Duration `toml:"read_timeout"`
+	WriteTimeout       internal.Duration `toml:"write_timeout"`
+	tlsint.ServerConfig
+
+	Log telegraf.Logger `toml:"-"`
+
+	acc          telegraf.Accumulator
+	grpcServer   *grpc.Server
+	grpcAddr     net.Addr
+	httpListener net.Listener
+	wg           sync.WaitGroup
+}
+
+func (o *OpenTelemetry) SampleConfig() string {
+	return sampleConfig
+}
+
+func (o *OpenTelemetry) Description() string {
+	return "Receive metrics sent using the OpenTelemetry protocol (OTLP)"
+}
+
+func (o *OpenTelemetry) Gather(_ telegraf.Accumulator) error {
+	return nil
+}
+
+// Start starts the gRPC and HTTP receivers.
+func (o *OpenTelemetry) Start(acc telegraf.Accumulator) error {
+	if o.MaxMessageSize.Size == 0 {
+		o.MaxMessageSize.Size = defaultMaxMessageSize
+	}
+	if o.ReadTimeout.Duration < time.Second {
+		o.ReadTimeout.Duration = time.Second * 10
+	}
+	if o.WriteTimeout.Duration < time.Second {
+		o.WriteTimeout.Duration = time.Second * 10
+	}
+
+	o.acc = acc
+
+	tlsConf, err := o.ServerConfig.TLSConfig()
+	if err != nil {
+		return err
+	}
+
+	if o.ServiceAddress != "" {
+		if err := o.startGRPC(tlsConf); err != nil {
+			return err
+		}
+	}
+
+	if o.HTTPServiceAddress != "" {
+		if err := o.startHTTP(tlsConf); err != nil {
+			o.Stop()
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *OpenTelemetry) startGRPC(tlsConf *tls.Config) error {
+	listener, err := net.Listen("tcp", o.ServiceAddress)
+	if err != nil {
+		return err
+	}
+	o.grpcAddr = listener.Addr()
+
+	opts := []grpc.ServerOption{grpc.MaxRecvMsgSize(int(o.MaxMessageSize.Size))}
+	if tlsConf != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConf)))
+	}
+	o.grpcServer = grpc.NewServer(opts...)
+	otlp.RegisterMetricsServiceServer(o.grpcServer, o)
+
+	o.wg.Add(1)
+	go func() {
+		defer o.wg.Done()
+		if err := o.grpcServer.Serve(listener); err != nil {
+			o.acc.AddError(err)
+		}
+	}()
+
+	o.Log.Infof("Listening for OTLP/gRPC on %s", listener.Addr().String())
+	return nil
+}
+
+func (o *OpenTelemetry) startHTTP(tlsConf *tls.Config) error {
+	var listener net.Listener
+	var err error
+	if tlsConf != nil {
+		listener, err = tls.Listen("tcp", o.HTTPServiceAddress, tlsConf)
+	} else {
+		listener, err = net.Listen("tcp", o.HTTPServiceAddress)
+	}
+	if err != nil {
+		return err
+	}
+	o.httpListener = listener
+
+	server := &http.Server{
+		Handler:      o,
+		ReadTimeout:  o.ReadTimeout.Duration,
+		WriteTimeout: o.WriteTimeout.Duration,
+		TLSConfig:    tlsConf,
+	}
+
+	o.wg.Add(1)
+	go func() {
+		defer o.wg.Done()
+		server.Serve(listener)
+	}()
+
+	o.Log.Infof("Listening for OTLP/HTTP on %s", listener.Addr().String())
+	return nil
+}
+
+// Stop shuts down the receivers.
+func (o *OpenTelemetry) Stop() {
+	if o.grpcServer != nil {
+		o.grpcServer.Stop()
+		o.grpcServer = nil
+	}
+	if o.httpListener != nil {
+		o.httpListener.Close()
+		o.httpListener = nil
+	}
+	o.wg.Wait()
+}
+
+// Export implements otlp.MetricsServiceServer.
+func (o *OpenTelemetry) Export(_ context.Context, req *otlp.ExportMetricsServiceRequest) (*otlp.ExportMetricsServiceResponse, error) {
+	o.addRequest(req)
+	return &otlp.ExportMetricsServiceResponse{}, nil
+}
+
+func (o *OpenTelemetry) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != otlp.HTTPPath {
+		http.NotFound(res, req)
+		return
+	}
+	if req.Method != "POST" {
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.HasPrefix(req.Header.Get("Content-Type"), otlp.ContentType) {
+		// JSON encoded requests are not supported.
+		res.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+	if req.ContentLength > o.MaxMessageSize.Size {
+		res.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(req.Body, o.MaxMessageSize.Size+1))
+	if err != nil {
+		o.Log.Debugf("Error reading request body: %v", err)
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if int64(len(body)) > o.MaxMessageSize.Size {
+		res.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	decoder, err := internal.NewContentDecoder(req.Header.Get("Content-Encoding"))
+	if err != nil {
+		res.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+	if body, err = decoder.Decode(body); err != nil {
+		o.Log.Debugf("Error decoding request body: %v", err)
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	exportReq := &otlp.ExportMetricsServiceRequest{}
+	if err := exportReq.Unmarshal(body); err != nil {
+		o.Log.Debugf("Error decoding request: %v", err)
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	o.addRequest(exportReq)
+
+	resp, _ := (&otlp.ExportMetricsServiceResponse{}).Marshal()
+	res.Header().Set("Content-Type", otlp.ContentType)
+	res.WriteHeader(http.StatusOK)
+	res.Write(resp)
+}
+
+func (o *OpenTelemetry) addRequest(req *otlp.ExportMetricsServiceRequest) {
+	for _, rm := range req.ResourceMetrics {
+		resourceTags := attributeTags(nil, rm.Resource.Attributes)
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				for _, tm := range convert(m, resourceTags) {
+					o.acc.AddMetric(tm)
+				}
+			}
+		}
+	}
+}
+
+// convert returns the Telegraf metrics of an OTLP metric.  Gauges and sums
+// have a single value field, histograms and summaries use the layout of the
+// prometheus input with metric_version 1.
+func convert(m *otlp.Metric, resourceTags map[string]string) []telegraf.Metric {
+	var metrics []telegraf.Metric
+	add := func(attributes []otlp.KeyValue, ts uint64, fields map[string]interface{}, vt telegraf.ValueType) {
+		tags := attributeTags(resourceTags, attributes)
+		t := time.Now()
+		if ts != 0 {
+			t = time.Unix(0, int64(ts))
+		}
+		tm, err := metric.New(m.Name, tags, fields, t, vt)
+		if err != nil {
+			return
+		}
+		metrics = append(metrics, tm)
+	}
+
+	switch {
+	case m.Gauge != nil:
+		for _, dp := range m.Gauge.DataPoints {
+			add(dp.Attributes, dp.TimeUnixNano, map[string]interface{}{"value": dp.Value}, telegraf.Gauge)
+		}
+	case m.Sum != nil:
+		vt := telegraf.Gauge
+		if m.Sum.IsMonotonic {
+			vt = telegraf.Counter
+		}
+		for _, dp := range m.Sum.DataPoints {
+			add(dp.Attributes, dp.TimeUnixNano, map[string]interface{}{"value": dp.Value}, vt)
+		}
+	case m.Histogram != nil:
+		for _, dp := range m.Histogram.DataPoints {
+			fields := map[string]interface{}{
+				"count": float64(dp.Count),
+				"sum":   dp.Sum,
+			}
+			var cumulative uint64
+			for i, count := range dp.BucketCounts {
+				cumulative += count
+				bound := math.Inf(1)
+				if i < len(dp.ExplicitBounds) {
+					bound = dp.ExplicitBounds[i]
+				}
+				fields[formatFloat(bound)] = float64(cumulative)
+			}
+			add(dp.Attributes, dp.TimeUnixNano, fields, telegraf.Histogram)
+		}
+	case m.Summary != nil:
+		for _, dp := range m.Summary.DataPoints {
+			fields := map[string]interface{}{
+				"count": float64(dp.Count),
+				"sum":   dp.Sum,
+			}
+			for _, q := range dp.QuantileValues {
+				fields[formatFloat(q.Quantile)] = q.Value
+			}
+			add(dp.Attributes, dp.TimeUnixNano, fields, telegraf.Summary)
+		}
+	}
+	return metrics
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// attributeTags returns the tags with the attributes added as tags.
+func attributeTags(tags map[string]string, attributes []otlp.KeyValue) map[string]string {
+	result := make(map[string]string, len(tags)+len(attributes))
+	for k, v := range tags {
+		result[k] = v
+	}
+	for _, kv := range attributes {
+		switch v := kv.Value.(type) {
+		case string:
+			result[kv.Key] = v
+		case bool:
+			result[kv.Key] = strconv.FormatBool(v)
+		case int64:
+			result[kv.Key] = strconv.FormatInt(v, 10)
+		case float64:
+			result[kv.Key] = strconv.FormatFloat(v, 'g', -1, 64)
+		case []byte:
+			result[kv.Key] = base64.StdEncoding.EncodeToString(v)
+		}
+	}
+	return result
+}
+
+func init() {
+	inputs.Add("opentelemetry", func() telegraf.Input {
+		return &OpenTelemetry{
+			ServiceAddress:     ":4317",
+			HTTPServiceAddress: ":4318",
+		}
+	})
+}
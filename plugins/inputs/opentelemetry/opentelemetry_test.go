@@ -0,0 +1,216 @@
+package opentelemetry
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/common/otlp"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+var ts = time.Unix(1577836800, 0)
+
+func request() *otlp.ExportMetricsServiceRequest {
+	tsNano := uint64(ts.UnixNano())
+	return &otlp.ExportMetricsServiceRequest{
+		ResourceMetrics: []*otlp.ResourceMetrics{
+			{
+				Resource: otlp.Resource{
+					Attributes: []otlp.KeyValue{
+						{Key: "service.name", Value: "checkout"},
+						{Key: "host", Value: "server01"},
+					},
+				},
+				ScopeMetrics: []*otlp.ScopeMetrics{
+					{
+						Metrics: []*otlp.Metric{
+							{
+								Name: "queue_size",
+								Gauge: &otlp.Gauge{
+									DataPoints: []*otlp.NumberDataPoint{
+										{
+											Attributes:   []otlp.KeyValue{{Key: "queue", Value: "orders"}},
+											TimeUnixNano: tsNano,
+											Value:        int64(12),
+										},
+									},
+								},
+							},
+							{
+								Name: "requests",
+								Sum: &otlp.Sum{
+									DataPoints: []*otlp.NumberDataPoint{
+										{
+											Attributes:   []otlp.KeyValue{{Key: "code", Value: int64(200)}, {Key: "host", Value: "server02"}},
+											TimeUnixNano: tsNano,
+											Value:        1024.0,
+										},
+									},
+									AggregationTemporality: otlp.AggregationTemporalityCumulative,
+									IsMonotonic:            true,
+								},
+							},
+							{
+								Name: "latency",
+								Histogram: &otlp.Histogram{
+									DataPoints: []*otlp.HistogramDataPoint{
+										{
+											TimeUnixNano:   tsNano,
+											Count:          10,
+											Sum:            4.2,
+											BucketCounts:   []uint64{2, 5, 3},
+											ExplicitBounds: []float64{0.1, 0.5},
+										},
+									},
+									AggregationTemporality: otlp.AggregationTemporalityCumulative,
+								},
+							},
+							{
+								Name: "size",
+								Summary: &otlp.Summary{
+									DataPoints: []*otlp.SummaryDataPoint{
+										{
+											Attributes:   []otlp.KeyValue{{Key: "sampled", Value: true}},
+											TimeUnixNano: tsNano,
+											Count:        3,
+											Sum:          300,
+											QuantileValues: []otlp.ValueAtQuantile{
+												{Quantile: 0.5, Value: 100},
+												{Quantile: 0.99, Value: 180},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func expected() []telegraf.Metric {
+	return []telegraf.Metric{
+		testutil.MustMetric("queue_size",
+			map[string]string{"service.name": "checkout", "host": "server01", "queue": "orders"},
+			map[string]interface{}{"value": int64(12)},
+			ts, telegraf.Gauge),
+		testutil.MustMetric("requests",
+			map[string]string{"service.name": "checkout", "host": "server02", "code": "200"},
+			map[string]interface{}{"value": 1024.0},
+			ts, telegraf.Counter),
+		testutil.MustMetric("latency",
+			map[string]string{"service.name": "checkout", "host": "server01"},
+			map[string]interface{}{
+				"count": 10.0,
+				"sum":   4.2,
+				"0.1":   2.0,
+				"0.5":   7.0,
+				"+Inf":  10.0,
+			},
+			ts, telegraf.Histogram),
+		testutil.MustMetric("size",
+			map[string]string{"service.name": "checkout", "host": "server01", "sampled": "true"},
+			map[string]interface{}{
+				"count": 3.0,
+				"sum":   300.0,
+				"0.5":   100.0,
+				"0.99":  180.0,
+			},
+			ts, telegraf.Summary),
+	}
+}
+
+func newReceiver() *OpenTelemetry {
+	return &OpenTelemetry{
+		ServiceAddress:     "127.0.0.1:0",
+		HTTPServiceAddress: "127.0.0.1:0",
+		Log:                testutil.Logger{},
+	}
+}
+
+func TestReceiveGRPC(t *testing.T) {
+	o := newReceiver()
+	acc := &testutil.Accumulator{}
+	require.NoError(t, o.Start(acc))
+	defer o.Stop()
+
+	conn, err := grpc.Dial(o.grpcAddr.String(), grpc.WithInsecure())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = otlp.Export(ctx, conn, request())
+	require.NoError(t, err)
+
+	acc.Wait(4)
+	testutil.RequireMetricsEqual(t, expected(), acc.GetTelegrafMetrics(), testutil.SortMetrics())
+}
+
+func TestReceiveHTTP(t *testing.T) {
+	o := newReceiver()
+	acc := &testutil.Accumulator{}
+	require.NoError(t, o.Start(acc))
+	defer o.Stop()
+
+	body, err := request().Marshal()
+	require.NoError(t, err)
+	encoder, err := internal.NewContentEncoder("gzip")
+	require.NoError(t, err)
+	body, err = encoder.Encode(body)
+	require.NoError(t, err)
+
+	url := "http://" + o.httpListener.Addr().String() + "/v1/metrics"
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "application/x-protobuf", resp.Header.Get("Content-Type"))
+
+	testutil.RequireMetricsEqual(t, expected(), acc.GetTelegrafMetrics(), testutil.SortMetrics())
+}
+
+func TestReceiveHTTPErrors(t *testing.T) {
+	o := newReceiver()
+	o.ServiceAddress = ""
+	o.MaxMessageSize = internal.Size{Size: 16}
+	acc := &testutil.Accumulator{}
+	require.NoError(t, o.Start(acc))
+	defer o.Stop()
+
+	url := "http://" + o.httpListener.Addr().String()
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        []byte
+		status      int
+	}{
+		{"wrong path", "/v1/traces", "application/x-protobuf", nil, http.StatusNotFound},
+		{"json", "/v1/metrics", "application/json", []byte("{}"), http.StatusUnsupportedMediaType},
+		{"too large", "/v1/metrics", "application/x-protobuf", make([]byte, 32), http.StatusRequestEntityTooLarge},
+		{"invalid", "/v1/metrics", "application/x-protobuf", []byte{0x0a, 0x05}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Post(url+tt.path, tt.contentType, bytes.NewReader(tt.body))
+			require.NoError(t, err)
+			resp.Body.Close()
+			require.Equal(t, tt.status, resp.StatusCode)
+		})
+	}
+	require.Empty(t, acc.GetTelegrafMetrics())
+}
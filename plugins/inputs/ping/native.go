@@ -0,0 +1,662 @@
+package ping
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// Sockets of the native method.
+const (
+	socketAuto     = "auto"
+	socketRaw      = "raw"
+	socketDatagram = "datagram"
+)
+
+const (
+	protocolICMP     = 1
+	protocolIPv6ICMP = 58
+
+	defaultSize = 56
+	// maximum payload of an echo request in an IPv4 datagram
+	maxSize = 65535 - 20 - 8
+)
+
+// Target is a host pinged with its own packet options by the native method.
+type Target struct {
+	URL  string `toml:"url"`
+	Size *int   `toml:"size"`
+	TOS  *int   `toml:"tos"`
+}
+
+// nativeTarget is a host pinged by the native method.
+type nativeTarget struct {
+	url  string
+	addr *net.IPAddr
+	size int
+	tos  int
+}
+
+// nativeTargets returns the hosts of urls and targets, with their packet
+// options.
+func (p *Ping) nativeTargets() []nativeTarget {
+	targets := make([]nativeTarget, 0, len(p.Urls)+len(p.Targets))
+	for _, u := range p.Urls {
+		targets = append(targets, nativeTarget{url: u, size: p.Size, tos: p.TOS})
+	}
+	for _, t := range p.Targets {
+		target := nativeTarget{url: t.URL, size: p.Size, tos: p.TOS}
+		if t.Size != nil {
+			target.size = *t.Size
+		}
+		if t.TOS != nil {
+			target.tos = *t.TOS
+		}
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+func (p *Ping) gatherNative(ctx context.Context, acc telegraf.Accumulator) {
+	if p.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(p.Deadline)*time.Second)
+		defer cancel()
+	}
+
+	network := "ip4"
+	if p.IPv6 {
+		network = "ip6"
+	}
+
+	interval := p.PingInterval
+	if interval < 0.2 {
+		interval = 0.2
+	}
+
+	timeout := p.Timeout
+	if timeout == 0 {
+		timeout = 5
+	}
+
+	pinger := newNativePinger(p.NativeSocket, p.listenAddr)
+	defer pinger.close()
+
+	// The first requests to the targets are spread over the interval, so
+	// that the replies do not overflow the buffer of the socket.
+	targets := p.nativeTargets()
+	for i, target := range targets {
+		offset := time.Duration(interval*float64(time.Second)) *
+			time.Duration(i) / time.Duration(len(targets))
+
+		p.wg.Add(1)
+		go func(target nativeTarget) {
+			defer p.wg.Done()
+
+			if err := internal.SleepContext(ctx, offset); err != nil {
+				return
+			}
+
+			addr, err := net.ResolveIPAddr(network, target.url)
+			if err != nil {
+				acc.AddFields(
+					"ping",
+					map[string]interface{}{"result_code": 1},
+					map[string]string{"url": target.url},
+				)
+				acc.AddError(err)
+				return
+			}
+			target.addr = addr
+
+			res := pinger.ping(ctx, &target, p.Count,
+				time.Duration(interval*float64(time.Second)),
+				time.Duration(timeout*float64(time.Second)))
+			if res.sent == 0 && res.err != nil {
+				acc.AddError(fmt.Errorf("host %s: %s", target.url, res.err))
+			}
+
+			tags, fields := onFin(res, target.url, p.Percentiles)
+			acc.AddFields("ping", fields, tags)
+		}(target)
+	}
+
+	p.wg.Wait()
+}
+
+// probe is an echo request sent, waiting for its reply.
+type probe struct {
+	key  probeKey
+	sent time.Time
+
+	// set before done is closed, when the reply is received
+	rtt  time.Duration
+	ttl  int
+	done chan struct{}
+}
+
+type probeKey struct {
+	addr string
+	seq  int
+}
+
+// pingResult is the outcome of the echo requests sent to a target.
+type pingResult struct {
+	sent int
+	// round trip times of the replies, in the order of the requests
+	rtts []time.Duration
+	ttl  int
+	// last error sending the requests
+	err error
+}
+
+// nativePinger sends the echo requests to all the targets of a gather from
+// one socket per address family, and matches the replies with the requests.
+type nativePinger struct {
+	socket string
+	src    string
+	// identifier of the requests sent from raw sockets; the kernel sets the
+	// identifier of the requests sent from datagram sockets.
+	id int
+
+	sync.Mutex
+	conns    map[bool]*icmpConn
+	connErrs map[bool]error
+	probes   map[probeKey]*probe
+	seq      int
+
+	wg sync.WaitGroup
+}
+
+func newNativePinger(socket, src string) *nativePinger {
+	// The global source is not seeded, so the identifier would be the same
+	// for all processes pinging from raw sockets.
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	return &nativePinger{
+		socket:   socket,
+		src:      src,
+		id:       r.Intn(1 << 16),
+		conns:    make(map[bool]*icmpConn),
+		connErrs: make(map[bool]error),
+		probes:   make(map[probeKey]*probe),
+	}
+}
+
+// ping sends count echo requests to the target, every interval, and waits up
+// to timeout for each reply.
+func (np *nativePinger) ping(
+	ctx context.Context,
+	target *nativeTarget,
+	count int,
+	interval time.Duration,
+	timeout time.Duration,
+) pingResult {
+	res := pingResult{ttl: -1}
+
+	c, err := np.conn(target.addr.IP.To4() == nil)
+	if err != nil {
+		res.err = err
+		return res
+	}
+
+	payload := make([]byte, target.size)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	probes := make([]*probe, 0, count)
+	defer func() {
+		np.forget(probes)
+	}()
+
+send:
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				break send
+			case <-ticker.C:
+			}
+		}
+
+		pr, err := np.send(c, target, payload)
+		if err != nil {
+			res.err = err
+			continue
+		}
+		res.sent++
+		probes = append(probes, pr)
+	}
+
+	for _, pr := range probes {
+		if waitReply(ctx, pr, timeout) {
+			res.rtts = append(res.rtts, pr.rtt)
+			res.ttl = pr.ttl
+		}
+	}
+	return res
+}
+
+// waitReply returns whether the reply of the probe is received within the
+// timeout.
+func waitReply(ctx context.Context, pr *probe, timeout time.Duration) bool {
+	select {
+	case <-pr.done:
+		return true
+	default:
+	}
+
+	timer := time.NewTimer(time.Until(pr.sent.Add(timeout)))
+	defer timer.Stop()
+	select {
+	case <-pr.done:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// conn returns the socket of the address family, opening it on first use.
+func (np *nativePinger) conn(v6 bool) (*icmpConn, error) {
+	np.Lock()
+	defer np.Unlock()
+
+	if c, ok := np.conns[v6]; ok {
+		return c, nil
+	}
+	if err, ok := np.connErrs[v6]; ok {
+		return nil, err
+	}
+
+	c, err := listen(np.socket, np.src, v6)
+	if err != nil {
+		np.connErrs[v6] = err
+		return nil, err
+	}
+	np.conns[v6] = c
+
+	np.wg.Add(1)
+	go func() {
+		defer np.wg.Done()
+		np.receive(c)
+	}()
+	return c, nil
+}
+
+func (np *nativePinger) send(c *icmpConn, target *nativeTarget, payload []byte) (*probe, error) {
+	np.Lock()
+	np.seq = (np.seq + 1) & 0xffff
+	seq := np.seq
+	np.Unlock()
+
+	var typ icmp.Type = ipv4.ICMPTypeEcho
+	if c.ipv6 {
+		typ = ipv6.ICMPTypeEchoRequest
+	}
+	msg := icmp.Message{
+		Type: typ,
+		Body: &icmp.Echo{ID: np.id, Seq: seq, Data: payload},
+	}
+	b, err := msg.Marshal(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	pr := &probe{
+		key:  probeKey{addr: target.addr.IP.String(), seq: seq},
+		done: make(chan struct{}),
+	}
+	np.Lock()
+	np.probes[pr.key] = pr
+	pr.sent = time.Now()
+	np.Unlock()
+
+	if err := c.send(b, target.addr, target.tos); err != nil {
+		np.forget([]*probe{pr})
+		return nil, err
+	}
+	return pr, nil
+}
+
+// forget stops waiting for the replies of the probes.
+func (np *nativePinger) forget(probes []*probe) {
+	np.Lock()
+	defer np.Unlock()
+	for _, pr := range probes {
+		delete(np.probes, pr.key)
+	}
+}
+
+// receive matches the replies read from the socket with the probes, until the
+// socket is closed.
+func (np *nativePinger) receive(c *icmpConn) {
+	proto := protocolICMP
+	if c.ipv6 {
+		proto = protocolIPv6ICMP
+	}
+
+	b := make([]byte, 65536)
+	for {
+		n, ttl, src, err := c.read(b)
+		received := time.Now()
+		if err != nil {
+			if err, ok := err.(net.Error); ok && err.Temporary() {
+				continue
+			}
+			return
+		}
+
+		m, err := icmp.ParseMessage(proto, b[:n])
+		if err != nil {
+			continue
+		}
+		if m.Type != ipv4.ICMPTypeEchoReply && m.Type != ipv6.ICMPTypeEchoReply {
+			continue
+		}
+		echo, ok := m.Body.(*icmp.Echo)
+		if !ok || (!c.datagram && echo.ID != np.id) {
+			continue
+		}
+
+		key := probeKey{addr: src.String(), seq: echo.Seq}
+		np.Lock()
+		if pr, ok := np.probes[key]; ok {
+			delete(np.probes, key)
+			pr.rtt = received.Sub(pr.sent)
+			pr.ttl = ttl
+			close(pr.done)
+		}
+		np.Unlock()
+	}
+}
+
+// close closes the sockets, and waits for the receivers to stop.
+func (np *nativePinger) close() {
+	np.Lock()
+	for _, c := range np.conns {
+		c.Close()
+	}
+	np.Unlock()
+	np.wg.Wait()
+}
+
+// icmpConn is an ICMP socket of an address family.
+type icmpConn struct {
+	*icmp.PacketConn
+	ipv6     bool
+	datagram bool
+
+	// serializes the writes, each setting the type of service
+	mu  sync.Mutex
+	tos int
+}
+
+// listen opens a raw or datagram ICMP socket; with the auto socket a
+// datagram socket is opened when a raw socket is not permitted.
+func listen(socket, src string, v6 bool) (*icmpConn, error) {
+	address := "0.0.0.0"
+	if v6 {
+		address = "::"
+	}
+	if ip := net.ParseIP(src); ip != nil && (ip.To4() == nil) == v6 {
+		address = ip.String()
+	}
+
+	raw, datagram := "ip4:icmp", "udp4"
+	if v6 {
+		raw, datagram = "ip6:ipv6-icmp", "udp6"
+	}
+
+	var c *icmp.PacketConn
+	var err error
+	switch socket {
+	case socketRaw:
+		c, err = icmp.ListenPacket(raw, address)
+	case socketDatagram:
+		c, err = icmp.ListenPacket(datagram, address)
+	default:
+		c, err = icmp.ListenPacket(raw, address)
+		if err != nil {
+			var err2 error
+			c, err2 = icmp.ListenPacket(datagram, address)
+			if err2 != nil {
+				err = fmt.Errorf("%s: %s", err, err2)
+			} else {
+				socket, err = socketDatagram, nil
+			}
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error listening for ICMP packets: %s", err)
+	}
+
+	conn := &icmpConn{PacketConn: c, ipv6: v6, datagram: socket == socketDatagram}
+	// The TTL of the replies and the filters are not available on all
+	// platforms.  A raw socket receives all the ICMP messages of the host,
+	// including the echo requests sent to the loopback interface.
+	if v6 {
+		c.IPv6PacketConn().SetControlMessage(ipv6.FlagHopLimit, true)
+		if !conn.datagram {
+			var f ipv6.ICMPFilter
+			f.SetAll(true)
+			f.Accept(ipv6.ICMPTypeEchoReply)
+			c.IPv6PacketConn().SetICMPFilter(&f)
+		}
+	} else {
+		c.IPv4PacketConn().SetControlMessage(ipv4.FlagTTL, true)
+		if !conn.datagram {
+			var f ipv4.ICMPFilter
+			f.SetAll(true)
+			f.Accept(ipv4.ICMPTypeEchoReply)
+			c.IPv4PacketConn().SetICMPFilter(&f)
+		}
+	}
+	return conn, nil
+}
+
+func (c *icmpConn) send(b []byte, dst *net.IPAddr, tos int) error {
+	var addr net.Addr = dst
+	if c.datagram {
+		addr = &net.UDPAddr{IP: dst.IP, Zone: dst.Zone}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if tos != c.tos {
+		var err error
+		if c.ipv6 {
+			err = c.IPv6PacketConn().SetTrafficClass(tos)
+		} else {
+			err = c.IPv4PacketConn().SetTOS(tos)
+		}
+		if err != nil {
+			return fmt.Errorf("setting type of service: %s", err)
+		}
+		c.tos = tos
+	}
+
+	_, err := c.WriteTo(b, addr)
+	return err
+}
+
+// read reads an ICMP message, and returns its size, TTL or -1 when not
+// available, and source address.
+func (c *icmpConn) read(b []byte) (int, int, net.IP, error) {
+	var n int
+	var src net.Addr
+	var err error
+	ttl := -1
+	if c.ipv6 {
+		var cm *ipv6.ControlMessage
+		n, cm, src, err = c.IPv6PacketConn().ReadFrom(b)
+		if cm != nil {
+			ttl = cm.HopLimit
+		}
+	} else {
+		var cm *ipv4.ControlMessage
+		n, cm, src, err = c.IPv4PacketConn().ReadFrom(b)
+		if cm != nil {
+			ttl = cm.TTL
+		}
+	}
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	switch addr := src.(type) {
+	case *net.IPAddr:
+		return n, ttl, addr.IP, nil
+	case *net.UDPAddr:
+		return n, ttl, addr.IP, nil
+	}
+	return n, ttl, nil, nil
+}
+
+func onFin(res pingResult, destination string, percentiles []int) (map[string]string, map[string]interface{}) {
+	packetsSent := res.sent
+	packetsRcvd := len(res.rtts)
+
+	tags := map[string]string{"url": destination}
+	fields := map[string]interface{}{
+		"result_code":         0,
+		"packets_transmitted": packetsSent,
+		"packets_received":    packetsRcvd,
+	}
+
+	if packetsSent == 0 {
+		if res.err != nil {
+			fields["result_code"] = 2
+		}
+		return tags, fields
+	}
+
+	if packetsRcvd == 0 {
+		if res.err != nil {
+			fields["result_code"] = 1
+		}
+		fields["percent_packet_loss"] = float64(100)
+		return tags, fields
+	}
+
+	loss := float64(packetsSent-packetsRcvd) / float64(packetsSent) * 100
+	fields["percent_packet_loss"] = loss
+
+	var min, max, avg, total time.Duration
+	min = res.rtts[0]
+	max = res.rtts[0]
+
+	for _, rtt := range res.rtts {
+		if rtt < min {
+			min = rtt
+		}
+		if rtt > max {
+			max = rtt
+		}
+		total += rtt
+	}
+
+	avg = total / time.Duration(packetsRcvd)
+	var sumsquares time.Duration
+	for _, rtt := range res.rtts {
+		sumsquares += (rtt - avg) * (rtt - avg)
+	}
+	stdDev := time.Duration(math.Sqrt(float64(sumsquares / time.Duration(packetsRcvd))))
+
+	// Set TTL only on supported platform. See golang.org/x/net/ipv4/payload_cmsg.go
+	switch runtime.GOOS {
+	case "aix", "darwin", "dragonfly", "freebsd", "linux", "netbsd", "openbsd", "solaris":
+		if res.ttl >= 0 {
+			fields["ttl"] = res.ttl
+		}
+	}
+
+	fields["minimum_response_ms"] = durationMs(min)
+	fields["average_response_ms"] = durationMs(avg)
+	fields["maximum_response_ms"] = durationMs(max)
+	fields["standard_deviation_ms"] = durationMs(stdDev)
+
+	jitter := jitter(res.rtts)
+	if packetsRcvd > 1 {
+		fields["jitter_ms"] = durationMs(jitter)
+	}
+	fields["mos"] = mos(avg, jitter, loss)
+
+	if len(percentiles) > 0 {
+		sorted := make([]time.Duration, len(res.rtts))
+		copy(sorted, res.rtts)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		for _, perc := range percentiles {
+			fields[fmt.Sprintf("percentile%d_response_ms", perc)] = durationMs(percentile(sorted, perc))
+		}
+	}
+
+	return tags, fields
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d.Nanoseconds()) / float64(time.Millisecond)
+}
+
+// jitter returns the mean difference between the consecutive round trip
+// times.
+func jitter(rtts []time.Duration) time.Duration {
+	if len(rtts) < 2 {
+		return 0
+	}
+	var total time.Duration
+	for i := 1; i < len(rtts); i++ {
+		d := rtts[i] - rtts[i-1]
+		if d < 0 {
+			d = -d
+		}
+		total += d
+	}
+	return total / time.Duration(len(rtts)-1)
+}
+
+// percentile returns the nearest rank percentile of the sorted round trip
+// times.
+func percentile(sorted []time.Duration, perc int) time.Duration {
+	rank := int(math.Ceil(float64(perc) / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// mos estimates the mean opinion score of a voice call over the path, from
+// 1 (bad) to 4.4 (best), with the simplified E-model of ITU-T G.107.
+func mos(latency, jitter time.Duration, loss float64) float64 {
+	effective := durationMs(latency) + 2*durationMs(jitter) + 10
+
+	var r float64
+	if effective < 160 {
+		r = 93.2 - effective/40
+	} else {
+		r = 93.2 - (effective-120)/10
+	}
+	r -= 2.5 * loss
+
+	if r < 0 {
+		return 1
+	}
+	return 1 + 0.035*r + 0.000007*r*(r-60)*(100-r)
+}
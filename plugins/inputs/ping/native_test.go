@@ -0,0 +1,121 @@
+package ping
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNativeLoopback(t *testing.T) {
+	for _, socket := range []string{socketRaw, socketDatagram} {
+		t.Run(socket, func(t *testing.T) {
+			c, err := listen(socket, "", false)
+			if err != nil {
+				t.Skipf("Skipping test, cannot open ICMP %s socket: %s", socket, err)
+			}
+			c.Close()
+
+			size, tos := 1000, 184
+			p := &Ping{
+				Urls:         []string{"127.0.0.1"},
+				Targets:      []Target{{URL: "127.0.0.2", Size: &size, TOS: &tos}},
+				Method:       "native",
+				Count:        3,
+				PingInterval: 0.2,
+				Timeout:      1,
+				NativeSocket: socket,
+				Size:         defaultSize,
+				Percentiles:  []int{50, 99},
+			}
+			require.NoError(t, p.Init())
+
+			var acc testutil.Accumulator
+			require.NoError(t, p.Gather(&acc))
+			require.Empty(t, acc.Errors)
+
+			for _, url := range []string{"127.0.0.1", "127.0.0.2"} {
+				tags := map[string]string{"url": url}
+				require.True(t, acc.HasPoint("ping", tags, "packets_transmitted", 3), url)
+				require.True(t, acc.HasPoint("ping", tags, "packets_received", 3), url)
+				require.True(t, acc.HasPoint("ping", tags, "result_code", 0), url)
+				for _, field := range []string{
+					"average_response_ms",
+					"jitter_ms",
+					"mos",
+					"percentile50_response_ms",
+					"percentile99_response_ms",
+				} {
+					require.True(t, acc.HasFloatField("ping", field), field)
+				}
+			}
+		})
+	}
+}
+
+func TestOnFin(t *testing.T) {
+	res := pingResult{
+		sent: 5,
+		rtts: []time.Duration{
+			10 * time.Millisecond,
+			30 * time.Millisecond,
+			20 * time.Millisecond,
+			40 * time.Millisecond,
+		},
+		ttl: 64,
+	}
+	tags, fields := onFin(res, "example.org", []int{50, 75, 100})
+
+	require.Equal(t, map[string]string{"url": "example.org"}, tags)
+	require.Equal(t, 5, fields["packets_transmitted"])
+	require.Equal(t, 4, fields["packets_received"])
+	require.Equal(t, float64(20), fields["percent_packet_loss"])
+	require.Equal(t, float64(10), fields["minimum_response_ms"])
+	require.Equal(t, float64(25), fields["average_response_ms"])
+	require.Equal(t, float64(40), fields["maximum_response_ms"])
+	// |30-10|, |20-30|, |40-20|
+	require.InDelta(t, 50.0/3, fields["jitter_ms"], 0.001)
+	require.Equal(t, float64(20), fields["percentile50_response_ms"])
+	require.Equal(t, float64(30), fields["percentile75_response_ms"])
+	require.Equal(t, float64(40), fields["percentile100_response_ms"])
+	// R = 93.2 - (25 + 2 * 16.67 + 10) / 40 - 2.5 * 20 = 41.53
+	require.InDelta(t, 2.1, fields["mos"], 0.05)
+}
+
+func TestOnFinNoReply(t *testing.T) {
+	_, fields := onFin(pingResult{sent: 3}, "example.org", nil)
+	require.Equal(t, map[string]interface{}{
+		"result_code":         0,
+		"packets_transmitted": 3,
+		"packets_received":    0,
+		"percent_packet_loss": float64(100),
+	}, fields)
+
+	_, fields = onFin(pingResult{err: errors.New("socket: operation not permitted")}, "example.org", nil)
+	require.Equal(t, 2, fields["result_code"])
+}
+
+func TestMOS(t *testing.T) {
+	require.InDelta(t, 4.4, mos(0, 0, 0), 0.05)
+	require.True(t, mos(20*time.Millisecond, 0, 0) > mos(200*time.Millisecond, 0, 0))
+	require.True(t, mos(20*time.Millisecond, 0, 0) > mos(20*time.Millisecond, 10*time.Millisecond, 0))
+	require.True(t, mos(20*time.Millisecond, 0, 0) > mos(20*time.Millisecond, 0, 5))
+	require.Equal(t, float64(1), mos(20*time.Millisecond, 0, 100))
+}
+
+func TestInitNative(t *testing.T) {
+	size, tos := -1, 256
+	for _, p := range []*Ping{
+		{Count: 1, NativeSocket: "icmp"},
+		{Count: 1, NativeSocket: socketAuto, Size: maxSize + 1},
+		{Count: 1, NativeSocket: socketAuto, TOS: 256},
+		{Count: 1, NativeSocket: socketAuto, Percentiles: []int{0}},
+		{Count: 1, NativeSocket: socketAuto, Targets: []Target{{}}},
+		{Count: 1, NativeSocket: socketAuto, Targets: []Target{{URL: "a", Size: &size}}},
+		{Count: 1, NativeSocket: socketAuto, Targets: []Target{{URL: "a", TOS: &tos}}},
+	} {
+		require.Error(t, p.Init())
+	}
+}
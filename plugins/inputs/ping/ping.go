@@ -3,16 +3,12 @@ package ping
 import (
 	"context"
 	"errors"
-	"log"
-	"math"
+	"fmt"
 	"net"
 	"os/exec"
-	"runtime"
-	"strings"
 	"sync"
 	"time"
 
-	"github.com/glinton/ping"
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/internal"
 	"github.com/influxdata/telegraf/plugins/inputs"
@@ -57,6 +53,21 @@ type Ping struct {
 	// Whether to resolve addresses using ipv6 or not.
 	IPv6 bool
 
+	// Socket used by the native method (auto, raw or datagram)
+	NativeSocket string `toml:"native_socket"`
+
+	// Size of the payload of the packets sent by the native method
+	Size int
+
+	// Type of service of the packets sent by the native method
+	TOS int `toml:"tos"`
+
+	// Percentiles of the response times reported by the native method
+	Percentiles []int
+
+	// Hosts pinged with their own packet options by the native method
+	Targets []Target `toml:"target"`
+
 	// host ping function
 	pingHost HostPinger
 
@@ -111,6 +122,30 @@ const sampleConfig = `
 
   ## Use only IPv6 addresses when resolving a hostname.
   # ipv6 = false
+
+  ## Socket used for sending pings with the native method, one of:
+  ##   "auto"     - a raw socket if permitted, else a datagram socket
+  ##   "raw"      - a raw ICMP socket, requiring privileges
+  ##   "datagram" - an unprivileged ICMP datagram socket; on Linux the group
+  ##                of the process must be in net.ipv4.ping_group_range
+  # native_socket = "auto"
+
+  ## Size of the payload of the ping packets in bytes, with the native method.
+  # size = 56
+
+  ## Type of service of the ping packets, with the native method.
+  # tos = 0
+
+  ## Percentiles of the response times to report with the native method, as
+  ## the percentile<N>_response_ms fields.  None by default.
+  # percentiles = [50, 95, 99]
+
+  ## Hosts to ping with their own packet size or type of service, with the
+  ## native method.
+  # [[inputs.ping.target]]
+  #   url = "voip.example.org"
+  #   size = 160
+  #   tos = 184
 `
 
 func (*Ping) SampleConfig() string {
@@ -118,10 +153,21 @@ func (*Ping) SampleConfig() string {
 }
 
 func (p *Ping) Gather(acc telegraf.Accumulator) error {
+	return p.GatherContext(context.Background(), acc)
+}
+
+// GatherContext is Gather, stopping the pings of the native method when the
+// context is done.
+func (p *Ping) GatherContext(ctx context.Context, acc telegraf.Accumulator) error {
 	if p.Interface != "" && p.listenAddr == "" {
 		p.listenAddr = getAddr(p.Interface)
 	}
 
+	if p.Method == "native" {
+		p.gatherNative(ctx, acc)
+		return nil
+	}
+
 	for _, host := range p.Urls {
 		_, err := net.LookupHost(host)
 		if err != nil {
@@ -133,13 +179,7 @@ func (p *Ping) Gather(acc telegraf.Accumulator) error {
 		p.wg.Add(1)
 		go func(host string) {
 			defer p.wg.Done()
-
-			switch p.Method {
-			case "native":
-				p.pingToURLNative(host, acc)
-			default:
-				p.pingToURL(host, acc)
-			}
+			p.pingToURL(host, acc)
 		}(host)
 	}
 
@@ -194,195 +234,39 @@ func hostPinger(binary string, timeout float64, args ...string) (string, error)
 	return string(out), err
 }
 
-func (p *Ping) pingToURLNative(destination string, acc telegraf.Accumulator) {
-	ctx := context.Background()
-
-	network := "ip4"
-	if p.IPv6 {
-		network = "ip6"
-	}
-
-	host, err := net.ResolveIPAddr(network, destination)
-	if err != nil {
-		acc.AddFields(
-			"ping",
-			map[string]interface{}{"result_code": 1},
-			map[string]string{"url": destination},
-		)
-		acc.AddError(err)
-		return
+// Init ensures the plugin is configured correctly.
+func (p *Ping) Init() error {
+	if p.Count < 1 {
+		return errors.New("bad number of packets to transmit")
 	}
 
-	interval := p.PingInterval
-	if interval < 0.2 {
-		interval = 0.2
+	switch p.NativeSocket {
+	case socketAuto, socketRaw, socketDatagram:
+	default:
+		return fmt.Errorf("invalid native_socket %q", p.NativeSocket)
 	}
 
-	timeout := p.Timeout
-	if timeout == 0 {
-		timeout = 5
+	if p.Size < 0 || p.Size > maxSize {
+		return fmt.Errorf("size must be between 0 and %d", maxSize)
 	}
-
-	tick := time.NewTicker(time.Duration(interval * float64(time.Second)))
-	defer tick.Stop()
-
-	if p.Deadline > 0 {
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, time.Duration(p.Deadline)*time.Second)
-		defer cancel()
+	if p.TOS < 0 || p.TOS > 255 {
+		return errors.New("tos must be between 0 and 255")
 	}
-
-	resps := make(chan *ping.Response)
-	rsps := []*ping.Response{}
-
-	r := &sync.WaitGroup{}
-	r.Add(1)
-	go func() {
-		for res := range resps {
-			rsps = append(rsps, res)
+	for _, t := range p.Targets {
+		if t.URL == "" {
+			return errors.New("target without url")
 		}
-		r.Done()
-	}()
-
-	wg := &sync.WaitGroup{}
-	c := ping.Client{}
-
-	var doErr error
-	var packetsSent int
-
-	type sentReq struct {
-		err  error
-		sent bool
-	}
-	sents := make(chan sentReq)
-
-	r.Add(1)
-	go func() {
-		for sent := range sents {
-			if sent.err != nil {
-				doErr = sent.err
-			}
-			if sent.sent {
-				packetsSent++
-			}
+		if t.Size != nil && (*t.Size < 0 || *t.Size > maxSize) {
+			return fmt.Errorf("size of target %s must be between 0 and %d", t.URL, maxSize)
 		}
-		r.Done()
-	}()
-
-	for i := 0; i < p.Count; i++ {
-		select {
-		case <-ctx.Done():
-			goto finish
-		case <-tick.C:
-			ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout*float64(time.Second)))
-			defer cancel()
-
-			wg.Add(1)
-			go func(seq int) {
-				defer wg.Done()
-				resp, err := c.Do(ctx, &ping.Request{
-					Dst: net.ParseIP(host.String()),
-					Src: net.ParseIP(p.listenAddr),
-					Seq: seq,
-				})
-
-				sent := sentReq{err: err, sent: true}
-				if err != nil {
-					if strings.Contains(err.Error(), "not permitted") {
-						sent.sent = false
-					}
-					sents <- sent
-					return
-				}
-
-				resps <- resp
-				sents <- sent
-			}(i + 1)
+		if t.TOS != nil && (*t.TOS < 0 || *t.TOS > 255) {
+			return fmt.Errorf("tos of target %s must be between 0 and 255", t.URL)
 		}
 	}
-
-finish:
-	wg.Wait()
-	close(resps)
-	close(sents)
-
-	r.Wait()
-
-	if doErr != nil && strings.Contains(doErr.Error(), "not permitted") {
-		log.Printf("D! [inputs.ping] %s", doErr.Error())
-	}
-
-	tags, fields := onFin(packetsSent, rsps, doErr, destination)
-	acc.AddFields("ping", fields, tags)
-}
-
-func onFin(packetsSent int, resps []*ping.Response, err error, destination string) (map[string]string, map[string]interface{}) {
-	packetsRcvd := len(resps)
-
-	tags := map[string]string{"url": destination}
-	fields := map[string]interface{}{
-		"result_code":         0,
-		"packets_transmitted": packetsSent,
-		"packets_received":    packetsRcvd,
-	}
-
-	if packetsSent == 0 {
-		if err != nil {
-			fields["result_code"] = 2
-		}
-		return tags, fields
-	}
-
-	if packetsRcvd == 0 {
-		if err != nil {
-			fields["result_code"] = 1
+	for _, perc := range p.Percentiles {
+		if perc <= 0 || perc > 100 {
+			return fmt.Errorf("invalid percentile %d", perc)
 		}
-		fields["percent_packet_loss"] = float64(100)
-		return tags, fields
-	}
-
-	fields["percent_packet_loss"] = float64(packetsSent-packetsRcvd) / float64(packetsSent) * 100
-	ttl := resps[0].TTL
-
-	var min, max, avg, total time.Duration
-	min = resps[0].RTT
-	max = resps[0].RTT
-
-	for _, res := range resps {
-		if res.RTT < min {
-			min = res.RTT
-		}
-		if res.RTT > max {
-			max = res.RTT
-		}
-		total += res.RTT
-	}
-
-	avg = total / time.Duration(packetsRcvd)
-	var sumsquares time.Duration
-	for _, res := range resps {
-		sumsquares += (res.RTT - avg) * (res.RTT - avg)
-	}
-	stdDev := time.Duration(math.Sqrt(float64(sumsquares / time.Duration(packetsRcvd))))
-
-	// Set TTL only on supported platform. See golang.org/x/net/ipv4/payload_cmsg.go
-	switch runtime.GOOS {
-	case "aix", "darwin", "dragonfly", "freebsd", "linux", "netbsd", "openbsd", "solaris":
-		fields["ttl"] = ttl
-	}
-
-	fields["minimum_response_ms"] = float64(min.Nanoseconds()) / float64(time.Millisecond)
-	fields["average_response_ms"] = float64(avg.Nanoseconds()) / float64(time.Millisecond)
-	fields["maximum_response_ms"] = float64(max.Nanoseconds()) / float64(time.Millisecond)
-	fields["standard_deviation_ms"] = float64(stdDev.Nanoseconds()) / float64(time.Millisecond)
-
-	return tags, fields
-}
-
-// Init ensures the plugin is configured correctly.
-func (p *Ping) Init() error {
-	if p.Count < 1 {
-		return errors.New("bad number of packets to transmit")
 	}
 
 	return nil
@@ -399,6 +283,8 @@ func init() {
 			Method:       "exec",
 			Binary:       "ping",
 			Arguments:    []string{},
+			NativeSocket: socketAuto,
+			Size:         defaultSize,
 		}
 	})
 }
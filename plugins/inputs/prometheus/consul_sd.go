@@ -0,0 +1,139 @@
+package prometheus
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// ConsulSD discovers the targets from the Consul catalog, like the
+// Prometheus consul_sd_configs.
+type ConsulSD struct {
+	// Address and scheme of the Consul API.
+	Address string `toml:"address"`
+	Scheme  string `toml:"scheme"`
+	// Datacenter to query, the one of the agent by default.
+	Datacenter string `toml:"datacenter"`
+	Token      string `toml:"token"`
+	// Services to discover, all by default.
+	Services []string `toml:"services"`
+	// Tags the services must all have.
+	Tags []string `toml:"tags"`
+
+	sdConfig
+
+	client *api.Client
+}
+
+func (c *ConsulSD) init() error {
+	config := api.DefaultConfig()
+	if c.Address != "" {
+		config.Address = c.Address
+	}
+	if c.Scheme != "" {
+		config.Scheme = c.Scheme
+	}
+	if c.Datacenter != "" {
+		config.Datacenter = c.Datacenter
+	}
+	if c.Token != "" {
+		config.Token = c.Token
+	}
+
+	client, err := api.NewClient(config)
+	if err != nil {
+		return err
+	}
+	c.client = client
+	return nil
+}
+
+func (c *ConsulSD) discover(ctx context.Context) ([]*targetGroup, error) {
+	opts := (&api.QueryOptions{}).WithContext(ctx)
+	services, _, err := c.client.Catalog().Services(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []*targetGroup
+	for name, tags := range services {
+		if !c.wanted(name, tags) {
+			continue
+		}
+
+		nodes, _, err := c.client.Catalog().Service(name, "", opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, node := range nodes {
+			groups = append(groups, consulTargetGroup(node))
+		}
+	}
+	return groups, nil
+}
+
+// wanted reports whether the service is in the services and has all the tags
+// configured.
+func (c *ConsulSD) wanted(name string, tags []string) bool {
+	if len(c.Services) > 0 {
+		found := false
+		for _, s := range c.Services {
+			if s == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	for _, want := range c.Tags {
+		found := false
+		for _, tag := range tags {
+			if tag == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func consulTargetGroup(node *api.CatalogService) *targetGroup {
+	host := node.ServiceAddress
+	if host == "" {
+		host = node.Address
+	}
+	port := strconv.Itoa(node.ServicePort)
+
+	labels := map[string]string{
+		"__meta_consul_address":         node.Address,
+		"__meta_consul_dc":              node.Datacenter,
+		"__meta_consul_node":            node.Node,
+		"__meta_consul_service":         node.ServiceName,
+		"__meta_consul_service_address": node.ServiceAddress,
+		"__meta_consul_service_id":      node.ServiceID,
+		"__meta_consul_service_port":    port,
+		// the tags are surrounded by the separator so they can be matched
+		// with a regex such as ".*,tag,.*"
+		"__meta_consul_tags": "," + strings.Join(node.ServiceTags, ",") + ",",
+	}
+	for k, v := range node.NodeMeta {
+		labels["__meta_consul_metadata_"+sanitizeLabelName(k)] = v
+	}
+	for k, v := range node.ServiceMeta {
+		labels["__meta_consul_service_metadata_"+sanitizeLabelName(k)] = v
+	}
+
+	return &targetGroup{
+		Targets: []string{net.JoinHostPort(host, port)},
+		Labels:  labels,
+	}
+}
@@ -0,0 +1,209 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf/internal"
+)
+
+const (
+	addressLabel     = "__address__"
+	schemeLabel      = "__scheme__"
+	metricsPathLabel = "__metrics_path__"
+	paramLabelPrefix = "__param_"
+
+	defaultRefreshInterval = 30 * time.Second
+)
+
+var invalidLabelCharRe = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// targetGroup is a set of targets sharing the same labels, in the format of
+// the Prometheus file based discovery.
+type targetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// discoverer finds scrape targets.
+type discoverer interface {
+	// discover returns the targets currently found.
+	discover(ctx context.Context) ([]*targetGroup, error)
+}
+
+// sdConfig holds the options common to the discovery providers.
+type sdConfig struct {
+	RefreshInterval internal.Duration `toml:"refresh_interval"`
+}
+
+func (c *sdConfig) refreshInterval() time.Duration {
+	if c.RefreshInterval.Duration <= 0 {
+		return defaultRefreshInterval
+	}
+	return c.RefreshInterval.Duration
+}
+
+// sanitizeLabelName replaces the characters not allowed in label names.
+func sanitizeLabelName(name string) string {
+	return invalidLabelCharRe.ReplaceAllString(name, "_")
+}
+
+// initDiscovery validates the relabeling rules and the discovery providers.
+func (p *Prometheus) initDiscovery() error {
+	for i, r := range p.Relabel {
+		if err := r.init(); err != nil {
+			return fmt.Errorf("relabel %d: %v", i, err)
+		}
+	}
+
+	p.discoverers = nil
+	p.discoveredTargets = make(map[string]map[string]URLAndAddress)
+	add := func(kind string, i int, d discoverer, interval time.Duration, err error) error {
+		if err != nil {
+			return fmt.Errorf("%s %d: %v", kind, i, err)
+		}
+		p.discoverers = append(p.discoverers, discovery{
+			name:     fmt.Sprintf("%s/%d", kind, i),
+			d:        d,
+			interval: interval,
+		})
+		return nil
+	}
+	for i, c := range p.FileSD {
+		if err := add("file_sd", i, c, c.refreshInterval(), c.init()); err != nil {
+			return err
+		}
+	}
+	for i, c := range p.DNSSD {
+		if err := add("dns_sd", i, c, c.refreshInterval(), c.init()); err != nil {
+			return err
+		}
+	}
+	for i, c := range p.ConsulSD {
+		if err := add("consul_sd", i, c, c.refreshInterval(), c.init()); err != nil {
+			return err
+		}
+	}
+	for i, c := range p.KubernetesSD {
+		if err := add("kubernetes_sd", i, c, c.refreshInterval(), c.init(p)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// discovery is a running discovery provider.
+type discovery struct {
+	name     string
+	d        discoverer
+	interval time.Duration
+}
+
+// startDiscovery runs the discovery providers until the context is done.
+func (p *Prometheus) startDiscovery(ctx context.Context) {
+	for _, d := range p.discoverers {
+		p.wg.Add(1)
+		go func(d discovery) {
+			defer p.wg.Done()
+			p.runDiscovery(ctx, d)
+		}(d)
+	}
+}
+
+func (p *Prometheus) runDiscovery(ctx context.Context, d discovery) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		groups, err := d.d.discover(ctx)
+		if err != nil {
+			// keep the targets previously found
+			p.Log.Errorf("Discovering targets with %s: %s", d.name, err.Error())
+		} else {
+			targets := p.targets(groups)
+			p.Log.Debugf("Discovered %d targets with %s", len(targets), d.name)
+
+			p.lock.Lock()
+			p.discoveredTargets[d.name] = targets
+			p.lock.Unlock()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// targets relabels the targets of the groups and returns the ones kept.
+func (p *Prometheus) targets(groups []*targetGroup) map[string]URLAndAddress {
+	targets := make(map[string]URLAndAddress)
+	for _, group := range groups {
+		for _, target := range group.Targets {
+			labels := make(map[string]string, len(group.Labels)+3)
+			labels[schemeLabel] = "http"
+			labels[metricsPathLabel] = "/metrics"
+			for k, v := range group.Labels {
+				labels[k] = v
+			}
+			labels[addressLabel] = target
+
+			if !relabel(labels, p.Relabel) {
+				continue
+			}
+
+			u, err := targetURL(labels)
+			if err != nil {
+				p.Log.Errorf("Invalid target %q: %s", target, err.Error())
+				continue
+			}
+
+			tags := make(map[string]string)
+			for k, v := range labels {
+				if !strings.HasPrefix(k, "__") {
+					tags[k] = v
+				}
+			}
+			targets[u.String()] = URLAndAddress{
+				URL:         u,
+				OriginalURL: u,
+				Tags:        tags,
+			}
+		}
+	}
+	return targets
+}
+
+// targetURL returns the URL to scrape from the labels of a target.
+func targetURL(labels map[string]string) (*url.URL, error) {
+	address := labels[addressLabel]
+	if address == "" {
+		return nil, fmt.Errorf("no address")
+	}
+	if strings.Contains(address, "/") {
+		return nil, fmt.Errorf("address %q contains a path", address)
+	}
+
+	params := url.Values{}
+	for k, v := range labels {
+		if strings.HasPrefix(k, paramLabelPrefix) {
+			params.Set(strings.TrimPrefix(k, paramLabelPrefix), v)
+		}
+	}
+
+	path := labels[metricsPathLabel]
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return &url.URL{
+		Scheme:   labels[schemeLabel],
+		Host:     address,
+		Path:     path,
+		RawQuery: params.Encode(),
+	}, nil
+}
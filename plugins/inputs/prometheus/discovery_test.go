@@ -0,0 +1,391 @@
+package prometheus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	v1 "github.com/ericchiang/k8s/apis/core/v1"
+	metav1 "github.com/ericchiang/k8s/apis/meta/v1"
+	"github.com/hashicorp/consul/api"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func urls(targets map[string]URLAndAddress) []string {
+	var s []string
+	for k := range targets {
+		s = append(s, k)
+	}
+	sort.Strings(s)
+	return s
+}
+
+func TestTargets(t *testing.T) {
+	p := &Prometheus{
+		Log: testutil.Logger{},
+		Relabel: []*Relabel{
+			{SourceLabels: []string{"env"}, Regex: "test", Action: "drop"},
+			{SourceLabels: []string{"__meta_path"}, Regex: "(.+)", TargetLabel: "__metrics_path__"},
+			{SourceLabels: []string{"__meta_service"}, TargetLabel: "service"},
+			{TargetLabel: "__param_module", Replacement: str("http_2xx")},
+		},
+	}
+	require.NoError(t, p.Init())
+
+	groups := []*targetGroup{
+		{
+			Targets: []string{"10.0.0.1:9100", "10.0.0.2:9100"},
+			Labels:  map[string]string{"env": "prod", "__meta_service": "node"},
+		},
+		{
+			Targets: []string{"10.0.0.3:9100"},
+			Labels:  map[string]string{"env": "test"},
+		},
+		{
+			Targets: []string{"10.0.0.4:8080"},
+			Labels:  map[string]string{"__meta_path": "/probe", "__scheme__": "https"},
+		},
+	}
+	targets := p.targets(groups)
+	require.Equal(t, []string{
+		"http://10.0.0.1:9100/metrics?module=http_2xx",
+		"http://10.0.0.2:9100/metrics?module=http_2xx",
+		"https://10.0.0.4:8080/probe?module=http_2xx",
+	}, urls(targets))
+	require.Equal(t, map[string]string{"env": "prod", "service": "node"},
+		targets["http://10.0.0.1:9100/metrics?module=http_2xx"].Tags)
+	require.Empty(t, targets["https://10.0.0.4:8080/probe?module=http_2xx"].Tags)
+}
+
+func TestFileSD(t *testing.T) {
+	dir, err := ioutil.TempDir("", "file_sd")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	jsonFile := filepath.Join(dir, "targets.json")
+	require.NoError(t, ioutil.WriteFile(jsonFile, []byte(`[
+  {"targets": ["10.0.0.1:9100"], "labels": {"job": "node"}}
+]`), 0644))
+	yamlFile := filepath.Join(dir, "targets.yml")
+	require.NoError(t, ioutil.WriteFile(yamlFile, []byte(`
+- targets:
+  - 10.0.0.2:9100
+  - 10.0.0.3:9100
+  labels:
+    job: app
+`), 0644))
+
+	f := &FileSD{Files: []string{filepath.Join(dir, "*.json"), filepath.Join(dir, "*.yml")}}
+	require.NoError(t, f.init())
+
+	groups, err := f.discover(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []*targetGroup{
+		{
+			Targets: []string{"10.0.0.1:9100"},
+			Labels:  map[string]string{"job": "node", "__meta_filepath": jsonFile},
+		},
+		{
+			Targets: []string{"10.0.0.2:9100", "10.0.0.3:9100"},
+			Labels:  map[string]string{"job": "app", "__meta_filepath": yamlFile},
+		},
+	}, groups)
+
+	// the files are read again once modified
+	require.NoError(t, ioutil.WriteFile(jsonFile, []byte(`[
+  {"targets": ["10.0.0.4:9100", "10.0.0.5:9100"]}
+]`), 0644))
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(jsonFile, later, later))
+	require.NoError(t, os.Remove(yamlFile))
+
+	groups, err = f.discover(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []*targetGroup{
+		{
+			Targets: []string{"10.0.0.4:9100", "10.0.0.5:9100"},
+			Labels:  map[string]string{"__meta_filepath": jsonFile},
+		},
+	}, groups)
+}
+
+func TestFileSDInvalid(t *testing.T) {
+	require.Error(t, (&FileSD{}).init())
+	require.Error(t, (&FileSD{Files: []string{"targets.txt"}}).init())
+	require.Error(t, (&FileSD{Files: []string{"[.json"}}).init())
+}
+
+func TestDNSSD(t *testing.T) {
+	defer func(srv func(context.Context, string, string, string) (string, []*net.SRV, error)) {
+		lookupSRV = srv
+	}(lookupSRV)
+	defer func(ip func(context.Context, string) ([]net.IPAddr, error)) {
+		lookupIP = ip
+	}(lookupIP)
+
+	lookupSRV = func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+		require.Equal(t, "_metrics._tcp.example.org", name)
+		return name, []*net.SRV{
+			{Target: "a.example.org.", Port: 9100},
+			{Target: "b.example.org.", Port: 9200},
+		}, nil
+	}
+	lookupIP = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		require.Equal(t, "example.org", host)
+		return []net.IPAddr{{IP: net.ParseIP("10.0.0.1")}, {IP: net.ParseIP("::1")}}, nil
+	}
+
+	d := &DNSSD{Names: []string{"_metrics._tcp.example.org"}}
+	require.NoError(t, d.init())
+	groups, err := d.discover(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []*targetGroup{
+		{
+			Targets: []string{"a.example.org:9100"},
+			Labels: map[string]string{
+				"__meta_dns_name":              "_metrics._tcp.example.org",
+				"__meta_dns_srv_record_target": "a.example.org.",
+				"__meta_dns_srv_record_port":   "9100",
+			},
+		},
+		{
+			Targets: []string{"b.example.org:9200"},
+			Labels: map[string]string{
+				"__meta_dns_name":              "_metrics._tcp.example.org",
+				"__meta_dns_srv_record_target": "b.example.org.",
+				"__meta_dns_srv_record_port":   "9200",
+			},
+		},
+	}, groups)
+
+	d = &DNSSD{Names: []string{"example.org"}, Type: "a", Port: 9100}
+	require.NoError(t, d.init())
+	groups, err = d.discover(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []*targetGroup{{
+		Targets: []string{"10.0.0.1:9100"},
+		Labels:  map[string]string{"__meta_dns_name": "example.org"},
+	}}, groups)
+
+	d = &DNSSD{Names: []string{"example.org"}, Type: "AAAA", Port: 9100}
+	require.NoError(t, d.init())
+	groups, err = d.discover(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"[::1]:9100"}, groups[0].Targets)
+
+	require.Error(t, (&DNSSD{Names: []string{"example.org"}, Type: "A"}).init())
+	require.Error(t, (&DNSSD{Names: []string{"example.org"}, Type: "MX"}).init())
+}
+
+func TestConsulSD(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/catalog/services":
+			json.NewEncoder(w).Encode(map[string][]string{
+				"web":    {"metrics", "http"},
+				"db":     {"metrics"},
+				"consul": {},
+			})
+		case "/v1/catalog/service/web":
+			json.NewEncoder(w).Encode([]*api.CatalogService{{
+				Node:           "node1",
+				Address:        "10.0.0.1",
+				Datacenter:     "dc1",
+				ServiceID:      "web-1",
+				ServiceName:    "web",
+				ServiceAddress: "10.0.1.1",
+				ServicePort:    8080,
+				ServiceTags:    []string{"metrics", "http"},
+				ServiceMeta:    map[string]string{"version": "1.2"},
+				NodeMeta:       map[string]string{"rack-id": "r1"},
+			}})
+		case "/v1/catalog/service/db":
+			json.NewEncoder(w).Encode([]*api.CatalogService{{
+				Node:        "node2",
+				Address:     "10.0.0.2",
+				Datacenter:  "dc1",
+				ServiceID:   "db",
+				ServiceName: "db",
+				ServicePort: 9187,
+				ServiceTags: []string{"metrics"},
+			}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	u, err := net.ResolveTCPAddr("tcp", ts.Listener.Addr().String())
+	require.NoError(t, err)
+
+	c := &ConsulSD{Address: u.String(), Tags: []string{"metrics"}}
+	require.NoError(t, c.init())
+	groups, err := c.discover(context.Background())
+	require.NoError(t, err)
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Targets[0] < groups[j].Targets[0] })
+	require.Equal(t, []*targetGroup{
+		{
+			Targets: []string{"10.0.0.2:9187"},
+			Labels: map[string]string{
+				"__meta_consul_address":         "10.0.0.2",
+				"__meta_consul_dc":              "dc1",
+				"__meta_consul_node":            "node2",
+				"__meta_consul_service":         "db",
+				"__meta_consul_service_address": "",
+				"__meta_consul_service_id":      "db",
+				"__meta_consul_service_port":    "9187",
+				"__meta_consul_tags":            ",metrics,",
+			},
+		},
+		{
+			Targets: []string{"10.0.1.1:8080"},
+			Labels: map[string]string{
+				"__meta_consul_address":                  "10.0.0.1",
+				"__meta_consul_dc":                       "dc1",
+				"__meta_consul_node":                     "node1",
+				"__meta_consul_service":                  "web",
+				"__meta_consul_service_address":          "10.0.1.1",
+				"__meta_consul_service_id":               "web-1",
+				"__meta_consul_service_port":             "8080",
+				"__meta_consul_tags":                     ",metrics,http,",
+				"__meta_consul_metadata_rack_id":         "r1",
+				"__meta_consul_service_metadata_version": "1.2",
+			},
+		},
+	}, groups)
+
+	c = &ConsulSD{Address: u.String(), Services: []string{"web"}}
+	require.NoError(t, c.init())
+	groups, err = c.discover(context.Background())
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+	require.Equal(t, []string{"10.0.1.1:8080"}, groups[0].Targets)
+}
+
+func TestKubernetesServiceTargets(t *testing.T) {
+	service := &v1.Service{
+		Metadata: &metav1.ObjectMeta{
+			Name:        str("web"),
+			Namespace:   str("default"),
+			Labels:      map[string]string{"app.kubernetes.io/name": "web"},
+			Annotations: map[string]string{"prometheus.io/scrape": "true"},
+		},
+		Spec: &v1.ServiceSpec{
+			ClusterIP: str("10.96.0.10"),
+			Type:      str("ClusterIP"),
+			Ports: []*v1.ServicePort{
+				{Name: str("metrics"), Protocol: str("TCP"), Port: int32p(9100)},
+			},
+		},
+	}
+
+	groups := serviceTargetGroups(service)
+	require.Equal(t, []*targetGroup{{
+		Targets: []string{"web.default.svc:9100"},
+		Labels: map[string]string{
+			"__meta_kubernetes_namespace":                               "default",
+			"__meta_kubernetes_service_name":                            "web",
+			"__meta_kubernetes_service_cluster_ip":                      "10.96.0.10",
+			"__meta_kubernetes_service_type":                            "ClusterIP",
+			"__meta_kubernetes_service_label_app_kubernetes_io_name":    "web",
+			"__meta_kubernetes_service_annotation_prometheus_io_scrape": "true",
+			"__meta_kubernetes_service_port_name":                       "metrics",
+			"__meta_kubernetes_service_port_protocol":                   "TCP",
+		},
+	}}, groups)
+
+	endpoints := &v1.Endpoints{
+		Metadata: &metav1.ObjectMeta{
+			Name:      str("web"),
+			Namespace: str("default"),
+		},
+		Subsets: []*v1.EndpointSubset{{
+			Addresses: []*v1.EndpointAddress{{
+				Ip:        str("10.244.0.5"),
+				NodeName:  str("node1"),
+				TargetRef: &v1.ObjectReference{Kind: str("Pod"), Name: str("web-1")},
+			}},
+			NotReadyAddresses: []*v1.EndpointAddress{{
+				Ip: str("10.244.0.6"),
+			}},
+			Ports: []*v1.EndpointPort{
+				{Name: str("metrics"), Protocol: str("TCP"), Port: int32p(9100)},
+			},
+		}},
+	}
+
+	groups = endpointsTargetGroups(endpoints, service)
+	require.Len(t, groups, 2)
+	require.Equal(t, []string{"10.244.0.5:9100"}, groups[0].Targets)
+	require.Equal(t, "true", groups[0].Labels["__meta_kubernetes_endpoint_ready"])
+	require.Equal(t, "node1", groups[0].Labels["__meta_kubernetes_endpoint_node_name"])
+	require.Equal(t, "Pod", groups[0].Labels["__meta_kubernetes_endpoint_address_target_kind"])
+	require.Equal(t, "web-1", groups[0].Labels["__meta_kubernetes_endpoint_address_target_name"])
+	require.Equal(t, "web", groups[0].Labels["__meta_kubernetes_endpoints_name"])
+	require.Equal(t, "web", groups[0].Labels["__meta_kubernetes_service_label_app_kubernetes_io_name"])
+	require.Equal(t, []string{"10.244.0.6:9100"}, groups[1].Targets)
+	require.Equal(t, "false", groups[1].Labels["__meta_kubernetes_endpoint_ready"])
+}
+
+func TestPrometheusFileSD(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, sampleGaugeTextFormat)
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "file_sd")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "targets.json")
+	targets := fmt.Sprintf(`[{"targets": ["%s"], "labels": {"__meta_env": "prod"}}]`, ts.Listener.Addr().String())
+	require.NoError(t, ioutil.WriteFile(file, []byte(targets), 0644))
+
+	p := &Prometheus{
+		Log:    testutil.Logger{},
+		URLTag: "url",
+		FileSD: []*FileSD{{
+			Files:    []string{file},
+			sdConfig: sdConfig{RefreshInterval: internal.Duration{Duration: time.Hour}},
+		}},
+		Relabel: []*Relabel{
+			{SourceLabels: []string{"__meta_env"}, TargetLabel: "env"},
+		},
+	}
+	require.NoError(t, p.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, p.Start(&acc))
+	defer p.Stop()
+
+	// wait for the first discovery
+	for {
+		all, err := p.GetAllURLs()
+		require.NoError(t, err)
+		if len(all) > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	require.NoError(t, acc.GatherError(p.Gather))
+	require.True(t, acc.HasFloatField("go_goroutines", "gauge"))
+	require.True(t, acc.HasTag("go_goroutines", "env"))
+	require.Equal(t, "prod", acc.TagValue("go_goroutines", "env"))
+	require.Equal(t, ts.URL+"/metrics", acc.TagValue("go_goroutines", "url"))
+}
+
+func int32p(i int32) *int32 {
+	return &i
+}
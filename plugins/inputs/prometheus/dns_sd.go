@@ -0,0 +1,106 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Resolver functions, so tests can mock out the DNS.
+var (
+	lookupSRV = net.DefaultResolver.LookupSRV
+	lookupIP  = net.DefaultResolver.LookupIPAddr
+)
+
+// DNSSD discovers the targets from DNS records, like the Prometheus
+// dns_sd_configs.
+type DNSSD struct {
+	// Names to query.
+	Names []string `toml:"names"`
+	// Type of the records, one of SRV, A or AAAA.
+	Type string `toml:"type"`
+	// Port of the targets for A and AAAA records.
+	Port int `toml:"port"`
+
+	sdConfig
+}
+
+func (d *DNSSD) init() error {
+	if len(d.Names) == 0 {
+		return fmt.Errorf("no names")
+	}
+	d.Type = strings.ToUpper(d.Type)
+	switch d.Type {
+	case "":
+		d.Type = "SRV"
+	case "SRV":
+	case "A", "AAAA":
+		if d.Port <= 0 {
+			return fmt.Errorf("port is required for %s records", d.Type)
+		}
+	default:
+		return fmt.Errorf("invalid record type %q", d.Type)
+	}
+	return nil
+}
+
+func (d *DNSSD) discover(ctx context.Context) ([]*targetGroup, error) {
+	var groups []*targetGroup
+	for _, name := range d.Names {
+		var found []*targetGroup
+		var err error
+		if d.Type == "SRV" {
+			found, err = d.lookupSRV(ctx, name)
+		} else {
+			found, err = d.lookupIP(ctx, name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, found...)
+	}
+	return groups, nil
+}
+
+func (d *DNSSD) lookupSRV(ctx context.Context, name string) ([]*targetGroup, error) {
+	_, records, err := lookupSRV(ctx, "", "", name)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]*targetGroup, 0, len(records))
+	for _, record := range records {
+		target := strings.TrimSuffix(record.Target, ".")
+		port := strconv.Itoa(int(record.Port))
+		groups = append(groups, &targetGroup{
+			Targets: []string{net.JoinHostPort(target, port)},
+			Labels: map[string]string{
+				"__meta_dns_name":              name,
+				"__meta_dns_srv_record_target": record.Target,
+				"__meta_dns_srv_record_port":   port,
+			},
+		})
+	}
+	return groups, nil
+}
+
+func (d *DNSSD) lookupIP(ctx context.Context, name string) ([]*targetGroup, error) {
+	addrs, err := lookupIP(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	group := &targetGroup{}
+	port := strconv.Itoa(d.Port)
+	for _, addr := range addrs {
+		isV4 := addr.IP.To4() != nil
+		if (d.Type == "A") != isV4 {
+			continue
+		}
+		group.Targets = append(group.Targets, net.JoinHostPort(addr.IP.String(), port))
+	}
+	group.Labels = map[string]string{"__meta_dns_name": name}
+	return []*targetGroup{group}, nil
+}
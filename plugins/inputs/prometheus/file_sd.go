@@ -0,0 +1,110 @@
+package prometheus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ghodss/yaml"
+)
+
+// FileSD discovers the targets listed in JSON or YAML files, in the format
+// of the Prometheus file_sd_configs.
+type FileSD struct {
+	// Files to read, may contain glob patterns.
+	Files []string `toml:"files"`
+
+	sdConfig
+
+	cache map[string]*fileSDEntry
+}
+
+// fileSDEntry holds the targets read from a file, until it is modified.
+type fileSDEntry struct {
+	modTime time.Time
+	size    int64
+	groups  []*targetGroup
+}
+
+func (f *FileSD) init() error {
+	if len(f.Files) == 0 {
+		return fmt.Errorf("no files")
+	}
+	for _, pattern := range f.Files {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+		switch filepath.Ext(pattern) {
+		case ".json", ".yml", ".yaml":
+		default:
+			return fmt.Errorf("file %q must have a .json, .yml or .yaml extension", pattern)
+		}
+	}
+	f.cache = make(map[string]*fileSDEntry)
+	return nil
+}
+
+// discover reads the files matching the patterns, the files not modified
+// since the previous discovery are not read again.
+func (f *FileSD) discover(ctx context.Context) ([]*targetGroup, error) {
+	cache := make(map[string]*fileSDEntry)
+	var groups []*targetGroup
+	for _, pattern := range f.Files {
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if _, ok := cache[file]; ok {
+				continue
+			}
+
+			entry, err := f.read(file)
+			if err != nil {
+				return nil, err
+			}
+			cache[file] = entry
+			groups = append(groups, entry.groups...)
+		}
+	}
+	f.cache = cache
+	return groups, nil
+}
+
+func (f *FileSD) read(file string) (*fileSDEntry, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	if entry, ok := f.cache[file]; ok && entry.modTime.Equal(info.ModTime()) && entry.size == info.Size() {
+		return entry, nil
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []*targetGroup
+	switch filepath.Ext(file) {
+	case ".json":
+		err = json.Unmarshal(data, &groups)
+	default:
+		err = yaml.Unmarshal(data, &groups)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", file, err)
+	}
+
+	for _, group := range groups {
+		if group.Labels == nil {
+			group.Labels = make(map[string]string)
+		}
+		group.Labels["__meta_filepath"] = file
+	}
+	return &fileSDEntry{modTime: info.ModTime(), size: info.Size(), groups: groups}, nil
+}
@@ -9,7 +9,6 @@ import (
 	"net/url"
 	"os/user"
 	"path/filepath"
-	"sync"
 	"time"
 
 	"github.com/ericchiang/k8s"
@@ -38,25 +37,30 @@ func loadClient(kubeconfigPath string) (*k8s.Client, error) {
 	return k8s.NewClient(&config)
 }
 
-func (p *Prometheus) start(ctx context.Context) error {
+// kubernetesClient returns the in-cluster client, or else the client of the
+// kube_config file.
+func (p *Prometheus) kubernetesClient() (*k8s.Client, error) {
 	client, err := k8s.NewInClusterClient()
-	if err != nil {
-		u, err := user.Current()
-		if err != nil {
-			return fmt.Errorf("Failed to get current user - %v", err)
-		}
+	if err == nil {
+		return client, nil
+	}
 
-		configLocation := filepath.Join(u.HomeDir, ".kube/config")
-		if p.KubeConfig != "" {
-			configLocation = p.KubeConfig
-		}
-		client, err = loadClient(configLocation)
+	configLocation := p.KubeConfig
+	if configLocation == "" {
+		u, err := user.Current()
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("Failed to get current user - %v", err)
 		}
+		configLocation = filepath.Join(u.HomeDir, ".kube/config")
 	}
+	return loadClient(configLocation)
+}
 
-	p.wg = sync.WaitGroup{}
+func (p *Prometheus) start(ctx context.Context) error {
+	client, err := p.kubernetesClient()
+	if err != nil {
+		return err
+	}
 
 	p.wg.Add(1)
 	go func() {
@@ -0,0 +1,157 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/ericchiang/k8s"
+	corev1 "github.com/ericchiang/k8s/apis/core/v1"
+)
+
+// KubernetesSD discovers the targets from the Kubernetes services or
+// endpoints, like the Prometheus kubernetes_sd_configs.
+type KubernetesSD struct {
+	// Role of the targets, "service" or "endpoints".
+	Role string `toml:"role"`
+	// Namespace of the targets, all by default.
+	Namespace string `toml:"namespace"`
+
+	sdConfig
+
+	p      *Prometheus
+	client *k8s.Client
+}
+
+func (k *KubernetesSD) init(p *Prometheus) error {
+	switch k.Role {
+	case "":
+		k.Role = "service"
+	case "service", "endpoints":
+	default:
+		return fmt.Errorf("invalid role %q, must be \"service\" or \"endpoints\"", k.Role)
+	}
+	k.p = p
+	return nil
+}
+
+func (k *KubernetesSD) discover(ctx context.Context) ([]*targetGroup, error) {
+	if k.client == nil {
+		client, err := k.p.kubernetesClient()
+		if err != nil {
+			return nil, err
+		}
+		k.client = client
+	}
+
+	var services corev1.ServiceList
+	if err := k.client.List(ctx, k.Namespace, &services); err != nil {
+		return nil, err
+	}
+
+	var groups []*targetGroup
+	if k.Role == "service" {
+		for _, service := range services.GetItems() {
+			groups = append(groups, serviceTargetGroups(service)...)
+		}
+		return groups, nil
+	}
+
+	var endpoints corev1.EndpointsList
+	if err := k.client.List(ctx, k.Namespace, &endpoints); err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*corev1.Service)
+	for _, service := range services.GetItems() {
+		meta := service.GetMetadata()
+		byName[meta.GetNamespace()+"/"+meta.GetName()] = service
+	}
+	for _, e := range endpoints.GetItems() {
+		meta := e.GetMetadata()
+		groups = append(groups, endpointsTargetGroups(e, byName[meta.GetNamespace()+"/"+meta.GetName()])...)
+	}
+	return groups, nil
+}
+
+// serviceLabels returns the labels describing the service.
+func serviceLabels(service *corev1.Service) map[string]string {
+	meta := service.GetMetadata()
+	labels := map[string]string{
+		"__meta_kubernetes_namespace":          meta.GetNamespace(),
+		"__meta_kubernetes_service_name":       meta.GetName(),
+		"__meta_kubernetes_service_cluster_ip": service.GetSpec().GetClusterIP(),
+		"__meta_kubernetes_service_type":       service.GetSpec().GetType(),
+	}
+	for k, v := range meta.GetLabels() {
+		labels["__meta_kubernetes_service_label_"+sanitizeLabelName(k)] = v
+	}
+	for k, v := range meta.GetAnnotations() {
+		labels["__meta_kubernetes_service_annotation_"+sanitizeLabelName(k)] = v
+	}
+	return labels
+}
+
+// serviceTargetGroups returns a target for each port of the service, at the
+// DNS name of the service.
+func serviceTargetGroups(service *corev1.Service) []*targetGroup {
+	meta := service.GetMetadata()
+	host := meta.GetName() + "." + meta.GetNamespace() + ".svc"
+
+	var groups []*targetGroup
+	for _, port := range service.GetSpec().GetPorts() {
+		labels := serviceLabels(service)
+		labels["__meta_kubernetes_service_port_name"] = port.GetName()
+		labels["__meta_kubernetes_service_port_protocol"] = port.GetProtocol()
+		groups = append(groups, &targetGroup{
+			Targets: []string{net.JoinHostPort(host, strconv.Itoa(int(port.GetPort())))},
+			Labels:  labels,
+		})
+	}
+	return groups
+}
+
+// endpointsTargetGroups returns a target for each port of each address of
+// the endpoints, with the labels of the service of the same name if any.
+func endpointsTargetGroups(endpoints *corev1.Endpoints, service *corev1.Service) []*targetGroup {
+	meta := endpoints.GetMetadata()
+
+	var groups []*targetGroup
+	add := func(address *corev1.EndpointAddress, port *corev1.EndpointPort, ready bool) {
+		labels := map[string]string{}
+		if service != nil {
+			labels = serviceLabels(service)
+		}
+		labels["__meta_kubernetes_namespace"] = meta.GetNamespace()
+		labels["__meta_kubernetes_endpoints_name"] = meta.GetName()
+		labels["__meta_kubernetes_endpoint_ready"] = strconv.FormatBool(ready)
+		labels["__meta_kubernetes_endpoint_port_name"] = port.GetName()
+		labels["__meta_kubernetes_endpoint_port_protocol"] = port.GetProtocol()
+		if address.GetHostname() != "" {
+			labels["__meta_kubernetes_endpoint_hostname"] = address.GetHostname()
+		}
+		if address.GetNodeName() != "" {
+			labels["__meta_kubernetes_endpoint_node_name"] = address.GetNodeName()
+		}
+		if ref := address.GetTargetRef(); ref != nil {
+			labels["__meta_kubernetes_endpoint_address_target_kind"] = ref.GetKind()
+			labels["__meta_kubernetes_endpoint_address_target_name"] = ref.GetName()
+		}
+		groups = append(groups, &targetGroup{
+			Targets: []string{net.JoinHostPort(address.GetIp(), strconv.Itoa(int(port.GetPort())))},
+			Labels:  labels,
+		})
+	}
+
+	for _, subset := range endpoints.GetSubsets() {
+		for _, port := range subset.GetPorts() {
+			for _, address := range subset.GetAddresses() {
+				add(address, port, true)
+			}
+			for _, address := range subset.GetNotReadyAddresses() {
+				add(address, port, false)
+			}
+		}
+	}
+	return groups
+}
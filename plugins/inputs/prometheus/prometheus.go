@@ -14,6 +14,7 @@ import (
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/internal"
 	"github.com/influxdata/telegraf/internal/tls"
+	"github.com/influxdata/telegraf/plugins/common/scrape"
 	"github.com/influxdata/telegraf/plugins/inputs"
 )
 
@@ -44,6 +45,7 @@ type Prometheus struct {
 	URLTag string `toml:"url_tag"`
 
 	tls.ClientConfig
+	scrape.Config
 
 	Log telegraf.Logger
 
@@ -56,6 +58,17 @@ type Prometheus struct {
 	kubernetesPods map[string]URLAndAddress
 	cancel         context.CancelFunc
 	wg             sync.WaitGroup
+
+	// Discovery providers of targets, and the relabeling rules applied to the
+	// targets they find.
+	FileSD       []*FileSD       `toml:"file_sd"`
+	DNSSD        []*DNSSD        `toml:"dns_sd"`
+	ConsulSD     []*ConsulSD     `toml:"consul_sd"`
+	KubernetesSD []*KubernetesSD `toml:"kubernetes_sd"`
+	Relabel      []*Relabel      `toml:"relabel"`
+
+	discoverers       []discovery
+	discoveredTargets map[string]map[string]URLAndAddress
 }
 
 var sampleConfig = `
@@ -91,6 +104,55 @@ var sampleConfig = `
   ##   ex: monitor_kubernetes_pods_namespace = "default"
   # monitor_kubernetes_pods_namespace = ""
 
+  ## Discover the targets from files, in the format of the Prometheus
+  ## file_sd_configs.  The files are checked for changes every
+  ## refresh_interval.
+  # [[inputs.prometheus.file_sd]]
+  #   ## Files to read, with a .json, .yml or .yaml extension.  May contain
+  #   ## glob patterns.
+  #   files = ["/etc/telegraf/targets/*.json"]
+  #   # refresh_interval = "30s"
+
+  ## Discover the targets from DNS SRV, A or AAAA records.
+  # [[inputs.prometheus.dns_sd]]
+  #   names = ["_metrics._tcp.example.org"]
+  #   # type = "SRV"
+  #   ## Port of the targets, required for A and AAAA records.
+  #   # port = 9100
+  #   # refresh_interval = "30s"
+
+  ## Discover the targets from the services of the Consul catalog.
+  # [[inputs.prometheus.consul_sd]]
+  #   # address = "localhost:8500"
+  #   # scheme = "http"
+  #   # datacenter = ""
+  #   # token = ""
+  #   ## Services to discover, all by default.
+  #   # services = []
+  #   ## Tags the services must all have.
+  #   # tags = []
+  #   # refresh_interval = "30s"
+
+  ## Discover the targets from the Kubernetes services or endpoints, using
+  ## the in-cluster configuration or kube_config.
+  # [[inputs.prometheus.kubernetes_sd]]
+  #   ## Either "service" or "endpoints".
+  #   # role = "service"
+  #   ## Namespace of the targets, all by default.
+  #   # namespace = ""
+  #   # refresh_interval = "30s"
+
+  ## Relabeling rules applied in order to the discovered targets, with the
+  ## semantics of the Prometheus relabel_configs.  The labels not starting
+  ## with "__" are added as tags.
+  # [[inputs.prometheus.relabel]]
+  #   source_labels = ["__meta_consul_tags"]
+  #   regex = ".*,metrics,.*"
+  #   action = "keep"
+  # [[inputs.prometheus.relabel]]
+  #   source_labels = ["__meta_consul_service"]
+  #   target_label = "service"
+
   ## Use bearer token for authorization. ('bearer_token' takes priority)
   # bearer_token = "/path/to/bearer/token"
   ## OR
@@ -104,6 +166,16 @@ var sampleConfig = `
   ## Specify timeout duration for slower prometheus clients (default is 3s)
   # response_timeout = "3s"
 
+  ## Maximum number of targets scraped at the same time, unlimited if 0.
+  # max_concurrent_scrapes = 0
+  ## Timeout of the scrape of each target, none if 0.
+  # scrape_timeout = "0s"
+  ## Spread the start of the scrapes of the targets over this duration.
+  # scrape_stagger = "0s"
+  ## Add a prometheus_scrape metric for each target, with the up,
+  ## scrape_duration_seconds and scrape_samples fields.
+  # scrape_metrics = false
+
   ## Optional TLS Config
   # tls_ca = /path/to/cafile
   # tls_cert = /path/to/certfile
@@ -124,7 +196,7 @@ func (p *Prometheus) Init() error {
 	if p.MetricVersion != 2 {
 		p.Log.Warnf("Use of deprecated configuration: 'metric_version = 1'; please update to 'metric_version = 2'")
 	}
-	return nil
+	return p.initDiscovery()
 }
 
 var ErrProtocolError = errors.New("prometheus protocol error")
@@ -172,6 +244,12 @@ func (p *Prometheus) GetAllURLs() (map[string]URLAndAddress, error) {
 	for k, v := range p.kubernetesPods {
 		allURLs[k] = v
 	}
+	// and through the discovery providers
+	for _, targets := range p.discoveredTargets {
+		for k, v := range targets {
+			allURLs[k] = v
+		}
+	}
 
 	for _, service := range p.KubernetesServices {
 		URL, err := url.Parse(service)
@@ -199,6 +277,12 @@ func (p *Prometheus) GetAllURLs() (map[string]URLAndAddress, error) {
 // Reads stats from all configured servers accumulates stats.
 // Returns one of the errors encountered while gather stats (if any).
 func (p *Prometheus) Gather(acc telegraf.Accumulator) error {
+	return p.GatherContext(context.Background(), acc)
+}
+
+// GatherContext is Gather, cancelling the requests in flight when the
+// context is done.
+func (p *Prometheus) GatherContext(ctx context.Context, acc telegraf.Accumulator) error {
 	if p.client == nil {
 		client, err := p.createHTTPClient()
 		if err != nil {
@@ -207,25 +291,45 @@ func (p *Prometheus) Gather(acc telegraf.Accumulator) error {
 		p.client = client
 	}
 
-	var wg sync.WaitGroup
-
 	allURLs, err := p.GetAllURLs()
 	if err != nil {
 		return err
 	}
+
+	targets := make([]scrape.Target, 0, len(allURLs))
 	for _, URL := range allURLs {
-		wg.Add(1)
-		go func(serviceURL URLAndAddress) {
-			defer wg.Done()
-			acc.AddError(p.gatherURL(serviceURL, acc))
-		}(URL)
+		serviceURL := URL
+		targets = append(targets, scrape.Target{
+			Name: serviceURL.URL.String(),
+			Tags: p.scrapeTags(serviceURL),
+			Scrape: func(ctx context.Context, acc telegraf.Accumulator) error {
+				return p.gatherURL(ctx, serviceURL, acc)
+			},
+		})
 	}
-
-	wg.Wait()
+	p.Config.Scrape(ctx, acc, "prometheus_scrape", targets)
 
 	return nil
 }
 
+// scrapeTags returns the tags of the scrape metric of the target, the ones
+// of its metrics.
+func (p *Prometheus) scrapeTags(u URLAndAddress) map[string]string {
+	tags := make(map[string]string, len(u.Tags)+2)
+	if p.URLTag != "" {
+		originalURL := *u.OriginalURL
+		originalURL.User = nil
+		tags[p.URLTag] = originalURL.String()
+	}
+	if u.Address != "" {
+		tags["address"] = u.Address
+	}
+	for k, v := range u.Tags {
+		tags[k] = v
+	}
+	return tags
+}
+
 func (p *Prometheus) createHTTPClient() (*http.Client, error) {
 	tlsCfg, err := p.ClientConfig.TLSConfig()
 	if err != nil {
@@ -243,7 +347,7 @@ func (p *Prometheus) createHTTPClient() (*http.Client, error) {
 	return client, nil
 }
 
-func (p *Prometheus) gatherURL(u URLAndAddress, acc telegraf.Accumulator) error {
+func (p *Prometheus) gatherURL(ctx context.Context, u URLAndAddress, acc telegraf.Accumulator) error {
 	var req *http.Request
 	var err error
 	var uClient *http.Client
@@ -274,6 +378,10 @@ func (p *Prometheus) gatherURL(u URLAndAddress, acc telegraf.Accumulator) error
 		}
 		req, err = http.NewRequest("GET", u.URL.String(), nil)
 	}
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
 
 	req.Header.Add("Accept", acceptHeader)
 
@@ -351,18 +459,24 @@ func (p *Prometheus) gatherURL(u URLAndAddress, acc telegraf.Accumulator) error
 	return nil
 }
 
-// Start will start the Kubernetes scraping if enabled in the configuration
+// Start will start the Kubernetes scraping and the discovery of targets if
+// enabled in the configuration
 func (p *Prometheus) Start(a telegraf.Accumulator) error {
+	if !p.MonitorPods && len(p.discoverers) == 0 {
+		return nil
+	}
+
+	var ctx context.Context
+	ctx, p.cancel = context.WithCancel(context.Background())
+	p.startDiscovery(ctx)
 	if p.MonitorPods {
-		var ctx context.Context
-		ctx, p.cancel = context.WithCancel(context.Background())
 		return p.start(ctx)
 	}
 	return nil
 }
 
 func (p *Prometheus) Stop() {
-	if p.MonitorPods {
+	if p.cancel != nil {
 		p.cancel()
 	}
 	p.wg.Wait()
@@ -234,3 +234,33 @@ func TestPrometheusGeneratesGaugeMetricsV2(t *testing.T) {
 	assert.True(t, acc.TagValue("prometheus", "url") == ts.URL+"/metrics")
 	assert.True(t, acc.HasTimestamp("prometheus", time.Unix(1490802350, 0)))
 }
+
+func TestPrometheusScrapeMetrics(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, sampleGaugeTextFormat)
+	}))
+	defer ts.Close()
+
+	p := &Prometheus{
+		Log:    testutil.Logger{},
+		URLs:   []string{ts.URL, "http://127.0.0.1:1/metrics"},
+		URLTag: "url",
+	}
+	p.ScrapeMetrics = true
+	p.MaxConcurrentScrapes = 1
+
+	var acc testutil.Accumulator
+	require.NoError(t, p.Gather(&acc))
+	require.Len(t, acc.Errors, 1)
+
+	ups := make(map[string]interface{})
+	for _, m := range acc.GetTelegrafMetrics() {
+		if m.Name() == "prometheus_scrape" {
+			ups[m.Tags()["url"]], _ = m.GetField("up")
+		}
+	}
+	require.Equal(t, map[string]interface{}{
+		ts.URL:                       int64(1),
+		"http://127.0.0.1:1/metrics": int64(0),
+	}, ups)
+}
@@ -0,0 +1,167 @@
+package prometheus
+
+import (
+	"crypto/md5"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	relabelReplace   = "replace"
+	relabelKeep      = "keep"
+	relabelDrop      = "drop"
+	relabelHashMod   = "hashmod"
+	relabelLabelMap  = "labelmap"
+	relabelLabelDrop = "labeldrop"
+	relabelLabelKeep = "labelkeep"
+)
+
+var labelNameRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Relabel is a relabeling rule applied to the labels of the discovered
+// targets, with the semantics of the Prometheus relabel_configs.
+type Relabel struct {
+	// Labels whose values are concatenated and matched against the regex.
+	SourceLabels []string `toml:"source_labels"`
+	// Separator placed between the concatenated values, ";" by default.
+	Separator string `toml:"separator"`
+	// Regular expression the concatenated values are matched against,
+	// anchored at both ends, "(.*)" by default.
+	Regex string `toml:"regex"`
+	// Modulus of the hash of the concatenated values, for hashmod.
+	Modulus uint64 `toml:"modulus"`
+	// Label the result is written to, for replace and hashmod.
+	TargetLabel string `toml:"target_label"`
+	// Replacement written to the target label, capture groups can be
+	// referenced as $1, "$1" when not set.  An empty replacement removes
+	// the target label.
+	Replacement *string `toml:"replacement"`
+	// One of replace, keep, drop, hashmod, labelmap, labeldrop and labelkeep,
+	// replace by default.
+	Action string `toml:"action"`
+
+	regex       *regexp.Regexp
+	replacement string
+}
+
+func (r *Relabel) init() error {
+	if r.Separator == "" {
+		r.Separator = ";"
+	}
+	if r.Regex == "" {
+		r.Regex = "(.*)"
+	}
+	r.replacement = "$1"
+	if r.Replacement != nil {
+		r.replacement = *r.Replacement
+	}
+	if r.Action == "" {
+		r.Action = relabelReplace
+	}
+
+	re, err := regexp.Compile("^(?:" + r.Regex + ")$")
+	if err != nil {
+		return fmt.Errorf("invalid regex %q: %v", r.Regex, err)
+	}
+	r.regex = re
+
+	switch r.Action {
+	case relabelReplace:
+		if r.TargetLabel == "" {
+			return fmt.Errorf("target_label is required for action %q", r.Action)
+		}
+	case relabelHashMod:
+		if r.TargetLabel == "" {
+			return fmt.Errorf("target_label is required for action %q", r.Action)
+		}
+		if r.Modulus == 0 {
+			return fmt.Errorf("modulus is required for action %q", r.Action)
+		}
+	case relabelKeep, relabelDrop:
+		if len(r.SourceLabels) == 0 {
+			return fmt.Errorf("source_labels is required for action %q", r.Action)
+		}
+	case relabelLabelMap, relabelLabelDrop, relabelLabelKeep:
+	default:
+		return fmt.Errorf("unknown action %q", r.Action)
+	}
+	return nil
+}
+
+// relabel applies the rules to the labels, which are modified in place.  It
+// returns false if the target is dropped.
+func relabel(labels map[string]string, rules []*Relabel) bool {
+	for _, r := range rules {
+		if !r.apply(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Relabel) apply(labels map[string]string) bool {
+	values := make([]string, 0, len(r.SourceLabels))
+	for _, name := range r.SourceLabels {
+		values = append(values, labels[name])
+	}
+	value := strings.Join(values, r.Separator)
+
+	switch r.Action {
+	case relabelKeep:
+		return r.regex.MatchString(value)
+	case relabelDrop:
+		return !r.regex.MatchString(value)
+	case relabelReplace:
+		indexes := r.regex.FindStringSubmatchIndex(value)
+		if indexes == nil {
+			return true
+		}
+		target := string(r.regex.ExpandString(nil, r.TargetLabel, value, indexes))
+		if !labelNameRe.MatchString(target) {
+			return true
+		}
+		result := string(r.regex.ExpandString(nil, r.replacement, value, indexes))
+		if result == "" {
+			delete(labels, target)
+		} else {
+			labels[target] = result
+		}
+	case relabelHashMod:
+		labels[r.TargetLabel] = fmt.Sprintf("%d", hashValue(value)%r.Modulus)
+	case relabelLabelMap:
+		mapped := make(map[string]string)
+		for name, v := range labels {
+			if r.regex.MatchString(name) {
+				mapped[r.regex.ReplaceAllString(name, r.replacement)] = v
+			}
+		}
+		for name, v := range mapped {
+			labels[name] = v
+		}
+	case relabelLabelDrop:
+		for name := range labels {
+			if r.regex.MatchString(name) {
+				delete(labels, name)
+			}
+		}
+	case relabelLabelKeep:
+		for name := range labels {
+			if !r.regex.MatchString(name) {
+				delete(labels, name)
+			}
+		}
+	}
+	return true
+}
+
+// hashValue returns the last 8 bytes of the MD5 sum of the value, as
+// Prometheus does for hashmod.
+func hashValue(value string) uint64 {
+	sum := md5.Sum([]byte(value))
+	var h uint64
+	for _, b := range sum[md5.Size-8:] {
+		h = h<<8 | uint64(b)
+	}
+	return h
+}
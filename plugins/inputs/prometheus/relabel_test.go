@@ -0,0 +1,162 @@
+package prometheus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelabel(t *testing.T) {
+	tests := []struct {
+		name     string
+		rules    []*Relabel
+		labels   map[string]string
+		expected map[string]string
+	}{
+		{
+			name: "replace",
+			rules: []*Relabel{{
+				SourceLabels: []string{"a", "b"},
+				Regex:        "f(.*);(.*)r",
+				TargetLabel:  "c",
+				Replacement:  str("ch${1}-ch${2}"),
+			}},
+			labels:   map[string]string{"a": "foo", "b": "bar"},
+			expected: map[string]string{"a": "foo", "b": "bar", "c": "choo-chba"},
+		},
+		{
+			name: "replace without match",
+			rules: []*Relabel{{
+				SourceLabels: []string{"a"},
+				Regex:        "x(.*)",
+				TargetLabel:  "c",
+			}},
+			labels:   map[string]string{"a": "foo"},
+			expected: map[string]string{"a": "foo"},
+		},
+		{
+			name: "replace with empty result deletes",
+			rules: []*Relabel{{
+				SourceLabels: []string{"b"},
+				TargetLabel:  "a",
+			}},
+			labels:   map[string]string{"a": "foo"},
+			expected: map[string]string{},
+		},
+		{
+			name: "replace with empty replacement deletes",
+			rules: []*Relabel{{
+				SourceLabels: []string{"a"},
+				TargetLabel:  "a",
+				Replacement:  str(""),
+			}},
+			labels:   map[string]string{"a": "foo", "b": "bar"},
+			expected: map[string]string{"b": "bar"},
+		},
+		{
+			name: "replace with expanded target label",
+			rules: []*Relabel{{
+				SourceLabels: []string{"a"},
+				Regex:        "some-([^-]+)-(.+)",
+				TargetLabel:  "${1}",
+				Replacement:  str("${2}"),
+			}},
+			labels:   map[string]string{"a": "some-name-value"},
+			expected: map[string]string{"a": "some-name-value", "name": "value"},
+		},
+		{
+			name: "keep",
+			rules: []*Relabel{{
+				SourceLabels: []string{"a"},
+				Regex:        "f.*",
+				Action:       "keep",
+			}},
+			labels:   map[string]string{"a": "foo"},
+			expected: map[string]string{"a": "foo"},
+		},
+		{
+			name: "keep anchored",
+			rules: []*Relabel{{
+				SourceLabels: []string{"a"},
+				Regex:        "o",
+				Action:       "keep",
+			}},
+			labels: map[string]string{"a": "foo"},
+		},
+		{
+			name: "drop",
+			rules: []*Relabel{{
+				SourceLabels: []string{"a"},
+				Regex:        "f.*",
+				Action:       "drop",
+			}},
+			labels: map[string]string{"a": "foo"},
+		},
+		{
+			name: "hashmod",
+			rules: []*Relabel{{
+				SourceLabels: []string{"c"},
+				TargetLabel:  "d",
+				Modulus:      1000,
+				Action:       "hashmod",
+			}},
+			labels:   map[string]string{"c": "baz"},
+			expected: map[string]string{"c": "baz", "d": "976"},
+		},
+		{
+			name: "labelmap",
+			rules: []*Relabel{{
+				Regex:       "__meta_(.+)",
+				Replacement: str("${1}"),
+				Action:      "labelmap",
+			}},
+			labels:   map[string]string{"__meta_service": "web", "a": "foo"},
+			expected: map[string]string{"__meta_service": "web", "service": "web", "a": "foo"},
+		},
+		{
+			name: "labeldrop",
+			rules: []*Relabel{{
+				Regex:  "a.*",
+				Action: "labeldrop",
+			}},
+			labels:   map[string]string{"a": "foo", "ab": "bar", "b": "baz"},
+			expected: map[string]string{"b": "baz"},
+		},
+		{
+			name: "labelkeep",
+			rules: []*Relabel{{
+				Regex:  "a.*",
+				Action: "labelkeep",
+			}},
+			labels:   map[string]string{"a": "foo", "ab": "bar", "b": "baz"},
+			expected: map[string]string{"a": "foo", "ab": "bar"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, r := range tt.rules {
+				require.NoError(t, r.init())
+			}
+			kept := relabel(tt.labels, tt.rules)
+			if tt.expected == nil {
+				require.False(t, kept)
+				return
+			}
+			require.True(t, kept)
+			require.Equal(t, tt.expected, tt.labels)
+		})
+	}
+}
+
+func TestRelabelInvalid(t *testing.T) {
+	rules := []*Relabel{
+		{Action: "replace"},
+		{Action: "hashmod", TargetLabel: "a"},
+		{Action: "keep"},
+		{Action: "unknown"},
+		{Regex: "(", TargetLabel: "a"},
+	}
+	for _, r := range rules {
+		require.Error(t, r.init())
+	}
+}
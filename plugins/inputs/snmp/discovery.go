@@ -0,0 +1,442 @@
+package snmp
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/toml"
+)
+
+const (
+	sysDescrOid    = ".1.3.6.1.2.1.1.1.0"
+	sysObjectIDOid = ".1.3.6.1.2.1.1.2.0"
+
+	maxDiscoveryAddresses = 65536
+)
+
+// Discovery holds the configuration of the agent discovery.
+type Discovery struct {
+	// Networks to sweep, in CIDR notation.
+	Networks []string `toml:"networks"`
+	// Port the agents listen on.
+	Port uint16 `toml:"port"`
+	// Interval between two discoveries.
+	Interval internal.Duration `toml:"interval"`
+	// Maximum number of agents queried at the same time.
+	MaxConcurrent int `toml:"max_concurrent"`
+	// Profile files, or directories of profile files.
+	ProfilePaths []string `toml:"profile_paths"`
+
+	networks []*net.IPNet
+}
+
+// Profile is a set of fields and tables collected from the discovered agents
+// matching it.
+type Profile struct {
+	// Name of the profile, added as the profile tag.  Defaults to the file
+	// name without extension.
+	Name string `toml:"name"`
+	// The sysObjectID of the agents must be under one of these OIDs.
+	SysObjectIDs []string `toml:"sys_object_ids"`
+	// The sysDescr of the agents must match one of these regular expressions.
+	SysDescr []string `toml:"sys_descr"`
+
+	Fields []Field `toml:"field"`
+	Tables []Table `toml:"table"`
+
+	sysDescr []*regexp.Regexp
+}
+
+// discoveredAgent is an agent found by the discovery, with the profile it
+// matches.
+type discoveredAgent struct {
+	agent   string
+	profile *Profile
+	conn    snmpConnection
+}
+
+// connectAgent is so tests can mock out the connections to discovered agents.
+var connectAgent = (*Snmp).connect
+
+func (s *Snmp) initDiscovery() error {
+	d := s.Discovery
+	if d.Port == 0 {
+		d.Port = 161
+	}
+	if d.Interval.Duration == 0 {
+		d.Interval.Duration = time.Hour
+	}
+	if d.MaxConcurrent <= 0 {
+		d.MaxConcurrent = 64
+	}
+
+	d.networks = nil
+	for _, network := range d.Networks {
+		_, n, err := net.ParseCIDR(network)
+		if err != nil {
+			return err
+		}
+		ones, bits := n.Mask.Size()
+		if bits-ones > 16 {
+			return fmt.Errorf("network %s has more than %d addresses", network, maxDiscoveryAddresses)
+		}
+		d.networks = append(d.networks, n)
+	}
+
+	profiles, err := loadProfiles(d.ProfilePaths)
+	if err != nil {
+		return err
+	}
+	if len(profiles) == 0 {
+		return fmt.Errorf("no profile found")
+	}
+	s.profiles = profiles
+	return nil
+}
+
+// loadProfiles loads the profile files, and the "*.toml" files of the
+// directories.
+func loadProfiles(paths []string) ([]*Profile, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(path, "*.toml"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+
+	var profiles []*Profile
+	names := map[string]bool{}
+	for _, file := range files {
+		p, err := loadProfile(file)
+		if err != nil {
+			return nil, Errorf(err, "loading profile %s", file)
+		}
+		if names[p.Name] {
+			return nil, fmt.Errorf("duplicate profile %s in %s", p.Name, file)
+		}
+		names[p.Name] = true
+		profiles = append(profiles, p)
+	}
+	return profiles, nil
+}
+
+func loadProfile(file string) (*Profile, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Profile{}
+	if err := toml.Unmarshal(data, p); err != nil {
+		return nil, err
+	}
+	if p.Name == "" {
+		p.Name = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	}
+
+	for i, oid := range p.SysObjectIDs {
+		if strings.ContainsAny(oid, ":abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ") {
+			_, oidNum, _, _, err := SnmpTranslate(oid)
+			if err != nil {
+				return nil, Errorf(err, "translating %s", oid)
+			}
+			oid = oidNum
+		}
+		p.SysObjectIDs[i] = normalizeOid(oid)
+	}
+
+	for _, expr := range p.SysDescr {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		p.sysDescr = append(p.sysDescr, re)
+	}
+
+	for i := range p.Tables {
+		if err := p.Tables[i].init(); err != nil {
+			return nil, Errorf(err, "initializing table %s", p.Tables[i].Name)
+		}
+	}
+	for i := range p.Fields {
+		if err := p.Fields[i].init(); err != nil {
+			return nil, Errorf(err, "initializing field %s", p.Fields[i].Name)
+		}
+	}
+	return p, nil
+}
+
+// normalizeOid returns the numeric OID with a leading and no trailing dot.
+func normalizeOid(oid string) string {
+	oid = strings.TrimSuffix(oid, ".")
+	if !strings.HasPrefix(oid, ".") {
+		oid = "." + oid
+	}
+	return oid
+}
+
+// match reports whether the agent matches the profile, and the length of the
+// sysObjectID matched.
+func (p *Profile) match(sysObjectID, sysDescr string) (int, bool) {
+	n := -1
+	for _, oid := range p.SysObjectIDs {
+		if (sysObjectID == oid || strings.HasPrefix(sysObjectID, oid+".")) && len(oid) > n {
+			n = len(oid)
+		}
+	}
+	if len(p.SysObjectIDs) > 0 && n < 0 {
+		return 0, false
+	}
+
+	if len(p.sysDescr) > 0 {
+		matched := false
+		for _, re := range p.sysDescr {
+			if re.MatchString(sysDescr) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return 0, false
+		}
+	}
+	return n, true
+}
+
+// matchProfile returns the profile with the longest sysObjectID matching the
+// agent, the first one loaded when several match.
+func (s *Snmp) matchProfile(sysObjectID, sysDescr string) *Profile {
+	var best *Profile
+	bestLen := -2
+	for _, p := range s.profiles {
+		if n, ok := p.match(sysObjectID, sysDescr); ok && n > bestLen {
+			best, bestLen = p, n
+		}
+	}
+	return best
+}
+
+// discoveredAgents returns the agents found by the last discovery.  It is
+// called once per gather and closes the retired connections: the gathers of
+// an input do not overlap, so the previous gather is done using them.
+func (s *Snmp) discoveredAgents() []*discoveredAgent {
+	s.discoveryLock.Lock()
+	defer s.discoveryLock.Unlock()
+
+	for _, conn := range s.retired {
+		closeConnection(conn)
+	}
+	s.retired = nil
+
+	agents := make([]*discoveredAgent, 0, len(s.discovered))
+	for _, d := range s.discovered {
+		agents = append(agents, d)
+	}
+	return agents
+}
+
+// startDiscovery runs a discovery in the background when the interval has
+// elapsed since the last one.  The agents found are collected from the next
+// gather on.
+func (s *Snmp) startDiscovery(acc telegraf.Accumulator) {
+	s.discoveryLock.Lock()
+	defer s.discoveryLock.Unlock()
+
+	if s.discovering {
+		return
+	}
+	if !s.lastDiscovery.IsZero() && time.Since(s.lastDiscovery) < s.Discovery.Interval.Duration {
+		return
+	}
+	s.discovering = true
+	s.lastDiscovery = time.Now()
+
+	s.discoveryWG.Add(1)
+	go func() {
+		defer s.discoveryWG.Done()
+		if err := s.discover(s.discoveryCtx); err != nil && err != context.Canceled {
+			acc.AddError(Errorf(err, "discovering agents"))
+		}
+
+		s.discoveryLock.Lock()
+		s.discovering = false
+		s.discoveryLock.Unlock()
+	}()
+}
+
+// discover sweeps the networks, and replaces the discovered agents with the
+// ones found.  The sweep stops when the context is cancelled, the discovered
+// agents are then left unchanged.
+func (s *Snmp) discover(ctx context.Context) error {
+	addresses := make(chan string)
+	found := make(chan *discoveredAgent)
+
+	var errOnce sync.Once
+	var setupErr error
+
+	var wg sync.WaitGroup
+	for i := 0; i < s.Discovery.MaxConcurrent; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for agent := range addresses {
+				d, err := s.probe(agent)
+				if err != nil {
+					errOnce.Do(func() { setupErr = err })
+					continue
+				}
+				if d != nil {
+					found <- d
+				}
+			}
+		}()
+	}
+
+	go func() {
+	sweep:
+		for _, n := range s.Discovery.networks {
+			for _, ip := range hosts(n) {
+				select {
+				case addresses <- "udp://" + net.JoinHostPort(ip.String(), strconv.Itoa(int(s.Discovery.Port))):
+				case <-ctx.Done():
+					break sweep
+				}
+			}
+		}
+		close(addresses)
+		wg.Wait()
+		close(found)
+	}()
+
+	agents := map[string]*discoveredAgent{}
+	for d := range found {
+		agents[d.agent] = d
+	}
+
+	if ctx.Err() != nil {
+		for _, d := range agents {
+			closeConnection(d.conn)
+		}
+		return ctx.Err()
+	}
+
+	s.discoveryLock.Lock()
+	previous := s.discovered
+	for agent, d := range agents {
+		// keep the connection of the agents already discovered
+		if p, ok := previous[agent]; ok {
+			closeConnection(d.conn)
+			d.conn = p.conn
+			delete(previous, agent)
+		}
+	}
+	s.discovered = agents
+	// A running gather may still use the connections of the agents gone.
+	for _, d := range previous {
+		s.retired = append(s.retired, d.conn)
+	}
+	s.discoveryLock.Unlock()
+
+	log.Printf("D! [inputs.snmp] Discovered %d agents", len(agents))
+	return setupErr
+}
+
+// probe identifies the agent, it returns nil when no agent answers at the
+// address or when no profile matches it.  Errors are only returned for
+// invalid connection options.
+func (s *Snmp) probe(agent string) (*discoveredAgent, error) {
+	conn, err := connectAgent(s, agent)
+	if err != nil {
+		return nil, err
+	}
+
+	pkt, err := conn.Get([]string{sysObjectIDOid, sysDescrOid})
+	if err != nil || pkt == nil {
+		closeConnection(conn)
+		return nil, nil
+	}
+
+	var sysObjectID, sysDescr string
+	for _, v := range pkt.Variables {
+		switch v.Name {
+		case sysObjectIDOid:
+			if oid, ok := v.Value.(string); ok {
+				sysObjectID = normalizeOid(oid)
+			}
+		case sysDescrOid:
+			switch value := v.Value.(type) {
+			case []byte:
+				sysDescr = string(value)
+			case string:
+				sysDescr = value
+			}
+		}
+	}
+	if sysObjectID == "" {
+		closeConnection(conn)
+		return nil, nil
+	}
+
+	profile := s.matchProfile(sysObjectID, sysDescr)
+	if profile == nil {
+		log.Printf("D! [inputs.snmp] No profile matches agent %s with sysObjectID %s", agent, sysObjectID)
+		closeConnection(conn)
+		return nil, nil
+	}
+	return &discoveredAgent{agent: agent, profile: profile, conn: conn}, nil
+}
+
+func closeConnection(conn snmpConnection) {
+	if gs, ok := conn.(gosnmpWrapper); ok && gs.Conn != nil {
+		gs.Conn.Close()
+	}
+}
+
+// hosts returns the addresses of the network, without the network and
+// broadcast addresses of IPv4 networks larger than /31.
+func hosts(n *net.IPNet) []net.IP {
+	ones, bits := n.Mask.Size()
+	count := 1 << uint(bits-ones)
+
+	first := 0
+	last := count - 1
+	if bits == 32 && bits-ones > 1 {
+		first++
+		last--
+	}
+
+	base := new(big.Int).SetBytes(n.IP.Mask(n.Mask))
+	ips := make([]net.IP, 0, last-first+1)
+	for i := first; i <= last; i++ {
+		b := new(big.Int).Add(base, big.NewInt(int64(i))).Bytes()
+		ip := make(net.IP, bits/8)
+		copy(ip[len(ip)-len(b):], b)
+		ips = append(ips, ip)
+	}
+	return ips
+}
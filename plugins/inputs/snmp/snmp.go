@@ -3,6 +3,7 @@ package snmp
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"log"
 	"math"
@@ -16,6 +17,7 @@ import (
 
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/common/mib"
 	"github.com/influxdata/telegraf/plugins/inputs"
 	"github.com/influxdata/wlog"
 	"github.com/soniah/gosnmp"
@@ -43,6 +45,11 @@ const sampleConfig = `
   ## The GETBULK max-repetitions parameter.
   # max_repetitions = 10
 
+  ## Directories to load MIB files from.  OIDs and tables are translated
+  ## in-process using these MIBs, the net-snmp tools are only run for the
+  ## OIDs not found in them.
+  # mib_paths = ["/usr/share/snmp/mibs"]
+
   ## SNMPv3 authentication and encryption options.
   ##
   ## Security Name.
@@ -60,6 +67,21 @@ const sampleConfig = `
   ## Privacy password used for encrypted messages.
   # priv_password = ""
 
+  ## Discover the agents of networks, and collect the fields and tables of
+  ## the profile matching each agent.  Discovered agents are queried with the
+  ## version, community and SNMPv3 options above.
+  # [inputs.snmp.discovery]
+  #   ## Networks to sweep, at most 65536 addresses each.
+  #   networks = ["192.168.1.0/24"]
+  #   ## Port the agents listen on.
+  #   # port = 161
+  #   ## Interval between two discoveries.
+  #   # interval = "1h"
+  #   ## Maximum number of agents queried at the same time.
+  #   # max_concurrent = 64
+  #   ## Profile files, or directories of "*.toml" profile files.
+  #   profile_paths = ["/etc/telegraf/snmp_profiles"]
+
   ## Add fields and tables defining the variables you wish to collect.  This
   ## example collects the system uptime and interface variables.  Reference the
   ## full plugin documentation for configuration details.
@@ -124,6 +146,9 @@ type Snmp struct {
 	EngineBoots  uint32 `toml:"-"`
 	EngineTime   uint32 `toml:"-"`
 
+	// Directories to load MIB files from.
+	MibPaths []string `toml:"mib_paths"`
+
 	Tables []Table `toml:"table"`
 
 	// Name & Fields are the elements of a Table.
@@ -132,8 +157,24 @@ type Snmp struct {
 	Name   string  // deprecated in 1.14; use name_override
 	Fields []Field `toml:"field"`
 
+	// Discovery of the agents in a network, when set.
+	Discovery *Discovery `toml:"discovery"`
+
 	connectionCache []snmpConnection
 	initialized     bool
+
+	profiles      []*Profile
+	discoveryLock sync.Mutex
+	discovering   bool
+	lastDiscovery time.Time
+	discovered    map[string]*discoveredAgent
+	// retired holds the connections of the agents no longer discovered,
+	// closed by the next gather.
+	retired []snmpConnection
+
+	discoveryCtx    context.Context
+	cancelDiscovery context.CancelFunc
+	discoveryWG     sync.WaitGroup
 }
 
 func (s *Snmp) init() error {
@@ -143,6 +184,12 @@ func (s *Snmp) init() error {
 
 	s.connectionCache = make([]snmpConnection, len(s.Agents))
 
+	if len(s.MibPaths) > 0 {
+		if err := loadMibs(s.MibPaths); err != nil {
+			return Errorf(err, "loading MIBs")
+		}
+	}
+
 	for i := range s.Tables {
 		if err := s.Tables[i].init(); err != nil {
 			return Errorf(err, "initializing table %s", s.Tables[i].Name)
@@ -155,6 +202,13 @@ func (s *Snmp) init() error {
 		}
 	}
 
+	if s.Discovery != nil {
+		if err := s.initDiscovery(); err != nil {
+			return Errorf(err, "initializing discovery")
+		}
+		s.discoveryCtx, s.cancelDiscovery = context.WithCancel(context.Background())
+	}
+
 	s.initialized = true
 	return nil
 }
@@ -203,8 +257,8 @@ func (t *Table) init() error {
 }
 
 // initBuild initializes the table if it has an OID configured. If so, the
-// net-snmp tools will be used to look up the OID and auto-populate the table's
-// fields.
+// loaded MIBs or the net-snmp tools will be used to look up the OID and
+// auto-populate the table's fields.
 func (t *Table) initBuild() error {
 	if t.Oid == "" {
 		return nil
@@ -276,8 +330,6 @@ func (f *Field) init() error {
 		f.Conversion = conversion
 	}
 
-	//TODO use textual convention conversion from the MIB
-
 	f.initialized = true
 	return nil
 }
@@ -345,6 +397,32 @@ func (s *Snmp) Description() string {
 	return description
 }
 
+// Start implements telegraf.ServiceInput, so that the discovery running in
+// the background is stopped with the input.
+func (s *Snmp) Start(_ telegraf.Accumulator) error {
+	return nil
+}
+
+// Stop cancels the running discovery and closes the connections of the
+// discovered agents.
+func (s *Snmp) Stop() {
+	if s.cancelDiscovery != nil {
+		s.cancelDiscovery()
+	}
+	s.discoveryWG.Wait()
+
+	s.discoveryLock.Lock()
+	defer s.discoveryLock.Unlock()
+	for _, d := range s.discovered {
+		closeConnection(d.conn)
+	}
+	for _, conn := range s.retired {
+		closeConnection(conn)
+	}
+	s.discovered = nil
+	s.retired = nil
+}
+
 // Gather retrieves all the configured fields and tables.
 // Any error encountered does not halt the process. The errors are accumulated
 // and returned at the end.
@@ -353,6 +431,10 @@ func (s *Snmp) Gather(acc telegraf.Accumulator) error {
 		return err
 	}
 
+	if s.Discovery != nil {
+		s.startDiscovery(acc)
+	}
+
 	var wg sync.WaitGroup
 	for i, agent := range s.Agents {
 		wg.Add(1)
@@ -363,31 +445,45 @@ func (s *Snmp) Gather(acc telegraf.Accumulator) error {
 				acc.AddError(Errorf(err, "agent %s", agent))
 				return
 			}
-
-			// First is the top-level fields. We treat the fields as table prefixes with an empty index.
-			t := Table{
-				Name:   s.Name,
-				Fields: s.Fields,
-			}
-			topTags := map[string]string{}
-			if err := s.gatherTable(acc, gs, t, topTags, false); err != nil {
-				acc.AddError(Errorf(err, "agent %s", agent))
-			}
-
-			// Now is the real tables.
-			for _, t := range s.Tables {
-				if err := s.gatherTable(acc, gs, t, topTags, true); err != nil {
-					acc.AddError(Errorf(err, "agent %s: gathering table %s", agent, t.Name))
-				}
-			}
+			s.gatherAgent(acc, gs, agent, s.Fields, s.Tables, nil)
 		}(i, agent)
 	}
+
+	for _, d := range s.discoveredAgents() {
+		wg.Add(1)
+		go func(d *discoveredAgent) {
+			defer wg.Done()
+			tags := map[string]string{"profile": d.profile.Name}
+			s.gatherAgent(acc, d.conn, d.agent, d.profile.Fields, d.profile.Tables, tags)
+		}(d)
+	}
 	wg.Wait()
 
 	return nil
 }
 
-func (s *Snmp) gatherTable(acc telegraf.Accumulator, gs snmpConnection, t Table, topTags map[string]string, walk bool) error {
+// gatherAgent retrieves the fields and tables from an agent, the tags are
+// added to all the metrics.
+func (s *Snmp) gatherAgent(acc telegraf.Accumulator, gs snmpConnection, agent string, fields []Field, tables []Table, tags map[string]string) {
+	// First is the top-level fields. We treat the fields as table prefixes with an empty index.
+	t := Table{
+		Name:   s.Name,
+		Fields: fields,
+	}
+	topTags := map[string]string{}
+	if err := s.gatherTable(acc, gs, t, topTags, tags, false); err != nil {
+		acc.AddError(Errorf(err, "agent %s", agent))
+	}
+
+	// Now is the real tables.
+	for _, t := range tables {
+		if err := s.gatherTable(acc, gs, t, topTags, tags, true); err != nil {
+			acc.AddError(Errorf(err, "agent %s: gathering table %s", agent, t.Name))
+		}
+	}
+}
+
+func (s *Snmp) gatherTable(acc telegraf.Accumulator, gs snmpConnection, t Table, topTags map[string]string, tags map[string]string, walk bool) error {
 	rt, err := t.Build(gs, walk)
 	if err != nil {
 		return err
@@ -410,6 +506,9 @@ func (s *Snmp) gatherTable(acc telegraf.Accumulator, gs snmpConnection, t Table,
 		if _, ok := tr.Tags["agent_host"]; !ok {
 			tr.Tags["agent_host"] = gs.Host()
 		}
+		for k, v := range tags {
+			tr.Tags[k] = v
+		}
 		acc.AddFields(rt.Name, tr.Fields, tr.Tags, rt.Time)
 	}
 
@@ -610,13 +709,31 @@ func (s *Snmp) getConnection(idx int) (snmpConnection, error) {
 	gs := gosnmpWrapper{&gosnmp.GoSNMP{}}
 	s.connectionCache[idx] = gs
 
+	if err := s.setupConnection(gs, agent); err != nil {
+		return nil, err
+	}
+	return gs, nil
+}
+
+// connect creates a snmpConnection to the agent, it is not cached.
+func (s *Snmp) connect(agent string) (snmpConnection, error) {
+	gs := gosnmpWrapper{&gosnmp.GoSNMP{}}
+	if err := s.setupConnection(gs, agent); err != nil {
+		return nil, err
+	}
+	return gs, nil
+}
+
+// setupConnection configures the connection to the agent with the options of
+// the plugin, and connects it.
+func (s *Snmp) setupConnection(gs gosnmpWrapper, agent string) error {
 	if !strings.Contains(agent, "://") {
 		agent = "udp://" + agent
 	}
 
 	u, err := url.Parse(agent)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	switch u.Scheme {
@@ -625,7 +742,7 @@ func (s *Snmp) getConnection(idx int) (snmpConnection, error) {
 	case "", "udp":
 		gs.Transport = "udp"
 	default:
-		return nil, fmt.Errorf("unsupported scheme: %v", u.Scheme)
+		return fmt.Errorf("unsupported scheme: %v", u.Scheme)
 	}
 
 	gs.Target = u.Hostname()
@@ -636,7 +753,7 @@ func (s *Snmp) getConnection(idx int) (snmpConnection, error) {
 	}
 	port, err := strconv.ParseUint(portStr, 10, 16)
 	if err != nil {
-		return nil, Errorf(err, "parsing port")
+		return Errorf(err, "parsing port")
 	}
 	gs.Port = uint16(port)
 
@@ -652,7 +769,7 @@ func (s *Snmp) getConnection(idx int) (snmpConnection, error) {
 	case 1:
 		gs.Version = gosnmp.Version1
 	default:
-		return nil, fmt.Errorf("invalid version")
+		return fmt.Errorf("invalid version")
 	}
 
 	if s.Version < 3 {
@@ -680,7 +797,7 @@ func (s *Snmp) getConnection(idx int) (snmpConnection, error) {
 		case "authpriv":
 			gs.MsgFlags = gosnmp.AuthPriv
 		default:
-			return nil, fmt.Errorf("invalid secLevel")
+			return fmt.Errorf("invalid secLevel")
 		}
 
 		sp.UserName = s.SecName
@@ -693,7 +810,7 @@ func (s *Snmp) getConnection(idx int) (snmpConnection, error) {
 		case "":
 			sp.AuthenticationProtocol = gosnmp.NoAuth
 		default:
-			return nil, fmt.Errorf("invalid authProtocol")
+			return fmt.Errorf("invalid authProtocol")
 		}
 
 		sp.AuthenticationPassphrase = s.AuthPassword
@@ -706,7 +823,7 @@ func (s *Snmp) getConnection(idx int) (snmpConnection, error) {
 		case "":
 			sp.PrivacyProtocol = gosnmp.NoPriv
 		default:
-			return nil, fmt.Errorf("invalid privProtocol")
+			return fmt.Errorf("invalid privProtocol")
 		}
 
 		sp.PrivacyPassphrase = s.PrivPassword
@@ -719,10 +836,10 @@ func (s *Snmp) getConnection(idx int) (snmpConnection, error) {
 	}
 
 	if err := gs.Connect(); err != nil {
-		return nil, Errorf(err, "setting up connection")
+		return Errorf(err, "setting up connection")
 	}
 
-	return gs, nil
+	return nil
 }
 
 // fieldConvert converts from any type according to the conv specification
@@ -879,6 +996,12 @@ func snmpTable(oid string) (mibName string, oidNum string, oidText string, field
 }
 
 func snmpTableCall(oid string) (mibName string, oidNum string, oidText string, fields []Field, err error) {
+	if tree, node, suffix, ok := mibTranslate(oid); ok && suffix == "" {
+		if columns, index, err := tree.Columns(node); err == nil {
+			return mibTableFields(node, columns, index)
+		}
+	}
+
 	mibName, oidNum, oidText, _, err = SnmpTranslate(oid)
 	if err != nil {
 		return "", "", "", nil, Errorf(err, "translating")
@@ -998,6 +1121,15 @@ func SnmpTranslateClear() {
 }
 
 func snmpTranslateCall(oid string) (mibName string, oidNum string, oidText string, conversion string, err error) {
+	if tree, node, suffix, ok := mibTranslate(oid); ok {
+		for _, tc := range tree.TextualConventions(node) {
+			if conversion = tcConversion(tc); conversion != "" {
+				break
+			}
+		}
+		return node.Module, node.Oid + suffix, node.Name + suffix, conversion, nil
+	}
+
 	var out []byte
 	if strings.ContainsAny(oid, ":abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ") {
 		out, err = execCmd("snmptranslate", "-Td", "-Ob", oid)
@@ -1039,11 +1171,8 @@ func snmpTranslateCall(oid string) (mibName string, oidNum string, oidText strin
 
 		if strings.HasPrefix(line, "  -- TEXTUAL CONVENTION ") {
 			tc := strings.TrimPrefix(line, "  -- TEXTUAL CONVENTION ")
-			switch tc {
-			case "MacAddress", "PhysAddress":
-				conversion = "hwaddr"
-			case "InetAddressIPv4", "InetAddressIPv6", "InetAddress", "IPSIpAddress":
-				conversion = "ipaddr"
+			if c := tcConversion(tc); c != "" {
+				conversion = c
 			}
 		} else if strings.HasPrefix(line, "::= { ") {
 			objs := strings.TrimPrefix(line, "::= { ")
@@ -1066,3 +1195,67 @@ func snmpTranslateCall(oid string) (mibName string, oidNum string, oidText strin
 
 	return mibName, oidNum, oidText, conversion, nil
 }
+
+// tcConversion returns the conversion of the values of a textual convention.
+func tcConversion(tc string) string {
+	switch tc {
+	case "MacAddress", "PhysAddress":
+		return "hwaddr"
+	case "InetAddressIPv4", "InetAddressIPv6", "InetAddress", "IPSIpAddress":
+		return "ipaddr"
+	}
+	return ""
+}
+
+// mibTrees are the MIBs loaded from the mib_paths of the plugin instances.
+// Like the translation caches they are shared by all the instances, and are
+// consulted before running the net-snmp tools.
+var mibTrees []*mib.Tree
+var mibTreesLock sync.Mutex
+
+func loadMibs(paths []string) error {
+	tree, err := mib.LoadDirs(paths)
+	if err != nil {
+		return err
+	}
+
+	mibTreesLock.Lock()
+	defer mibTreesLock.Unlock()
+	for _, t := range mibTrees {
+		if t == tree {
+			return nil
+		}
+	}
+	for _, w := range tree.Warnings {
+		log.Printf("W! [inputs.snmp] %v", w)
+	}
+	mibTrees = append(mibTrees, tree)
+	return nil
+}
+
+// mibTranslate resolves the OID with the loaded MIBs.  OIDs resolving to
+// a node outside of any module are left to the net-snmp tools.
+func mibTranslate(oid string) (*mib.Tree, *mib.Node, string, bool) {
+	mibTreesLock.Lock()
+	defer mibTreesLock.Unlock()
+	for _, tree := range mibTrees {
+		if node, suffix, err := tree.Lookup(oid); err == nil && node.Module != "" {
+			return tree, node, suffix, true
+		}
+	}
+	return nil, nil, "", false
+}
+
+// mibTableFields returns the table information resolved from the MIBs, in
+// the form returned by snmpTableCall.
+func mibTableFields(table *mib.Node, columns []*mib.Node, index []string) (mibName string, oidNum string, oidText string, fields []Field, err error) {
+	tags := make(map[string]bool, len(index))
+	for _, name := range index {
+		tags[name] = true
+	}
+
+	for _, col := range columns {
+		fields = append(fields, Field{Name: col.Name, Oid: col.Module + "::" + col.Name, IsTag: tags[col.Name]})
+	}
+	return table.Module, table.Oid, table.Name, fields, nil
+}
@@ -2,13 +2,16 @@
 package snmp
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"os/exec"
+	"regexp"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/internal"
 	"github.com/influxdata/telegraf/plugins/inputs"
 	"github.com/influxdata/telegraf/testutil"
@@ -180,6 +183,50 @@ func TestSnmpInit(t *testing.T) {
 	}, s.Fields[0])
 }
 
+func TestSnmpInit_mibPaths(t *testing.T) {
+	// override execCommand so the net-snmp tools can not be used
+	defer func(ec func(string, ...string) *exec.Cmd) { execCommand = ec }(execCommand)
+	execCommand = func(_ string, _ ...string) *exec.Cmd {
+		return exec.Command("snmptranslateExecErrNotFound")
+	}
+
+	reset := func() {
+		SnmpTranslateClear()
+		snmpTableCachesLock.Lock()
+		snmpTableCaches = nil
+		snmpTableCachesLock.Unlock()
+		mibTreesLock.Lock()
+		mibTrees = nil
+		mibTreesLock.Unlock()
+	}
+	reset()
+	defer reset()
+
+	s := &Snmp{
+		MibPaths: []string{"testdata"},
+		Tables: []Table{
+			{Oid: "TEST::testTable"},
+		},
+		Fields: []Field{
+			{Oid: "TEST::hostname"},
+			{Oid: ".1.0.0.0.1.1.0"},
+		},
+	}
+
+	err := s.init()
+	require.NoError(t, err)
+
+	assert.Equal(t, "testTable", s.Tables[0].Name)
+	assert.Len(t, s.Tables[0].Fields, 4)
+	assert.Contains(t, s.Tables[0].Fields, Field{Oid: ".1.0.0.0.1.1", Name: "server", IsTag: true, initialized: true})
+	assert.Contains(t, s.Tables[0].Fields, Field{Oid: ".1.0.0.0.1.2", Name: "connections", initialized: true})
+	assert.Contains(t, s.Tables[0].Fields, Field{Oid: ".1.0.0.0.1.3", Name: "latency", initialized: true})
+	assert.Contains(t, s.Tables[0].Fields, Field{Oid: ".1.0.0.0.1.4", Name: "description", initialized: true})
+
+	assert.Equal(t, Field{Oid: ".1.0.0.1.1", Name: "hostname", initialized: true}, s.Fields[0])
+	assert.Equal(t, Field{Oid: ".1.0.0.0.1.1.0", Name: "server.0", initialized: true}, s.Fields[1])
+}
+
 func TestSnmpInit_noTranslate(t *testing.T) {
 	// override execCommand so it returns exec.ErrNotFound
 	defer func(ec func(string, ...string) *exec.Cmd) { execCommand = ec }(execCommand)
@@ -799,3 +846,210 @@ func TestError(t *testing.T) {
 	assert.Contains(t, err.Error(), "top error 123")
 	assert.Contains(t, err.Error(), "nested error")
 }
+
+func TestHosts(t *testing.T) {
+	tests := []struct {
+		network string
+		hosts   []string
+	}{
+		{"192.168.1.0/30", []string{"192.168.1.1", "192.168.1.2"}},
+		{"192.168.1.7/31", []string{"192.168.1.6", "192.168.1.7"}},
+		{"10.0.0.1/32", []string{"10.0.0.1"}},
+		{"2001:db8::/127", []string{"2001:db8::", "2001:db8::1"}},
+	}
+	for _, tt := range tests {
+		_, n, err := net.ParseCIDR(tt.network)
+		require.NoError(t, err)
+		var ips []string
+		for _, ip := range hosts(n) {
+			ips = append(ips, ip.String())
+		}
+		assert.Equal(t, tt.hosts, ips, tt.network)
+	}
+
+	_, n, err := net.ParseCIDR("10.0.0.0/24")
+	require.NoError(t, err)
+	assert.Len(t, hosts(n), 254)
+}
+
+func TestProfileMatch(t *testing.T) {
+	s := &Snmp{
+		profiles: []*Profile{
+			{Name: "any"},
+			{Name: "vendor", SysObjectIDs: []string{".1.3.6.1.4.1.9"}},
+			{Name: "model", SysObjectIDs: []string{".1.3.6.1.4.1.9.1.1", ".1.3.6.1.4.1.9.1.2"}},
+			{Name: "descr", SysObjectIDs: []string{".1.3.6.1.4.1.9"}, sysDescr: []*regexp.Regexp{regexp.MustCompile("^IOS")}},
+		},
+	}
+
+	assert.Equal(t, "model", s.matchProfile(".1.3.6.1.4.1.9.1.2", "IOS").Name)
+	assert.Equal(t, "vendor", s.matchProfile(".1.3.6.1.4.1.9.1.3", "IOS").Name)
+	assert.Equal(t, "vendor", s.matchProfile(".1.3.6.1.4.1.9", "NX-OS").Name)
+	assert.Equal(t, "any", s.matchProfile(".1.3.6.1.4.1.99", "IOS").Name)
+
+	s.profiles = s.profiles[1:]
+	assert.Nil(t, s.matchProfile(".1.3.6.1.4.1.99", "IOS"))
+}
+
+func TestLoadProfiles(t *testing.T) {
+	// override execCommand so the net-snmp tools are not used for the
+	// numeric OIDs
+	defer func(ec func(string, ...string) *exec.Cmd) { execCommand = ec }(execCommand)
+	execCommand = func(_ string, _ ...string) *exec.Cmd {
+		return exec.Command("snmptranslateExecErrNotFound")
+	}
+
+	profiles, err := loadProfiles([]string{"testdata/profiles"})
+	require.NoError(t, err)
+	require.Len(t, profiles, 2)
+	assert.Equal(t, "linux", profiles[0].Name)
+	assert.Equal(t, "test", profiles[1].Name)
+	assert.Equal(t, []string{".1.3.6.1.4.1.99999"}, profiles[1].SysObjectIDs)
+	assert.Equal(t, []Field{{Name: "connections", Oid: ".1.0.0.0.1.2", initialized: true}}, profiles[1].Tables[0].Fields)
+
+	_, err = loadProfiles([]string{"testdata/profiles", "testdata/profiles/linux.toml"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "duplicate profile linux")
+}
+
+func TestDiscovery(t *testing.T) {
+	defer func(ec func(string, ...string) *exec.Cmd) { execCommand = ec }(execCommand)
+	execCommand = func(_ string, _ ...string) *exec.Cmd {
+		return exec.Command("snmptranslateExecErrNotFound")
+	}
+
+	agents := map[string]*testSNMPConnection{
+		"udp://192.168.1.1:1161": {
+			host: "192.168.1.1",
+			values: map[string]interface{}{
+				sysObjectIDOid:   ".1.3.6.1.4.1.99999.1.5",
+				sysDescrOid:      []byte("Linux test 4.19"),
+				".1.0.0.1.2":     234,
+				".1.0.0.0.1.2.0": 1,
+				".1.0.0.0.1.2.1": 2,
+			},
+		},
+		"udp://192.168.1.2:1161": {
+			host: "192.168.1.2",
+			values: map[string]interface{}{
+				sysObjectIDOid: ".1.3.6.1.4.1.8072.3.2.10",
+				sysDescrOid:    []byte("Linux host 5.4"),
+				".1.0.0.1.1":   "host",
+				".1.0.0.1.2":   345,
+			},
+		},
+		"udp://192.168.1.3:1161": {
+			host: "192.168.1.3",
+			values: map[string]interface{}{
+				sysObjectIDOid: ".1.3.6.1.4.1.9.1.1",
+				sysDescrOid:    []byte("Cisco IOS"),
+			},
+		},
+	}
+	defer func(ca func(*Snmp, string) (snmpConnection, error)) { connectAgent = ca }(connectAgent)
+	var lock sync.Mutex
+	var probed []string
+	connectAgent = func(_ *Snmp, agent string) (snmpConnection, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		probed = append(probed, agent)
+		if c, ok := agents[agent]; ok {
+			return c, nil
+		}
+		return &testSNMPConnection{}, nil
+	}
+
+	s := &Snmp{
+		Name: "snmp",
+		Discovery: &Discovery{
+			Networks:     []string{"192.168.1.0/29"},
+			Port:         1161,
+			ProfilePaths: []string{"testdata/profiles"},
+		},
+	}
+	require.NoError(t, s.init())
+	require.NoError(t, s.discover(context.Background()))
+	assert.Len(t, probed, 6)
+
+	discovered := map[string]string{}
+	for _, d := range s.discoveredAgents() {
+		discovered[d.agent] = d.profile.Name
+	}
+	assert.Equal(t, map[string]string{
+		"udp://192.168.1.1:1161": "test",
+		"udp://192.168.1.2:1161": "linux",
+	}, discovered)
+
+	// don't start another discovery
+	s.lastDiscovery = time.Now()
+
+	acc := &testutil.Accumulator{}
+	require.NoError(t, s.Gather(acc))
+
+	expected := []telegraf.Metric{
+		testutil.MustMetric("snmp",
+			map[string]string{"agent_host": "192.168.1.1", "profile": "test"},
+			map[string]interface{}{"uptime": 234},
+			time.Unix(0, 0)),
+		testutil.MustMetric("testTable",
+			map[string]string{"agent_host": "192.168.1.1", "profile": "test", "index": "0"},
+			map[string]interface{}{"connections": 1},
+			time.Unix(0, 0)),
+		testutil.MustMetric("testTable",
+			map[string]string{"agent_host": "192.168.1.1", "profile": "test", "index": "1"},
+			map[string]interface{}{"connections": 2},
+			time.Unix(0, 0)),
+		testutil.MustMetric("snmp",
+			map[string]string{"agent_host": "192.168.1.2", "profile": "linux", "hostname": "host"},
+			map[string]interface{}{"uptime": 345},
+			time.Unix(0, 0)),
+	}
+	testutil.RequireMetricsEqual(t, expected, acc.GetTelegrafMetrics(), testutil.SortMetrics(), testutil.IgnoreTime())
+
+	// the connection of an agent gone is closed by the next gather
+	lock.Lock()
+	gone := agents["udp://192.168.1.1:1161"]
+	delete(agents, "udp://192.168.1.1:1161")
+	lock.Unlock()
+	require.NoError(t, s.discover(context.Background()))
+	assert.Equal(t, []snmpConnection{gone}, s.retired)
+	assert.Len(t, s.discoveredAgents(), 1)
+	assert.Empty(t, s.retired)
+
+	s.Stop()
+	assert.Empty(t, s.discoveredAgents())
+}
+
+func TestDiscoveryCancel(t *testing.T) {
+	defer func(ca func(*Snmp, string) (snmpConnection, error)) { connectAgent = ca }(connectAgent)
+	connectAgent = func(_ *Snmp, agent string) (snmpConnection, error) {
+		return &testSNMPConnection{
+			host: agent,
+			values: map[string]interface{}{
+				sysObjectIDOid: ".1.3.6.1.4.1.8072.3.2.10",
+				sysDescrOid:    []byte("Linux host 5.4"),
+			},
+		}, nil
+	}
+
+	s := &Snmp{
+		Name: "snmp",
+		Discovery: &Discovery{
+			Networks:     []string{"192.168.0.0/16"},
+			ProfilePaths: []string{"testdata/profiles"},
+		},
+	}
+	require.NoError(t, s.init())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.Equal(t, context.Canceled, s.discover(ctx))
+	assert.Empty(t, s.discoveredAgents())
+
+	// stopping the input cancels the running discovery
+	acc := &testutil.Accumulator{}
+	s.startDiscovery(acc)
+	s.Stop()
+	assert.Empty(t, s.discoveredAgents())
+	assert.Empty(t, acc.Errors)
+}
@@ -0,0 +1,154 @@
+package snmp_trap
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The messages are decoded by gosnmp, except for the SNMPv3 message wrapping
+// the PDU which is handled by the plugin so that several users and inform
+// requests are supported.  These are the few BER helpers needed for it.
+
+const (
+	berInteger     = 0x02
+	berOctetString = 0x04
+	berSequence    = 0x30
+	berCounter32   = 0x41
+)
+
+var errTruncated = errors.New("truncated message")
+
+// element is a decoded BER element, raw holds the whole encoding and content
+// starts at offset in the message.
+type element struct {
+	tag     byte
+	raw     []byte
+	content []byte
+	offset  int
+}
+
+// start returns the offset of the element in the message.
+func (e element) start() int {
+	return e.offset - len(e.raw) + len(e.content)
+}
+
+// berReader reads the elements of a message in sequence.
+type berReader struct {
+	b   []byte
+	off int
+	end int
+}
+
+func newBERReader(b []byte) *berReader {
+	return &berReader{b: b, end: len(b)}
+}
+
+// children returns a reader of the elements contained in the element.
+func (r *berReader) children(e element) *berReader {
+	return &berReader{b: r.b, off: e.offset, end: e.offset + len(e.content)}
+}
+
+func (r *berReader) next() (element, error) {
+	if r.off+2 > r.end {
+		return element{}, errTruncated
+	}
+
+	start := r.off
+	tag := r.b[start]
+	length := int(r.b[start+1])
+	offset := start + 2
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 3 || offset+n > r.end {
+			return element{}, fmt.Errorf("invalid length at offset %d", start)
+		}
+		length = 0
+		for _, c := range r.b[offset : offset+n] {
+			length = length<<8 | int(c)
+		}
+		offset += n
+	}
+	if offset+length > r.end {
+		return element{}, errTruncated
+	}
+
+	r.off = offset + length
+	return element{
+		tag:     tag,
+		raw:     r.b[start:r.off],
+		content: r.b[offset:r.off],
+		offset:  offset,
+	}, nil
+}
+
+// expect reads the next element and checks its tag.
+func (r *berReader) expect(tag byte) (element, error) {
+	e, err := r.next()
+	if err != nil {
+		return e, err
+	}
+	if e.tag != tag {
+		return e, fmt.Errorf("unexpected tag %#x at offset %d, expected %#x", e.tag, e.offset, tag)
+	}
+	return e, nil
+}
+
+func (r *berReader) integer() (int64, error) {
+	e, err := r.expect(berInteger)
+	if err != nil {
+		return 0, err
+	}
+	if len(e.content) == 0 || len(e.content) > 8 {
+		return 0, fmt.Errorf("invalid integer at offset %d", e.offset)
+	}
+
+	var v int64
+	if e.content[0]&0x80 != 0 {
+		v = -1
+	}
+	for _, c := range e.content {
+		v = v<<8 | int64(c)
+	}
+	return v, nil
+}
+
+func (r *berReader) octetString() ([]byte, error) {
+	e, err := r.expect(berOctetString)
+	return e.content, err
+}
+
+// appendTLV appends the encoding of an element.
+func appendTLV(b []byte, tag byte, content ...[]byte) []byte {
+	length := 0
+	for _, c := range content {
+		length += len(c)
+	}
+
+	b = append(b, tag)
+	switch {
+	case length < 0x80:
+		b = append(b, byte(length))
+	case length <= 0xff:
+		b = append(b, 0x81, byte(length))
+	default:
+		b = append(b, 0x82, byte(length>>8), byte(length))
+	}
+	for _, c := range content {
+		b = append(b, c...)
+	}
+	return b
+}
+
+// encodeInteger returns the content of an INTEGER element.
+func encodeInteger(v int64) []byte {
+	b := []byte{byte(v)}
+	for v > 0x7f || v < -0x80 {
+		v >>= 8
+		b = append([]byte{byte(v)}, b...)
+	}
+	return b
+}
+
+func tlv(tag byte, content ...[]byte) []byte {
+	return appendTLV(nil, tag, content...)
+}
@@ -13,6 +13,7 @@ import (
 
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/common/mib"
 	"github.com/influxdata/telegraf/plugins/inputs"
 
 	"github.com/soniah/gosnmp"
@@ -31,11 +32,17 @@ type mibEntry struct {
 type SnmpTrap struct {
 	ServiceAddress string            `toml:"service_address"`
 	Timeout        internal.Duration `toml:"timeout"`
+	MibPaths       []string          `toml:"mib_paths"`
+	EngineID       string            `toml:"engine_id"`
+	AllowedSources []string          `toml:"allowed_sources"`
+	MinSecLevel    string            `toml:"min_sec_level"`
+	Users          []*User           `toml:"user"`
 
 	acc      telegraf.Accumulator
-	listener *gosnmp.TrapListener
+	conn     *net.UDPConn
+	done     chan struct{}
+	wg       sync.WaitGroup
 	timeFunc func() time.Time
-	errCh    chan error
 
 	makeHandlerWrapper func(handler) handler
 
@@ -44,7 +51,12 @@ type SnmpTrap struct {
 	cacheLock sync.Mutex
 	cache     map[string]mibEntry
 
+	mibs    *mib.Tree
 	execCmd execer
+
+	usm     *usm
+	sources []*net.IPNet
+	decoder *gosnmp.GoSNMP
 }
 
 var sampleConfig = `
@@ -58,6 +70,40 @@ var sampleConfig = `
   # service_address = "udp://:162"
   ## Timeout running snmptranslate command
   # timeout = "5s"
+  ## Directories to load MIB files from.  OIDs are translated in-process
+  ## using these MIBs, snmptranslate is only run for the OIDs not found in
+  ## them.
+  # mib_paths = ["/usr/share/snmp/mibs"]
+
+  ## Only accept traps and inform requests sent from these addresses or
+  ## networks.  By default any source is accepted.
+  # allowed_sources = ["127.0.0.1", "192.168.0.0/16"]
+
+  ## SNMPv3 engine ID of the trap receiver, in hex.  Agents sending inform
+  ## requests must use it to localize their keys.  Randomly generated on
+  ## startup by default.
+  # engine_id = "0x80001f8880a1b2c3d4e5f60708"
+
+  ## Minimum security level of the accepted messages, SNMPv1 and SNMPv2c
+  ## messages authenticated by community only are rejected when set.
+  ## Values: "", "noAuthNoPriv", "authNoPriv", "authPriv"
+  # min_sec_level = ""
+
+  ## SNMPv3 users allowed to send traps and inform requests.  Messages from
+  ## other users are dropped.
+  # [[inputs.snmp_trap.user]]
+  #   sec_name = "myuser"
+  #   ## Values: "noAuthNoPriv", "authNoPriv", "authPriv"
+  #   sec_level = "authNoPriv"
+  #   ## Values: "MD5", "SHA", "".
+  #   auth_protocol = "MD5"
+  #   auth_password = "authpassword"
+  #   ## Values: "DES", "AES", "".
+  #   priv_protocol = ""
+  #   priv_password = ""
+  #   ## Engine ID of the agent sending traps as this user, in hex.  By
+  #   ## default traps are accepted from any engine.
+  #   # engine_id = ""
 `
 
 func (s *SnmpTrap) SampleConfig() string {
@@ -96,18 +142,78 @@ func realExecCmd(Timeout internal.Duration, arg0 string, args ...string) ([]byte
 func (s *SnmpTrap) Init() error {
 	s.cache = map[string]mibEntry{}
 	s.execCmd = realExecCmd
+
+	if len(s.MibPaths) > 0 {
+		mibs, err := mib.LoadDirs(s.MibPaths)
+		if err != nil {
+			return fmt.Errorf("loading MIBs: %v", err)
+		}
+		for _, w := range mibs.Warnings {
+			s.Log.Warnf("%v", w)
+		}
+		s.mibs = mibs
+	}
+
+	for _, source := range s.AllowedSources {
+		if !strings.Contains(source, "/") {
+			if strings.Contains(source, ":") {
+				source += "/128"
+			} else {
+				source += "/32"
+			}
+		}
+		_, network, err := net.ParseCIDR(source)
+		if err != nil {
+			return fmt.Errorf("invalid allowed source: %v", err)
+		}
+		s.sources = append(s.sources, network)
+	}
+
+	if s.MinSecLevel != "" && len(s.Users) == 0 {
+		return fmt.Errorf("min_sec_level requires an SNMPv3 user")
+	}
+
+	if len(s.Users) > 0 {
+		minLevel, err := parseSecLevel(s.MinSecLevel)
+		if err != nil {
+			return fmt.Errorf("min_sec_level: %v", err)
+		}
+
+		engineID := s.EngineID
+		if engineID == "" {
+			id, err := newEngineID()
+			if err != nil {
+				return err
+			}
+			engineID = id
+		} else {
+			id, err := parseEngineID(engineID)
+			if err != nil {
+				return err
+			}
+			engineID = id
+		}
+
+		for _, user := range s.Users {
+			if err := user.init(); err != nil {
+				return fmt.Errorf("user %q: %v", user.SecName, err)
+			}
+		}
+		s.usm = newUSM(engineID, s.Users)
+		s.usm.minLevel = minLevel
+	}
+
+	s.decoder = &gosnmp.GoSNMP{}
 	return nil
 }
 
 func (s *SnmpTrap) Start(acc telegraf.Accumulator) error {
 	s.acc = acc
-	s.listener = gosnmp.NewTrapListener()
-	s.listener.OnNewTrap = makeTrapHandler(s)
-	s.listener.Params = gosnmp.Default
+	h := makeTrapHandler(s)
 
 	// wrap the handler, used in unit tests
 	if nil != s.makeHandlerWrapper {
-		s.listener.OnNewTrap = s.makeHandlerWrapper(s.listener.OnNewTrap)
+		h = s.makeHandlerWrapper(h)
 	}
 
 	split := strings.SplitN(s.ServiceAddress, "://", 2)
@@ -118,37 +224,192 @@ func (s *SnmpTrap) Start(acc telegraf.Accumulator) error {
 	protocol := split[0]
 	addr := split[1]
 
-	// gosnmp.TrapListener currently supports udp only.  For forward
-	// compatibility, require udp in the service address
+	// Only udp is supported.  For forward compatibility, require udp in
+	// the service address
 	if protocol != "udp" {
 		return fmt.Errorf("unknown protocol '%s' in '%s'", protocol, s.ServiceAddress)
 	}
 
-	// If (*TrapListener).Listen immediately returns an error we need
-	// to return it from this function.  Use a channel to get it here
-	// from the goroutine.  Buffer one in case Listen returns after
-	// Listening but before our Close is called.
-	s.errCh = make(chan error, 1)
-	go func() {
-		s.errCh <- s.listener.Listen(addr)
-	}()
-
-	select {
-	case <-s.listener.Listening():
-		s.Log.Infof("Listening on %s", s.ServiceAddress)
-	case err := <-s.errCh:
+	udpAddr, err := net.ResolveUDPAddr(protocol, addr)
+	if err != nil {
+		return err
+	}
+	s.conn, err = net.ListenUDP(protocol, udpAddr)
+	if err != nil {
 		return err
 	}
+	s.done = make(chan struct{})
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.listen(h)
+	}()
 
+	s.Log.Infof("Listening on %s", s.ServiceAddress)
 	return nil
 }
 
 func (s *SnmpTrap) Stop() {
-	s.listener.Close()
-	err := <-s.errCh
-	if nil != err {
+	close(s.done)
+	if err := s.conn.Close(); err != nil {
 		s.Log.Errorf("Error stopping trap listener %v", err)
 	}
+	s.wg.Wait()
+}
+
+func (s *SnmpTrap) listen(h handler) {
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, addr, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-s.done:
+				return
+			default:
+			}
+			s.Log.Errorf("Error reading message: %v", err)
+			continue
+		}
+
+		if !s.allowed(addr.IP) {
+			s.Log.Debugf("Dropping message from %s: source not allowed", addr.IP)
+			continue
+		}
+
+		packet, response, err := s.decode(buf[:n])
+		if err != nil {
+			s.Log.Errorf("Error decoding message from %s: %v", addr.IP, err)
+			continue
+		}
+
+		if response != nil {
+			if _, err := s.conn.WriteToUDP(response, addr); err != nil {
+				s.Log.Errorf("Error sending response to %s: %v", addr.IP, err)
+			}
+		}
+		if packet != nil {
+			h(packet, addr)
+		}
+	}
+}
+
+func (s *SnmpTrap) allowed(ip net.IP) bool {
+	if len(s.sources) == 0 {
+		return true
+	}
+	for _, network := range s.sources {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// decode returns the trap or inform request in the message, and the message
+// to send back to the sender if any: the response to an inform request, or
+// a report during SNMPv3 engine discovery.
+func (s *SnmpTrap) decode(msg []byte) (*gosnmp.SnmpPacket, []byte, error) {
+	r := newBERReader(msg)
+	seq, err := r.expect(berSequence)
+	if err != nil {
+		return nil, nil, err
+	}
+	r = r.children(seq)
+	version, err := r.integer()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch gosnmp.SnmpVersion(version) {
+	case gosnmp.Version1, gosnmp.Version2c:
+		if s.MinSecLevel != "" {
+			return nil, nil, fmt.Errorf("community based message rejected by min_sec_level")
+		}
+		if _, err := r.octetString(); err != nil {
+			return nil, nil, err
+		}
+		pdu, err := r.next()
+		if err != nil {
+			return nil, nil, err
+		}
+		return s.decodeCommunity(msg, pdu)
+	case gosnmp.Version3:
+		if s.usm == nil {
+			return nil, nil, fmt.Errorf("no SNMPv3 user configured")
+		}
+		return s.decodeV3(msg)
+	default:
+		return nil, nil, fmt.Errorf("unsupported version %d", version)
+	}
+}
+
+func (s *SnmpTrap) decodeCommunity(msg []byte, pdu element) (*gosnmp.SnmpPacket, []byte, error) {
+	switch pdu.tag {
+	case byte(gosnmp.Trap), pduSNMPv2Trap:
+		packet := s.decoder.UnmarshalTrap(msg)
+		if packet == nil {
+			return nil, nil, fmt.Errorf("invalid PDU of type %#x", pdu.tag)
+		}
+		return packet, nil, nil
+	case pduInformRequest:
+		// gosnmp does not decode inform requests, decode it as a trap and
+		// acknowledge it with the same message as a response.
+		trap := append([]byte(nil), msg...)
+		trap[pdu.start()] = pduSNMPv2Trap
+		packet := s.decoder.UnmarshalTrap(trap)
+		if packet == nil {
+			return nil, nil, fmt.Errorf("invalid PDU of type %#x", pdu.tag)
+		}
+		packet.PDUType = gosnmp.InformRequest
+
+		response := append([]byte(nil), msg...)
+		response[pdu.start()] = pduResponse
+		return packet, response, nil
+	default:
+		return nil, nil, fmt.Errorf("unexpected PDU of type %#x", pdu.tag)
+	}
+}
+
+func (s *SnmpTrap) decodeV3(msg []byte) (*gosnmp.SnmpPacket, []byte, error) {
+	m, scoped, user, report, err := s.usm.decode(msg)
+	if err != nil || report != nil {
+		return nil, report, err
+	}
+
+	switch scoped.pdu.tag {
+	case pduSNMPv2Trap, pduInformRequest:
+	default:
+		return nil, nil, fmt.Errorf("unexpected PDU of type %#x", scoped.pdu.tag)
+	}
+
+	packet := s.decoder.UnmarshalTrap(wrapV2c(scoped.pdu.raw, pduSNMPv2Trap))
+	if packet == nil {
+		return nil, nil, fmt.Errorf("invalid PDU of type %#x", scoped.pdu.tag)
+	}
+	packet.Version = gosnmp.Version3
+	packet.Community = ""
+	packet.PDUType = gosnmp.PDUType(scoped.pdu.tag)
+	packet.MsgID = uint32(m.msgID)
+	packet.MsgFlags = gosnmp.SnmpV3MsgFlags(m.flags)
+	packet.SecurityModel = gosnmp.UserSecurityModel
+	packet.SecurityParameters = &gosnmp.UsmSecurityParameters{
+		AuthoritativeEngineID:    m.engineID,
+		AuthoritativeEngineBoots: uint32(m.boots),
+		AuthoritativeEngineTime:  uint32(m.time),
+		UserName:                 m.userName,
+	}
+	packet.ContextEngineID = scoped.contextEngineID
+	packet.ContextName = scoped.contextName
+
+	if scoped.pdu.tag != pduInformRequest {
+		return packet, nil, nil
+	}
+	response, err := s.usm.response(m, scoped, user)
+	if err != nil {
+		return nil, nil, err
+	}
+	return packet, response, nil
 }
 
 func setTrapOid(tags map[string]string, oid string, e mibEntry) {
@@ -166,6 +427,15 @@ func makeTrapHandler(s *SnmpTrap) handler {
 		tags["version"] = packet.Version.String()
 		tags["source"] = addr.IP.String()
 
+		if packet.Version == gosnmp.Version3 {
+			if sp, ok := packet.SecurityParameters.(*gosnmp.UsmSecurityParameters); ok {
+				tags["sec_name"] = sp.UserName
+			}
+			if packet.ContextName != "" {
+				tags["context_name"] = packet.ContextName
+			}
+		}
+
 		if packet.Version == gosnmp.Version1 {
 			// Follow the procedure described in RFC 2576 3.1 to
 			// translate a v1 trap to v2.
@@ -254,8 +524,8 @@ func (s *SnmpTrap) lookup(oid string) (e mibEntry, err error) {
 	defer s.cacheLock.Unlock()
 	var ok bool
 	if e, ok = s.cache[oid]; !ok {
-		// cache miss.  exec snmptranlate
-		e, err = s.snmptranslate(oid)
+		// cache miss.  use the loaded MIBs, or exec snmptranlate
+		e, err = s.translate(oid)
 		if err == nil {
 			s.cache[oid] = e
 		}
@@ -276,6 +546,15 @@ func (s *SnmpTrap) load(oid string, e mibEntry) {
 	s.cache[oid] = e
 }
 
+func (s *SnmpTrap) translate(oid string) (e mibEntry, err error) {
+	if s.mibs != nil {
+		if n, suffix, err := s.mibs.Lookup(oid); err == nil && n.Module != "" {
+			return mibEntry{mibName: n.Module, oidText: n.Name + suffix}, nil
+		}
+	}
+	return s.snmptranslate(oid)
+}
+
 func (s *SnmpTrap) snmptranslate(oid string) (e mibEntry, err error) {
 	var out []byte
 	out, err = s.execCmd(s.Timeout, "snmptranslate", "-Td", "-Ob", "-m", "all", oid)
@@ -1,9 +1,11 @@
 package snmp_trap
 
 import (
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
 	"net"
-	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -36,6 +38,27 @@ func TestLoad(t *testing.T) {
 	require.Equal(t, "coldStart", e.oidText)
 }
 
+func TestLookupMibPaths(t *testing.T) {
+	s := &SnmpTrap{
+		MibPaths: []string{"testdata"},
+		Log:      testutil.Logger{},
+	}
+	require.NoError(t, s.Init())
+	s.execCmd = fakeExecCmd
+
+	e, err := s.lookup(".1.3.6.1.4.1.99999.0.1")
+	require.NoError(t, err)
+	require.Equal(t, mibEntry{"TEST-TRAP-MIB", "testTrapFailure"}, e)
+
+	e, err = s.lookup(".1.3.6.1.4.1.99999.1.1.0")
+	require.NoError(t, err)
+	require.Equal(t, mibEntry{"TEST-TRAP-MIB", "testTrapReason.0"}, e)
+
+	// OIDs missing from the MIBs are left to snmptranslate
+	_, err = s.lookup(".1.3.6.1.6.3.1.1.5.1")
+	require.EqualError(t, err, "mock snmptranslate -Td -Ob -m all .1.3.6.1.6.3.1.1.5.1")
+}
+
 func fakeExecCmd(_ internal.Duration, x string, y ...string) ([]byte, error) {
 	return nil, fmt.Errorf("mock " + x + " " + strings.Join(y, " "))
 }
@@ -279,13 +302,6 @@ func TestReceiveTrap(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// We would prefer to specify port 0 and let the network
-			// stack choose an unused port for us but TrapListener
-			// doesn't have a way to return the autoselected port.
-			// Instead, we'll use an unusual port and hope it's
-			// unused.
-			const port = 12399
-
 			// Hook into the trap handler so the test knows when the
 			// trap has been received
 			received := make(chan int)
@@ -298,7 +314,7 @@ func TestReceiveTrap(t *testing.T) {
 
 			// Set up the service input plugin
 			s := &SnmpTrap{
-				ServiceAddress:     "udp://:" + strconv.Itoa(port),
+				ServiceAddress:     "udp://127.0.0.1:0",
 				makeHandlerWrapper: wrap,
 				timeFunc: func() time.Time {
 					return fakeTime
@@ -306,9 +322,14 @@ func TestReceiveTrap(t *testing.T) {
 				Log: testutil.Logger{},
 			}
 			require.Nil(t, s.Init())
+
+			// Don't look up oid with snmptranslate.
+			s.execCmd = fakeExecCmd
+
 			var acc testutil.Accumulator
 			require.Nil(t, s.Start(&acc))
 			defer s.Stop()
+			port := uint16(s.conn.LocalAddr().(*net.UDPAddr).Port)
 
 			// Preload the cache with the oids we'll use in this test
 			// so snmptranslate and mibs don't need to be installed.
@@ -316,9 +337,6 @@ func TestReceiveTrap(t *testing.T) {
 				s.load(entry.oid, entry.e)
 			}
 
-			// Don't look up oid with snmptranslate.
-			s.execCmd = fakeExecCmd
-
 			// Send the trap
 			sendTrap(t, port, now, tt.trap, tt.version)
 
@@ -337,3 +355,457 @@ func TestReceiveTrap(t *testing.T) {
 	}
 
 }
+
+// listen starts the plugin on a random port and returns a channel receiving
+// the handled packets.
+func listen(t *testing.T, s *SnmpTrap, acc *testutil.Accumulator) (*net.UDPAddr, chan *gosnmp.SnmpPacket) {
+	received := make(chan *gosnmp.SnmpPacket, 1)
+	s.ServiceAddress = "udp://127.0.0.1:0"
+	s.makeHandlerWrapper = func(f handler) handler {
+		return func(p *gosnmp.SnmpPacket, a *net.UDPAddr) {
+			f(p, a)
+			received <- p
+		}
+	}
+	s.timeFunc = func() time.Time {
+		return time.Unix(456456456, 456)
+	}
+	s.Log = testutil.Logger{}
+	require.NoError(t, s.Init())
+	s.execCmd = fakeExecCmd
+	require.NoError(t, s.Start(acc))
+	s.load(".1.3.6.1.6.3.1.1.4.1.0", mibEntry{"SNMPv2-MIB", "snmpTrapOID.0"})
+	s.load(".1.3.6.1.6.3.1.1.5.1", mibEntry{"SNMPv2-MIB", "coldStart"})
+	s.load(".1.3.6.1.2.1.1.3.0", mibEntry{"DISMAN-EVENT-MIB", "sysUpTimeInstance"})
+	return s.conn.LocalAddr().(*net.UDPAddr), received
+}
+
+func waitPacket(t *testing.T, received chan *gosnmp.SnmpPacket) *gosnmp.SnmpPacket {
+	select {
+	case p := <-received:
+		return p
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for trap to be received")
+	}
+	return nil
+}
+
+func coldStart() []gosnmp.SnmpPDU {
+	return []gosnmp.SnmpPDU{
+		{Name: ".1.3.6.1.2.1.1.3.0", Type: gosnmp.TimeTicks, Value: uint32(123123123)},
+		{Name: ".1.3.6.1.6.3.1.1.4.1.0", Type: gosnmp.ObjectIdentifier, Value: ".1.3.6.1.6.3.1.1.5.1"},
+	}
+}
+
+// marshalPDU returns the encoding of a coldStart PDU with the tag.
+func marshalPDU(t *testing.T, tag byte) []byte {
+	packet := &gosnmp.SnmpPacket{
+		Version:   gosnmp.Version2c,
+		Community: "public",
+		PDUType:   gosnmp.SNMPv2Trap,
+		RequestID: 42,
+		Variables: coldStart(),
+	}
+	msg, err := packet.MarshalMsg()
+	require.NoError(t, err)
+
+	r := newBERReader(msg)
+	seq, err := r.expect(berSequence)
+	require.NoError(t, err)
+	r = r.children(seq)
+	_, err = r.integer()
+	require.NoError(t, err)
+	_, err = r.octetString()
+	require.NoError(t, err)
+	pdu, err := r.next()
+	require.NoError(t, err)
+	return append([]byte{tag}, pdu.raw[1:]...)
+}
+
+func exchange(t *testing.T, addr *net.UDPAddr, msg []byte) []byte {
+	conn, err := net.DialUDP("udp", nil, addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write(msg)
+	require.NoError(t, err)
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+	buf := make([]byte, maxMessageSize)
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	return buf[:n]
+}
+
+func TestPasswordToKey(t *testing.T) {
+	// RFC 3414 A.3
+	engineID := string([]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2})
+
+	key := localizeKey(md5.New, passwordToKey(md5.New, "maplesyrup"), engineID)
+	require.Equal(t, "526f5eed9fcce26f8964c2930787d82b", hex.EncodeToString(key))
+
+	key = localizeKey(sha1.New, passwordToKey(sha1.New, "maplesyrup"), engineID)
+	require.Equal(t, "6695febc9288e36282235fc7151f128497b38f3f", hex.EncodeToString(key))
+}
+
+func TestUserInit(t *testing.T) {
+	tests := []struct {
+		name string
+		user User
+		err  string
+	}{
+		{"valid", User{SecName: "u", SecLevel: "authPriv", AuthProtocol: "SHA", AuthPassword: "password", PrivProtocol: "AES", PrivPassword: "password"}, ""},
+		{"no auth", User{SecName: "u", SecLevel: "noAuthNoPriv"}, ""},
+		{"missing name", User{}, "missing sec_name"},
+		{"sec_level", User{SecName: "u", SecLevel: "auth"}, `invalid sec_level "auth"`},
+		{"auth_protocol", User{SecName: "u", AuthProtocol: "SHA512"}, `invalid auth_protocol "SHA512"`},
+		{"priv_protocol", User{SecName: "u", PrivProtocol: "3DES"}, `invalid priv_protocol "3DES"`},
+		{"missing auth_protocol", User{SecName: "u", SecLevel: "authNoPriv"}, "auth_protocol is required with sec_level authNoPriv"},
+		{"missing priv_protocol", User{SecName: "u", SecLevel: "authPriv", AuthProtocol: "MD5", AuthPassword: "password"}, "priv_protocol is required with sec_level authPriv"},
+		{"short password", User{SecName: "u", SecLevel: "authNoPriv", AuthProtocol: "MD5", AuthPassword: "pass"}, "auth_password must be at least 8 characters"},
+		{"engine_id", User{SecName: "u", EngineID: "0x80zz"}, `invalid engine ID "0x80zz": encoding/hex: invalid byte: U+007A 'z'`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.user.init()
+			if tt.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestReceiveTrapV3(t *testing.T) {
+	agentEngineID := "\x80\x00\x1f\x88\x80\x01\x02\x03\x04"
+
+	tests := []struct {
+		name  string
+		user  User
+		flags gosnmp.SnmpV3MsgFlags
+		auth  gosnmp.SnmpV3AuthProtocol
+		priv  gosnmp.SnmpV3PrivProtocol
+	}{
+		{
+			name:  "noAuthNoPriv",
+			user:  User{SecName: "user", SecLevel: "noAuthNoPriv"},
+			flags: gosnmp.NoAuthNoPriv,
+		},
+		{
+			name:  "authNoPriv MD5",
+			user:  User{SecName: "user", SecLevel: "authNoPriv", AuthProtocol: "MD5", AuthPassword: "authpassword"},
+			flags: gosnmp.AuthNoPriv,
+			auth:  gosnmp.MD5,
+		},
+		{
+			name:  "authPriv MD5 DES",
+			user:  User{SecName: "user", SecLevel: "authPriv", AuthProtocol: "MD5", AuthPassword: "authpassword", PrivProtocol: "DES", PrivPassword: "privpassword"},
+			flags: gosnmp.AuthPriv,
+			auth:  gosnmp.MD5,
+			priv:  gosnmp.DES,
+		},
+		{
+			name:  "authPriv SHA AES",
+			user:  User{SecName: "user", SecLevel: "authPriv", AuthProtocol: "SHA", AuthPassword: "authpassword", PrivProtocol: "AES", PrivPassword: "privpassword", EngineID: "80001f888001020304"},
+			flags: gosnmp.AuthPriv,
+			auth:  gosnmp.SHA,
+			priv:  gosnmp.AES,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := tt.user
+			s := &SnmpTrap{Users: []*User{&user}}
+			var acc testutil.Accumulator
+			addr, received := listen(t, s, &acc)
+			defer s.Stop()
+
+			agent := tt.user
+			require.NoError(t, agent.init())
+			keys := agent.keys(agentEngineID)
+			g := &gosnmp.GoSNMP{
+				Target:        "127.0.0.1",
+				Port:          uint16(addr.Port),
+				Version:       gosnmp.Version3,
+				Timeout:       2 * time.Second,
+				MaxOids:       gosnmp.MaxOids,
+				SecurityModel: gosnmp.UserSecurityModel,
+				MsgFlags:      tt.flags,
+				SecurityParameters: &gosnmp.UsmSecurityParameters{
+					UserName:                 user.SecName,
+					AuthoritativeEngineID:    agentEngineID,
+					AuthoritativeEngineBoots: 1,
+					AuthoritativeEngineTime:  1000,
+					AuthenticationProtocol:   tt.auth,
+					PrivacyProtocol:          tt.priv,
+					SecretKey:                keys.auth,
+					PrivacyKey:               keys.priv,
+				},
+				ContextName: "ctx",
+			}
+			require.NoError(t, g.Connect())
+			defer g.Conn.Close()
+			_, err := g.SendTrap(gosnmp.SnmpTrap{Variables: coldStart()})
+			require.NoError(t, err)
+
+			p := waitPacket(t, received)
+			require.Equal(t, gosnmp.SNMPv2Trap, p.PDUType)
+
+			expected := []telegraf.Metric{
+				testutil.MustMetric(
+					"snmp_trap",
+					map[string]string{
+						"oid":          ".1.3.6.1.6.3.1.1.5.1",
+						"name":         "coldStart",
+						"mib":          "SNMPv2-MIB",
+						"version":      "3",
+						"source":       "127.0.0.1",
+						"sec_name":     "user",
+						"context_name": "ctx",
+					},
+					map[string]interface{}{
+						"sysUpTimeInstance": uint32(123123123),
+					},
+					time.Unix(456456456, 456),
+				),
+			}
+			testutil.RequireMetricsEqual(t, expected, acc.GetTelegrafMetrics())
+		})
+	}
+}
+
+func TestDecodeV3Rejected(t *testing.T) {
+	user := &User{SecName: "user", SecLevel: "authPriv", AuthProtocol: "SHA", AuthPassword: "authpassword", PrivProtocol: "AES", PrivPassword: "privpassword"}
+	require.NoError(t, user.init())
+	u := newUSM("\x80\x00\x1f\x88\x80\x01\x02\x03\x04", []*User{user})
+	s := &SnmpTrap{usm: u, decoder: &gosnmp.GoSNMP{}}
+
+	trap := marshalPDU(t, pduSNMPv2Trap)
+
+	msg, err := u.encode(1, flagAuth|flagPriv, user, "", "", trap)
+	require.NoError(t, err)
+	p, _, err := s.decode(msg)
+	require.NoError(t, err)
+	require.Len(t, p.Variables, 2)
+
+	// wrong digest
+	msg[len(msg)-1] ^= 0xff
+	_, _, err = s.decode(msg)
+	require.EqualError(t, err, `wrong digest for user "user"`)
+
+	// security level lower than the user's
+	msg, err = u.encode(1, flagAuth, user, "", "", trap)
+	require.NoError(t, err)
+	_, _, err = s.decode(msg)
+	require.EqualError(t, err, `security level of user "user" not met`)
+
+	// unknown user
+	other := &User{SecName: "other"}
+	require.NoError(t, other.init())
+	msg, err = u.encode(1, 0, other, "", "", trap)
+	require.NoError(t, err)
+	_, _, err = s.decode(msg)
+	require.EqualError(t, err, `unknown user "other"`)
+
+	// no users configured
+	s.usm = nil
+	_, _, err = s.decode(msg)
+	require.EqualError(t, err, "no SNMPv3 user configured")
+}
+
+func TestDecodeV3NotInTimeWindow(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	user := &User{SecName: "user", SecLevel: "authNoPriv", AuthProtocol: "SHA", AuthPassword: "authpassword"}
+	require.NoError(t, user.init())
+	u := newUSM("\x80\x00\x1f\x88\x80\xa1\xb2\xc3\xd4\xe5\xf6\x07\x08", []*User{user})
+	u.now = func() time.Time { return now }
+	s := &SnmpTrap{usm: u, decoder: &gosnmp.GoSNMP{}}
+
+	agent := newUSM("\x80\x00\x1f\x88\x80\x01\x02\x03\x04", []*User{user})
+	agent.boots = 5
+	agent.start = now.Add(-1000 * time.Second)
+	agent.now = func() time.Time { return now }
+	trap := marshalPDU(t, pduSNMPv2Trap)
+
+	msg, err := agent.encode(1, flagAuth, user, "", "", trap)
+	require.NoError(t, err)
+	_, _, err = s.decode(msg)
+	require.NoError(t, err)
+
+	// replayed within the time window
+	now = now.Add(100 * time.Second)
+	_, _, err = s.decode(msg)
+	require.NoError(t, err)
+
+	// replayed after the time window
+	now = now.Add(100 * time.Second)
+	_, _, err = s.decode(msg)
+	require.EqualError(t, err, `message of user "user" not in time window`)
+	require.Equal(t, uint32(1), u.notInTimeWindows)
+
+	// sent before the last reboot of the agent
+	agent.boots = 4
+	msg, err = agent.encode(2, flagAuth, user, "", "", trap)
+	require.NoError(t, err)
+	_, _, err = s.decode(msg)
+	require.Error(t, err)
+
+	// sent after a reboot of the agent
+	agent.boots = 6
+	agent.start = now
+	msg, err = agent.encode(3, flagAuth, user, "", "", trap)
+	require.NoError(t, err)
+	_, _, err = s.decode(msg)
+	require.NoError(t, err)
+}
+
+func TestMinSecLevel(t *testing.T) {
+	noAuth := &User{SecName: "noauth"}
+	auth := &User{SecName: "auth", SecLevel: "authNoPriv", AuthProtocol: "MD5", AuthPassword: "authpassword"}
+	s := &SnmpTrap{
+		MinSecLevel: "authNoPriv",
+		Users:       []*User{noAuth, auth},
+		Log:         testutil.Logger{},
+	}
+	require.NoError(t, s.Init())
+
+	v2c := tlv(berSequence,
+		tlv(berInteger, encodeInteger(1)),
+		tlv(berOctetString, []byte("public")),
+		marshalPDU(t, pduSNMPv2Trap))
+	_, _, err := s.decode(v2c)
+	require.EqualError(t, err, "community based message rejected by min_sec_level")
+
+	agent := newUSM("\x80\x00\x1f\x88\x80\x01\x02\x03\x04", nil)
+	trap := marshalPDU(t, pduSNMPv2Trap)
+
+	msg, err := agent.encode(1, 0, noAuth, "", "", trap)
+	require.NoError(t, err)
+	_, _, err = s.decode(msg)
+	require.EqualError(t, err, `security level of user "noauth" below min_sec_level`)
+
+	msg, err = agent.encode(2, flagAuth, auth, "", "", trap)
+	require.NoError(t, err)
+	p, _, err := s.decode(msg)
+	require.NoError(t, err)
+	require.Len(t, p.Variables, 2)
+}
+
+func TestMinSecLevelInit(t *testing.T) {
+	s := &SnmpTrap{MinSecLevel: "authNoPriv", Log: testutil.Logger{}}
+	require.EqualError(t, s.Init(), "min_sec_level requires an SNMPv3 user")
+
+	s = &SnmpTrap{
+		MinSecLevel: "auth",
+		Users:       []*User{{SecName: "user"}},
+		Log:         testutil.Logger{},
+	}
+	require.EqualError(t, s.Init(), `min_sec_level: invalid sec_level "auth"`)
+}
+
+func TestInformV2c(t *testing.T) {
+	s := &SnmpTrap{}
+	var acc testutil.Accumulator
+	addr, received := listen(t, s, &acc)
+	defer s.Stop()
+
+	inform := tlv(berSequence,
+		tlv(berInteger, encodeInteger(1)),
+		tlv(berOctetString, []byte("public")),
+		marshalPDU(t, pduInformRequest))
+
+	response := exchange(t, addr, inform)
+	p := waitPacket(t, received)
+	require.Equal(t, gosnmp.InformRequest, p.PDUType)
+	require.Equal(t, "public", p.Community)
+	require.Len(t, acc.GetTelegrafMetrics(), 1)
+
+	expected := append([]byte(nil), inform...)
+	expected[len(inform)-len(marshalPDU(t, pduInformRequest))] = pduResponse
+	require.Equal(t, expected, response)
+}
+
+func TestInformV3(t *testing.T) {
+	user := User{SecName: "user", SecLevel: "authPriv", AuthProtocol: "MD5", AuthPassword: "authpassword", PrivProtocol: "DES", PrivPassword: "privpassword"}
+	s := &SnmpTrap{
+		EngineID: "0x80001f8880a1b2c3d4e5f60708",
+		Users:    []*User{&user},
+	}
+	var acc testutil.Accumulator
+	addr, received := listen(t, s, &acc)
+	defer s.Stop()
+
+	// engine ID discovery
+	discovery := tlv(berSequence,
+		tlv(berInteger, encodeInteger(3)),
+		tlv(berSequence,
+			tlv(berInteger, encodeInteger(100)),
+			tlv(berInteger, encodeInteger(maxMessageSize)),
+			tlv(berOctetString, []byte{flagReportable}),
+			tlv(berInteger, encodeInteger(userSecurityModel))),
+		tlv(berOctetString, tlv(berSequence,
+			tlv(berOctetString),
+			tlv(berInteger, encodeInteger(0)),
+			tlv(berInteger, encodeInteger(0)),
+			tlv(berOctetString),
+			tlv(berOctetString),
+			tlv(berOctetString))),
+		tlv(berSequence,
+			tlv(berOctetString),
+			tlv(berOctetString),
+			tlv(pduGetRequest,
+				tlv(berInteger, encodeInteger(7)),
+				tlv(berInteger, encodeInteger(0)),
+				tlv(berInteger, encodeInteger(0)),
+				tlv(berSequence))))
+	m, err := parseV3Message(exchange(t, addr, discovery))
+	require.NoError(t, err)
+	require.Equal(t, "\x80\x00\x1f\x88\x80\xa1\xb2\xc3\xd4\xe5\xf6\x07\x08", m.engineID)
+	require.Equal(t, int64(100), m.msgID)
+	scoped, err := parseScopedPDU(m.data.raw)
+	require.NoError(t, err)
+	require.Equal(t, byte(pduReport), scoped.pdu.tag)
+	require.Contains(t, string(scoped.pdu.raw), string(usmStatsUnknownEngineIDs))
+
+	// inform request sent with the discovered engine ID
+	agent := User{SecName: "user", SecLevel: "authPriv", AuthProtocol: "MD5", AuthPassword: "authpassword", PrivProtocol: "DES", PrivPassword: "privpassword"}
+	require.NoError(t, agent.init())
+	sender := newUSM(m.engineID, []*User{&agent})
+	inform, err := sender.encode(101, flagAuth|flagPriv|flagReportable, &agent, m.engineID, "", marshalPDU(t, pduInformRequest))
+	require.NoError(t, err)
+
+	response := exchange(t, addr, inform)
+	p := waitPacket(t, received)
+	require.Equal(t, gosnmp.InformRequest, p.PDUType)
+	require.Equal(t, gosnmp.Version3, p.Version)
+	require.Len(t, acc.GetTelegrafMetrics(), 1)
+
+	r, scoped, _, report, err := sender.decode(response)
+	require.NoError(t, err)
+	require.Nil(t, report)
+	require.Equal(t, int64(101), r.msgID)
+	require.Equal(t, byte(flagAuth|flagPriv), r.flags)
+	require.Equal(t, byte(pduResponse), scoped.pdu.tag)
+	require.Equal(t, int64(42), scoped.requestID)
+}
+
+func TestAllowedSources(t *testing.T) {
+	s := &SnmpTrap{
+		AllowedSources: []string{"10.0.0.0/8", "192.168.1.1", "2001:db8::1"},
+		Log:            testutil.Logger{},
+	}
+	require.NoError(t, s.Init())
+
+	require.True(t, s.allowed(net.ParseIP("10.1.2.3")))
+	require.True(t, s.allowed(net.ParseIP("192.168.1.1")))
+	require.True(t, s.allowed(net.ParseIP("2001:db8::1")))
+	require.False(t, s.allowed(net.ParseIP("192.168.1.2")))
+	require.False(t, s.allowed(net.ParseIP("127.0.0.1")))
+
+	s = &SnmpTrap{
+		AllowedSources: []string{"10.0.0.0/33"},
+		Log:            testutil.Logger{},
+	}
+	require.EqualError(t, s.Init(), "invalid allowed source: invalid CIDR address: 10.0.0.0/33")
+}
@@ -0,0 +1,699 @@
+package snmp_trap
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+	"time"
+)
+
+// SNMPv3 msgFlags
+const (
+	flagAuth       = 0x01
+	flagPriv       = 0x02
+	flagReportable = 0x04
+)
+
+// PDU tags
+const (
+	pduGetRequest     = 0xa0
+	pduGetNextRequest = 0xa1
+	pduResponse       = 0xa2
+	pduSetRequest     = 0xa3
+	pduGetBulkRequest = 0xa5
+	pduInformRequest  = 0xa6
+	pduSNMPv2Trap     = 0xa7
+	pduReport         = 0xa8
+)
+
+// Encoded OIDs of the USM statistics sent in reports.
+var (
+	usmStatsNotInTimeWindows = []byte{0x2b, 6, 1, 6, 3, 15, 1, 1, 2, 0}
+	usmStatsUnknownEngineIDs = []byte{0x2b, 6, 1, 6, 3, 15, 1, 1, 4, 0}
+)
+
+const (
+	userSecurityModel = 3
+	maxMessageSize    = 65507
+	authParamsLength  = 12
+	// timeWindow is the number of seconds an authenticated message may be
+	// late, see RFC 3414 section 3.2.
+	timeWindow = 150
+	// maxEngineBoots is the value of snmpEngineBoots of an engine that must
+	// be reconfigured, its messages are never in the time window.
+	maxEngineBoots = 2147483647
+)
+
+// User is an SNMPv3 user allowed to send notifications.  The options are
+// named as in the snmp input.
+type User struct {
+	SecName string `toml:"sec_name"`
+	// Values: "noAuthNoPriv", "authNoPriv", "authPriv"
+	SecLevel string `toml:"sec_level"`
+	// Values: "MD5", "SHA", "". Default: ""
+	AuthProtocol string `toml:"auth_protocol"`
+	AuthPassword string `toml:"auth_password"`
+	// Values: "DES", "AES", "". Default: ""
+	PrivProtocol string `toml:"priv_protocol"`
+	PrivPassword string `toml:"priv_password"`
+	// Engine ID of the agent sending traps as this user, in hex.
+	EngineID string `toml:"engine_id"`
+
+	level    byte
+	hash     func() hash.Hash
+	engineID string
+	authKey  []byte
+	privKey  []byte
+	local    map[string]localKeys
+}
+
+// localKeys are the keys of a user localized to an engine.
+type localKeys struct {
+	auth []byte
+	priv []byte
+}
+
+func (u *User) init() error {
+	if u.SecName == "" {
+		return errors.New("missing sec_name")
+	}
+
+	level, err := parseSecLevel(u.SecLevel)
+	if err != nil {
+		return err
+	}
+	u.level = level
+
+	switch strings.ToLower(u.AuthProtocol) {
+	case "md5":
+		u.hash = md5.New
+	case "sha":
+		u.hash = sha1.New
+	case "":
+	default:
+		return fmt.Errorf("invalid auth_protocol %q", u.AuthProtocol)
+	}
+
+	switch strings.ToLower(u.PrivProtocol) {
+	case "des", "aes", "":
+	default:
+		return fmt.Errorf("invalid priv_protocol %q", u.PrivProtocol)
+	}
+
+	if u.level&flagAuth != 0 && u.hash == nil {
+		return errors.New("auth_protocol is required with sec_level " + u.SecLevel)
+	}
+	if u.level&flagPriv != 0 && u.PrivProtocol == "" {
+		return errors.New("priv_protocol is required with sec_level " + u.SecLevel)
+	}
+	if u.PrivProtocol != "" && u.hash == nil {
+		return errors.New("priv_protocol requires an auth_protocol")
+	}
+
+	// RFC 3414 requires passwords of at least 8 characters.
+	if u.hash != nil {
+		if len(u.AuthPassword) < 8 {
+			return errors.New("auth_password must be at least 8 characters")
+		}
+		u.authKey = passwordToKey(u.hash, u.AuthPassword)
+	}
+	if u.PrivProtocol != "" {
+		if len(u.PrivPassword) < 8 {
+			return errors.New("priv_password must be at least 8 characters")
+		}
+		u.privKey = passwordToKey(u.hash, u.PrivPassword)
+	}
+
+	if u.EngineID != "" {
+		id, err := parseEngineID(u.EngineID)
+		if err != nil {
+			return err
+		}
+		u.engineID = id
+	}
+
+	u.local = make(map[string]localKeys)
+	return nil
+}
+
+// parseSecLevel returns the msgFlags of the security level, noAuthNoPriv by
+// default.
+func parseSecLevel(level string) (byte, error) {
+	switch strings.ToLower(level) {
+	case "noauthnopriv", "":
+		return 0, nil
+	case "authnopriv":
+		return flagAuth, nil
+	case "authpriv":
+		return flagAuth | flagPriv, nil
+	default:
+		return 0, fmt.Errorf("invalid sec_level %q", level)
+	}
+}
+
+// keys returns the keys of the user localized to the engine.
+func (u *User) keys(engineID string) localKeys {
+	if k, ok := u.local[engineID]; ok {
+		return k
+	}
+
+	var k localKeys
+	if u.authKey != nil {
+		k.auth = localizeKey(u.hash, u.authKey, engineID)
+	}
+	if u.privKey != nil {
+		k.priv = localizeKey(u.hash, u.privKey, engineID)
+	}
+	u.local[engineID] = k
+	return k
+}
+
+// passwordToKey is the password to key algorithm of RFC 3414 A.2.
+func passwordToKey(h func() hash.Hash, password string) []byte {
+	d := h()
+	buf := make([]byte, 64)
+	for i, n := 0, 0; n < 1048576; n += len(buf) {
+		for j := range buf {
+			buf[j] = password[i%len(password)]
+			i++
+		}
+		d.Write(buf)
+	}
+	return d.Sum(nil)
+}
+
+func localizeKey(h func() hash.Hash, key []byte, engineID string) []byte {
+	d := h()
+	d.Write(key)
+	d.Write([]byte(engineID))
+	d.Write(key)
+	return d.Sum(nil)
+}
+
+func parseEngineID(s string) (string, error) {
+	id, err := hex.DecodeString(strings.TrimPrefix(strings.ToLower(s), "0x"))
+	if err != nil {
+		return "", fmt.Errorf("invalid engine ID %q: %v", s, err)
+	}
+	if len(id) < 5 || len(id) > 32 {
+		return "", fmt.Errorf("invalid engine ID %q: must be 5 to 32 octets", s)
+	}
+	return string(id), nil
+}
+
+// newEngineID returns a random engine ID, in the octets format of RFC 3411.
+func newEngineID() (string, error) {
+	id := make([]byte, 13)
+	id[0], id[4] = 0x80, 0x05
+	if _, err := rand.Read(id[5:]); err != nil {
+		return "", err
+	}
+	return string(id), nil
+}
+
+// v3Message is a decoded SNMPv3 message.
+type v3Message struct {
+	msgID      int64
+	flags      byte
+	engineID   string
+	boots      int64
+	time       int64
+	userName   string
+	authParams []byte
+	authOffset int
+	privParams []byte
+	data       element
+}
+
+func parseV3Message(msg []byte) (*v3Message, error) {
+	r := newBERReader(msg)
+	seq, err := r.expect(berSequence)
+	if err != nil {
+		return nil, err
+	}
+	r = r.children(seq)
+	if _, err := r.integer(); err != nil {
+		return nil, err
+	}
+
+	m := &v3Message{}
+
+	header, err := r.expect(berSequence)
+	if err != nil {
+		return nil, err
+	}
+	hr := r.children(header)
+	if m.msgID, err = hr.integer(); err != nil {
+		return nil, err
+	}
+	if _, err = hr.integer(); err != nil {
+		return nil, err
+	}
+	flags, err := hr.octetString()
+	if err != nil {
+		return nil, err
+	}
+	if len(flags) != 1 {
+		return nil, errors.New("invalid msgFlags")
+	}
+	m.flags = flags[0]
+	model, err := hr.integer()
+	if err != nil {
+		return nil, err
+	}
+	if model != userSecurityModel {
+		return nil, fmt.Errorf("unsupported security model %d", model)
+	}
+
+	secParams, err := r.expect(berOctetString)
+	if err != nil {
+		return nil, err
+	}
+	sr := r.children(secParams)
+	usm, err := sr.expect(berSequence)
+	if err != nil {
+		return nil, err
+	}
+	ur := sr.children(usm)
+	engineID, err := ur.octetString()
+	if err != nil {
+		return nil, err
+	}
+	m.engineID = string(engineID)
+	if m.boots, err = ur.integer(); err != nil {
+		return nil, err
+	}
+	if m.time, err = ur.integer(); err != nil {
+		return nil, err
+	}
+	userName, err := ur.octetString()
+	if err != nil {
+		return nil, err
+	}
+	m.userName = string(userName)
+	authParams, err := ur.expect(berOctetString)
+	if err != nil {
+		return nil, err
+	}
+	m.authParams, m.authOffset = authParams.content, authParams.offset
+	if m.privParams, err = ur.octetString(); err != nil {
+		return nil, err
+	}
+
+	if m.data, err = r.next(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// scopedPDU is the plaintext of an SNMPv3 message.
+type scopedPDU struct {
+	contextEngineID string
+	contextName     string
+	pdu             element
+	requestID       int64
+}
+
+func parseScopedPDU(b []byte) (*scopedPDU, error) {
+	r := newBERReader(b)
+	seq, err := r.expect(berSequence)
+	if err != nil {
+		return nil, err
+	}
+	r = r.children(seq)
+
+	s := &scopedPDU{}
+	contextEngineID, err := r.octetString()
+	if err != nil {
+		return nil, err
+	}
+	s.contextEngineID = string(contextEngineID)
+	contextName, err := r.octetString()
+	if err != nil {
+		return nil, err
+	}
+	s.contextName = string(contextName)
+	if s.pdu, err = r.next(); err != nil {
+		return nil, err
+	}
+	if s.requestID, err = r.children(s.pdu).integer(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// usm is the User-based Security Model of the local engine, see RFC 3414.
+// The local engine is authoritative for the inform requests it receives,
+// the agents sending traps are authoritative for the traps.
+type usm struct {
+	engineID string
+	boots    int64
+	start    time.Time
+	users    map[string][]*User
+	// minLevel is the lowest security level of the accepted messages.
+	minLevel byte
+	// engines holds the time of the authoritative engines of the received
+	// traps.
+	engines map[string]*engineTime
+	now     func() time.Time
+
+	unknownEngineIDs uint32
+	notInTimeWindows uint32
+}
+
+// engineTime is the local notion of the time of an authoritative engine, see
+// RFC 3414 section 2.3.
+type engineTime struct {
+	boots int64
+	time  int64
+	// latest is the highest time received in a message of the engine.
+	latest int64
+	// received is the local time at which the engine time was updated.
+	received time.Time
+}
+
+func newUSM(engineID string, users []*User) *usm {
+	u := &usm{
+		engineID: engineID,
+		boots:    1,
+		start:    time.Now(),
+		users:    make(map[string][]*User),
+		engines:  make(map[string]*engineTime),
+		now:      time.Now,
+	}
+	for _, user := range users {
+		u.users[user.SecName] = append(u.users[user.SecName], user)
+	}
+	return u
+}
+
+func (u *usm) time() int64 {
+	return int64(u.now().Sub(u.start) / time.Second)
+}
+
+// timely updates the time of the authoritative engine of an authenticated
+// message and returns false if the message is outside the time window, see
+// RFC 3414 section 3.2 step 7b.
+func (u *usm) timely(m *v3Message) bool {
+	now := u.now()
+	t, ok := u.engines[m.engineID]
+	if !ok || m.boots > t.boots || m.boots == t.boots && m.time > t.latest {
+		t = &engineTime{boots: m.boots, time: m.time, latest: m.time, received: now}
+		u.engines[m.engineID] = t
+	}
+
+	estimated := t.time + int64(now.Sub(t.received)/time.Second)
+	return t.boots < maxEngineBoots && m.boots == t.boots && m.time >= estimated-timeWindow
+}
+
+// user returns the user able to send messages from the engine.
+func (u *usm) user(name, engineID string) *User {
+	for _, user := range u.users[name] {
+		if user.engineID == "" || user.engineID == engineID || engineID == u.engineID {
+			return user
+		}
+	}
+	return nil
+}
+
+// decode authenticates and decrypts a message.  It returns the report to
+// send when the sender needs to synchronize with the local engine.
+func (u *usm) decode(msg []byte) (*v3Message, *scopedPDU, *User, []byte, error) {
+	m, err := parseV3Message(msg)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	level := m.flags & (flagAuth | flagPriv)
+	if level == flagPriv {
+		return nil, nil, nil, nil, errors.New("invalid msgFlags, privacy without authentication")
+	}
+
+	// Engine ID discovery, see RFC 3414 section 4.
+	if m.engineID == "" {
+		if level != 0 || m.data.tag != berSequence {
+			return nil, nil, nil, nil, errors.New("unknown engine ID")
+		}
+		s, err := parseScopedPDU(m.data.raw)
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+		report, err := u.report(m, s, nil, usmStatsUnknownEngineIDs, &u.unknownEngineIDs)
+		return nil, nil, nil, report, err
+	}
+
+	if level < u.minLevel {
+		return nil, nil, nil, nil, fmt.Errorf("security level of user %q below min_sec_level", m.userName)
+	}
+
+	user := u.user(m.userName, m.engineID)
+	if user == nil {
+		return nil, nil, nil, nil, fmt.Errorf("unknown user %q", m.userName)
+	}
+	if level < user.level {
+		return nil, nil, nil, nil, fmt.Errorf("security level of user %q not met", user.SecName)
+	}
+	if level&flagAuth != 0 && user.authKey == nil || level&flagPriv != 0 && user.privKey == nil {
+		return nil, nil, nil, nil, fmt.Errorf("unsupported security level for user %q", user.SecName)
+	}
+	keys := user.keys(m.engineID)
+
+	if level&flagAuth != 0 {
+		if len(m.authParams) != authParamsLength {
+			return nil, nil, nil, nil, errors.New("invalid authentication parameters")
+		}
+		expected := make([]byte, authParamsLength)
+		copy(expected, m.authParams)
+		if !hmac.Equal(expected, digest(user.hash, keys.auth, msg, m.authOffset)) {
+			return nil, nil, nil, nil, fmt.Errorf("wrong digest for user %q", user.SecName)
+		}
+	}
+
+	plaintext := m.data.raw
+	if level&flagPriv != 0 {
+		if m.data.tag != berOctetString {
+			return nil, nil, nil, nil, errors.New("invalid encrypted PDU")
+		}
+		if plaintext, err = decrypt(user, keys.priv, m, m.data.content); err != nil {
+			return nil, nil, nil, nil, err
+		}
+	}
+	s, err := parseScopedPDU(plaintext)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	switch s.pdu.tag {
+	case pduGetRequest, pduGetNextRequest, pduSetRequest, pduGetBulkRequest, pduInformRequest:
+		// The local engine is authoritative for these.
+		if m.engineID != u.engineID {
+			report, err := u.report(m, s, nil, usmStatsUnknownEngineIDs, &u.unknownEngineIDs)
+			return nil, nil, nil, report, err
+		}
+		if level&flagAuth != 0 && (m.boots != u.boots || abs(m.time-u.time()) > timeWindow) {
+			report, err := u.report(m, s, user, usmStatsNotInTimeWindows, &u.notInTimeWindows)
+			return nil, nil, nil, report, err
+		}
+	default:
+		// The sender is authoritative for traps, unconfirmed messages
+		// are dropped without a report.
+		if level&flagAuth != 0 && !u.timely(m) {
+			u.notInTimeWindows++
+			return nil, nil, nil, nil, fmt.Errorf("message of user %q not in time window", user.SecName)
+		}
+	}
+	return m, s, user, nil, nil
+}
+
+// report returns a report of the statistic when the message is reportable.
+// Reports of the unknown engine ID are not authenticated, the sender does not
+// know the engine ID the keys are localized with yet.
+func (u *usm) report(m *v3Message, s *scopedPDU, user *User, oid []byte, counter *uint32) ([]byte, error) {
+	*counter++
+	if m.flags&flagReportable == 0 {
+		return nil, nil
+	}
+
+	var flags byte
+	if user != nil {
+		flags = flagAuth
+	}
+	pdu := tlv(pduReport,
+		tlv(berInteger, encodeInteger(s.requestID)),
+		tlv(berInteger, encodeInteger(0)),
+		tlv(berInteger, encodeInteger(0)),
+		tlv(berSequence, tlv(berSequence,
+			tlv(0x06, oid),
+			tlv(berCounter32, encodeInteger(int64(*counter))))))
+	return u.encode(m.msgID, flags, user, u.engineID, "", pdu)
+}
+
+// response returns the response acknowledging an inform request, the
+// variable bindings are those of the request.
+func (u *usm) response(m *v3Message, s *scopedPDU, user *User) ([]byte, error) {
+	pdu := append([]byte{pduResponse}, s.pdu.raw[1:]...)
+	return u.encode(m.msgID, m.flags&^flagReportable, user, s.contextEngineID, s.contextName, pdu)
+}
+
+// encode returns a message sent by the local engine, the user is nil when
+// the message is not authenticated.
+func (u *usm) encode(msgID int64, flags byte, user *User, contextEngineID, contextName string, pdu []byte) ([]byte, error) {
+	boots, now := u.boots, u.time()
+	scoped := tlv(berSequence,
+		tlv(berOctetString, []byte(contextEngineID)),
+		tlv(berOctetString, []byte(contextName)),
+		pdu)
+
+	var keys localKeys
+	var userName, authParams, privParams []byte
+	if user != nil {
+		keys = user.keys(u.engineID)
+		userName = []byte(user.SecName)
+	}
+	if flags&flagAuth != 0 {
+		authParams = make([]byte, authParamsLength)
+	}
+
+	data := scoped
+	if flags&flagPriv != 0 {
+		privParams = make([]byte, 8)
+		if _, err := rand.Read(privParams); err != nil {
+			return nil, err
+		}
+		ciphertext, err := encrypt(user, keys.priv, boots, now, privParams, scoped)
+		if err != nil {
+			return nil, err
+		}
+		data = tlv(berOctetString, ciphertext)
+	}
+
+	msg := tlv(berSequence,
+		tlv(berInteger, encodeInteger(3)),
+		tlv(berSequence,
+			tlv(berInteger, encodeInteger(msgID)),
+			tlv(berInteger, encodeInteger(maxMessageSize)),
+			tlv(berOctetString, []byte{flags}),
+			tlv(berInteger, encodeInteger(userSecurityModel))),
+		tlv(berOctetString, tlv(berSequence,
+			tlv(berOctetString, []byte(u.engineID)),
+			tlv(berInteger, encodeInteger(boots)),
+			tlv(berInteger, encodeInteger(now)),
+			tlv(berOctetString, userName),
+			tlv(berOctetString, authParams),
+			tlv(berOctetString, privParams))),
+		data)
+
+	if flags&flagAuth != 0 {
+		m, err := parseV3Message(msg)
+		if err != nil {
+			return nil, err
+		}
+		copy(msg[m.authOffset:], digest(user.hash, keys.auth, msg, m.authOffset))
+	}
+	return msg, nil
+}
+
+// digest returns the HMAC-96 of the message computed with the
+// authentication parameters zeroed.
+func digest(h func() hash.Hash, key []byte, msg []byte, authOffset int) []byte {
+	zeroed := make([]byte, len(msg))
+	copy(zeroed, msg)
+	copy(zeroed[authOffset:authOffset+authParamsLength], make([]byte, authParamsLength))
+
+	mac := hmac.New(h, key[:h().Size()])
+	mac.Write(zeroed)
+	return mac.Sum(nil)[:authParamsLength]
+}
+
+// decrypt decrypts the scoped PDU with CBC-DES (RFC 3414) or CFB128-AES-128
+// (RFC 3826).
+func decrypt(user *User, key []byte, m *v3Message, ciphertext []byte) ([]byte, error) {
+	if len(m.privParams) != 8 {
+		return nil, errors.New("invalid privacy parameters")
+	}
+
+	plaintext := make([]byte, len(ciphertext))
+	if strings.ToLower(user.PrivProtocol) == "aes" {
+		block, err := aes.NewCipher(key[:16])
+		if err != nil {
+			return nil, err
+		}
+		cipher.NewCFBDecrypter(block, aesIV(m.boots, m.time, m.privParams)).XORKeyStream(plaintext, ciphertext)
+		return plaintext, nil
+	}
+
+	if len(ciphertext)%des.BlockSize != 0 {
+		return nil, errors.New("invalid encrypted PDU length")
+	}
+	block, err := des.NewCipher(key[:8])
+	if err != nil {
+		return nil, err
+	}
+	cipher.NewCBCDecrypter(block, desIV(key, m.privParams)).CryptBlocks(plaintext, ciphertext)
+	return plaintext, nil
+}
+
+func encrypt(user *User, key []byte, boots, now int64, salt, plaintext []byte) ([]byte, error) {
+	if strings.ToLower(user.PrivProtocol) == "aes" {
+		block, err := aes.NewCipher(key[:16])
+		if err != nil {
+			return nil, err
+		}
+		ciphertext := make([]byte, len(plaintext))
+		cipher.NewCFBEncrypter(block, aesIV(boots, now, salt)).XORKeyStream(ciphertext, plaintext)
+		return ciphertext, nil
+	}
+
+	block, err := des.NewCipher(key[:8])
+	if err != nil {
+		return nil, err
+	}
+	if pad := len(plaintext) % des.BlockSize; pad != 0 {
+		plaintext = append(plaintext, make([]byte, des.BlockSize-pad)...)
+	}
+	ciphertext := make([]byte, len(plaintext))
+	cipher.NewCBCEncrypter(block, desIV(key, salt)).CryptBlocks(ciphertext, plaintext)
+	return ciphertext, nil
+}
+
+func aesIV(boots, now int64, salt []byte) []byte {
+	iv := make([]byte, 16)
+	binary.BigEndian.PutUint32(iv, uint32(boots))
+	binary.BigEndian.PutUint32(iv[4:], uint32(now))
+	copy(iv[8:], salt)
+	return iv
+}
+
+func desIV(key, salt []byte) []byte {
+	iv := make([]byte, des.BlockSize)
+	for i := range iv {
+		iv[i] = key[8+i] ^ salt[i]
+	}
+	return iv
+}
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// wrapV2c returns the PDU wrapped in an SNMPv2c message, with the tag of the
+// PDU replaced, so that it can be decoded by gosnmp.
+func wrapV2c(pdu []byte, tag byte) []byte {
+	return tlv(berSequence,
+		tlv(berInteger, encodeInteger(1)),
+		tlv(berOctetString),
+		append([]byte{tag}, pdu[1:]...))
+}
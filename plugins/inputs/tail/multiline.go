@@ -0,0 +1,158 @@
+// +build !solaris
+
+package tail
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf/internal"
+)
+
+const (
+	defaultMultilineMaxLines = 1000
+	defaultMultilineTimeout  = 5 * time.Second
+)
+
+// Multiline configures how the lines of a file are joined into records
+// before being parsed.
+type Multiline struct {
+	// Lines matching the pattern are continuation lines, joined to the
+	// previous or next line depending on MatchWhichLine.
+	Pattern string `toml:"pattern"`
+	// Lines matching the start pattern begin a new record, the other lines
+	// are joined to the current record.
+	StartPattern string `toml:"start_pattern"`
+	// Either "previous" or "next".
+	MatchWhichLine string `toml:"match_which_line"`
+	// Join the lines not matching the pattern instead.
+	InvertMatch bool `toml:"invert_match"`
+	// Keep the newlines between the lines of a record, else the lines are
+	// concatenated so line based data formats parse the whole record.
+	PreserveNewline bool `toml:"preserve_newline"`
+	// Maximum number of lines in a record.
+	MaxLines int `toml:"max_lines"`
+	// Time after which an incomplete record is parsed when no new line is
+	// read.
+	Timeout internal.Duration `toml:"timeout"`
+
+	pattern *regexp.Regexp
+	next    bool
+}
+
+func (m *Multiline) init() error {
+	switch {
+	case m.Pattern != "" && m.StartPattern != "":
+		return fmt.Errorf("only one of pattern and start_pattern can be set")
+	case m.Pattern != "":
+		switch m.MatchWhichLine {
+		case "", "previous":
+		case "next":
+			m.next = true
+		default:
+			return fmt.Errorf("invalid match_which_line %q, must be \"previous\" or \"next\"", m.MatchWhichLine)
+		}
+	case m.StartPattern != "":
+		if m.MatchWhichLine != "" {
+			return fmt.Errorf("match_which_line cannot be used with start_pattern")
+		}
+	default:
+		return fmt.Errorf("one of pattern and start_pattern must be set")
+	}
+
+	expr := m.Pattern
+	if expr == "" {
+		expr = m.StartPattern
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return err
+	}
+	m.pattern = re
+
+	if m.MaxLines <= 0 {
+		m.MaxLines = defaultMultilineMaxLines
+	}
+	if m.Timeout.Duration <= 0 {
+		m.Timeout.Duration = defaultMultilineTimeout
+	}
+	return nil
+}
+
+func (m *Multiline) matches(line string) bool {
+	return m.pattern.MatchString(line) != m.InvertMatch
+}
+
+// multilineBuffer assembles the lines of a file into records.
+type multilineBuffer struct {
+	config *Multiline
+	lines  []string
+	// size is the number of bytes of the buffered lines in the file.
+	size int64
+}
+
+func newMultilineBuffer(config *Multiline) *multilineBuffer {
+	return &multilineBuffer{config: config}
+}
+
+// add adds a line taking size bytes in the file, and returns the records it
+// completes.
+func (b *multilineBuffer) add(line string, size int64) []string {
+	var records []string
+	switch {
+	case b.config.StartPattern != "":
+		if b.config.matches(line) {
+			records = b.appendFlush(records)
+		}
+		b.push(line, size)
+	case b.config.next:
+		b.push(line, size)
+		if !b.config.matches(line) {
+			records = b.appendFlush(records)
+		}
+	default:
+		if !b.config.matches(line) {
+			records = b.appendFlush(records)
+		}
+		b.push(line, size)
+	}
+
+	if len(b.lines) >= b.config.MaxLines {
+		records = b.appendFlush(records)
+	}
+	return records
+}
+
+func (b *multilineBuffer) push(line string, size int64) {
+	b.lines = append(b.lines, line)
+	b.size += size
+}
+
+// pending reports whether lines are waiting for the rest of their record.
+func (b *multilineBuffer) pending() bool {
+	return len(b.lines) > 0
+}
+
+// flush returns the buffered lines as a record.
+func (b *multilineBuffer) flush() (string, bool) {
+	if len(b.lines) == 0 {
+		return "", false
+	}
+	separator := ""
+	if b.config.PreserveNewline {
+		separator = "\n"
+	}
+	record := strings.Join(b.lines, separator)
+	b.lines = b.lines[:0]
+	b.size = 0
+	return record, true
+}
+
+func (b *multilineBuffer) appendFlush(records []string) []string {
+	if record, ok := b.flush(); ok {
+		records = append(records, record)
+	}
+	return records
+}
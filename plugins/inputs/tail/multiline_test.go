@@ -0,0 +1,119 @@
+// +build !solaris
+
+package tail
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultilineInit(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Multiline
+		err    bool
+	}{
+		{"pattern", Multiline{Pattern: `^\s`}, false},
+		{"next", Multiline{Pattern: `\\$`, MatchWhichLine: "next"}, false},
+		{"start pattern", Multiline{StartPattern: `^\S`}, false},
+		{"none", Multiline{}, true},
+		{"both", Multiline{Pattern: `^\s`, StartPattern: `^\S`}, true},
+		{"invalid match_which_line", Multiline{Pattern: `^\s`, MatchWhichLine: "both"}, true},
+		{"start pattern with match_which_line", Multiline{StartPattern: `^\S`, MatchWhichLine: "next"}, true},
+		{"invalid pattern", Multiline{Pattern: `(`}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.init()
+			if tt.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, defaultMultilineMaxLines, tt.config.MaxLines)
+			require.Equal(t, defaultMultilineTimeout, tt.config.Timeout.Duration)
+		})
+	}
+}
+
+func TestMultilineBuffer(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Multiline
+		lines   []string
+		records []string
+	}{
+		{
+			name:   "previous",
+			config: Multiline{Pattern: `^\s`, PreserveNewline: true},
+			lines: []string{
+				"panic: boom",
+				"  at a",
+				"  at b",
+				"info: ok",
+				"panic: again",
+				"  at c",
+			},
+			records: []string{"panic: boom\n  at a\n  at b", "info: ok", "panic: again\n  at c"},
+		},
+		{
+			name:   "next",
+			config: Multiline{Pattern: `\\$`, MatchWhichLine: "next"},
+			lines:  []string{`a=1 \`, `b=2 \`, `c=3`, `d=4`},
+			records: []string{
+				`a=1 \b=2 \c=3`,
+				`d=4`,
+			},
+		},
+		{
+			name:   "start pattern",
+			config: Multiline{StartPattern: `^\d{4}-`, PreserveNewline: true},
+			lines: []string{
+				"2020-01-01 first",
+				"detail",
+				"2020-01-02 second",
+				"2020-01-03 third",
+				"more",
+			},
+			records: []string{"2020-01-01 first\ndetail", "2020-01-02 second", "2020-01-03 third\nmore"},
+		},
+		{
+			name:    "invert match",
+			config:  Multiline{Pattern: `^\[`, InvertMatch: true},
+			lines:   []string{"[a]", "b", "c", "[d]"},
+			records: []string{"[a]bc", "[d]"},
+		},
+		{
+			name:    "max lines",
+			config:  Multiline{Pattern: `^\s`, MaxLines: 2},
+			lines:   []string{"a", " b", " c", " d", "e"},
+			records: []string{"a b", " c d", "e"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, tt.config.init())
+			buffer := newMultilineBuffer(&tt.config)
+
+			var records []string
+			for _, line := range tt.lines {
+				records = append(records, buffer.add(line, int64(len(line)+1))...)
+			}
+
+			// the size of the held lines is tracked
+			var held int64
+			for _, line := range buffer.lines {
+				held += int64(len(line) + 1)
+			}
+			require.Equal(t, held, buffer.size)
+
+			if record, ok := buffer.flush(); ok {
+				records = append(records, record)
+			}
+			require.Equal(t, tt.records, records)
+			require.False(t, buffer.pending())
+			require.Equal(t, int64(0), buffer.size)
+		})
+	}
+}
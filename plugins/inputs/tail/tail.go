@@ -3,12 +3,16 @@
 package tail
 
 import (
+	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/influxdata/tail"
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/internal/globpath"
+	"github.com/influxdata/telegraf/plugins/common/fileoffset"
 	"github.com/influxdata/telegraf/plugins/inputs"
 	"github.com/influxdata/telegraf/plugins/parsers"
 	"github.com/influxdata/telegraf/plugins/parsers/csv"
@@ -19,7 +23,7 @@ const (
 )
 
 var (
-	offsets      = make(map[string]int64)
+	offsets      = make(map[string]fileoffset.Position)
 	offsetsMutex = new(sync.Mutex)
 )
 
@@ -28,11 +32,13 @@ type Tail struct {
 	FromBeginning bool
 	Pipe          bool
 	WatchMethod   string
+	Multiline     *Multiline
 
 	Log telegraf.Logger
 
 	tailers    map[string]*tail.Tail
-	offsets    map[string]int64
+	offsets    map[string]fileoffset.Position
+	held       map[string]*int64
 	parserFunc parsers.ParserFunc
 	wg         sync.WaitGroup
 	acc        telegraf.Accumulator
@@ -42,7 +48,7 @@ type Tail struct {
 
 func NewTail() *Tail {
 	offsetsMutex.Lock()
-	offsetsCopy := make(map[string]int64, len(offsets))
+	offsetsCopy := make(map[string]fileoffset.Position, len(offsets))
 	for k, v := range offsets {
 		offsetsCopy[k] = v
 	}
@@ -73,6 +79,27 @@ const sampleConfig = `
   ## Method used to watch for file updates.  Can be either "inotify" or "poll".
   # watch_method = "inotify"
 
+  ## Join the lines of multiline records, such as stack traces, before they
+  ## are parsed.
+  # [inputs.tail.multiline]
+  #   ## Lines matching the pattern are continuation lines, joined to the
+  #   ## "previous" or "next" line according to match_which_line.
+  #   pattern = '^\s'
+  #   # match_which_line = "previous"
+  #   ## Alternatively, lines matching start_pattern begin a new record and
+  #   ## all other lines are joined to it.
+  #   # start_pattern = '^\d{4}-\d{2}-\d{2}'
+  #   ## Join the lines not matching the pattern instead.
+  #   # invert_match = false
+  #   ## Keep the newlines between the lines of a record, else the lines are
+  #   ## concatenated so that line based data formats parse the whole record.
+  #   # preserve_newline = false
+  #   ## Maximum number of lines in a record.
+  #   # max_lines = 1000
+  #   ## Time after which an incomplete record is parsed when no new line is
+  #   ## read.
+  #   # timeout = "5s"
+
   ## Data format to consume.
   ## Each data format has its own unique set of configuration options, read
   ## more about them here:
@@ -88,6 +115,15 @@ func (t *Tail) Description() string {
 	return "Stream a log file, like the tail -f command"
 }
 
+func (t *Tail) Init() error {
+	if t.Multiline != nil {
+		if err := t.Multiline.init(); err != nil {
+			return fmt.Errorf("multiline: %v", err)
+		}
+	}
+	return nil
+}
+
 func (t *Tail) Gather(acc telegraf.Accumulator) error {
 	t.Lock()
 	defer t.Unlock()
@@ -101,14 +137,15 @@ func (t *Tail) Start(acc telegraf.Accumulator) error {
 
 	t.acc = acc
 	t.tailers = make(map[string]*tail.Tail)
+	t.held = make(map[string]*int64)
 
 	err := t.tailNewFiles(t.FromBeginning)
 
 	// clear offsets
-	t.offsets = make(map[string]int64)
+	t.offsets = make(map[string]fileoffset.Position)
 	// assumption that once Start is called, all parallel plugins have already been initialized
 	offsetsMutex.Lock()
-	offsets = make(map[string]int64)
+	offsets = make(map[string]fileoffset.Position)
 	offsetsMutex.Unlock()
 
 	return err
@@ -134,8 +171,13 @@ func (t *Tail) tailNewFiles(fromBeginning bool) error {
 
 			var seek *tail.SeekInfo
 			if !t.Pipe && !fromBeginning {
-				if offset, ok := t.offsets[file]; ok {
-					t.Log.Debugf("Using offset %d for %q", offset, file)
+				if position, ok := t.offsets[file]; ok {
+					offset, ok := position.Resume(file)
+					if ok {
+						t.Log.Debugf("Using offset %d for %q", offset, file)
+					} else {
+						t.Log.Debugf("File %q was rotated or truncated, reading from the beginning", file)
+					}
 					seek = &tail.SeekInfo{
 						Whence: 0,
 						Offset: offset,
@@ -171,12 +213,14 @@ func (t *Tail) tailNewFiles(fromBeginning bool) error {
 			}
 
 			// create a goroutine for each "tailer"
+			held := new(int64)
 			t.wg.Add(1)
 			go func() {
 				defer t.wg.Done()
-				t.receiver(parser, tailer)
+				t.receiver(parser, tailer, held)
 			}()
 			t.tailers[tailer.Filename] = tailer
+			t.held[tailer.Filename] = held
 		}
 	}
 	return nil
@@ -208,10 +252,59 @@ func parseLine(parser parsers.Parser, line string, firstLine bool) ([]telegraf.M
 }
 
 // Receiver is launched as a goroutine to continuously watch a tailed logfile
-// for changes, parse any incoming msgs, and add to the accumulator.
-func (t *Tail) receiver(parser parsers.Parser, tailer *tail.Tail) {
+// for changes, parse any incoming msgs, and add to the accumulator.  The size
+// of the lines waiting for the rest of their multiline record is stored in
+// held.
+func (t *Tail) receiver(parser parsers.Parser, tailer *tail.Tail, held *int64) {
 	var firstLine = true
-	for line := range tailer.Lines {
+	parse := func(text string) {
+		metrics, err := parseLine(parser, text, firstLine)
+		if err != nil {
+			t.Log.Errorf("Malformed log line in %q: [%q]: %s",
+				tailer.Filename, text, err.Error())
+			return
+		}
+		firstLine = false
+
+		for _, metric := range metrics {
+			metric.AddTag("path", tailer.Filename)
+			t.acc.AddMetric(metric)
+		}
+	}
+
+	// Without multiline records each line is parsed as it is read, else the
+	// lines are buffered until their record is complete or the timeout
+	// elapses.
+	var buffer *multilineBuffer
+	var timer *time.Timer
+	if t.Multiline != nil {
+		buffer = newMultilineBuffer(t.Multiline)
+		timer = time.NewTimer(t.Multiline.Timeout.Duration)
+		timer.Stop()
+		defer timer.Stop()
+	}
+
+	for {
+		var timeout <-chan time.Time
+		if buffer != nil && buffer.pending() {
+			timeout = timer.C
+		}
+
+		var line *tail.Line
+		var ok bool
+		select {
+		case line, ok = <-tailer.Lines:
+		case <-timeout:
+			if record, ok := buffer.flush(); ok {
+				parse(record)
+			}
+			atomic.StoreInt64(held, buffer.size)
+			continue
+		}
+		if !ok {
+			break
+		}
+
 		if line.Err != nil {
 			t.Log.Errorf("Tailing %q: %s", tailer.Filename, line.Err.Error())
 			continue
@@ -219,17 +312,28 @@ func (t *Tail) receiver(parser parsers.Parser, tailer *tail.Tail) {
 		// Fix up files with Windows line endings.
 		text := strings.TrimRight(line.Text, "\r")
 
-		metrics, err := parseLine(parser, text, firstLine)
-		if err != nil {
-			t.Log.Errorf("Malformed log line in %q: [%q]: %s",
-				tailer.Filename, line.Text, err.Error())
+		if buffer == nil {
+			parse(text)
 			continue
 		}
-		firstLine = false
 
-		for _, metric := range metrics {
-			metric.AddTag("path", tailer.Filename)
-			t.acc.AddMetric(metric)
+		for _, record := range buffer.add(text, int64(len(line.Text)+1)) {
+			parse(record)
+		}
+		atomic.StoreInt64(held, buffer.size)
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(t.Multiline.Timeout.Duration)
+	}
+
+	// parse the last record when the tailer is stopped
+	if buffer != nil {
+		if record, ok := buffer.flush(); ok {
+			parse(record)
 		}
 	}
 
@@ -246,10 +350,12 @@ func (t *Tail) Stop() {
 
 	for _, tailer := range t.tailers {
 		if !t.Pipe && !t.FromBeginning {
-			// store offset for resume
-			offset, err := tailer.Tell()
+			// store offset for resume, the lines held for a multiline record
+			// are parsed once the tailer is stopped
+			position, err := t.position(tailer, nil)
 			if err == nil {
-				t.Log.Debugf("Recording offset %d for %q", offset, tailer.Filename)
+				t.offsets[tailer.Filename] = position
+				t.Log.Debugf("Recording offset %d for %q", position.Offset, tailer.Filename)
 			} else {
 				t.Log.Errorf("Recording offset for %q: %s", tailer.Filename, err.Error())
 			}
@@ -261,6 +367,9 @@ func (t *Tail) Stop() {
 	}
 
 	t.wg.Wait()
+	// the offsets of the stopped tailers are recorded above
+	t.tailers = make(map[string]*tail.Tail)
+	t.held = make(map[string]*int64)
 
 	// persist offsets
 	offsetsMutex.Lock()
@@ -270,6 +379,64 @@ func (t *Tail) Stop() {
 	offsetsMutex.Unlock()
 }
 
+// position returns the position reached by the tailer, before the lines
+// waiting for the rest of their multiline record if held is not nil.
+func (t *Tail) position(tailer *tail.Tail, held *int64) (fileoffset.Position, error) {
+	offset, err := tailer.Tell()
+	if err != nil {
+		return fileoffset.Position{}, err
+	}
+	// The lines held are read before Tell returns, so they are always
+	// included in the offset.
+	if held != nil {
+		offset -= atomic.LoadInt64(held)
+	}
+	return fileoffset.New(tailer.Filename, offset)
+}
+
+// GetState returns the positions reached in the files so they can be
+// persisted.  It is called while the files are tailed, and after Stop.
+func (t *Tail) GetState() interface{} {
+	t.Lock()
+	defer t.Unlock()
+
+	state := make(map[string]fileoffset.Position, len(t.offsets)+len(t.tailers))
+	for file, position := range t.offsets {
+		state[file] = position
+	}
+	if t.Pipe {
+		return state
+	}
+	for _, tailer := range t.tailers {
+		position, err := t.position(tailer, t.held[tailer.Filename])
+		if err != nil {
+			t.Log.Debugf("Recording offset for %q: %s", tailer.Filename, err.Error())
+			continue
+		}
+		state[tailer.Filename] = position
+	}
+	return state
+}
+
+// SetState restores the positions in the files, reading resumes at them
+// unless from_beginning is set or the files were rotated.
+func (t *Tail) SetState(state interface{}) error {
+	positions, ok := state.(map[string]fileoffset.Position)
+	if !ok {
+		return fmt.Errorf("invalid state type %T", state)
+	}
+
+	t.Lock()
+	defer t.Unlock()
+	if t.offsets == nil {
+		t.offsets = make(map[string]fileoffset.Position, len(positions))
+	}
+	for file, position := range positions {
+		t.offsets[file] = position
+	}
+	return nil
+}
+
 func (t *Tail) SetParserFunc(fn parsers.ParserFunc) {
 	t.parserFunc = fn
 }
@@ -10,8 +10,11 @@ import (
 	"time"
 
 	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/common/fileoffset"
 	"github.com/influxdata/telegraf/plugins/parsers"
 	"github.com/influxdata/telegraf/plugins/parsers/csv"
+	"github.com/influxdata/telegraf/plugins/parsers/grok"
 	"github.com/influxdata/telegraf/plugins/parsers/json"
 	"github.com/influxdata/telegraf/testutil"
 	"github.com/stretchr/testify/assert"
@@ -268,3 +271,239 @@ func TestMultipleMetricsOnFirstLine(t *testing.T) {
 	testutil.RequireMetricsEqual(t, expected, acc.GetTelegrafMetrics(),
 		testutil.IgnoreTime())
 }
+
+func TestTailResumeState(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "")
+	require.NoError(t, err)
+	defer os.Remove(tmpfile.Name())
+	defer tmpfile.Close()
+	_, err = tmpfile.WriteString("cpu usage_idle=100\ncpu usage_idle=99\n")
+	require.NoError(t, err)
+
+	position, err := fileoffset.New(tmpfile.Name(), int64(len("cpu usage_idle=100\n")))
+	require.NoError(t, err)
+
+	tt := NewTail()
+	tt.Log = testutil.Logger{}
+	tt.Files = []string{tmpfile.Name()}
+	tt.SetParserFunc(parsers.NewInfluxParser)
+	require.NoError(t, tt.SetState(map[string]fileoffset.Position{tmpfile.Name(): position}))
+
+	acc := testutil.Accumulator{}
+	require.NoError(t, tt.Start(&acc))
+	acc.Wait(1)
+	tt.Stop()
+
+	require.Len(t, acc.Metrics, 1)
+	acc.AssertContainsFields(t, "cpu", map[string]interface{}{"usage_idle": float64(99)})
+
+	state := tt.GetState().(map[string]fileoffset.Position)
+	require.Equal(t, int64(len("cpu usage_idle=100\ncpu usage_idle=99\n")), state[tmpfile.Name()].Offset)
+}
+
+func TestTailResumeStateRotated(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "")
+	require.NoError(t, err)
+	defer os.Remove(tmpfile.Name())
+	defer tmpfile.Close()
+	_, err = tmpfile.WriteString("cpu usage_idle=100\ncpu usage_idle=99\n")
+	require.NoError(t, err)
+
+	// position recorded in a file with other content
+	position, err := fileoffset.New(tmpfile.Name(), int64(len("cpu usage_idle=100\n")))
+	require.NoError(t, err)
+	position.Fingerprint = "other"
+
+	tt := NewTail()
+	tt.Log = testutil.Logger{}
+	tt.Files = []string{tmpfile.Name()}
+	tt.SetParserFunc(parsers.NewInfluxParser)
+	require.NoError(t, tt.SetState(map[string]fileoffset.Position{tmpfile.Name(): position}))
+
+	acc := testutil.Accumulator{}
+	require.NoError(t, tt.Start(&acc))
+	acc.Wait(2)
+	tt.Stop()
+
+	require.Len(t, acc.Metrics, 2)
+}
+
+func TestTailMultiline(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "")
+	require.NoError(t, err)
+	defer func() {
+		tmpfile.Close()
+		os.Remove(tmpfile.Name())
+	}()
+
+	_, err = tmpfile.WriteString(`{
+  "time_idle": 42
+}
+{
+  "time_idle": 43
+}
+`)
+	require.NoError(t, err)
+
+	plugin := NewTail()
+	plugin.Log = testutil.Logger{}
+	plugin.FromBeginning = true
+	plugin.Files = []string{tmpfile.Name()}
+	plugin.Multiline = &Multiline{
+		StartPattern:    `^\{`,
+		PreserveNewline: true,
+		Timeout:         internal.Duration{Duration: 100 * time.Millisecond},
+	}
+	plugin.SetParserFunc(func() (parsers.Parser, error) {
+		return json.New(
+			&json.Config{
+				MetricName: "cpu",
+			})
+	})
+	require.NoError(t, plugin.Init())
+	defer plugin.Stop()
+
+	acc := testutil.Accumulator{}
+	require.NoError(t, plugin.Start(&acc))
+	require.NoError(t, plugin.Gather(&acc))
+	// the last record is parsed once the timeout elapses
+	acc.Wait(2)
+	plugin.Stop()
+
+	expected := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{
+				"path": tmpfile.Name(),
+			},
+			map[string]interface{}{
+				"time_idle": 42.0,
+			},
+			time.Unix(0, 0)),
+		testutil.MustMetric("cpu",
+			map[string]string{
+				"path": tmpfile.Name(),
+			},
+			map[string]interface{}{
+				"time_idle": 43.0,
+			},
+			time.Unix(0, 0)),
+	}
+	testutil.RequireMetricsEqual(t, expected, acc.GetTelegrafMetrics(),
+		testutil.IgnoreTime())
+}
+
+func TestTailMultilineState(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "")
+	require.NoError(t, err)
+	defer func() {
+		tmpfile.Close()
+		os.Remove(tmpfile.Name())
+	}()
+
+	first := "{\n  \"time_idle\": 42\n}\n"
+	second := "{\r\n  \"time_idle\": 43\r\n}\r\n"
+	_, err = tmpfile.WriteString(first + second)
+	require.NoError(t, err)
+
+	position, err := fileoffset.New(tmpfile.Name(), 0)
+	require.NoError(t, err)
+
+	plugin := NewTail()
+	plugin.Log = testutil.Logger{}
+	plugin.Files = []string{tmpfile.Name()}
+	require.NoError(t, plugin.SetState(map[string]fileoffset.Position{tmpfile.Name(): position}))
+	plugin.Multiline = &Multiline{
+		StartPattern: `^\{`,
+		Timeout:      internal.Duration{Duration: time.Hour},
+	}
+	plugin.SetParserFunc(func() (parsers.Parser, error) {
+		return json.New(
+			&json.Config{
+				MetricName: "cpu",
+			})
+	})
+	require.NoError(t, plugin.Init())
+	defer plugin.Stop()
+
+	acc := testutil.Accumulator{}
+	require.NoError(t, plugin.Start(&acc))
+	acc.Wait(1)
+
+	// the lines of the incomplete record are not part of the state
+	offset := func() int64 {
+		return plugin.GetState().(map[string]fileoffset.Position)[tmpfile.Name()].Offset
+	}
+	require.Eventually(t, func() bool {
+		return offset() == int64(len(first))
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, uint64(1), acc.NMetrics())
+
+	// the record is parsed when stopping, and the whole file is read
+	plugin.Stop()
+	require.Equal(t, uint64(2), acc.NMetrics())
+	require.Equal(t, int64(len(first+second)), offset())
+}
+
+func TestTailMultilineGrok(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "")
+	require.NoError(t, err)
+	defer func() {
+		tmpfile.Close()
+		os.Remove(tmpfile.Name())
+	}()
+
+	_, err = tmpfile.WriteString(`ERROR something failed
+  at a
+  at b
+INFO done
+`)
+	require.NoError(t, err)
+
+	plugin := NewTail()
+	plugin.Log = testutil.Logger{}
+	plugin.FromBeginning = true
+	plugin.Files = []string{tmpfile.Name()}
+	plugin.Multiline = &Multiline{
+		Pattern: `^\s`,
+	}
+	plugin.SetParserFunc(func() (parsers.Parser, error) {
+		parser := &grok.Parser{
+			Measurement: "log",
+			Patterns:    []string{`%{WORD:level:tag} %{GREEDYDATA:message}`},
+		}
+		err := parser.Compile()
+		return parser, err
+	})
+	require.NoError(t, plugin.Init())
+	defer plugin.Stop()
+
+	acc := testutil.Accumulator{}
+	require.NoError(t, plugin.Start(&acc))
+	require.NoError(t, plugin.Gather(&acc))
+	acc.Wait(1)
+	// the last record is parsed when the plugin is stopped
+	plugin.Stop()
+
+	expected := []telegraf.Metric{
+		testutil.MustMetric("log",
+			map[string]string{
+				"level": "ERROR",
+				"path":  tmpfile.Name(),
+			},
+			map[string]interface{}{
+				"message": "something failed  at a  at b",
+			},
+			time.Unix(0, 0)),
+		testutil.MustMetric("log",
+			map[string]string{
+				"level": "INFO",
+				"path":  tmpfile.Name(),
+			},
+			map[string]interface{}{
+				"message": "done",
+			},
+			time.Unix(0, 0)),
+	}
+	testutil.RequireMetricsEqual(t, expected, acc.GetTelegrafMetrics(),
+		testutil.IgnoreTime())
+}
@@ -0,0 +1,519 @@
+package clickhouse
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/internal/tls"
+	"github.com/influxdata/telegraf/plugins/outputs"
+)
+
+const (
+	modeMeasurement = "measurement"
+	modeGeneric     = "generic"
+
+	timestampFormat = "2006-01-02 15:04:05.000000000"
+)
+
+var sampleConfig = `
+  ## URL of the ClickHouse HTTP interface.
+  url = "http://localhost:8123"
+
+  ## Database holding the tables, it must already exist.
+  # database = "default"
+
+  ## Credentials sent in the X-ClickHouse-User and X-ClickHouse-Key headers.
+  # username = "default"
+  # password = ""
+
+  ## How metrics are laid out in tables:
+  ##   measurement: one table per measurement with a column per tag and field
+  ##   generic:     a single table with the tags and fields stored in Map
+  ##                columns, requires ClickHouse 21.8 or later
+  # table_mode = "measurement"
+
+  ## Table used by the generic mode.
+  # table = "metrics"
+
+  ## Prefix added to the table names in measurement mode.
+  # table_prefix = ""
+
+  ## Name of the column holding the metric timestamp.
+  # timestamp_column = "time"
+
+  ## Create missing tables.
+  # table_create = true
+
+  ## Add columns for new tags and fields in measurement mode, when false
+  ## values without a column are not written.
+  # column_add = true
+
+  ## Table engine and options used when creating tables.  The tables are
+  ## ordered by their tags and the timestamp.
+  # engine = "MergeTree()"
+  # partition_by = "toYYYYMM(time)"
+  # ttl = "time + INTERVAL 90 DAY"
+  # table_settings = "non_replicated_deduplication_window = 100"
+
+  ## Send a deduplication token with each insert, so that the server ignores
+  ## inserts retried after a failure.  Requires ClickHouse 22.2 or later and
+  ## replicated tables or the non_replicated_deduplication_window setting.
+  # deduplicate = false
+
+  ## HTTP Content-Encoding of the requests, "gzip" or "identity".
+  # content_encoding = "gzip"
+
+  ## Timeout for each request.
+  # timeout = "5s"
+
+  ## Optional TLS Config
+  # tls_ca = "/etc/telegraf/ca.pem"
+  # tls_cert = "/etc/telegraf/cert.pem"
+  # tls_key = "/etc/telegraf/key.pem"
+  ## Use TLS but skip chain & host verification
+  # insecure_skip_verify = false
+`
+
+type ClickHouse struct {
+	URL             string            `toml:"url"`
+	Database        string            `toml:"database"`
+	Username        string            `toml:"username"`
+	Password        string            `toml:"password"`
+	TableMode       string            `toml:"table_mode"`
+	Table           string            `toml:"table"`
+	TablePrefix     string            `toml:"table_prefix"`
+	TimestampColumn string            `toml:"timestamp_column"`
+	TableCreate     bool              `toml:"table_create"`
+	ColumnAdd       bool              `toml:"column_add"`
+	Engine          string            `toml:"engine"`
+	PartitionBy     string            `toml:"partition_by"`
+	TTL             string            `toml:"ttl"`
+	TableSettings   string            `toml:"table_settings"`
+	Deduplicate     bool              `toml:"deduplicate"`
+	ContentEncoding string            `toml:"content_encoding"`
+	Timeout         internal.Duration `toml:"timeout"`
+	tls.ClientConfig
+
+	Log telegraf.Logger `toml:"-"`
+
+	client *http.Client
+	// tables caches the known columns and their types of each table.
+	tables map[string]map[string]string
+	// written holds the tokens of the inserts that succeeded since the last
+	// complete write, they are skipped when the batch is retried.
+	written map[string]bool
+}
+
+// batch collects the rows written to a single table.
+type batch struct {
+	table   string
+	tags    map[string]string
+	fields  map[string]string
+	records []map[string]interface{}
+}
+
+func (c *ClickHouse) Description() string {
+	return "Send metrics to ClickHouse using the HTTP interface"
+}
+
+func (c *ClickHouse) SampleConfig() string {
+	return sampleConfig
+}
+
+func (c *ClickHouse) Init() error {
+	switch c.TableMode {
+	case modeMeasurement:
+	case modeGeneric:
+		if c.Table == "" {
+			return fmt.Errorf("table must be set in %s mode", c.TableMode)
+		}
+	default:
+		return fmt.Errorf("unknown table_mode %q", c.TableMode)
+	}
+
+	if c.TimestampColumn == "" {
+		return fmt.Errorf("timestamp_column must not be empty")
+	}
+
+	switch c.ContentEncoding {
+	case "", "identity", "gzip":
+	default:
+		return fmt.Errorf("unsupported content_encoding %q", c.ContentEncoding)
+	}
+
+	if c.Engine == "" {
+		c.Engine = "MergeTree()"
+	}
+	if c.PartitionBy == "" {
+		c.PartitionBy = "toYYYYMM(" + quote(c.TimestampColumn) + ")"
+	}
+	return nil
+}
+
+func (c *ClickHouse) Connect() error {
+	tlsCfg, err := c.ClientConfig.TLSConfig()
+	if err != nil {
+		return err
+	}
+
+	c.client = &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: tlsCfg,
+			Proxy:           http.ProxyFromEnvironment,
+		},
+		Timeout: c.Timeout.Duration,
+	}
+	c.tables = make(map[string]map[string]string)
+	c.written = make(map[string]bool)
+	return nil
+}
+
+func (c *ClickHouse) Close() error {
+	return nil
+}
+
+// Write inserts the rows of each table with a single request.  When a
+// request fails the inserts that already succeeded are remembered, and
+// skipped if the same rows are written again.
+func (c *ClickHouse) Write(metrics []telegraf.Metric) error {
+	batches := c.batches(metrics)
+	names := make([]string, 0, len(batches))
+	for name := range batches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		b := batches[name]
+		body, err := c.rows(b)
+		if err != nil {
+			return err
+		}
+		if len(body) == 0 {
+			continue
+		}
+
+		sum := sha256.Sum256(append([]byte(b.table+"\n"), body...))
+		token := hex.EncodeToString(sum[:])
+		if c.written[token] {
+			c.Log.Debugf("Skipping rows already written to table %q", b.table)
+			continue
+		}
+
+		if err := c.insert(b.table, body, token); err != nil {
+			// The table may have been changed behind our back, look it up
+			// again on the next write.
+			delete(c.tables, b.table)
+			return fmt.Errorf("writing to table %q failed: %v", b.table, err)
+		}
+		c.written[token] = true
+	}
+
+	c.written = make(map[string]bool)
+	return nil
+}
+
+// batches groups the metrics by destination table.
+func (c *ClickHouse) batches(metrics []telegraf.Metric) map[string]*batch {
+	batches := make(map[string]*batch)
+	for _, m := range metrics {
+		table := c.Table
+		if c.TableMode == modeMeasurement {
+			table = c.TablePrefix + m.Name()
+		}
+
+		b, ok := batches[table]
+		if !ok {
+			b = &batch{
+				table:  table,
+				tags:   make(map[string]string),
+				fields: make(map[string]string),
+			}
+			batches[table] = b
+		}
+
+		if c.TableMode == modeGeneric {
+			b.records = append(b.records, c.genericRecord(m))
+			continue
+		}
+
+		record := map[string]interface{}{
+			c.TimestampColumn: m.Time().UTC().Format(timestampFormat),
+		}
+		for _, tag := range m.TagList() {
+			if tag.Key == c.TimestampColumn {
+				c.Log.Debugf("Dropping tag %q named like the timestamp column", tag.Key)
+				continue
+			}
+			b.tags[tag.Key] = typeTag
+			record[tag.Key] = tag.Value
+		}
+		for _, field := range m.FieldList() {
+			typ := fieldType(field.Value)
+			if typ == "" {
+				continue
+			}
+			// Fields named like the timestamp column or a tag are dropped
+			if _, ok := record[field.Key]; ok {
+				c.Log.Debugf("Dropping field %q named like a tag or the timestamp column", field.Key)
+				continue
+			}
+			if _, ok := b.fields[field.Key]; !ok {
+				b.fields[field.Key] = typ
+			}
+			record[field.Key] = field.Value
+		}
+		b.records = append(b.records, record)
+	}
+	return batches
+}
+
+// genericRecord returns the row of the metric in the generic table, numeric
+// and boolean fields are stored as floats and string fields separately.
+func (c *ClickHouse) genericRecord(m telegraf.Metric) map[string]interface{} {
+	fields := make(map[string]float64)
+	stringFields := make(map[string]string)
+	for _, field := range m.FieldList() {
+		switch v := field.Value.(type) {
+		case int64:
+			fields[field.Key] = float64(v)
+		case uint64:
+			fields[field.Key] = float64(v)
+		case float64:
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				continue
+			}
+			fields[field.Key] = v
+		case bool:
+			if v {
+				fields[field.Key] = 1
+			} else {
+				fields[field.Key] = 0
+			}
+		case string:
+			stringFields[field.Key] = v
+		}
+	}
+
+	return map[string]interface{}{
+		c.TimestampColumn: m.Time().UTC().Format(timestampFormat),
+		"measurement":     m.Name(),
+		"tags":            m.Tags(),
+		"fields":          fields,
+		"string_fields":   stringFields,
+	}
+}
+
+// rows prepares the table of the batch and returns the rows in the
+// JSONEachRow format.
+func (c *ClickHouse) rows(b *batch) ([]byte, error) {
+	var columns []column
+	var orderBy []string
+	if c.TableMode == modeGeneric {
+		columns = []column{
+			{name: c.TimestampColumn, typ: typeTimestamp},
+			{name: "measurement", typ: typeTag},
+			{name: "tags", typ: "Map(String, String)"},
+			{name: "fields", typ: "Map(String, Float64)"},
+			{name: "string_fields", typ: "Map(String, String)"},
+		}
+		orderBy = []string{"measurement", c.TimestampColumn}
+	} else {
+		columns = []column{{name: c.TimestampColumn, typ: typeTimestamp}}
+		for _, name := range sortedKeys(b.tags) {
+			columns = append(columns, column{name: name, typ: typeTag})
+			orderBy = append(orderBy, name)
+		}
+		orderBy = append(orderBy, c.TimestampColumn)
+		for _, name := range sortedKeys(b.fields) {
+			if _, ok := b.tags[name]; ok {
+				continue
+			}
+			columns = append(columns, column{name: name, typ: b.fields[name]})
+		}
+	}
+
+	known, err := c.prepareTable(b.table, columns, orderBy)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	for _, record := range b.records {
+		row := make(map[string]interface{}, len(record))
+		for name, value := range record {
+			typ, ok := known[name]
+			if !ok {
+				continue
+			}
+			if _, ok := b.fields[name]; ok && c.TableMode == modeMeasurement {
+				if v, ok := value.(float64); ok && (math.IsNaN(v) || math.IsInf(v, 0)) {
+					continue
+				}
+				value, ok = coerce(value, typ)
+				if !ok {
+					c.Log.Debugf("Dropping value of field %q not matching column type %s of table %q",
+						name, typ, b.table)
+					continue
+				}
+			}
+			row[name] = value
+		}
+
+		line, err := json.Marshal(row)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// prepareTable makes sure the table exists and has the needed columns.  It
+// returns the columns of the table and their types.
+func (c *ClickHouse) prepareTable(table string, wanted []column, orderBy []string) (map[string]string, error) {
+	known, ok := c.tables[table]
+	if !ok {
+		var err error
+		known, err = c.lookupColumns(table)
+		if err != nil {
+			return nil, fmt.Errorf("looking up columns of table %q failed: %v", table, err)
+		}
+		if len(known) == 0 {
+			if !c.TableCreate {
+				return nil, fmt.Errorf("table %q does not exist", table)
+			}
+			if err := c.exec(c.createTable(table, wanted, orderBy)); err != nil {
+				return nil, fmt.Errorf("creating table %q failed: %v", table, err)
+			}
+			for _, col := range wanted {
+				known[col.name] = col.typ
+			}
+		}
+		c.tables[table] = known
+	}
+
+	if !c.ColumnAdd {
+		return known, nil
+	}
+	for _, col := range wanted {
+		if _, ok := known[col.name]; ok {
+			continue
+		}
+		if err := c.exec(c.addColumn(table, col)); err != nil {
+			delete(c.tables, table)
+			return nil, fmt.Errorf("adding column %q to table %q failed: %v", col.name, table, err)
+		}
+		known[col.name] = col.typ
+	}
+	return known, nil
+}
+
+func (c *ClickHouse) lookupColumns(table string) (map[string]string, error) {
+	resp, err := c.do(nil, []byte(c.selectColumns(table)))
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(resp))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), "\t", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		known[unescapeTSV(parts[0])] = unescapeTSV(parts[1])
+	}
+	return known, scanner.Err()
+}
+
+func (c *ClickHouse) exec(query string) error {
+	_, err := c.do(nil, []byte(query))
+	return err
+}
+
+func (c *ClickHouse) insert(table string, rows []byte, token string) error {
+	params := url.Values{}
+	params.Set("query", "INSERT INTO "+c.tableName(table)+" FORMAT JSONEachRow")
+	if c.Deduplicate {
+		params.Set("insert_deduplication_token", token)
+	}
+	_, err := c.do(params, rows)
+	return err
+}
+
+// do sends a request to the HTTP interface and returns the response body.
+func (c *ClickHouse) do(params url.Values, body []byte) ([]byte, error) {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("database", c.Database)
+
+	var reqBody io.Reader = bytes.NewReader(body)
+	if c.ContentEncoding == "gzip" {
+		rc, err := internal.CompressWithGzip(reqBody)
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		reqBody = rc
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.URL+"/?"+params.Encode(), reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Telegraf/"+internal.Version())
+	if c.ContentEncoding == "gzip" {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if c.Username != "" {
+		req.Header.Set("X-ClickHouse-User", c.Username)
+		req.Header.Set("X-ClickHouse-Key", c.Password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("received status code %d: %s",
+			resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+func init() {
+	outputs.Add("clickhouse", func() telegraf.Output {
+		return &ClickHouse{
+			URL:             "http://localhost:8123",
+			Database:        "default",
+			TableMode:       modeMeasurement,
+			Table:           "metrics",
+			TimestampColumn: "time",
+			TableCreate:     true,
+			ColumnAdd:       true,
+			Engine:          "MergeTree()",
+			ContentEncoding: "gzip",
+			Timeout:         internal.Duration{Duration: 5 * time.Second},
+		}
+	})
+}
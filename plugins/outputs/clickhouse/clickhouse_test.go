@@ -0,0 +1,308 @@
+package clickhouse
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// stub is a stand-in for the ClickHouse HTTP interface, recording the
+// statements and inserts it receives.
+type stub struct {
+	sync.Mutex
+	columns    map[string][]string
+	statements []string
+	inserts    []insert
+	failInsert map[string]bool
+}
+
+type insert struct {
+	query  string
+	params map[string]string
+	rows   string
+}
+
+func newStub() *stub {
+	return &stub{
+		columns:    make(map[string][]string),
+		failInsert: make(map[string]bool),
+	}
+}
+
+func (s *stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	body := r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body = gz
+	}
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query().Get("query")
+	if query == "" {
+		query = string(data)
+	}
+
+	switch {
+	case strings.HasPrefix(query, "SELECT name, type FROM system.columns"):
+		for table, columns := range s.columns {
+			if strings.Contains(query, "table = '"+table+"'") {
+				fmt.Fprint(w, strings.Join(columns, "\n"))
+			}
+		}
+	case strings.HasPrefix(query, "INSERT"):
+		table := strings.Fields(query)[2]
+		if s.failInsert[table] {
+			http.Error(w, "Code: 252. DB::Exception: Too many parts", http.StatusInternalServerError)
+			return
+		}
+		params := make(map[string]string)
+		for k := range r.URL.Query() {
+			params[k] = r.URL.Query().Get(k)
+		}
+		s.inserts = append(s.inserts, insert{query: query, params: params, rows: string(data)})
+	default:
+		s.statements = append(s.statements, query)
+	}
+}
+
+func newClickHouse(url string) *ClickHouse {
+	return &ClickHouse{
+		URL:             url,
+		Database:        "telegraf",
+		TableMode:       modeMeasurement,
+		Table:           "metrics",
+		TimestampColumn: "time",
+		TableCreate:     true,
+		ColumnAdd:       true,
+		ContentEncoding: "gzip",
+		Timeout:         internal.Duration{Duration: 5 * time.Second},
+		Log:             testutil.Logger{},
+	}
+}
+
+func testMetrics() []telegraf.Metric {
+	return []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "a", "cpu": "cpu0"},
+			map[string]interface{}{"usage_idle": 42.5, "ok": true},
+			time.Unix(1577836800, 500)),
+		testutil.MustMetric("mem",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"used": int64(10), "state": "ok"},
+			time.Unix(1577836800, 0)),
+	}
+}
+
+func TestCreateTablesAndInsert(t *testing.T) {
+	s := newStub()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	c := newClickHouse(ts.URL)
+	c.TTL = "time + INTERVAL 90 DAY"
+	require.NoError(t, c.Init())
+	require.NoError(t, c.Connect())
+	require.NoError(t, c.Write(testMetrics()))
+
+	require.Equal(t, []string{
+		"CREATE TABLE IF NOT EXISTS `telegraf`.`cpu` (`time` DateTime64(9, 'UTC'), " +
+			"`cpu` LowCardinality(String), `host` LowCardinality(String), " +
+			"`ok` Nullable(UInt8), `usage_idle` Nullable(Float64)) " +
+			"ENGINE = MergeTree() PARTITION BY toYYYYMM(`time`) ORDER BY (`cpu`, `host`, `time`) " +
+			"TTL time + INTERVAL 90 DAY",
+		"CREATE TABLE IF NOT EXISTS `telegraf`.`mem` (`time` DateTime64(9, 'UTC'), " +
+			"`host` LowCardinality(String), `state` Nullable(String), `used` Nullable(Int64)) " +
+			"ENGINE = MergeTree() PARTITION BY toYYYYMM(`time`) ORDER BY (`host`, `time`) " +
+			"TTL time + INTERVAL 90 DAY",
+	}, s.statements)
+
+	require.Len(t, s.inserts, 2)
+	require.Equal(t, "INSERT INTO `telegraf`.`cpu` FORMAT JSONEachRow", s.inserts[0].query)
+	require.Equal(t, "telegraf", s.inserts[0].params["database"])
+	require.Equal(t,
+		`{"cpu":"cpu0","host":"a","ok":1,"time":"2020-01-01 00:00:00.000000500","usage_idle":42.5}`+"\n",
+		s.inserts[0].rows)
+	require.Equal(t,
+		`{"host":"a","state":"ok","time":"2020-01-01 00:00:00.000000000","used":10}`+"\n",
+		s.inserts[1].rows)
+}
+
+func TestExistingTableColumns(t *testing.T) {
+	s := newStub()
+	s.columns["cpu"] = []string{
+		"time\tDateTime64(9, 'UTC')",
+		"host\tLowCardinality(String)",
+		"usage_idle\tNullable(Int64)",
+		"ok\tNullable(String)",
+	}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	c := newClickHouse(ts.URL)
+	require.NoError(t, c.Init())
+	require.NoError(t, c.Connect())
+	require.NoError(t, c.Write(testMetrics()[:1]))
+
+	// The missing tag column is added, values are converted to the type of
+	// the existing columns or dropped.
+	require.Equal(t, []string{
+		"ALTER TABLE `telegraf`.`cpu` ADD COLUMN IF NOT EXISTS `cpu` LowCardinality(String)",
+	}, s.statements)
+	require.Len(t, s.inserts, 1)
+	require.Equal(t,
+		`{"cpu":"cpu0","host":"a","ok":"true","time":"2020-01-01 00:00:00.000000500"}`+"\n",
+		s.inserts[0].rows)
+}
+
+func TestNoColumnAdd(t *testing.T) {
+	s := newStub()
+	s.columns["cpu"] = []string{
+		"time\tDateTime64(9, 'UTC')",
+		"usage_idle\tFloat64",
+	}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	c := newClickHouse(ts.URL)
+	c.ColumnAdd = false
+	require.NoError(t, c.Init())
+	require.NoError(t, c.Connect())
+	require.NoError(t, c.Write(testMetrics()[:1]))
+
+	require.Empty(t, s.statements)
+	require.Equal(t,
+		`{"time":"2020-01-01 00:00:00.000000500","usage_idle":42.5}`+"\n",
+		s.inserts[0].rows)
+}
+
+func TestTimestampColumnCollision(t *testing.T) {
+	s := newStub()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	c := newClickHouse(ts.URL)
+	require.NoError(t, c.Init())
+	require.NoError(t, c.Connect())
+	require.NoError(t, c.Write([]telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "a", "time": "now"},
+			map[string]interface{}{"time": int64(1), "host": "b", "usage_idle": 42.5},
+			time.Unix(1577836800, 0)),
+	}))
+
+	require.Equal(t, []string{
+		"CREATE TABLE IF NOT EXISTS `telegraf`.`cpu` (`time` DateTime64(9, 'UTC'), " +
+			"`host` LowCardinality(String), `usage_idle` Nullable(Float64)) " +
+			"ENGINE = MergeTree() PARTITION BY toYYYYMM(`time`) ORDER BY (`host`, `time`)",
+	}, s.statements)
+	require.Len(t, s.inserts, 1)
+	require.Equal(t,
+		`{"host":"a","time":"2020-01-01 00:00:00.000000000","usage_idle":42.5}`+"\n",
+		s.inserts[0].rows)
+}
+
+func TestGenericTable(t *testing.T) {
+	s := newStub()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	c := newClickHouse(ts.URL)
+	c.TableMode = modeGeneric
+	c.ContentEncoding = "identity"
+	require.NoError(t, c.Init())
+	require.NoError(t, c.Connect())
+	require.NoError(t, c.Write(testMetrics()))
+
+	require.Equal(t, []string{
+		"CREATE TABLE IF NOT EXISTS `telegraf`.`metrics` (`time` DateTime64(9, 'UTC'), " +
+			"`measurement` LowCardinality(String), `tags` Map(String, String), " +
+			"`fields` Map(String, Float64), `string_fields` Map(String, String)) " +
+			"ENGINE = MergeTree() PARTITION BY toYYYYMM(`time`) ORDER BY (`measurement`, `time`)",
+	}, s.statements)
+	require.Len(t, s.inserts, 1)
+	require.Equal(t,
+		`{"fields":{"ok":1,"usage_idle":42.5},"measurement":"cpu","string_fields":{},"tags":{"cpu":"cpu0","host":"a"},"time":"2020-01-01 00:00:00.000000500"}`+"\n"+
+			`{"fields":{"used":10},"measurement":"mem","string_fields":{"state":"ok"},"tags":{"host":"a"},"time":"2020-01-01 00:00:00.000000000"}`+"\n",
+		s.inserts[0].rows)
+}
+
+func TestRetrySkipsWrittenTables(t *testing.T) {
+	s := newStub()
+	s.failInsert["`telegraf`.`mem`"] = true
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	c := newClickHouse(ts.URL)
+	c.Deduplicate = true
+	require.NoError(t, c.Init())
+	require.NoError(t, c.Connect())
+
+	err := c.Write(testMetrics())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Too many parts")
+	require.Len(t, s.inserts, 1)
+	token := s.inserts[0].params["insert_deduplication_token"]
+	require.Len(t, token, 64)
+
+	// The retried batch only inserts the rows of the failed table.
+	s.failInsert["`telegraf`.`mem`"] = false
+	require.NoError(t, c.Write(testMetrics()))
+	require.Len(t, s.inserts, 2)
+	require.Equal(t, "INSERT INTO `telegraf`.`mem` FORMAT JSONEachRow", s.inserts[1].query)
+
+	// Once the batch is complete the same rows are written again.
+	require.NoError(t, c.Write(testMetrics()))
+	require.Len(t, s.inserts, 4)
+	require.Equal(t, "INSERT INTO `telegraf`.`cpu` FORMAT JSONEachRow", s.inserts[2].query)
+	require.Equal(t, token, s.inserts[2].params["insert_deduplication_token"])
+}
+
+func TestTableNotCreated(t *testing.T) {
+	s := newStub()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	c := newClickHouse(ts.URL)
+	c.TableCreate = false
+	require.NoError(t, c.Init())
+	require.NoError(t, c.Connect())
+	require.Error(t, c.Write(testMetrics()))
+	require.Empty(t, s.inserts)
+}
+
+func TestInit(t *testing.T) {
+	c := newClickHouse("http://localhost:8123")
+	c.TableMode = "wide"
+	require.Error(t, c.Init())
+
+	c = newClickHouse("http://localhost:8123")
+	c.TableMode = modeGeneric
+	c.Table = ""
+	require.Error(t, c.Init())
+
+	c = newClickHouse("http://localhost:8123")
+	c.ContentEncoding = "br"
+	require.Error(t, c.Init())
+}
@@ -0,0 +1,175 @@
+package clickhouse
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	typeTimestamp = "DateTime64(9, 'UTC')"
+	typeTag       = "LowCardinality(String)"
+)
+
+// column is a column of a table with its ClickHouse type.
+type column struct {
+	name string
+	typ  string
+}
+
+// fieldType returns the type of the column created for a field value.
+func fieldType(value interface{}) string {
+	switch value.(type) {
+	case int64:
+		return "Nullable(Int64)"
+	case uint64:
+		return "Nullable(UInt64)"
+	case float64:
+		return "Nullable(Float64)"
+	case string:
+		return "Nullable(String)"
+	case bool:
+		return "Nullable(UInt8)"
+	}
+	return ""
+}
+
+// baseType strips the Nullable and LowCardinality modifiers from a type.
+func baseType(typ string) string {
+	for _, prefix := range []string{"Nullable(", "LowCardinality("} {
+		for strings.HasPrefix(typ, prefix) && strings.HasSuffix(typ, ")") {
+			typ = typ[len(prefix) : len(typ)-1]
+		}
+	}
+	return typ
+}
+
+// coerce converts a field value to the type of an existing column.  Values
+// that cannot be stored in the column are rejected.
+func coerce(value interface{}, typ string) (interface{}, bool) {
+	base := baseType(typ)
+	switch {
+	case base == "String":
+		switch v := value.(type) {
+		case string:
+			return v, true
+		case int64:
+			return strconv.FormatInt(v, 10), true
+		case uint64:
+			return strconv.FormatUint(v, 10), true
+		case float64:
+			return strconv.FormatFloat(v, 'g', -1, 64), true
+		case bool:
+			return strconv.FormatBool(v), true
+		}
+	case strings.HasPrefix(base, "Int") || strings.HasPrefix(base, "UInt"):
+		switch v := value.(type) {
+		case int64:
+			return v, true
+		case uint64:
+			return v, true
+		case bool:
+			if v {
+				return 1, true
+			}
+			return 0, true
+		}
+	case strings.HasPrefix(base, "Float") || strings.HasPrefix(base, "Decimal"):
+		switch v := value.(type) {
+		case int64:
+			return v, true
+		case uint64:
+			return v, true
+		case float64:
+			return v, true
+		case bool:
+			if v {
+				return 1, true
+			}
+			return 0, true
+		}
+	default:
+		return value, true
+	}
+	return nil, false
+}
+
+// quote returns the identifier quoted for use in a statement.
+func quote(ident string) string {
+	r := strings.NewReplacer("\\", "\\\\", "`", "\\`")
+	return "`" + r.Replace(ident) + "`"
+}
+
+// quoteString returns the string literal for use in a statement.
+func quoteString(s string) string {
+	r := strings.NewReplacer("\\", "\\\\", "'", "\\'")
+	return "'" + r.Replace(s) + "'"
+}
+
+// unescapeTSV reverses the escaping of a value in the TabSeparated format.
+func unescapeTSV(s string) string {
+	r := strings.NewReplacer("\\\\", "\\", "\\t", "\t", "\\n", "\n", "\\'", "'")
+	return r.Replace(s)
+}
+
+// createTable returns the statement creating a table ordered by the tags and
+// the timestamp.
+func (c *ClickHouse) createTable(table string, columns []column, orderBy []string) string {
+	defs := make([]string, 0, len(columns))
+	for _, col := range columns {
+		defs = append(defs, quote(col.name)+" "+col.typ)
+	}
+
+	order := make([]string, 0, len(orderBy))
+	for _, name := range orderBy {
+		order = append(order, quote(name))
+	}
+
+	var b strings.Builder
+	b.WriteString("CREATE TABLE IF NOT EXISTS ")
+	b.WriteString(c.tableName(table))
+	b.WriteString(" (")
+	b.WriteString(strings.Join(defs, ", "))
+	b.WriteString(") ENGINE = ")
+	b.WriteString(c.Engine)
+	if c.PartitionBy != "" {
+		b.WriteString(" PARTITION BY ")
+		b.WriteString(c.PartitionBy)
+	}
+	b.WriteString(" ORDER BY (")
+	b.WriteString(strings.Join(order, ", "))
+	b.WriteString(")")
+	if c.TTL != "" {
+		b.WriteString(" TTL ")
+		b.WriteString(c.TTL)
+	}
+	if c.TableSettings != "" {
+		b.WriteString(" SETTINGS ")
+		b.WriteString(c.TableSettings)
+	}
+	return b.String()
+}
+
+func (c *ClickHouse) addColumn(table string, col column) string {
+	return "ALTER TABLE " + c.tableName(table) + " ADD COLUMN IF NOT EXISTS " +
+		quote(col.name) + " " + col.typ
+}
+
+func (c *ClickHouse) selectColumns(table string) string {
+	return "SELECT name, type FROM system.columns WHERE database = " +
+		quoteString(c.Database) + " AND table = " + quoteString(table) +
+		" FORMAT TabSeparated"
+}
+
+func (c *ClickHouse) tableName(table string) string {
+	return quote(c.Database) + "." + quote(table)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
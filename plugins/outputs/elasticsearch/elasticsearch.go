@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"text/template"
@@ -14,6 +15,7 @@ import (
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/internal"
 	"github.com/influxdata/telegraf/internal/tls"
+	"github.com/influxdata/telegraf/plugins/common/shard"
 	"github.com/influxdata/telegraf/plugins/outputs"
 	"gopkg.in/olivere/elastic.v5"
 )
@@ -32,9 +34,21 @@ type Elasticsearch struct {
 	TemplateName        string
 	OverwriteTemplate   bool
 	MajorReleaseNumber  int
+	BulkMaxBytes        internal.Size `toml:"bulk_max_bytes"`
+	BulkMaxRetries      int           `toml:"bulk_max_retries"`
+	Pipeline            string        `toml:"pipeline"`
+	DataStream          bool          `toml:"data_stream"`
+	ILMPolicyName       string        `toml:"ilm_policy_name"`
+	ILMPolicy           string        `toml:"ilm_policy"`
 	tls.ClientConfig
+	shard.Config
 
 	Client *elastic.Client
+
+	// clients holds one client for each url in the round-robin and
+	// consistent-hash modes.
+	clients []*elastic.Client
+	sharder *shard.Sharder
 }
 
 var sampleConfig = `
@@ -42,6 +56,16 @@ var sampleConfig = `
   ## Multiple urls can be specified as part of the same cluster,
   ## this means that only ONE of the urls will be written to each interval.
   urls = [ "http://node1.es.example.com:9200" ] # required.
+  ## How metrics are distributed across multiple urls:
+  ##   ""                - requests are balanced across the healthy urls
+  ##   "round-robin"     - each batch is written to the next url, the
+  ##                       sniffer is not used in this mode
+  ##   "consistent-hash" - each series is written through a stable url, the
+  ##                       sniffer is not used in this mode
+  # shard_mode = ""
+  ## Tag identifying the series in consistent-hash mode; metrics without the
+  ## tag are sharded by measurement name and tag set.
+  # shard_tag = ""
   ## Elasticsearch client timeout, defaults to "5s" if not set.
   timeout = "5s"
   ## Set to true to ask Elasticsearch a list of all cluster nodes,
@@ -86,30 +110,54 @@ var sampleConfig = `
   template_name = "telegraf"
   ## Set to true if you want telegraf to overwrite an existing template
   overwrite_template = false
+
+  ## Maximum size of a bulk request, larger batches are split into multiple
+  ## requests.  Set to "0B" for no limit.
+  # bulk_max_bytes = "5MB"
+  ## Number of times the documents rejected with a temporary error (429 or
+  ## 5xx) are sent again before the write fails.  Documents rejected with a
+  ## permanent error, such as a mapping conflict, are dropped.
+  # bulk_max_retries = 3
+
+  ## Ingest pipeline the documents are processed with.
+  # pipeline = ""
+
+  ## Write to a data stream named by index_name instead of an index.  Requires
+  ## Elasticsearch 7.9 or later, with manage_template a composable index
+  ## template with data streams enabled is created.
+  # data_stream = false
+
+  ## Index lifecycle management policy applied to the indexes through the
+  ## managed template.  When ilm_policy is set the policy is created if it
+  ## does not exist, or updated if overwrite_template is true.
+  # ilm_policy_name = "telegraf"
+  # ilm_policy = '''
+  # {
+  #   "policy": {
+  #     "phases": {
+  #       "hot": {"actions": {"rollover": {"max_size": "50gb", "max_age": "1d"}}},
+  #       "delete": {"min_age": "30d", "actions": {"delete": {}}}
+  #     }
+  #   }
+  # }
+  # '''
 `
 
 const telegrafTemplate = `
-{
-	{{ if (lt .Version 6) }}
-	"template": "{{.TemplatePattern}}",
-	{{ else }}
-	"index_patterns" : [ "{{.TemplatePattern}}" ],
-	{{ end }}
+{{ define "settings" }}
 	"settings": {
 		"index": {
+			{{ if .ILMPolicyName }}
+			"lifecycle.name": "{{.ILMPolicyName}}",
+			{{ end }}
 			"refresh_interval": "10s",
 			"mapping.total_fields.limit": 5000,
 			"auto_expand_replicas" : "0-1",
 			"codec" : "best_compression"
 		}
-	},
-	"mappings" : {
-		{{ if (lt .Version 7) }}
-		"metrics" : {
-			{{ if (lt .Version 6) }}
-			"_all": { "enabled": false },
-			{{ end }}
-		{{ end }}
+	}
+{{ end }}
+{{ define "properties" }}
 		"properties" : {
 			"@timestamp" : { "type" : "date" },
 			"measurement_name" : { "type" : "keyword" }
@@ -152,15 +200,45 @@ const telegrafTemplate = `
 				}
 			}
 		]
+{{ end }}
+{
+	{{ if .DataStream }}
+	"index_patterns" : [ "{{.TemplatePattern}}" ],
+	"data_stream": {},
+	"priority": 200,
+	"template": {
+		{{ template "settings" . }},
+		"mappings" : {
+			{{ template "properties" . }}
+		}
+	}
+	{{ else }}
+	{{ if (lt .Version 6) }}
+	"template": "{{.TemplatePattern}}",
+	{{ else }}
+	"index_patterns" : [ "{{.TemplatePattern}}" ],
+	{{ end }}
+	{{ template "settings" . }},
+	"mappings" : {
+		{{ if (lt .Version 7) }}
+		"metrics" : {
+			{{ if (lt .Version 6) }}
+			"_all": { "enabled": false },
+			{{ end }}
+		{{ end }}
+		{{ template "properties" . }}
 		{{ if (lt .Version 7) }}
 		}
 		{{ end }}
 	}
+	{{ end }}
 }`
 
 type templatePart struct {
 	TemplatePattern string
 	Version         int
+	DataStream      bool
+	ILMPolicyName   string
 }
 
 func (a *Elasticsearch) Connect() error {
@@ -171,47 +249,28 @@ func (a *Elasticsearch) Connect() error {
 	ctx, cancel := context.WithTimeout(context.Background(), a.Timeout.Duration)
 	defer cancel()
 
-	var clientOptions []elastic.ClientOptionFunc
-
-	tlsCfg, err := a.ClientConfig.TLSConfig()
+	sharder, err := a.Config.NewSharder(a.URLs)
 	if err != nil {
 		return err
 	}
-	tr := &http.Transport{
-		TLSClientConfig: tlsCfg,
-	}
-
-	httpclient := &http.Client{
-		Transport: tr,
-		Timeout:   a.Timeout.Duration,
-	}
-
-	clientOptions = append(clientOptions,
-		elastic.SetHttpClient(httpclient),
-		elastic.SetSniff(a.EnableSniffer),
-		elastic.SetURL(a.URLs...),
-		elastic.SetHealthcheckInterval(a.HealthCheckInterval.Duration),
-	)
-
-	if a.Username != "" && a.Password != "" {
-		clientOptions = append(clientOptions,
-			elastic.SetBasicAuth(a.Username, a.Password),
-		)
-	}
-
-	if a.HealthCheckInterval.Duration == 0 {
-		clientOptions = append(clientOptions,
-			elastic.SetHealthcheck(false),
-		)
-		log.Printf("D! Elasticsearch output: disabling health check")
-	}
-
-	client, err := elastic.NewClient(clientOptions...)
+	a.sharder = sharder
 
+	client, err := a.newClient(a.URLs, a.EnableSniffer)
 	if err != nil {
 		return err
 	}
 
+	a.clients = nil
+	if sharder.Mode() != shard.ModeFailover {
+		for _, u := range a.URLs {
+			c, err := a.newClient([]string{u}, false)
+			if err != nil {
+				return err
+			}
+			a.clients = append(a.clients, c)
+		}
+	}
+
 	// check for ES version on first node
 	esVersion, err := client.ElasticsearchVersion(a.URLs[0])
 
@@ -220,16 +279,27 @@ func (a *Elasticsearch) Connect() error {
 	}
 
 	// quit if ES version is not supported
-	majorReleaseNumber, err := strconv.Atoi(strings.Split(esVersion, ".")[0])
+	majorReleaseNumber, minorReleaseNumber, err := parseVersion(esVersion)
 	if err != nil || majorReleaseNumber < 5 {
 		return fmt.Errorf("Elasticsearch version not supported: %s", esVersion)
 	}
 
 	log.Println("I! Elasticsearch version: " + esVersion)
 
+	if a.DataStream && (majorReleaseNumber < 7 || majorReleaseNumber == 7 && minorReleaseNumber < 9) {
+		return fmt.Errorf("Elasticsearch data streams require version 7.9 or later, found: %s", esVersion)
+	}
+
 	a.Client = client
 	a.MajorReleaseNumber = majorReleaseNumber
 
+	if a.ILMPolicy != "" {
+		err := a.manageILMPolicy(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
 	if a.ManageTemplate {
 		err := a.manageTemplate(ctx)
 		if err != nil {
@@ -242,14 +312,121 @@ func (a *Elasticsearch) Connect() error {
 	return nil
 }
 
+// parseVersion returns the major and minor release numbers of a version such
+// as "7.10.2".
+func parseVersion(version string) (int, int, error) {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return 0, 0, fmt.Errorf("invalid version %q", version)
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	return major, minor, nil
+}
+
+func (a *Elasticsearch) newClient(urls []string, sniff bool) (*elastic.Client, error) {
+	var clientOptions []elastic.ClientOptionFunc
+
+	tlsCfg, err := a.ClientConfig.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	tr := &http.Transport{
+		TLSClientConfig: tlsCfg,
+	}
+
+	httpclient := &http.Client{
+		Transport: tr,
+		Timeout:   a.Timeout.Duration,
+	}
+
+	clientOptions = append(clientOptions,
+		elastic.SetHttpClient(httpclient),
+		elastic.SetSniff(sniff),
+		elastic.SetURL(urls...),
+		elastic.SetHealthcheckInterval(a.HealthCheckInterval.Duration),
+	)
+
+	if a.Username != "" && a.Password != "" {
+		clientOptions = append(clientOptions,
+			elastic.SetBasicAuth(a.Username, a.Password),
+		)
+	}
+
+	if a.HealthCheckInterval.Duration == 0 {
+		clientOptions = append(clientOptions,
+			elastic.SetHealthcheck(false),
+		)
+		log.Printf("D! Elasticsearch output: disabling health check")
+	}
+
+	return elastic.NewClient(clientOptions...)
+}
+
 func (a *Elasticsearch) Write(metrics []telegraf.Metric) error {
 	if len(metrics) == 0 {
 		return nil
 	}
 
-	bulkRequest := a.Client.Bulk()
+	switch a.sharder.Mode() {
+	case shard.ModeRoundRobin:
+		// The metrics that could not be written through a url are sent to
+		// the next one.
+		failed := metrics
+		var err error
+		for _, n := range a.sharder.Order() {
+			failed, err = a.write(a.clients[n], failed)
+			if err == nil {
+				return nil
+			}
+			log.Printf("E! Elasticsearch write to %s failed: %v", a.URLs[n], err)
+		}
+		return writeError(err, metrics, failed)
+	case shard.ModeConsistentHash:
+		// Each series is written through its own url.
+		var failed []telegraf.Metric
+		var firstErr error
+		for n, part := range a.sharder.Partition(metrics) {
+			if len(part) == 0 {
+				continue
+			}
+			f, err := a.write(a.clients[n], part)
+			if err != nil {
+				failed = append(failed, f...)
+				if firstErr == nil {
+					firstErr = err
+				}
+			}
+		}
+		return writeError(firstErr, metrics, failed)
+	}
+
+	failed, err := a.write(a.Client, metrics)
+	return writeError(err, metrics, failed)
+}
+
+// writeError returns the error of a write, as a partial write error when
+// some of the metrics were written so that they are not sent again.
+func writeError(err error, metrics []telegraf.Metric, failed []telegraf.Metric) error {
+	if err == nil || len(failed) == len(metrics) {
+		return err
+	}
+	return &telegraf.PartialWriteError{Err: err, Failed: failed}
+}
 
-	for _, metric := range metrics {
+// write sends the metrics in bulk requests, on error it returns the metrics
+// that were not written.
+func (a *Elasticsearch) write(client *elastic.Client, metrics []telegraf.Metric) ([]telegraf.Metric, error) {
+	var requests []elastic.BulkableRequest
+	var pending []telegraf.Metric
+	var size int64
+	for i, metric := range metrics {
 		var name = metric.Name()
 
 		// index name has to be re-evaluated each time for telegraf
@@ -265,32 +442,146 @@ func (a *Elasticsearch) Write(metrics []telegraf.Metric) error {
 
 		br := elastic.NewBulkIndexRequest().Index(indexName).Doc(m)
 
-		if a.MajorReleaseNumber <= 6 {
+		if a.DataStream {
+			br.OpType("create")
+		} else if a.MajorReleaseNumber <= 6 {
 			br.Type("metrics")
 		}
 
-		bulkRequest.Add(br)
+		// Send the pending requests before the bulk request grows larger
+		// than the limit.
+		requestSize := bulkRequestSize(br)
+		if a.BulkMaxBytes.Size > 0 && len(requests) > 0 && size+requestSize > a.BulkMaxBytes.Size {
+			if failed, err := a.bulk(client, requests, pending); err != nil {
+				return append(failed, metrics[i:]...), err
+			}
+			requests = nil
+			pending = nil
+			size = 0
+		}
 
+		requests = append(requests, br)
+		pending = append(pending, metric)
+		size += requestSize
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), a.Timeout.Duration)
-	defer cancel()
-
-	res, err := bulkRequest.Do(ctx)
+	if len(requests) == 0 {
+		return nil, nil
+	}
+	return a.bulk(client, requests, pending)
+}
 
+// bulkRequestSize returns the size of the request in the bulk body.
+func bulkRequestSize(r elastic.BulkableRequest) int64 {
+	lines, err := r.Source()
 	if err != nil {
-		return fmt.Errorf("Error sending bulk request to Elasticsearch: %s", err)
+		return 0
 	}
 
-	if res.Errors {
-		for id, err := range res.Failed() {
-			log.Printf("E! Elasticsearch indexing failure, id: %d, error: %s, caused by: %s, %s", id, err.Error.Reason, err.Error.CausedBy["reason"], err.Error.CausedBy["type"])
+	var size int64
+	for _, line := range lines {
+		size += int64(len(line)) + 1
+	}
+	return size
+}
+
+// bulk sends the requests of the metrics, the documents rejected with a
+// temporary error are sent again up to bulk_max_retries times.  On error it
+// returns the metrics that were not written.
+func (a *Elasticsearch) bulk(client *elastic.Client, requests []elastic.BulkableRequest, metrics []telegraf.Metric) ([]telegraf.Metric, error) {
+	for attempt := 0; ; attempt++ {
+		bulkRequest := client.Bulk().Add(requests...)
+		if a.Pipeline != "" {
+			bulkRequest.Pipeline(a.Pipeline)
 		}
-		return fmt.Errorf("W! Elasticsearch failed to index %d metrics", len(res.Failed()))
+
+		ctx, cancel := context.WithTimeout(context.Background(), a.Timeout.Duration)
+		res, err := bulkRequest.Do(ctx)
+		cancel()
+
+		if err != nil {
+			return metrics, fmt.Errorf("Error sending bulk request to Elasticsearch: %s", err)
+		}
+
+		if !res.Errors {
+			return nil, nil
+		}
+
+		var retry []elastic.BulkableRequest
+		var retryMetrics []telegraf.Metric
+		var dropped int
+		for i, item := range res.Items {
+			for _, result := range item {
+				if result.Status >= 200 && result.Status <= 299 {
+					continue
+				}
+
+				if result.Status == http.StatusTooManyRequests || result.Status >= 500 {
+					retry = append(retry, requests[i])
+					retryMetrics = append(retryMetrics, metrics[i])
+					continue
+				}
+
+				dropped++
+				if result.Error != nil {
+					log.Printf("E! Elasticsearch indexing failure, id: %d, error: %s, caused by: %s, %s", i, result.Error.Reason, result.Error.CausedBy["reason"], result.Error.CausedBy["type"])
+				}
+			}
+		}
+
+		if dropped > 0 {
+			log.Printf("E! Elasticsearch dropped %d metrics rejected with a permanent error", dropped)
+		}
+
+		if len(retry) == 0 {
+			return nil, nil
+		}
+
+		if attempt >= a.BulkMaxRetries {
+			return retryMetrics, fmt.Errorf("Elasticsearch failed to index %d metrics", len(retry))
+		}
+
+		log.Printf("D! Elasticsearch retrying %d rejected metrics", len(retry))
+		time.Sleep(retryBackoff(attempt))
+		requests = retry
+		metrics = retryMetrics
 	}
+}
 
-	return nil
+// retryBackoff returns the time to wait before sending the rejected
+// documents again.
+func retryBackoff(attempt int) time.Duration {
+	backoff := 100 * time.Millisecond << uint(attempt)
+	if backoff > 5*time.Second {
+		backoff = 5 * time.Second
+	}
+	return backoff
+}
+
+func (a *Elasticsearch) manageILMPolicy(ctx context.Context) error {
+	if a.ILMPolicyName == "" {
+		return fmt.Errorf("Elasticsearch ilm_policy_name configuration not defined")
+	}
+
+	path := "/_ilm/policy/" + url.PathEscape(a.ILMPolicyName)
+	if !a.OverwriteTemplate {
+		res, err := a.Client.PerformRequest(ctx, "GET", path, nil, nil, http.StatusNotFound)
+		if err != nil {
+			return fmt.Errorf("Elasticsearch ILM policy check failed, policy name: %s, error: %s", a.ILMPolicyName, err)
+		}
+		if res.StatusCode == http.StatusOK {
+			log.Println("D! Found existing Elasticsearch ILM policy. Skipping policy management")
+			return nil
+		}
+	}
+
+	_, err := a.Client.PerformRequest(ctx, "PUT", path, nil, a.ILMPolicy)
+	if err != nil {
+		return fmt.Errorf("Elasticsearch failed to create ILM policy %s : %s", a.ILMPolicyName, err)
+	}
 
+	log.Printf("D! Elasticsearch ILM policy %s created or updated\n", a.ILMPolicyName)
+	return nil
 }
 
 func (a *Elasticsearch) manageTemplate(ctx context.Context) error {
@@ -298,7 +589,7 @@ func (a *Elasticsearch) manageTemplate(ctx context.Context) error {
 		return fmt.Errorf("Elasticsearch template_name configuration not defined")
 	}
 
-	templateExists, errExists := a.Client.IndexTemplateExists(a.TemplateName).Do(ctx)
+	templateExists, errExists := a.templateExists(ctx)
 
 	if errExists != nil {
 		return fmt.Errorf("Elasticsearch template check failed, template name: %s, error: %s", a.TemplateName, errExists)
@@ -322,13 +613,20 @@ func (a *Elasticsearch) manageTemplate(ctx context.Context) error {
 		tp := templatePart{
 			TemplatePattern: templatePattern + "*",
 			Version:         a.MajorReleaseNumber,
+			DataStream:      a.DataStream,
+			ILMPolicyName:   a.ILMPolicyName,
 		}
 
 		t := template.Must(template.New("template").Parse(telegrafTemplate))
 		var tmpl bytes.Buffer
 
 		t.Execute(&tmpl, tp)
-		_, errCreateTemplate := a.Client.IndexPutTemplate(a.TemplateName).BodyString(tmpl.String()).Do(ctx)
+		var errCreateTemplate error
+		if a.DataStream {
+			_, errCreateTemplate = a.Client.PerformRequest(ctx, "PUT", a.indexTemplatePath(), nil, tmpl.String())
+		} else {
+			_, errCreateTemplate = a.Client.IndexPutTemplate(a.TemplateName).BodyString(tmpl.String()).Do(ctx)
+		}
 
 		if errCreateTemplate != nil {
 			return fmt.Errorf("Elasticsearch failed to create index template %s : %s", a.TemplateName, errCreateTemplate)
@@ -344,6 +642,24 @@ func (a *Elasticsearch) manageTemplate(ctx context.Context) error {
 	return nil
 }
 
+// templateExists checks for the legacy index template, or the composable
+// index template when writing to data streams.
+func (a *Elasticsearch) templateExists(ctx context.Context) (bool, error) {
+	if !a.DataStream {
+		return a.Client.IndexTemplateExists(a.TemplateName).Do(ctx)
+	}
+
+	res, err := a.Client.PerformRequest(ctx, "GET", a.indexTemplatePath(), nil, nil, http.StatusNotFound)
+	if err != nil {
+		return false, err
+	}
+	return res.StatusCode == http.StatusOK, nil
+}
+
+func (a *Elasticsearch) indexTemplatePath() string {
+	return "/_index_template/" + url.PathEscape(a.TemplateName)
+}
+
 func (a *Elasticsearch) GetTagKeys(indexName string) (string, []string) {
 
 	tagKeys := []string{}
@@ -416,6 +732,10 @@ func (a *Elasticsearch) Description() string {
 
 func (a *Elasticsearch) Close() error {
 	a.Client = nil
+	for _, client := range a.clients {
+		client.Stop()
+	}
+	a.clients = nil
 	return nil
 }
 
@@ -424,6 +744,8 @@ func init() {
 		return &Elasticsearch{
 			Timeout:             internal.Duration{Duration: time.Second * 5},
 			HealthCheckInterval: internal.Duration{Duration: time.Second * 10},
+			BulkMaxBytes:        internal.Size{Size: 5 * 1024 * 1024},
+			BulkMaxRetries:      3,
 		}
 	})
 }
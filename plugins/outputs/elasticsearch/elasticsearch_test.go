@@ -1,11 +1,22 @@
 package elasticsearch
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"text/template"
 	"time"
 
+	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/internal"
 	"github.com/influxdata/telegraf/testutil"
 	"github.com/stretchr/testify/require"
@@ -257,3 +268,321 @@ func TestGetIndexName(t *testing.T) {
 		}
 	}
 }
+
+// esStub emulates the Elasticsearch API endpoints used by the output.
+type esStub struct {
+	sync.Mutex
+	bulks     [][]map[string]interface{}
+	params    []url.Values
+	templates map[string]string
+	policies  map[string]string
+	// version is the reported version, defaults to 7.10.0
+	version string
+	// statuses returns the status of each document in a bulk request
+	statuses func(call int, n int) []int
+}
+
+func (s *esStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	body, _ := ioutil.ReadAll(r.Body)
+	switch {
+	case r.URL.Path == "/":
+		version := s.version
+		if version == "" {
+			version = "7.10.0"
+		}
+		fmt.Fprintf(w, `{"version": {"number": %q}}`, version)
+	case r.URL.Path == "/_bulk":
+		var actions []map[string]interface{}
+		lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+		for i := 0; i < len(lines); i += 2 {
+			var action map[string]interface{}
+			json.Unmarshal([]byte(lines[i]), &action)
+			actions = append(actions, action)
+		}
+		s.bulks = append(s.bulks, actions)
+		s.params = append(s.params, r.URL.Query())
+
+		statuses := make([]int, len(actions))
+		for i := range statuses {
+			statuses[i] = http.StatusCreated
+		}
+		if s.statuses != nil {
+			statuses = s.statuses(len(s.bulks)-1, len(actions))
+		}
+
+		var items []string
+		errors := false
+		for _, status := range statuses {
+			if status >= 300 {
+				errors = true
+				items = append(items, fmt.Sprintf(`{"index": {"status": %d, "error": {"type": "error", "reason": "rejected"}}}`, status))
+			} else {
+				items = append(items, fmt.Sprintf(`{"index": {"status": %d}}`, status))
+			}
+		}
+		fmt.Fprintf(w, `{"took": 1, "errors": %v, "items": [%s]}`, errors, strings.Join(items, ","))
+	case strings.HasPrefix(r.URL.Path, "/_index_template/"):
+		s.handleObject(w, r, s.templates, "/_index_template/", string(body))
+	case strings.HasPrefix(r.URL.Path, "/_ilm/policy/"):
+		s.handleObject(w, r, s.policies, "/_ilm/policy/", string(body))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *esStub) handleObject(w http.ResponseWriter, r *http.Request, objects map[string]string, prefix, body string) {
+	name := strings.TrimPrefix(r.URL.Path, prefix)
+	switch r.Method {
+	case "GET":
+		if _, ok := objects[name]; !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "{}")
+	case "PUT":
+		objects[name] = body
+		fmt.Fprint(w, `{"acknowledged": true}`)
+	}
+}
+
+func newStubOutput(stub *esStub) (*Elasticsearch, func()) {
+	server := httptest.NewServer(stub)
+	e := &Elasticsearch{
+		URLs:           []string{server.URL},
+		IndexName:      "telegraf-%Y.%m.%d",
+		Timeout:        internal.Duration{Duration: time.Second * 5},
+		BulkMaxRetries: 3,
+	}
+	return e, server.Close
+}
+
+func TestBulkRetriesFailedItems(t *testing.T) {
+	stub := &esStub{
+		statuses: func(call int, n int) []int {
+			if call == 0 {
+				return []int{http.StatusCreated, http.StatusTooManyRequests, http.StatusBadRequest}
+			}
+			return []int{http.StatusCreated}
+		},
+	}
+	e, closer := newStubOutput(stub)
+	defer closer()
+	e.Pipeline = "telegraf-pipeline"
+	require.NoError(t, e.Connect())
+
+	metrics := testutil.MockMetrics()
+	metrics = append(metrics, testutil.TestMetric(2.0), testutil.TestMetric(3.0))
+	require.NoError(t, e.Write(metrics))
+
+	require.Len(t, stub.bulks, 2)
+	require.Len(t, stub.bulks[0], 3)
+	// Only the document rejected with a temporary error is sent again.
+	require.Len(t, stub.bulks[1], 1)
+	require.Equal(t, "telegraf-pipeline", stub.params[1].Get("pipeline"))
+}
+
+func TestBulkRetriesExhausted(t *testing.T) {
+	stub := &esStub{
+		statuses: func(call int, n int) []int {
+			return []int{http.StatusServiceUnavailable}
+		},
+	}
+	e, closer := newStubOutput(stub)
+	defer closer()
+	e.BulkMaxRetries = 1
+	require.NoError(t, e.Connect())
+
+	require.Error(t, e.Write(testutil.MockMetrics()))
+	require.Len(t, stub.bulks, 2)
+}
+
+func TestBulkRetriesExhaustedPartialWrite(t *testing.T) {
+	stub := &esStub{
+		statuses: func(call int, n int) []int {
+			return []int{http.StatusCreated, http.StatusServiceUnavailable}
+		},
+	}
+	e, closer := newStubOutput(stub)
+	defer closer()
+	e.BulkMaxRetries = 0
+	require.NoError(t, e.Connect())
+
+	metrics := []telegraf.Metric{testutil.TestMetric(1), testutil.TestMetric(2)}
+	err := e.Write(metrics)
+	require.Error(t, err)
+	partial, ok := err.(*telegraf.PartialWriteError)
+	require.True(t, ok, "expected partial write error")
+	require.Equal(t, metrics[1:], partial.Failed)
+}
+
+// failingStub rejects all documents with a temporary error.
+func failingStub() *esStub {
+	return &esStub{
+		statuses: func(call int, n int) []int {
+			statuses := make([]int, n)
+			for i := range statuses {
+				statuses[i] = http.StatusServiceUnavailable
+			}
+			return statuses
+		},
+	}
+}
+
+func TestConsistentHashPartialWrite(t *testing.T) {
+	good := &esStub{}
+	bad := failingStub()
+	e, closeGood := newStubOutput(good)
+	defer closeGood()
+	badServer := httptest.NewServer(bad)
+	defer badServer.Close()
+	e.URLs = append(e.URLs, badServer.URL)
+	e.ShardMode = "consistent-hash"
+	e.BulkMaxRetries = 0
+	require.NoError(t, e.Connect())
+
+	var metrics []telegraf.Metric
+	for i := 0; i < 20; i++ {
+		metrics = append(metrics, testutil.TestMetric(i, fmt.Sprintf("metric%d", i)))
+	}
+	err := e.Write(metrics)
+	require.Error(t, err)
+	partial, ok := err.(*telegraf.PartialWriteError)
+	require.True(t, ok, "expected partial write error")
+
+	// Only the series of the failing url are retried.
+	require.Len(t, good.bulks, 1)
+	require.Len(t, bad.bulks, 1)
+	require.Len(t, partial.Failed, len(bad.bulks[0]))
+	require.Equal(t, len(metrics), len(good.bulks[0])+len(partial.Failed))
+	for _, m := range partial.Failed {
+		require.Equal(t, 1, e.sharder.Endpoint(m))
+	}
+}
+
+func TestRoundRobinFailover(t *testing.T) {
+	bad := failingStub()
+	good := &esStub{}
+	e, closeBad := newStubOutput(bad)
+	defer closeBad()
+	goodServer := httptest.NewServer(good)
+	defer goodServer.Close()
+	e.URLs = append(e.URLs, goodServer.URL)
+	e.ShardMode = "round-robin"
+	e.BulkMaxRetries = 0
+	require.NoError(t, e.Connect())
+
+	metrics := []telegraf.Metric{testutil.TestMetric(1), testutil.TestMetric(2)}
+	for i := 0; i < 2; i++ {
+		require.NoError(t, e.Write(metrics))
+	}
+
+	// Each batch starts on the next url, the batch rejected by the failing
+	// url is sent to the other one.
+	require.Len(t, bad.bulks, 1)
+	require.Len(t, good.bulks, 2)
+}
+
+func TestBulkMaxBytes(t *testing.T) {
+	stub := &esStub{}
+	e, closer := newStubOutput(stub)
+	defer closer()
+	e.BulkMaxBytes = internal.Size{Size: 300}
+	require.NoError(t, e.Connect())
+
+	var metrics []telegraf.Metric
+	for i := 0; i < 10; i++ {
+		metrics = append(metrics, testutil.TestMetric(i))
+	}
+	require.NoError(t, e.Write(metrics))
+
+	require.True(t, len(stub.bulks) > 1, "expected the batch to be split")
+	var count int
+	for _, bulk := range stub.bulks {
+		count += len(bulk)
+	}
+	require.Equal(t, len(metrics), count)
+}
+
+func TestDataStream(t *testing.T) {
+	stub := &esStub{
+		templates: make(map[string]string),
+		policies:  make(map[string]string),
+	}
+	e, closer := newStubOutput(stub)
+	defer closer()
+	e.IndexName = "metrics-telegraf"
+	e.DataStream = true
+	e.ManageTemplate = true
+	e.TemplateName = "telegraf"
+	e.ILMPolicyName = "telegraf"
+	e.ILMPolicy = `{"policy": {"phases": {"delete": {"min_age": "30d", "actions": {"delete": {}}}}}}`
+	require.NoError(t, e.Connect())
+
+	require.Equal(t, e.ILMPolicy, stub.policies["telegraf"])
+
+	var tmpl map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(stub.templates["telegraf"]), &tmpl))
+	require.Equal(t, []interface{}{"metrics-telegraf*"}, tmpl["index_patterns"])
+	require.Equal(t, map[string]interface{}{}, tmpl["data_stream"])
+	settings := tmpl["template"].(map[string]interface{})["settings"].(map[string]interface{})
+	require.Equal(t, "telegraf", settings["index"].(map[string]interface{})["lifecycle.name"])
+
+	require.NoError(t, e.Write(testutil.MockMetrics()))
+	require.Len(t, stub.bulks, 1)
+	create, ok := stub.bulks[0][0]["create"].(map[string]interface{})
+	require.True(t, ok, "expected create action")
+	require.Equal(t, "metrics-telegraf", create["_index"])
+}
+
+func TestDataStreamVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		ok      bool
+	}{
+		{"6.8.13", false},
+		{"7.0.0", false},
+		{"7.8.1", false},
+		{"7.9.0", true},
+		{"7.10.2", true},
+		{"8.0.0", true},
+	}
+	for _, tt := range tests {
+		stub := &esStub{version: tt.version}
+		e, closer := newStubOutput(stub)
+		e.IndexName = "metrics-telegraf"
+		e.DataStream = true
+		err := e.Connect()
+		closer()
+		if tt.ok {
+			require.NoError(t, err, tt.version)
+		} else {
+			require.Error(t, err, tt.version)
+		}
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	major, minor, err := parseVersion("7.10.2-SNAPSHOT")
+	require.NoError(t, err)
+	require.Equal(t, 7, major)
+	require.Equal(t, 10, minor)
+
+	_, _, err = parseVersion("7")
+	require.Error(t, err)
+}
+
+func TestLegacyTemplateIsValidJSON(t *testing.T) {
+	for _, version := range []int{5, 6, 7} {
+		tp := templatePart{TemplatePattern: "telegraf-*", Version: version, ILMPolicyName: "telegraf"}
+		var buf bytes.Buffer
+		require.NoError(t, template.Must(template.New("template").Parse(telegrafTemplate)).Execute(&buf, tp))
+
+		var tmpl map[string]interface{}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &tmpl), "version %d", version)
+		require.Contains(t, tmpl, "mappings")
+		require.Contains(t, tmpl, "settings")
+	}
+}
@@ -3,14 +3,15 @@ package graphite
 import (
 	"crypto/tls"
 	"errors"
+	"fmt"
 	"io"
 	"log"
-	"math/rand"
 	"net"
 	"time"
 
 	"github.com/influxdata/telegraf"
 	tlsint "github.com/influxdata/telegraf/internal/tls"
+	"github.com/influxdata/telegraf/plugins/common/shard"
 	"github.com/influxdata/telegraf/plugins/outputs"
 	"github.com/influxdata/telegraf/plugins/serializers"
 )
@@ -23,7 +24,9 @@ type Graphite struct {
 	Template string
 	Timeout  int
 	conns    []net.Conn
+	sharder  *shard.Sharder
 	tlsint.ClientConfig
+	shard.Config
 }
 
 var sampleConfig = `
@@ -31,6 +34,15 @@ var sampleConfig = `
   ## If multiple endpoints are configured, output will be load balanced.
   ## Only one of the endpoints will be written to with each iteration.
   servers = ["localhost:2003"]
+
+  ## How metrics are distributed across multiple servers:
+  ##   ""                - write to a random server, fail over to the others
+  ##   "round-robin"     - write to the next server, fail over to the others
+  ##   "consistent-hash" - write each series to a stable server
+  # shard_mode = ""
+  ## Tag identifying the series in consistent-hash mode; metrics without the
+  ## tag are sharded by measurement name and tag set.
+  # shard_tag = ""
   ## Prefix metrics name
   prefix = ""
   ## Graphite output template
@@ -60,38 +72,49 @@ func (g *Graphite) Connect() error {
 		g.Servers = append(g.Servers, "localhost:2003")
 	}
 
+	if g.sharder == nil {
+		sharder, err := g.Config.NewSharder(g.Servers)
+		if err != nil {
+			return err
+		}
+		g.sharder = sharder
+	}
+
 	// Set tls config
 	tlsConfig, err := g.ClientConfig.TLSConfig()
 	if err != nil {
 		return err
 	}
 
-	// Get Connections
-	var conns []net.Conn
-	for _, server := range g.Servers {
-		// Dialer with timeout
-		d := net.Dialer{Timeout: time.Duration(g.Timeout) * time.Second}
-
-		// Get secure connection if tls config is set
-		var conn net.Conn
-		if tlsConfig != nil {
-			conn, err = tls.DialWithDialer(&d, "tcp", server, tlsConfig)
-		} else {
-			conn, err = d.Dial("tcp", server)
-		}
-
+	// Get Connections, servers that cannot be reached are left out until
+	// the next reconnect.
+	g.conns = make([]net.Conn, len(g.Servers))
+	for n, server := range g.Servers {
+		conn, err := g.dial(server, tlsConfig)
 		if err == nil {
-			conns = append(conns, conn)
+			g.conns[n] = conn
 		}
 	}
-	g.conns = conns
 	return nil
 }
 
+func (g *Graphite) dial(server string, tlsConfig *tls.Config) (net.Conn, error) {
+	// Dialer with timeout
+	d := net.Dialer{Timeout: time.Duration(g.Timeout) * time.Second}
+
+	// Get secure connection if tls config is set
+	if tlsConfig != nil {
+		return tls.DialWithDialer(&d, "tcp", server, tlsConfig)
+	}
+	return d.Dial("tcp", server)
+}
+
 func (g *Graphite) Close() error {
 	// Closing all connections
 	for _, conn := range g.conns {
-		conn.Close()
+		if conn != nil {
+			conn.Close()
+		}
 	}
 	return nil
 }
@@ -129,29 +152,27 @@ func checkEOF(conn net.Conn) {
 	}
 }
 
-// Choose a random server in the cluster to write to until a successful write
+// Choose a server in the cluster to write to until a successful write
 // occurs, logging each unsuccessful. If all servers fail, return error.
+// In consistent-hash mode each series is written to its own server.
 func (g *Graphite) Write(metrics []telegraf.Metric) error {
 	// Prepare data
-	var batch []byte
 	s, err := serializers.NewGraphiteSerializer(g.Prefix, g.Template, g.GraphiteTagSupport)
 	if err != nil {
 		return err
 	}
 
-	for _, metric := range metrics {
-		buf, err := s.Serialize(metric)
-		if err != nil {
-			log.Printf("E! Error serializing some metrics to graphite: %s", err.Error())
-		}
-		batch = append(batch, buf...)
+	if g.sharder.Mode() == shard.ModeConsistentHash {
+		return g.writeSharded(s, metrics)
 	}
 
+	batch := serialize(s, metrics)
 	err = g.send(batch)
 
 	// try to reconnect and retry to send
 	if err != nil {
 		log.Println("E! Graphite: Reconnecting and retrying: ")
+		g.Close()
 		g.Connect()
 		err = g.send(batch)
 	}
@@ -159,31 +180,93 @@ func (g *Graphite) Write(metrics []telegraf.Metric) error {
 	return err
 }
 
-func (g *Graphite) send(batch []byte) error {
-	// This will get set to nil if a successful write occurs
-	err := errors.New("Could not write to any Graphite server in cluster\n")
-
-	// Send data to a random server
-	p := rand.Perm(len(g.conns))
-	for _, n := range p {
-		if g.Timeout > 0 {
-			g.conns[n].SetWriteDeadline(time.Now().Add(time.Duration(g.Timeout) * time.Second))
+func (g *Graphite) writeSharded(s serializers.Serializer, metrics []telegraf.Metric) error {
+	var firstErr error
+	for n, part := range g.sharder.Partition(metrics) {
+		if len(part) == 0 {
+			continue
 		}
-		checkEOF(g.conns[n])
-		if _, e := g.conns[n].Write(batch); e != nil {
-			// Error
-			log.Println("E! Graphite Error: " + e.Error())
-			// Close explicitly
-			g.conns[n].Close()
-			// Let's try the next one
-		} else {
+
+		batch := serialize(s, part)
+		err := g.sendTo(n, batch)
+
+		// try to reconnect and retry to send
+		if err != nil {
+			log.Printf("E! Graphite: Reconnecting to %s and retrying", g.Servers[n])
+			if err := g.reconnect(n); err != nil {
+				return err
+			}
+			err = g.sendTo(n, batch)
+		}
+
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// reconnect replaces the connection to the server.
+func (g *Graphite) reconnect(n int) error {
+	if g.conns[n] != nil {
+		g.conns[n].Close()
+		g.conns[n] = nil
+	}
+
+	tlsConfig, err := g.ClientConfig.TLSConfig()
+	if err != nil {
+		return err
+	}
+	conn, err := g.dial(g.Servers[n], tlsConfig)
+	if err == nil {
+		g.conns[n] = conn
+	}
+	return nil
+}
+
+func serialize(s serializers.Serializer, metrics []telegraf.Metric) []byte {
+	var batch []byte
+	for _, metric := range metrics {
+		buf, err := s.Serialize(metric)
+		if err != nil {
+			log.Printf("E! Error serializing some metrics to graphite: %s", err.Error())
+		}
+		batch = append(batch, buf...)
+	}
+	return batch
+}
+
+func (g *Graphite) send(batch []byte) error {
+	// Send data to the servers in the order of the shard mode
+	for _, n := range g.sharder.Order() {
+		if g.sendTo(n, batch) == nil {
 			// Success
-			err = nil
-			break
+			return nil
 		}
+		// Let's try the next one
 	}
 
-	return err
+	return errors.New("Could not write to any Graphite server in cluster\n")
+}
+
+func (g *Graphite) sendTo(n int, batch []byte) error {
+	conn := g.conns[n]
+	if conn == nil {
+		return fmt.Errorf("not connected to Graphite server %s", g.Servers[n])
+	}
+
+	if g.Timeout > 0 {
+		conn.SetWriteDeadline(time.Now().Add(time.Duration(g.Timeout) * time.Second))
+	}
+	checkEOF(conn)
+	if _, e := conn.Write(batch); e != nil {
+		// Error
+		log.Println("E! Graphite Error: " + e.Error())
+		// Close explicitly
+		conn.Close()
+		return e
+	}
+	return nil
 }
 
 func init() {
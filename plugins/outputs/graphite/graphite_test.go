@@ -2,6 +2,7 @@ package graphite
 
 import (
 	"bufio"
+	"fmt"
 	"net"
 	"net/textproto"
 	"sync"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/plugins/common/shard"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -217,3 +219,58 @@ func TCPServer2WithTags(t *testing.T, wg *sync.WaitGroup) {
 		tcpServer.Close()
 	}()
 }
+
+func TestGraphiteConsistentHash(t *testing.T) {
+	var listeners []net.Listener
+	var servers []string
+	for i := 0; i < 2; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer l.Close()
+		listeners = append(listeners, l)
+		servers = append(servers, l.Addr().String())
+	}
+
+	g := Graphite{
+		Servers: servers,
+		Config:  shard.Config{ShardMode: shard.ModeConsistentHash},
+	}
+	require.NoError(t, g.Connect())
+
+	received := make([][]string, len(listeners))
+	var wg sync.WaitGroup
+	for i, l := range listeners {
+		conn, err := l.Accept()
+		require.NoError(t, err)
+		wg.Add(1)
+		go func(i int, conn net.Conn) {
+			defer wg.Done()
+			defer conn.Close()
+			scanner := bufio.NewScanner(conn)
+			for scanner.Scan() {
+				received[i] = append(received[i], scanner.Text())
+			}
+		}(i, conn)
+	}
+
+	var metrics []telegraf.Metric
+	expected := make([][]string, len(listeners))
+	for i := 0; i < 20; i++ {
+		host := fmt.Sprintf("host%d", i)
+		m, _ := metric.New(
+			"cpu",
+			map[string]string{"host": host},
+			map[string]interface{}{"value": float64(i)},
+			time.Date(2010, time.November, 10, 23, 0, 0, 0, time.UTC),
+		)
+		metrics = append(metrics, m)
+		n := g.sharder.Endpoint(m)
+		expected[n] = append(expected[n], fmt.Sprintf("%s.cpu %d 1289430000", host, i))
+	}
+
+	require.NoError(t, g.Write(metrics))
+	g.Close()
+	wg.Wait()
+
+	require.Equal(t, expected, received)
+}
@@ -3,6 +3,7 @@ package health
 import (
 	"context"
 	"crypto/tls"
+	"encoding/json"
 	"errors"
 	"log"
 	"net"
@@ -13,6 +14,7 @@ import (
 
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/internal/models"
 	tlsint "github.com/influxdata/telegraf/internal/tls"
 	"github.com/influxdata/telegraf/plugins/outputs"
 )
@@ -60,6 +62,27 @@ var sampleConfig = `
   ##
   ## [[outputs.health.contains]]
   ##   field = "buffer_size"
+
+  ## Checks on the state of the other plugins of the agent, these do not use
+  ## the metrics written to this output.
+  ##
+  ## The output_status check fails when an output has not written
+  ## successfully for max_flush_intervals flush intervals, or when its buffer
+  ## is filled above buffer_fill_ratio.  Outputs are selected by name with
+  ## glob patterns, all outputs are checked when names is empty.
+  ##
+  ## [[outputs.health.output_status]]
+  ##   names = ["influxdb"]
+  ##   max_flush_intervals = 3
+  ##   buffer_fill_ratio = 0.8
+  ##
+  ## The input_status check fails when an input has not completed a gather
+  ## for max_intervals intervals, or when an error was reported since the
+  ## start of its last gather.
+  ##
+  ## [[outputs.health.input_status]]
+  ##   names = ["cpu", "disk*"]
+  ##   max_intervals = 3
 `
 
 type Checker interface {
@@ -67,6 +90,19 @@ type Checker interface {
 	Check(metrics []telegraf.Metric) bool
 }
 
+// Result is the outcome of a single check, reported in the response body.
+type Result struct {
+	Check   string `json:"check"`
+	Name    string `json:"name,omitempty"`
+	Healthy bool   `json:"healthy"`
+	Message string `json:"message,omitempty"`
+}
+
+type report struct {
+	Healthy bool     `json:"healthy"`
+	Checks  []Result `json:"checks"`
+}
+
 type Health struct {
 	ServiceAddress string            `toml:"service_address"`
 	ReadTimeout    internal.Duration `toml:"read_timeout"`
@@ -75,9 +111,13 @@ type Health struct {
 	BasicPassword  string            `toml:"basic_password"`
 	tlsint.ServerConfig
 
-	Compares []*Compares `toml:"compares"`
-	Contains []*Contains `toml:"contains"`
-	checkers []Checker
+	Compares     []*Compares     `toml:"compares"`
+	Contains     []*Contains     `toml:"contains"`
+	OutputStatus []*OutputStatus `toml:"output_status"`
+	InputStatus  []*InputStatus  `toml:"input_status"`
+	checkers     []Checker
+
+	statusFunc func() models.AgentStatus
 
 	wg      sync.WaitGroup
 	server  *http.Server
@@ -88,6 +128,7 @@ type Health struct {
 
 	mu      sync.Mutex
 	healthy bool
+	results []Result
 }
 
 func (h *Health) SampleConfig() string {
@@ -95,7 +136,7 @@ func (h *Health) SampleConfig() string {
 }
 
 func (h *Health) Description() string {
-	return "Configurable HTTP health check resource based on metrics"
+	return "Configurable HTTP health check resource based on metrics and agent status"
 }
 
 func (h *Health) Init() error {
@@ -131,9 +172,25 @@ func (h *Health) Init() error {
 		h.checkers = append(h.checkers, h.Contains[i])
 	}
 
+	for _, c := range h.OutputStatus {
+		if err := c.init(); err != nil {
+			return err
+		}
+	}
+	for _, c := range h.InputStatus {
+		if err := c.init(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// SetStatusFunc implements models.StatusReporter.
+func (h *Health) SetStatusFunc(f func() models.AgentStatus) {
+	h.statusFunc = f
+}
+
 // Connect starts the HTTP server.
 func (h *Health) Connect() error {
 	authHandler := internal.AuthHandler(h.BasicUsername, h.BasicPassword, onAuthError)
@@ -181,29 +238,84 @@ func (h *Health) listen() (net.Listener, error) {
 }
 
 func (h *Health) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	r := h.report()
+
 	var code = http.StatusOK
-	if !h.isHealthy() {
+	if !r.Healthy {
 		code = http.StatusServiceUnavailable
 	}
 
 	rw.Header().Set("Server", internal.ProductToken())
-	http.Error(rw, http.StatusText(code), code)
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
+	json.NewEncoder(rw).Encode(r)
+}
+
+// report combines the results of the metric checks from the last write with
+// the status checks, which are run on each request.
+func (h *Health) report() report {
+	h.mu.Lock()
+	r := report{
+		Healthy: h.healthy,
+		Checks:  append([]Result{}, h.results...),
+	}
+	h.mu.Unlock()
+
+	if h.statusFunc == nil || len(h.OutputStatus)+len(h.InputStatus) == 0 {
+		return r
+	}
+
+	now := time.Now()
+	status := h.statusFunc()
+	for _, c := range h.OutputStatus {
+		r.Checks = append(r.Checks, c.check(now, status.Outputs)...)
+	}
+	for _, c := range h.InputStatus {
+		r.Checks = append(r.Checks, c.check(now, status.Inputs)...)
+	}
+	for _, result := range r.Checks {
+		if !result.Healthy {
+			r.Healthy = false
+		}
+	}
+	return r
 }
 
 // Write runs all checks over the metric batch and adjust health state.
 func (h *Health) Write(metrics []telegraf.Metric) error {
 	healthy := true
+	results := make([]Result, 0, len(h.checkers))
 	for _, checker := range h.checkers {
 		success := checker.Check(metrics)
 		if !success {
 			healthy = false
 		}
+		results = append(results, checkerResult(checker, success))
 	}
 
-	h.setHealthy(healthy)
+	h.mu.Lock()
+	h.healthy = healthy
+	h.results = results
+	h.mu.Unlock()
 	return nil
 }
 
+func checkerResult(checker Checker, success bool) Result {
+	result := Result{Healthy: success}
+	switch c := checker.(type) {
+	case *Compares:
+		result.Check = "compares"
+		result.Name = c.Field
+	case *Contains:
+		result.Check = "contains"
+		result.Name = c.Field
+	}
+	if !success {
+		result.Message = "check failed"
+	}
+	return result
+}
+
 // Close shuts down the HTTP server.
 func (h *Health) Close() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -245,18 +357,6 @@ func (h *Health) getOrigin(listener net.Listener) string {
 
 }
 
-func (h *Health) setHealthy(healthy bool) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-	h.healthy = healthy
-}
-
-func (h *Health) isHealthy() bool {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-	return h.healthy
-}
-
 func NewHealth() *Health {
 	return &Health{
 		ServiceAddress: defaultServiceAddress,
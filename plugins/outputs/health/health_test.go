@@ -1,12 +1,15 @@
 package health_test
 
 import (
+	"encoding/json"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal/models"
 	"github.com/influxdata/telegraf/plugins/outputs/health"
 	"github.com/influxdata/telegraf/testutil"
 	"github.com/stretchr/testify/require"
@@ -202,3 +205,204 @@ func TestInitServiceAddress(t *testing.T) {
 		})
 	}
 }
+
+func TestStatusChecks(t *testing.T) {
+	now := time.Now()
+	status := models.AgentStatus{
+		Outputs: []models.OutputStatus{
+			{
+				Name:          "influxdb",
+				FlushInterval: 10 * time.Second,
+				LastWrite:     now.Add(-time.Minute),
+				LastError:     "connection refused",
+				LastErrorTime: now.Add(-5 * time.Second),
+				BufferSize:    10,
+				BufferLimit:   100,
+			},
+			{
+				Name:          "file",
+				FlushInterval: 10 * time.Second,
+				LastWrite:     now,
+				BufferSize:    90,
+				BufferLimit:   100,
+			},
+			{
+				Name:          "kafka",
+				FlushInterval: 10 * time.Second,
+				LastWrite:     now,
+				BufferSize:    10,
+				BufferLimit:   100,
+			},
+		},
+		Inputs: []models.InputStatus{
+			{
+				Name:       "cpu",
+				Interval:   10 * time.Second,
+				LastGather: now,
+			},
+			{
+				Name:          "disk",
+				Alias:         "root",
+				Interval:      10 * time.Second,
+				GatherStart:   now.Add(-time.Second),
+				LastGather:    now,
+				LastError:     "permission denied",
+				LastErrorTime: now,
+			},
+			{
+				Name:          "mem",
+				Interval:      10 * time.Second,
+				GatherStart:   now,
+				LastGather:    now,
+				LastError:     "out of memory",
+				LastErrorTime: now.Add(-time.Second),
+			},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		outputs      []*health.OutputStatus
+		inputs       []*health.InputStatus
+		expectedCode int
+		expected     []health.Result
+	}{
+		{
+			name:         "no status checks",
+			expectedCode: 200,
+			expected:     []health.Result{},
+		},
+		{
+			name: "output checks",
+			outputs: []*health.OutputStatus{
+				{BufferFillRatio: 0.8},
+			},
+			expectedCode: 503,
+			expected: []health.Result{
+				{
+					Check:   "output_status",
+					Name:    "outputs.influxdb",
+					Message: "no successful write since " + now.Add(-time.Minute).Format(time.RFC3339) + ", last error: connection refused",
+				},
+				{
+					Check:   "output_status",
+					Name:    "outputs.file",
+					Message: "buffer fullness 90 / 100 metrics above 0.8",
+				},
+				{
+					Check:   "output_status",
+					Name:    "outputs.kafka",
+					Healthy: true,
+				},
+			},
+		},
+		{
+			name: "output names",
+			outputs: []*health.OutputStatus{
+				{Names: []string{"kafka", "fi*"}},
+			},
+			expectedCode: 200,
+			expected: []health.Result{
+				{
+					Check:   "output_status",
+					Name:    "outputs.file",
+					Healthy: true,
+				},
+				{
+					Check:   "output_status",
+					Name:    "outputs.kafka",
+					Healthy: true,
+				},
+			},
+		},
+		{
+			name: "input checks",
+			inputs: []*health.InputStatus{
+				{},
+			},
+			expectedCode: 503,
+			expected: []health.Result{
+				{
+					Check:   "input_status",
+					Name:    "inputs.cpu",
+					Healthy: true,
+				},
+				{
+					Check:   "input_status",
+					Name:    "inputs.disk::root",
+					Message: "error: permission denied",
+				},
+				{
+					Check:   "input_status",
+					Name:    "inputs.mem",
+					Healthy: true,
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := health.NewHealth()
+			output.ServiceAddress = "tcp://127.0.0.1:0"
+			output.OutputStatus = tt.outputs
+			output.InputStatus = tt.inputs
+			output.SetStatusFunc(func() models.AgentStatus {
+				return status
+			})
+
+			err := output.Init()
+			require.NoError(t, err)
+
+			err = output.Connect()
+			require.NoError(t, err)
+			defer output.Close()
+
+			resp, err := http.Get(output.Origin())
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			require.Equal(t, tt.expectedCode, resp.StatusCode)
+			require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+			var body struct {
+				Healthy bool            `json:"healthy"`
+				Checks  []health.Result `json:"checks"`
+			}
+			err = json.NewDecoder(resp.Body).Decode(&body)
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedCode == 200, body.Healthy)
+			require.Equal(t, tt.expected, body.Checks)
+		})
+	}
+}
+
+func TestMetricCheckResults(t *testing.T) {
+	output := health.NewHealth()
+	output.Contains = []*health.Contains{{Field: "buffer_size"}}
+
+	err := output.Init()
+	require.NoError(t, err)
+
+	err = output.Write([]telegraf.Metric{
+		testutil.MustMetric(
+			"cpu",
+			map[string]string{},
+			map[string]interface{}{
+				"time_idle": 42,
+			},
+			time.Now()),
+	})
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	output.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	require.Equal(t, 503, rec.Code)
+	require.JSONEq(t,
+		`{"healthy":false,"checks":[{"check":"contains","name":"buffer_size","healthy":false,"message":"check failed"}]}`,
+		rec.Body.String())
+}
+
+func TestInvalidBufferFillRatio(t *testing.T) {
+	output := health.NewHealth()
+	output.OutputStatus = []*health.OutputStatus{{BufferFillRatio: 80}}
+	require.Error(t, output.Init())
+}
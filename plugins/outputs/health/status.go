@@ -0,0 +1,122 @@
+package health
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/influxdata/telegraf/filter"
+	"github.com/influxdata/telegraf/internal/models"
+)
+
+const (
+	defaultMaxFlushIntervals = 3
+	defaultMaxIntervals      = 3
+)
+
+// OutputStatus checks that the other outputs are writing successfully and
+// that their buffers are not filling up.
+type OutputStatus struct {
+	Names             []string `toml:"names"`
+	MaxFlushIntervals int      `toml:"max_flush_intervals"`
+	BufferFillRatio   float64  `toml:"buffer_fill_ratio"`
+
+	filter filter.Filter
+}
+
+func (c *OutputStatus) init() error {
+	if c.MaxFlushIntervals <= 0 {
+		c.MaxFlushIntervals = defaultMaxFlushIntervals
+	}
+	if c.BufferFillRatio < 0 || c.BufferFillRatio > 1 {
+		return fmt.Errorf("buffer_fill_ratio must be between 0 and 1")
+	}
+
+	var err error
+	c.filter, err = filter.Compile(c.Names)
+	return err
+}
+
+func (c *OutputStatus) check(now time.Time, outputs []models.OutputStatus) []Result {
+	var results []Result
+	for _, s := range outputs {
+		if c.filter != nil && !c.filter.Match(s.Name) {
+			continue
+		}
+
+		result := Result{
+			Check:   "output_status",
+			Name:    pluginName("outputs", s.Name, s.Alias),
+			Healthy: true,
+		}
+
+		maxAge := time.Duration(c.MaxFlushIntervals) * s.FlushInterval
+		if maxAge > 0 && now.Sub(s.LastWrite) > maxAge {
+			result.Healthy = false
+			result.Message = fmt.Sprintf("no successful write since %s",
+				s.LastWrite.Format(time.RFC3339))
+			if s.LastError != "" {
+				result.Message += ", last error: " + s.LastError
+			}
+		} else if c.BufferFillRatio > 0 && s.BufferLimit > 0 &&
+			float64(s.BufferSize)/float64(s.BufferLimit) > c.BufferFillRatio {
+			result.Healthy = false
+			result.Message = fmt.Sprintf("buffer fullness %d / %d metrics above %g",
+				s.BufferSize, s.BufferLimit, c.BufferFillRatio)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// InputStatus checks that the inputs are gathering without errors.
+type InputStatus struct {
+	Names        []string `toml:"names"`
+	MaxIntervals int      `toml:"max_intervals"`
+
+	filter filter.Filter
+}
+
+func (c *InputStatus) init() error {
+	if c.MaxIntervals <= 0 {
+		c.MaxIntervals = defaultMaxIntervals
+	}
+
+	var err error
+	c.filter, err = filter.Compile(c.Names)
+	return err
+}
+
+func (c *InputStatus) check(now time.Time, inputs []models.InputStatus) []Result {
+	var results []Result
+	for _, s := range inputs {
+		if c.filter != nil && !c.filter.Match(s.Name) {
+			continue
+		}
+
+		result := Result{
+			Check:   "input_status",
+			Name:    pluginName("inputs", s.Name, s.Alias),
+			Healthy: true,
+		}
+
+		maxAge := time.Duration(c.MaxIntervals) * s.Interval
+		if maxAge > 0 && now.Sub(s.LastGather) > maxAge {
+			result.Healthy = false
+			result.Message = fmt.Sprintf("no gather completed since %s",
+				s.LastGather.Format(time.RFC3339))
+		} else if !s.LastErrorTime.IsZero() && !s.LastErrorTime.Before(s.GatherStart) {
+			// Errors are reported until the next gather starts.
+			result.Healthy = false
+			result.Message = "error: " + s.LastError
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func pluginName(kind, name, alias string) string {
+	if alias == "" {
+		return kind + "." + name
+	}
+	return kind + "." + name + "::" + alias
+}
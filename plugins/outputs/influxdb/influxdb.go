@@ -4,13 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"math/rand"
 	"net/url"
 	"time"
 
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/internal"
 	"github.com/influxdata/telegraf/internal/tls"
+	"github.com/influxdata/telegraf/plugins/common/shard"
 	"github.com/influxdata/telegraf/plugins/outputs"
 	"github.com/influxdata/telegraf/plugins/serializers/influx"
 )
@@ -49,10 +49,12 @@ type InfluxDB struct {
 	SkipDatabaseCreation bool              `toml:"skip_database_creation"`
 	InfluxUintSupport    bool              `toml:"influx_uint_support"`
 	tls.ClientConfig
+	shard.Config
 
 	Precision string // precision deprecated in 1.0; value is ignored
 
 	clients []Client
+	sharder *shard.Sharder
 
 	CreateHTTPClientF func(config *HTTPConfig) (Client, error)
 	CreateUDPClientF  func(config *UDPConfig) (Client, error)
@@ -69,6 +71,15 @@ var sampleConfig = `
   # urls = ["udp://127.0.0.1:8089"]
   # urls = ["http://127.0.0.1:8086"]
 
+  ## How metrics are distributed across multiple urls:
+  ##   ""                - write to a random url, fail over to the others
+  ##   "round-robin"     - write to the next url, fail over to the others
+  ##   "consistent-hash" - write each series to a stable url
+  # shard_mode = ""
+  ## Tag identifying the series in consistent-hash mode; metrics without the
+  ## tag are sharded by measurement name and tag set.
+  # shard_tag = ""
+
   ## The target database for metrics; will be created as needed.
   ## For UDP url endpoint database needs to be configured on server side.
   # database = "telegraf"
@@ -144,6 +155,12 @@ func (i *InfluxDB) Connect() error {
 		urls = append(urls, defaultURL)
 	}
 
+	sharder, err := i.Config.NewSharder(urls)
+	if err != nil {
+		return err
+	}
+	i.sharder = sharder
+
 	for _, u := range urls {
 		parts, err := url.Parse(u)
 		if err != nil {
@@ -197,34 +214,56 @@ func (i *InfluxDB) SampleConfig() string {
 }
 
 // Write sends metrics to one of the configured servers, logging each
-// unsuccessful. If all servers fail, return an error.
+// unsuccessful. If all servers fail, return an error.  In consistent-hash
+// mode each series is sent to its own server.
 func (i *InfluxDB) Write(metrics []telegraf.Metric) error {
 	ctx := context.Background()
 
-	var err error
-	p := rand.Perm(len(i.clients))
-	for _, n := range p {
-		client := i.clients[n]
-		err = client.Write(ctx, metrics)
-		if err == nil {
+	if i.sharder.Mode() == shard.ModeConsistentHash {
+		var failed int
+		for n, part := range i.sharder.Partition(metrics) {
+			if len(part) == 0 {
+				continue
+			}
+			if !i.write(ctx, i.clients[n], part) {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("could not write to %d of %d addresses", failed, len(i.clients))
+		}
+		return nil
+	}
+
+	for _, n := range i.sharder.Order() {
+		if i.write(ctx, i.clients[n], metrics) {
 			return nil
 		}
+	}
 
-		switch apiError := err.(type) {
-		case *DatabaseNotFoundError:
-			if !i.SkipDatabaseCreation {
-				err := client.CreateDatabase(ctx, apiError.Database)
-				if err != nil {
-					i.Log.Errorf("When writing to [%s]: database %q not found and failed to recreate",
-						client.URL(), apiError.Database)
-				}
+	return errors.New("could not write any address")
+}
+
+// write sends the metrics to the client, logging any error.
+func (i *InfluxDB) write(ctx context.Context, client Client, metrics []telegraf.Metric) bool {
+	err := client.Write(ctx, metrics)
+	if err == nil {
+		return true
+	}
+
+	switch apiError := err.(type) {
+	case *DatabaseNotFoundError:
+		if !i.SkipDatabaseCreation {
+			err := client.CreateDatabase(ctx, apiError.Database)
+			if err != nil {
+				i.Log.Errorf("When writing to [%s]: database %q not found and failed to recreate",
+					client.URL(), apiError.Database)
 			}
 		}
-
-		i.Log.Errorf("When writing to [%s]: %v", client.URL(), err)
 	}
 
-	return errors.New("could not write any address")
+	i.Log.Errorf("When writing to [%s]: %v", client.URL(), err)
+	return false
 }
 
 func (i *InfluxDB) udpClient(url *url.URL) (Client, error) {
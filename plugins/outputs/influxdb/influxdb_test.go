@@ -2,6 +2,7 @@ package influxdb_test
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"testing"
 	"time"
@@ -10,6 +11,7 @@ import (
 	"github.com/influxdata/telegraf/internal"
 	"github.com/influxdata/telegraf/internal/tls"
 	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/plugins/common/shard"
 	"github.com/influxdata/telegraf/plugins/outputs/influxdb"
 	"github.com/influxdata/telegraf/testutil"
 	"github.com/stretchr/testify/require"
@@ -215,3 +217,69 @@ func TestWriteRecreateDatabaseIfDatabaseNotFound(t *testing.T) {
 	// We only have one URL, so we expect an error
 	require.Error(t, err)
 }
+
+func mockUDPClients(written map[string][]telegraf.Metric) func(config *influxdb.UDPConfig) (influxdb.Client, error) {
+	return func(config *influxdb.UDPConfig) (influxdb.Client, error) {
+		url := config.URL.String()
+		return &MockClient{
+			URLF: func() string {
+				return url
+			},
+			WriteF: func(ctx context.Context, metrics []telegraf.Metric) error {
+				written[url] = append(written[url], metrics...)
+				return nil
+			},
+		}, nil
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	written := make(map[string][]telegraf.Metric)
+	output := influxdb.InfluxDB{
+		URLs:             []string{"udp://a:8089", "udp://b:8089", "udp://c:8089"},
+		Config:           shard.Config{ShardMode: shard.ModeRoundRobin},
+		CreateUDPClientF: mockUDPClients(written),
+		Log:              testutil.Logger{},
+	}
+	require.NoError(t, output.Connect())
+
+	for i := 0; i < 6; i++ {
+		require.NoError(t, output.Write([]telegraf.Metric{testutil.TestMetric(i)}))
+	}
+	require.Len(t, written["udp://a:8089"], 2)
+	require.Len(t, written["udp://b:8089"], 2)
+	require.Len(t, written["udp://c:8089"], 2)
+}
+
+func TestConsistentHash(t *testing.T) {
+	written := make(map[string][]telegraf.Metric)
+	output := influxdb.InfluxDB{
+		URLs:             []string{"udp://a:8089", "udp://b:8089"},
+		Config:           shard.Config{ShardMode: shard.ModeConsistentHash, ShardTag: "host"},
+		CreateUDPClientF: mockUDPClients(written),
+		Log:              testutil.Logger{},
+	}
+	require.NoError(t, output.Connect())
+
+	var metrics []telegraf.Metric
+	for i := 0; i < 20; i++ {
+		metrics = append(metrics, testutil.MustMetric("cpu",
+			map[string]string{"host": fmt.Sprintf("host%d", i)},
+			map[string]interface{}{"value": 42.0},
+			time.Unix(0, 0)))
+	}
+	require.NoError(t, output.Write(metrics))
+	require.NoError(t, output.Write(metrics))
+
+	require.Len(t, append(written["udp://a:8089"], written["udp://b:8089"]...), 2*len(metrics))
+	hosts := make(map[string]string)
+	for url, metrics := range written {
+		for _, m := range metrics {
+			host, _ := m.GetTag("host")
+			if other, ok := hosts[host]; ok {
+				require.Equal(t, other, url, "series %s written to two urls", host)
+			}
+			hosts[host] = url
+		}
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/influxdata/telegraf"
 	tlsint "github.com/influxdata/telegraf/internal/tls"
 	"github.com/influxdata/telegraf/plugins/common/kafka"
+	"github.com/influxdata/telegraf/plugins/common/topic"
 	"github.com/influxdata/telegraf/plugins/outputs"
 	"github.com/influxdata/telegraf/plugins/serializers"
 )
@@ -58,6 +59,7 @@ type (
 
 		tlsConfig tls.Config
 		producer  sarama.SyncProducer
+		topic     *topic.Template
 
 		serializer serializers.Serializer
 	}
@@ -91,7 +93,10 @@ func (*DebugLogger) Println(v ...interface{}) {
 var sampleConfig = `
   ## URLs of kafka brokers
   brokers = ["localhost:9092"]
-  ## Kafka topic for producer messages
+  ## Kafka topic for producer messages.  The topic can be a template
+  ## referencing the measurement name with {{.Name}}, tag values with
+  ## {{.Tag "key"}} and field names with {{.FieldNames}}.
+  ##   ex: topic = 'telegraf-{{.Tag "site"}}-{{.Name}}'
   topic = "telegraf"
 
   ## Optional Client id
@@ -212,14 +217,21 @@ func ValidateTopicSuffixMethod(method string) error {
 	return fmt.Errorf("Unknown topic suffix method provided: %s", method)
 }
 
-func (k *Kafka) GetTopicName(metric telegraf.Metric) string {
+// GetTopicName returns the topic of the metric, rendered from the topic
+// template with the topic suffix appended.  The template is parsed by Init.
+func (k *Kafka) GetTopicName(metric telegraf.Metric) (string, error) {
+	baseName, err := k.topic.Execute(metric)
+	if err != nil {
+		return "", err
+	}
+
 	var topicName string
 	switch k.TopicSuffix.Method {
 	case "measurement":
-		topicName = k.Topic + k.TopicSuffix.Separator + metric.Name()
+		topicName = baseName + k.TopicSuffix.Separator + metric.Name()
 	case "tags":
 		var topicNameComponents []string
-		topicNameComponents = append(topicNameComponents, k.Topic)
+		topicNameComponents = append(topicNameComponents, baseName)
 		for _, tag := range k.TopicSuffix.Keys {
 			tagValue := metric.Tags()[tag]
 			if tagValue != "" {
@@ -228,20 +240,25 @@ func (k *Kafka) GetTopicName(metric telegraf.Metric) string {
 		}
 		topicName = strings.Join(topicNameComponents, k.TopicSuffix.Separator)
 	default:
-		topicName = k.Topic
+		topicName = baseName
 	}
-	return topicName
+	return topicName, nil
 }
 
 func (k *Kafka) SetSerializer(serializer serializers.Serializer) {
 	k.serializer = serializer
 }
 
-func (k *Kafka) Connect() error {
+func (k *Kafka) Init() error {
 	err := ValidateTopicSuffixMethod(k.TopicSuffix.Method)
 	if err != nil {
 		return err
 	}
+	k.topic, err = topic.NewTemplate(k.Topic)
+	return err
+}
+
+func (k *Kafka) Connect() error {
 	config := sarama.NewConfig()
 
 	if k.Version != "" {
@@ -347,7 +364,18 @@ func (k *Kafka) routingKey(metric telegraf.Metric) (string, error) {
 
 func (k *Kafka) Write(metrics []telegraf.Metric) error {
 	msgs := make([]*sarama.ProducerMessage, 0, len(metrics))
+	var dropped int
+	var renderErr error
 	for _, metric := range metrics {
+		topicName, err := k.GetTopicName(metric)
+		if err != nil {
+			dropped++
+			if renderErr == nil {
+				renderErr = err
+			}
+			continue
+		}
+
 		buf, err := k.serializer.Serialize(metric)
 		if err != nil {
 			k.Log.Debugf("Could not serialize metric: %v", err)
@@ -355,7 +383,7 @@ func (k *Kafka) Write(metrics []telegraf.Metric) error {
 		}
 
 		m := &sarama.ProducerMessage{
-			Topic: k.GetTopicName(metric),
+			Topic: topicName,
 			Value: sarama.ByteEncoder(buf),
 		}
 
@@ -374,6 +402,9 @@ func (k *Kafka) Write(metrics []telegraf.Metric) error {
 		}
 		msgs = append(msgs, m)
 	}
+	if renderErr != nil {
+		k.Log.Errorf("Could not render topic of %d metrics, dropping them: %v", dropped, renderErr)
+	}
 
 	err := k.producer.SendMessages(msgs)
 	if err != nil {
@@ -4,6 +4,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/Shopify/sarama/mocks"
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/metric"
 	"github.com/influxdata/telegraf/plugins/serializers"
@@ -29,6 +30,8 @@ func TestConnectAndWrite(t *testing.T) {
 		serializer: s,
 	}
 
+	require.NoError(t, k.Init())
+
 	// Verify that we can connect to the Kafka broker
 	err := k.Connect()
 	require.NoError(t, err)
@@ -80,12 +83,80 @@ func TestTopicSuffixes(t *testing.T) {
 			Topic:       topic,
 			TopicSuffix: topicSuffix,
 		}
+		require.NoError(t, k.Init())
 
-		topic := k.GetTopicName(metric)
+		topic, err := k.GetTopicName(metric)
+		require.NoError(t, err)
 		require.Equal(t, expectedTopic, topic)
 	}
 }
 
+func TestTopicTemplate(t *testing.T) {
+	m := testutil.MustMetric("cpu",
+		map[string]string{"site": "ams"},
+		map[string]interface{}{"value": 42.0},
+		time.Unix(0, 0))
+
+	k := &Kafka{
+		Topic:       `telegraf-{{.Tag "site"}}`,
+		TopicSuffix: TopicSuffix{Method: "measurement", Separator: "-"},
+	}
+	require.NoError(t, k.Init())
+	topic, err := k.GetTopicName(m)
+	require.NoError(t, err)
+	require.Equal(t, "telegraf-ams-cpu", topic)
+
+	k = &Kafka{Topic: `{{.Tag "rack"}}`}
+	require.NoError(t, k.Init())
+	_, err = k.GetTopicName(m)
+	require.Error(t, err)
+
+	k = &Kafka{Topic: `{{.Tag "rack"`}
+	require.Error(t, k.Init())
+
+	k = &Kafka{Topic: "telegraf", TopicSuffix: TopicSuffix{Method: "unknown"}}
+	require.Error(t, k.Init())
+}
+
+// errorLogger counts the logged errors.
+type errorLogger struct {
+	testutil.Logger
+	errors int
+}
+
+func (l *errorLogger) Errorf(format string, args ...interface{}) {
+	l.errors++
+	l.Logger.Errorf(format, args...)
+}
+
+func TestWriteTopicRenderErrors(t *testing.T) {
+	s, _ := serializers.NewInfluxSerializer()
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageAndSucceed()
+	log := &errorLogger{}
+	k := &Kafka{
+		Topic:      `{{.Tag "site"}}`,
+		Log:        log,
+		serializer: s,
+		producer:   producer,
+	}
+	require.NoError(t, k.Init())
+
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu", map[string]string{"site": "ams"},
+			map[string]interface{}{"value": 42.0}, time.Unix(0, 0)),
+	}
+	for i := 0; i < 10; i++ {
+		metrics = append(metrics, testutil.MustMetric("cpu", map[string]string{},
+			map[string]interface{}{"value": 42.0}, time.Unix(0, 0)))
+	}
+
+	// The metrics without a topic are dropped with a single error
+	require.NoError(t, k.Write(metrics))
+	require.Equal(t, 1, log.errors)
+	require.NoError(t, producer.Close())
+}
+
 func TestValidateTopicSuffixMethod(t *testing.T) {
 	if testing.Short() {
 		t.Skip("Skipping integration test in short mode")
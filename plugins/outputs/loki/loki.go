@@ -0,0 +1,280 @@
+package loki
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/internal/tls"
+	"github.com/influxdata/telegraf/plugins/outputs"
+)
+
+const (
+	defaultURL           = "http://localhost:3100/loki/api/v1/push"
+	defaultClientTimeout = 5 * time.Second
+	defaultLineField     = "message"
+	defaultNameLabel     = "measurement"
+)
+
+var sampleConfig = `
+  ## URL of the Loki push API.
+  # url = "http://localhost:3100/loki/api/v1/push"
+
+  ## Timeout for HTTP message
+  # timeout = "5s"
+
+  ## Encoding of the push request, either "json" or "protobuf".  Protobuf
+  ## requests are always compressed with snappy.
+  # format = "json"
+
+  ## HTTP Content-Encoding for JSON requests, can be set to "gzip" to compress
+  ## the body or "identity" to apply no encoding.
+  # content_encoding = "identity"
+
+  ## HTTP Basic Auth credentials
+  # username = "username"
+  # password = "pa$$word"
+
+  ## Tenant ID sent in the X-Scope-OrgID header for multi-tenant servers.
+  # tenant_id = ""
+
+  ## Field used as the log line, metrics without this field are dropped.
+  # line_field = "message"
+
+  ## Label the measurement name is stored in, set to an empty string to leave
+  ## the measurement name out of the stream labels.
+  # name_label = "measurement"
+
+  ## Optional TLS Config
+  # tls_ca = "/etc/telegraf/ca.pem"
+  # tls_cert = "/etc/telegraf/cert.pem"
+  # tls_key = "/etc/telegraf/key.pem"
+  ## Use TLS but skip chain & host verification
+  # insecure_skip_verify = false
+
+  ## Additional HTTP headers
+  # [outputs.loki.headers]
+  #   X-Custom = "value"
+`
+
+type Loki struct {
+	URL             string            `toml:"url"`
+	Timeout         internal.Duration `toml:"timeout"`
+	Format          string            `toml:"format"`
+	ContentEncoding string            `toml:"content_encoding"`
+	Username        string            `toml:"username"`
+	Password        string            `toml:"password"`
+	TenantID        string            `toml:"tenant_id"`
+	LineField       string            `toml:"line_field"`
+	NameLabel       string            `toml:"name_label"`
+	Headers         map[string]string `toml:"headers"`
+	tls.ClientConfig
+
+	Log telegraf.Logger `toml:"-"`
+
+	client *http.Client
+}
+
+func (l *Loki) SampleConfig() string {
+	return sampleConfig
+}
+
+func (l *Loki) Description() string {
+	return "Send log lines to a Loki compatible push API"
+}
+
+func (l *Loki) Init() error {
+	switch l.Format {
+	case "":
+		l.Format = "json"
+	case "json", "protobuf":
+	default:
+		return fmt.Errorf("unsupported format %q", l.Format)
+	}
+
+	switch l.ContentEncoding {
+	case "", "identity", "gzip":
+	default:
+		return fmt.Errorf("unsupported content_encoding %q", l.ContentEncoding)
+	}
+	return nil
+}
+
+func (l *Loki) Connect() error {
+	if l.Timeout.Duration == 0 {
+		l.Timeout.Duration = defaultClientTimeout
+	}
+
+	tlsCfg, err := l.ClientConfig.TLSConfig()
+	if err != nil {
+		return err
+	}
+
+	l.client = &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: tlsCfg,
+			Proxy:           http.ProxyFromEnvironment,
+		},
+		Timeout: l.Timeout.Duration,
+	}
+	return nil
+}
+
+func (l *Loki) Close() error {
+	return nil
+}
+
+func (l *Loki) Write(metrics []telegraf.Metric) error {
+	streams := l.streams(metrics)
+	if len(streams) == 0 {
+		return nil
+	}
+
+	var body []byte
+	var err error
+	var contentType string
+	if l.Format == "protobuf" {
+		body = snappy.Encode(nil, marshalProtobuf(streams))
+		contentType = "application/x-protobuf"
+	} else {
+		body, err = marshalJSON(streams)
+		if err != nil {
+			return err
+		}
+		contentType = "application/json"
+	}
+
+	return l.write(body, contentType)
+}
+
+// streams groups the metrics into streams by label set.  The entries of
+// each stream are sorted by timestamp, as Loki rejects out of order entries
+// within a stream.
+func (l *Loki) streams(metrics []telegraf.Metric) []*Stream {
+	index := make(map[string]*Stream)
+	for _, m := range metrics {
+		value, ok := m.GetField(l.LineField)
+		if !ok {
+			l.Log.Debugf("Dropping metric %q without %q field", m.Name(), l.LineField)
+			continue
+		}
+		line, ok := value.(string)
+		if !ok {
+			line = fmt.Sprint(value)
+		}
+
+		labels := make(map[string]string, len(m.TagList())+1)
+		for _, tag := range m.TagList() {
+			labels[sanitize(tag.Key)] = tag.Value
+		}
+		if l.NameLabel != "" {
+			labels[l.NameLabel] = m.Name()
+		}
+
+		s := &Stream{Labels: labels}
+		key := s.labelString()
+		if existing, ok := index[key]; ok {
+			s = existing
+		} else {
+			index[key] = s
+		}
+		s.Entries = append(s.Entries, Entry{Timestamp: m.Time(), Line: line})
+	}
+
+	keys := make([]string, 0, len(index))
+	for k := range index {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	streams := make([]*Stream, 0, len(keys))
+	for _, k := range keys {
+		s := index[k]
+		sort.SliceStable(s.Entries, func(i, j int) bool {
+			return s.Entries[i].Timestamp.Before(s.Entries[j].Timestamp)
+		})
+		streams = append(streams, s)
+	}
+	return streams
+}
+
+func (l *Loki) write(body []byte, contentType string) error {
+	var reqBody io.Reader = bytes.NewBuffer(body)
+
+	gzip := l.Format == "json" && l.ContentEncoding == "gzip"
+	if gzip {
+		rc, err := internal.CompressWithGzip(reqBody)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		reqBody = rc
+	}
+
+	req, err := http.NewRequest(http.MethodPost, l.URL, reqBody)
+	if err != nil {
+		return err
+	}
+
+	if l.Username != "" || l.Password != "" {
+		req.SetBasicAuth(l.Username, l.Password)
+	}
+	if l.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", l.TenantID)
+	}
+
+	req.Header.Set("User-Agent", "Telegraf/"+internal.Version())
+	req.Header.Set("Content-Type", contentType)
+	if gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for k, v := range l.Headers {
+		if strings.ToLower(k) == "host" {
+			req.Host = v
+		}
+		req.Header.Set(k, v)
+	}
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("when writing to [%s] received status code %d: %s",
+			l.URL, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// sanitize replaces the characters not allowed in label names with an
+// underscore.
+func sanitize(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+func init() {
+	outputs.Add("loki", func() telegraf.Output {
+		return &Loki{
+			URL:       defaultURL,
+			Timeout:   internal.Duration{Duration: defaultClientTimeout},
+			LineField: defaultLineField,
+			NameLabel: defaultNameLabel,
+		}
+	})
+}
@@ -0,0 +1,203 @@
+package loki
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/common/protowire"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func newLoki(url string) *Loki {
+	return &Loki{
+		URL:       url,
+		Timeout:   internal.Duration{Duration: 5 * time.Second},
+		LineField: defaultLineField,
+		NameLabel: defaultNameLabel,
+		Log:       testutil.Logger{},
+	}
+}
+
+func logMetrics() []telegraf.Metric {
+	return []telegraf.Metric{
+		testutil.MustMetric("tail",
+			map[string]string{"path": "/var/log/app.log", "host": "a"},
+			map[string]interface{}{"message": "second"},
+			time.Unix(0, 2)),
+		testutil.MustMetric("syslog",
+			map[string]string{"appname": "sshd", "host": "a"},
+			map[string]interface{}{"message": "accepted", "severity_code": 6},
+			time.Unix(0, 5)),
+		testutil.MustMetric("tail",
+			map[string]string{"path": "/var/log/app.log", "host": "a"},
+			map[string]interface{}{"message": "first"},
+			time.Unix(0, 1)),
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"usage_idle": 42.0},
+			time.Unix(0, 3)),
+	}
+}
+
+func TestStreams(t *testing.T) {
+	l := newLoki(defaultURL)
+	streams := l.streams(logMetrics())
+	require.Equal(t, []*Stream{
+		{
+			Labels: map[string]string{"appname": "sshd", "host": "a", "measurement": "syslog"},
+			Entries: []Entry{
+				{Timestamp: time.Unix(0, 5), Line: "accepted"},
+			},
+		},
+		{
+			Labels: map[string]string{"host": "a", "measurement": "tail", "path": "/var/log/app.log"},
+			Entries: []Entry{
+				{Timestamp: time.Unix(0, 1), Line: "first"},
+				{Timestamp: time.Unix(0, 2), Line: "second"},
+			},
+		},
+	}, streams)
+	require.Equal(t, `{host="a", measurement="tail", path="/var/log/app.log"}`, streams[1].labelString())
+}
+
+func TestSanitizeLabels(t *testing.T) {
+	l := newLoki(defaultURL)
+	l.NameLabel = ""
+	streams := l.streams([]telegraf.Metric{
+		testutil.MustMetric("docker_log",
+			map[string]string{"container.name": "web"},
+			map[string]interface{}{"message": "GET /"},
+			time.Unix(0, 0)),
+	})
+	require.Len(t, streams, 1)
+	require.Equal(t, map[string]string{"container_name": "web"}, streams[0].Labels)
+}
+
+func TestWriteJSON(t *testing.T) {
+	var req jsonPushRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/loki/api/v1/push", r.URL.Path)
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+		require.Equal(t, "tenant1", r.Header.Get("X-Scope-OrgID"))
+
+		gz, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.NewDecoder(gz).Decode(&req))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	l := newLoki(server.URL + "/loki/api/v1/push")
+	l.ContentEncoding = "gzip"
+	l.TenantID = "tenant1"
+	require.NoError(t, l.Init())
+	require.NoError(t, l.Connect())
+	require.NoError(t, l.Write(logMetrics()))
+
+	require.Equal(t, jsonPushRequest{
+		Streams: []jsonStream{
+			{
+				Stream: map[string]string{"appname": "sshd", "host": "a", "measurement": "syslog"},
+				Values: [][2]string{{"5", "accepted"}},
+			},
+			{
+				Stream: map[string]string{"host": "a", "measurement": "tail", "path": "/var/log/app.log"},
+				Values: [][2]string{{"1", "first"}, {"2", "second"}},
+			},
+		},
+	}, req)
+}
+
+func TestWriteProtobuf(t *testing.T) {
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+
+		compressed, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		body, err = snappy.Decode(nil, compressed)
+		require.NoError(t, err)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	l := newLoki(server.URL)
+	l.Format = "protobuf"
+	require.NoError(t, l.Init())
+	require.NoError(t, l.Connect())
+	require.NoError(t, l.Write([]telegraf.Metric{
+		testutil.MustMetric("tail",
+			map[string]string{"path": "/var/log/app.log"},
+			map[string]interface{}{"message": "hello"},
+			time.Unix(1577836800, 500)),
+	}))
+
+	// PushRequest.streams
+	stream := decodeField(t, body, 1)
+	require.Equal(t, `{measurement="tail", path="/var/log/app.log"}`, string(decodeField(t, stream, 1)))
+
+	// StreamAdapter.entries
+	entry := decodeField(t, stream, 2)
+	require.Equal(t, "hello", string(decodeField(t, entry, 2)))
+
+	ts := protowire.NewDecoder(decodeField(t, entry, 1))
+	for _, expected := range []uint64{1<<3 | protowire.VarintType, 1577836800, 2<<3 | protowire.VarintType, 500} {
+		v, err := ts.Varint()
+		require.NoError(t, err)
+		require.Equal(t, expected, v)
+	}
+}
+
+// decodeField returns the first length delimited field with the number in the
+// message.
+func decodeField(t *testing.T, msg []byte, num int) []byte {
+	d := protowire.NewDecoder(msg)
+	for {
+		n, wire, err := d.Key()
+		require.NoError(t, err)
+		require.Equal(t, protowire.BytesType, wire, "unexpected wire type")
+		v, err := d.Bytes()
+		require.NoError(t, err)
+		if n == num {
+			return v
+		}
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "entry out of order", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	l := newLoki(server.URL)
+	require.NoError(t, l.Init())
+	require.NoError(t, l.Connect())
+	err := l.Write(logMetrics())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "entry out of order")
+}
+
+func TestInit(t *testing.T) {
+	l := newLoki(defaultURL)
+	require.NoError(t, l.Init())
+	require.Equal(t, "json", l.Format)
+
+	l = newLoki(defaultURL)
+	l.Format = "logfmt"
+	require.Error(t, l.Init())
+
+	l = newLoki(defaultURL)
+	l.ContentEncoding = "zstd"
+	require.Error(t, l.Init())
+}
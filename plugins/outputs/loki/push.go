@@ -0,0 +1,98 @@
+package loki
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf/plugins/common/protowire"
+)
+
+// Stream is a set of log entries sharing the same labels.
+type Stream struct {
+	Labels  map[string]string
+	Entries []Entry
+}
+
+// Entry is a single log line.
+type Entry struct {
+	Timestamp time.Time
+	Line      string
+}
+
+// labelString returns the labels in the Prometheus selector syntax used by
+// the protobuf encoding, for example {host="a", job="telegraf"}.
+func (s *Stream) labelString() string {
+	keys := make([]string, 0, len(s.Labels))
+	for k := range s.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(s.Labels[k]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+type jsonPushRequest struct {
+	Streams []jsonStream `json:"streams"`
+}
+
+type jsonStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// marshalJSON encodes the streams as a JSON push request.
+func marshalJSON(streams []*Stream) ([]byte, error) {
+	req := jsonPushRequest{Streams: make([]jsonStream, 0, len(streams))}
+	for _, s := range streams {
+		js := jsonStream{
+			Stream: s.Labels,
+			Values: make([][2]string, 0, len(s.Entries)),
+		}
+		for _, e := range s.Entries {
+			js.Values = append(js.Values, [2]string{strconv.FormatInt(e.Timestamp.UnixNano(), 10), e.Line})
+		}
+		req.Streams = append(req.Streams, js)
+	}
+	return json.Marshal(req)
+}
+
+// marshalProtobuf encodes the streams as a logproto.PushRequest message:
+//
+//	message PushRequest { repeated StreamAdapter streams = 1; }
+//	message StreamAdapter { string labels = 1; repeated EntryAdapter entries = 2; }
+//	message EntryAdapter { google.protobuf.Timestamp timestamp = 1; string line = 2; }
+func marshalProtobuf(streams []*Stream) []byte {
+	var req []byte
+	for _, s := range streams {
+		stream := protowire.AppendStringField(nil, 1, s.labelString())
+		for _, e := range s.Entries {
+			var ts []byte
+			if sec := e.Timestamp.Unix(); sec != 0 {
+				ts = protowire.AppendUvarintField(ts, 1, uint64(sec))
+			}
+			if nsec := e.Timestamp.Nanosecond(); nsec != 0 {
+				ts = protowire.AppendUvarintField(ts, 2, uint64(nsec))
+			}
+
+			entry := protowire.AppendBytesField(nil, 1, ts)
+			entry = protowire.AppendStringField(entry, 2, e.Line)
+			stream = protowire.AppendBytesField(stream, 2, entry)
+		}
+		req = protowire.AppendBytesField(req, 1, stream)
+	}
+	return req
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/internal"
 	"github.com/influxdata/telegraf/internal/tls"
+	"github.com/influxdata/telegraf/plugins/common/topic"
 	"github.com/influxdata/telegraf/plugins/outputs"
 	"github.com/influxdata/telegraf/plugins/serializers"
 )
@@ -23,6 +24,12 @@ var sampleConfig = `
   ##   ex: prefix/web01.example.com/mem
   topic_prefix = "telegraf"
 
+  ## Topic template, replaces the topic format above when set.  The template
+  ## can reference the measurement name with {{.Name}}, tag values with
+  ## {{.Tag "key"}} and field names with {{.FieldNames}}.
+  ##   ex: topic = 'telegraf/{{.Tag "site"}}/{{.Tag "host"}}/{{.Name}}'
+  # topic = ""
+
   ## QoS policy for messages
   ##   0 = at most once
   ##   1 = at least once
@@ -46,8 +53,8 @@ var sampleConfig = `
   ## Use TLS but skip chain & host verification
   # insecure_skip_verify = false
 
-  ## When true, metrics will be sent in one MQTT message per flush.  Otherwise,
-  ## metrics are written one metric per MQTT message.
+  ## When true, metrics will be sent in one MQTT message per topic and flush.
+  ## Otherwise, metrics are written one metric per MQTT message.
   # batch = false
 
   ## When true, metric will have RETAIN flag set, making broker cache entries until someone
@@ -68,6 +75,7 @@ type MQTT struct {
 	Database    string
 	Timeout     internal.Duration
 	TopicPrefix string
+	Topic       string `toml:"topic"`
 	QoS         int    `toml:"qos"`
 	ClientID    string `toml:"client_id"`
 	tls.ClientConfig
@@ -76,12 +84,24 @@ type MQTT struct {
 
 	client paho.Client
 	opts   *paho.ClientOptions
+	topic  *topic.Template
 
 	serializer serializers.Serializer
 
 	sync.Mutex
 }
 
+func (m *MQTT) Init() error {
+	if m.Topic != "" {
+		tmpl, err := topic.NewTemplate(m.Topic)
+		if err != nil {
+			return err
+		}
+		m.topic = tmpl
+	}
+	return nil
+}
+
 func (m *MQTT) Connect() error {
 	var err error
 	m.Lock()
@@ -128,54 +148,79 @@ func (m *MQTT) Write(metrics []telegraf.Metric) error {
 	if len(metrics) == 0 {
 		return nil
 	}
-	hostname, ok := metrics[0].Tags()["host"]
-	if !ok {
-		hostname = ""
-	}
-
-	metricsmap := make(map[string][]telegraf.Metric)
 
-	for _, metric := range metrics {
-		var t []string
-		if m.TopicPrefix != "" {
-			t = append(t, m.TopicPrefix)
-		}
-		if hostname != "" {
-			t = append(t, hostname)
+	var batches []*topic.Batch
+	if m.topic != nil {
+		var err error
+		batches, err = m.topic.Group(metrics)
+		if err != nil {
+			log.Printf("E! [outputs.mqtt] Could not render topic, dropping metrics: %v", err)
 		}
+	} else {
+		batches = m.legacyBatches(metrics)
+	}
 
-		t = append(t, metric.Name())
-		topic := strings.Join(t, "/")
-
+	for _, batch := range batches {
 		if m.BatchMessage {
-			metricsmap[topic] = append(metricsmap[topic], metric)
-		} else {
+			buf, err := m.serializer.SerializeBatch(batch.Metrics)
+			if err != nil {
+				return err
+			}
+			publisherr := m.publish(batch.Topic, buf)
+			if publisherr != nil {
+				return fmt.Errorf("Could not write to MQTT server, %s", publisherr)
+			}
+			continue
+		}
+
+		for _, metric := range batch.Metrics {
 			buf, err := m.serializer.Serialize(metric)
 			if err != nil {
 				log.Printf("D! [outputs.mqtt] Could not serialize metric: %v", err)
 				continue
 			}
 
-			err = m.publish(topic, buf)
+			err = m.publish(batch.Topic, buf)
 			if err != nil {
 				return fmt.Errorf("Could not write to MQTT server, %s", err)
 			}
 		}
 	}
 
-	for key := range metricsmap {
-		buf, err := m.serializer.SerializeBatch(metricsmap[key])
+	return nil
+}
 
-		if err != nil {
-			return err
+// legacyBatches groups the metrics by the "<topic_prefix>/<hostname>/<name>"
+// topic, the hostname is taken from the first metric.
+func (m *MQTT) legacyBatches(metrics []telegraf.Metric) []*topic.Batch {
+	hostname, ok := metrics[0].Tags()["host"]
+	if !ok {
+		hostname = ""
+	}
+
+	var batches []*topic.Batch
+	index := make(map[string]*topic.Batch)
+	for _, metric := range metrics {
+		var t []string
+		if m.TopicPrefix != "" {
+			t = append(t, m.TopicPrefix)
+		}
+		if hostname != "" {
+			t = append(t, hostname)
 		}
-		publisherr := m.publish(key, buf)
-		if publisherr != nil {
-			return fmt.Errorf("Could not write to MQTT server, %s", publisherr)
+
+		t = append(t, metric.Name())
+		name := strings.Join(t, "/")
+
+		b, ok := index[name]
+		if !ok {
+			b = &topic.Batch{Topic: name}
+			index[name] = b
+			batches = append(batches, b)
 		}
+		b.Metrics = append(b.Metrics, metric)
 	}
-
-	return nil
+	return batches
 }
 
 func (m *MQTT) publish(topic string, body []byte) error {
@@ -2,7 +2,10 @@ package mqtt
 
 import (
 	"testing"
+	"time"
 
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/plugins/common/topic"
 	"github.com/influxdata/telegraf/plugins/serializers"
 	"github.com/influxdata/telegraf/testutil"
 
@@ -29,3 +32,26 @@ func TestConnectAndWrite(t *testing.T) {
 	err = m.Write(testutil.MockMetrics())
 	require.NoError(t, err)
 }
+
+func TestLegacyTopic(t *testing.T) {
+	cpu := testutil.MustMetric("cpu",
+		map[string]string{"host": "web01"},
+		map[string]interface{}{"value": 1.0},
+		time.Unix(0, 0))
+	mem := testutil.MustMetric("mem",
+		map[string]string{"host": "web02"},
+		map[string]interface{}{"value": 2.0},
+		time.Unix(0, 0))
+
+	m := &MQTT{TopicPrefix: "telegraf"}
+	require.NoError(t, m.Init())
+	require.Equal(t, []*topic.Batch{
+		{Topic: "telegraf/web01/cpu", Metrics: []telegraf.Metric{cpu}},
+		{Topic: "telegraf/web01/mem", Metrics: []telegraf.Metric{mem}},
+	}, m.legacyBatches([]telegraf.Metric{cpu, mem}))
+}
+
+func TestInvalidTopicTemplate(t *testing.T) {
+	m := &MQTT{Topic: "{{.Name"}
+	require.Error(t, m.Init())
+}
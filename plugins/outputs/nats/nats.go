@@ -6,6 +6,7 @@ import (
 
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/internal/tls"
+	"github.com/influxdata/telegraf/plugins/common/topic"
 	"github.com/influxdata/telegraf/plugins/outputs"
 	"github.com/influxdata/telegraf/plugins/serializers"
 	nats_client "github.com/nats-io/go-nats"
@@ -17,9 +18,11 @@ type NATS struct {
 	Username string   `toml:"username"`
 	Password string   `toml:"password"`
 	Subject  string   `toml:"subject"`
+	Batch    bool     `toml:"batch"`
 	tls.ClientConfig
 
 	conn       *nats_client.Conn
+	subject    *topic.Template
 	serializer serializers.Serializer
 }
 
@@ -29,9 +32,16 @@ var sampleConfig = `
   ## Optional credentials
   # username = ""
   # password = ""
-  ## NATS subject for producer messages
+  ## NATS subject for producer messages.  The subject can be a template
+  ## referencing the measurement name with {{.Name}}, tag values with
+  ## {{.Tag "key"}} and field names with {{.FieldNames}}.
+  ##   ex: subject = 'telegraf.{{.Tag "site"}}.{{.Name}}'
   subject = "telegraf"
 
+  ## When true, metrics will be sent in one NATS message per subject and
+  ## flush.  Otherwise, metrics are written one metric per NATS message.
+  # batch = false
+
   ## Use Transport Layer Security
   # secure = false
 
@@ -53,6 +63,15 @@ func (n *NATS) SetSerializer(serializer serializers.Serializer) {
 	n.serializer = serializer
 }
 
+func (n *NATS) Init() error {
+	subject, err := topic.NewTemplate(n.Subject)
+	if err != nil {
+		return err
+	}
+	n.subject = subject
+	return nil
+}
+
 func (n *NATS) Connect() error {
 	var err error
 
@@ -105,16 +124,36 @@ func (n *NATS) Write(metrics []telegraf.Metric) error {
 		return nil
 	}
 
-	for _, metric := range metrics {
-		buf, err := n.serializer.Serialize(metric)
-		if err != nil {
-			log.Printf("D! [outputs.nats] Could not serialize metric: %v", err)
+	batches, err := n.subject.Group(metrics)
+	if err != nil {
+		log.Printf("E! [outputs.nats] Could not render subject, dropping metrics: %v", err)
+	}
+
+	for _, batch := range batches {
+		if n.Batch {
+			buf, err := n.serializer.SerializeBatch(batch.Metrics)
+			if err != nil {
+				return err
+			}
+
+			err = n.conn.Publish(batch.Topic, buf)
+			if err != nil {
+				return fmt.Errorf("FAILED to send NATS message: %s", err)
+			}
 			continue
 		}
 
-		err = n.conn.Publish(n.Subject, buf)
-		if err != nil {
-			return fmt.Errorf("FAILED to send NATS message: %s", err)
+		for _, metric := range batch.Metrics {
+			buf, err := n.serializer.Serialize(metric)
+			if err != nil {
+				log.Printf("D! [outputs.nats] Could not serialize metric: %v", err)
+				continue
+			}
+
+			err = n.conn.Publish(batch.Topic, buf)
+			if err != nil {
+				return fmt.Errorf("FAILED to send NATS message: %s", err)
+			}
 		}
 	}
 	return nil
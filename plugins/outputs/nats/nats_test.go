@@ -20,6 +20,7 @@ func TestConnectAndWrite(t *testing.T) {
 		Subject:    "telegraf",
 		serializer: s,
 	}
+	require.NoError(t, n.Init())
 
 	// Verify that we can connect to the NATS daemon
 	err := n.Connect()
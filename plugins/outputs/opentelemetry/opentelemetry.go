@@ -0,0 +1,507 @@
+package opentelemetry
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/internal/tls"
+	"github.com/influxdata/telegraf/plugins/common/otlp"
+	"github.com/influxdata/telegraf/plugins/outputs"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	_ "google.golang.org/grpc/encoding/gzip" // Register the gzip compressor
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	defaultGRPCEndpoint = "localhost:4317"
+	defaultHTTPEndpoint = "http://localhost:4318" + otlp.HTTPPath
+)
+
+var sampleConfig = `
+  ## Transport protocol, "grpc" or "http" (protobuf over HTTP).
+  # protocol = "grpc"
+
+  ## Endpoint to send metrics to.  For gRPC this is the address of the
+  ## collector, for HTTP the full URL.  Defaults to "localhost:4317" for gRPC
+  ## and "http://localhost:4318/v1/metrics" for HTTP.
+  # endpoint = "localhost:4317"
+
+  ## Timeout for each export request.
+  # timeout = "5s"
+
+  ## Compression of the requests, "gzip" or "none".
+  # compression = "none"
+
+  ## Additional headers, sent as gRPC metadata when using gRPC.
+  # [outputs.opentelemetry.headers]
+  #   Authorization = "Bearer <token>"
+
+  ## Global tags are sent as resource attributes instead of data point
+  ## attributes.  Additional resource attributes can be set here.
+  # [outputs.opentelemetry.resource_attributes]
+  #   "service.name" = "telegraf"
+
+  ## Optional TLS Config, TLS is used for gRPC when any of the options is set.
+  # tls_ca = "/etc/telegraf/ca.pem"
+  # tls_cert = "/etc/telegraf/cert.pem"
+  # tls_key = "/etc/telegraf/key.pem"
+  ## Use TLS but skip chain & host verification
+  # insecure_skip_verify = false
+`
+
+type OpenTelemetry struct {
+	Protocol           string            `toml:"protocol"`
+	Endpoint           string            `toml:"endpoint"`
+	Timeout            internal.Duration `toml:"timeout"`
+	Compression        string            `toml:"compression"`
+	Headers            map[string]string `toml:"headers"`
+	ResourceAttributes map[string]string `toml:"resource_attributes"`
+	tls.ClientConfig
+	Log telegraf.Logger `toml:"-"`
+
+	globalTags map[string]string
+	conn       *grpc.ClientConn
+	client     *http.Client
+}
+
+func (o *OpenTelemetry) Description() string {
+	return "Send metrics to an OpenTelemetry collector using OTLP"
+}
+
+func (o *OpenTelemetry) SampleConfig() string {
+	return sampleConfig
+}
+
+// SetGlobalTags implements outputs.GlobalTagsOutput.
+func (o *OpenTelemetry) SetGlobalTags(tags map[string]string) {
+	o.globalTags = tags
+}
+
+func (o *OpenTelemetry) Init() error {
+	switch o.Protocol {
+	case "grpc":
+		if o.Endpoint == "" {
+			o.Endpoint = defaultGRPCEndpoint
+		}
+	case "http":
+		if o.Endpoint == "" {
+			o.Endpoint = defaultHTTPEndpoint
+		}
+	default:
+		return fmt.Errorf("unknown protocol %q", o.Protocol)
+	}
+
+	switch o.Compression {
+	case "", "none", "gzip":
+	default:
+		return fmt.Errorf("unknown compression %q", o.Compression)
+	}
+	return nil
+}
+
+func (o *OpenTelemetry) Connect() error {
+	tlsCfg, err := o.ClientConfig.TLSConfig()
+	if err != nil {
+		return err
+	}
+
+	if o.Protocol == "http" {
+		o.client = &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: tlsCfg,
+			},
+			Timeout: o.Timeout.Duration,
+		}
+		return nil
+	}
+
+	opts := []grpc.DialOption{grpc.WithInsecure()}
+	if tlsCfg != nil {
+		opts = []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(tlsCfg))}
+	}
+	if o.Compression == "gzip" {
+		opts = append(opts, grpc.WithDefaultCallOptions(grpc.UseCompressor("gzip")))
+	}
+
+	// The connection is established in the background and re-established as
+	// needed, errors are reported by the export calls.
+	conn, err := grpc.Dial(o.Endpoint, opts...)
+	if err != nil {
+		return err
+	}
+	o.conn = conn
+	return nil
+}
+
+func (o *OpenTelemetry) Close() error {
+	if o.conn != nil {
+		err := o.conn.Close()
+		o.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (o *OpenTelemetry) Write(metrics []telegraf.Metric) error {
+	req := o.request(metrics)
+	if len(req.ResourceMetrics) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), o.Timeout.Duration)
+	defer cancel()
+
+	var resp *otlp.ExportMetricsServiceResponse
+	var err error
+	if o.Protocol == "http" {
+		resp, err = o.exportHTTP(ctx, req)
+	} else {
+		resp, err = o.exportGRPC(ctx, req)
+	}
+	if err != nil {
+		return err
+	}
+
+	if resp.RejectedDataPoints > 0 || resp.ErrorMessage != "" {
+		o.Log.Warnf("Collector rejected %d data points: %s", resp.RejectedDataPoints, resp.ErrorMessage)
+	}
+	return nil
+}
+
+func (o *OpenTelemetry) exportGRPC(ctx context.Context, req *otlp.ExportMetricsServiceRequest) (*otlp.ExportMetricsServiceResponse, error) {
+	if len(o.Headers) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, metadata.New(o.Headers))
+	}
+	return otlp.Export(ctx, o.conn, req)
+}
+
+func (o *OpenTelemetry) exportHTTP(ctx context.Context, req *otlp.ExportMetricsServiceRequest) (*otlp.ExportMetricsServiceResponse, error) {
+	body, err := req.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	if o.Compression == "gzip" {
+		encoder, err := internal.NewContentEncoder("gzip")
+		if err != nil {
+			return nil, err
+		}
+		if body, err = encoder.Encode(body); err != nil {
+			return nil, err
+		}
+	}
+
+	httpReq, err := http.NewRequest("POST", o.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq = httpReq.WithContext(ctx)
+	httpReq.Header.Set("Content-Type", otlp.ContentType)
+	httpReq.Header.Set("User-Agent", internal.ProductToken())
+	if o.Compression == "gzip" {
+		httpReq.Header.Set("Content-Encoding", "gzip")
+	}
+	for k, v := range o.Headers {
+		httpReq.Header.Set(k, v)
+	}
+
+	httpResp, err := o.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(io.LimitReader(httpResp.Body, 64*1024))
+	if err != nil {
+		return nil, err
+	}
+	if httpResp.StatusCode < 200 || httpResp.StatusCode > 299 {
+		return nil, fmt.Errorf("when writing to [%s] received status code: %d", o.Endpoint, httpResp.StatusCode)
+	}
+
+	resp := &otlp.ExportMetricsServiceResponse{}
+	if strings.HasPrefix(httpResp.Header.Get("Content-Type"), otlp.ContentType) {
+		if err := resp.Unmarshal(respBody); err != nil {
+			o.Log.Debugf("Could not decode response: %v", err)
+		}
+	}
+	return resp, nil
+}
+
+// request converts the metrics to an export request, metrics with the same
+// resource attributes share a resource.
+func (o *OpenTelemetry) request(metrics []telegraf.Metric) *otlp.ExportMetricsServiceRequest {
+	req := &otlp.ExportMetricsServiceRequest{}
+	resources := make(map[string]*otlp.ScopeMetrics)
+	for _, m := range metrics {
+		resource, attributes := o.attributes(m)
+		key := attributesKey(resource)
+
+		scope, ok := resources[key]
+		if !ok {
+			scope = &otlp.ScopeMetrics{
+				Scope: otlp.InstrumentationScope{
+					Name:    "telegraf",
+					Version: internal.Version(),
+				},
+			}
+			req.ResourceMetrics = append(req.ResourceMetrics, &otlp.ResourceMetrics{
+				Resource:     otlp.Resource{Attributes: resource},
+				ScopeMetrics: []*otlp.ScopeMetrics{scope},
+			})
+			resources[key] = scope
+		}
+
+		scope.Metrics = append(scope.Metrics, convert(m, attributes)...)
+	}
+	return req
+}
+
+// attributes splits the tags of the metric into resource and data point
+// attributes.  Tags matching a global tag are resource attributes.
+func (o *OpenTelemetry) attributes(m telegraf.Metric) ([]otlp.KeyValue, []otlp.KeyValue) {
+	resource := make([]otlp.KeyValue, 0, len(o.ResourceAttributes)+len(o.globalTags))
+	attributes := make([]otlp.KeyValue, 0, len(m.TagList()))
+	for _, tag := range m.TagList() {
+		if v, ok := o.globalTags[tag.Key]; ok && v == tag.Value {
+			resource = append(resource, otlp.KeyValue{Key: tag.Key, Value: tag.Value})
+			continue
+		}
+		attributes = append(attributes, otlp.KeyValue{Key: tag.Key, Value: tag.Value})
+	}
+	for k, v := range o.ResourceAttributes {
+		resource = append(resource, otlp.KeyValue{Key: k, Value: v})
+	}
+	sort.Slice(resource, func(i, j int) bool {
+		return resource[i].Key < resource[j].Key
+	})
+	return resource, attributes
+}
+
+func attributesKey(attributes []otlp.KeyValue) string {
+	var key strings.Builder
+	for _, kv := range attributes {
+		key.WriteString(kv.Key)
+		key.WriteByte(0)
+		key.WriteString(kv.Value.(string))
+		key.WriteByte(0)
+	}
+	return key.String()
+}
+
+// convert returns the OTLP metrics for a Telegraf metric based on its value
+// type.  Histograms and summaries are expected in the layout used by the
+// prometheus input with metric_version 1, other metrics create a gauge or sum
+// per field.
+func convert(m telegraf.Metric, attributes []otlp.KeyValue) []*otlp.Metric {
+	ts := uint64(m.Time().UnixNano())
+	switch m.Type() {
+	case telegraf.Histogram:
+		if dp, ok := histogramDataPoint(m); ok {
+			dp.Attributes = attributes
+			dp.TimeUnixNano = ts
+			return []*otlp.Metric{{
+				Name: m.Name(),
+				Histogram: &otlp.Histogram{
+					DataPoints:             []*otlp.HistogramDataPoint{dp},
+					AggregationTemporality: otlp.AggregationTemporalityCumulative,
+				},
+			}}
+		}
+	case telegraf.Summary:
+		if dp, ok := summaryDataPoint(m); ok {
+			dp.Attributes = attributes
+			dp.TimeUnixNano = ts
+			return []*otlp.Metric{{
+				Name:    m.Name(),
+				Summary: &otlp.Summary{DataPoints: []*otlp.SummaryDataPoint{dp}},
+			}}
+		}
+	}
+
+	metrics := make([]*otlp.Metric, 0, len(m.FieldList()))
+	for _, field := range m.FieldList() {
+		value, ok := numberValue(field.Value)
+		if !ok {
+			continue
+		}
+
+		name := m.Name()
+		if field.Key != "value" {
+			name += "_" + field.Key
+		}
+
+		dp := &otlp.NumberDataPoint{
+			Attributes:   attributes,
+			TimeUnixNano: ts,
+			Value:        value,
+		}
+		if m.Type() == telegraf.Counter {
+			metrics = append(metrics, &otlp.Metric{
+				Name: name,
+				Sum: &otlp.Sum{
+					DataPoints:             []*otlp.NumberDataPoint{dp},
+					AggregationTemporality: otlp.AggregationTemporalityCumulative,
+					IsMonotonic:            true,
+				},
+			})
+			continue
+		}
+		metrics = append(metrics, &otlp.Metric{
+			Name:  name,
+			Gauge: &otlp.Gauge{DataPoints: []*otlp.NumberDataPoint{dp}},
+		})
+	}
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].Name < metrics[j].Name
+	})
+	return metrics
+}
+
+// numberValue returns the field value as int64 or float64, string fields are
+// not supported.
+func numberValue(v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case int64:
+		return v, true
+	case uint64:
+		if v > math.MaxInt64 {
+			return float64(v), true
+		}
+		return int64(v), true
+	case float64:
+		return v, true
+	case bool:
+		if v {
+			return int64(1), true
+		}
+		return int64(0), true
+	}
+	return nil, false
+}
+
+func floatValue(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// histogramDataPoint converts the count, sum and cumulative bucket fields,
+// named after the upper bound of the bucket, to a data point.
+func histogramDataPoint(m telegraf.Metric) (*otlp.HistogramDataPoint, bool) {
+	dp := &otlp.HistogramDataPoint{}
+	type bucket struct {
+		bound float64
+		count float64
+	}
+	var buckets []bucket
+	var hasCount, hasSum bool
+	for _, field := range m.FieldList() {
+		v, ok := floatValue(field.Value)
+		if !ok {
+			return nil, false
+		}
+		switch field.Key {
+		case "count":
+			dp.Count = uint64(v)
+			hasCount = true
+		case "sum":
+			dp.Sum = v
+			hasSum = true
+		default:
+			bound, err := strconv.ParseFloat(field.Key, 64)
+			if err != nil {
+				return nil, false
+			}
+			buckets = append(buckets, bucket{bound: bound, count: v})
+		}
+	}
+	if !hasCount || !hasSum {
+		return nil, false
+	}
+
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].bound < buckets[j].bound
+	})
+	var previous uint64
+	for _, b := range buckets {
+		if math.IsInf(b.bound, 1) {
+			break
+		}
+		count := uint64(b.count)
+		if count < previous {
+			return nil, false
+		}
+		dp.ExplicitBounds = append(dp.ExplicitBounds, b.bound)
+		dp.BucketCounts = append(dp.BucketCounts, count-previous)
+		previous = count
+	}
+	if dp.Count < previous {
+		return nil, false
+	}
+	dp.BucketCounts = append(dp.BucketCounts, dp.Count-previous)
+	return dp, true
+}
+
+// summaryDataPoint converts the count, sum and quantile fields, named after
+// the quantile, to a data point.
+func summaryDataPoint(m telegraf.Metric) (*otlp.SummaryDataPoint, bool) {
+	dp := &otlp.SummaryDataPoint{}
+	var hasCount, hasSum bool
+	for _, field := range m.FieldList() {
+		v, ok := floatValue(field.Value)
+		if !ok {
+			return nil, false
+		}
+		switch field.Key {
+		case "count":
+			dp.Count = uint64(v)
+			hasCount = true
+		case "sum":
+			dp.Sum = v
+			hasSum = true
+		default:
+			q, err := strconv.ParseFloat(field.Key, 64)
+			if err != nil {
+				return nil, false
+			}
+			dp.QuantileValues = append(dp.QuantileValues, otlp.ValueAtQuantile{Quantile: q, Value: v})
+		}
+	}
+	if !hasCount || !hasSum {
+		return nil, false
+	}
+
+	sort.Slice(dp.QuantileValues, func(i, j int) bool {
+		return dp.QuantileValues[i].Quantile < dp.QuantileValues[j].Quantile
+	})
+	return dp, true
+}
+
+func init() {
+	outputs.Add("opentelemetry", func() telegraf.Output {
+		return &OpenTelemetry{
+			Protocol: "grpc",
+			Timeout:  internal.Duration{Duration: 5 * time.Second},
+		}
+	})
+}
@@ -0,0 +1,352 @@
+package opentelemetry
+
+import (
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/common/otlp"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+var ts = time.Unix(1577836800, 0)
+
+type collector struct {
+	sync.Mutex
+	requests []*otlp.ExportMetricsServiceRequest
+	metadata []metadata.MD
+}
+
+func (c *collector) Export(ctx context.Context, req *otlp.ExportMetricsServiceRequest) (*otlp.ExportMetricsServiceResponse, error) {
+	c.Lock()
+	defer c.Unlock()
+	c.requests = append(c.requests, req)
+	md, _ := metadata.FromIncomingContext(ctx)
+	c.metadata = append(c.metadata, md)
+	return &otlp.ExportMetricsServiceResponse{}, nil
+}
+
+func newOutput(protocol, endpoint string) *OpenTelemetry {
+	return &OpenTelemetry{
+		Protocol: protocol,
+		Endpoint: endpoint,
+		Timeout:  internal.Duration{Duration: 5 * time.Second},
+		Log:      testutil.Logger{},
+	}
+}
+
+func TestInit(t *testing.T) {
+	o := newOutput("grpc", "")
+	require.NoError(t, o.Init())
+	require.Equal(t, "localhost:4317", o.Endpoint)
+
+	o = newOutput("http", "")
+	require.NoError(t, o.Init())
+	require.Equal(t, "http://localhost:4318/v1/metrics", o.Endpoint)
+
+	require.Error(t, newOutput("thrift", "").Init())
+
+	o = newOutput("grpc", "")
+	o.Compression = "zstd"
+	require.Error(t, o.Init())
+}
+
+func TestConvertValueTypes(t *testing.T) {
+	attributes := []otlp.KeyValue{{Key: "host", Value: "a"}}
+	tests := []struct {
+		name     string
+		metric   telegraf.Metric
+		expected []*otlp.Metric
+	}{
+		{
+			name: "gauge fields",
+			metric: testutil.MustMetric("mem",
+				map[string]string{},
+				map[string]interface{}{
+					"used":     int64(42),
+					"percent":  12.5,
+					"ok":       true,
+					"big":      uint64(1 << 63),
+					"instance": "skipped",
+				},
+				ts, telegraf.Gauge),
+			expected: []*otlp.Metric{
+				gauge("mem_big", float64(1<<63)),
+				gauge("mem_ok", int64(1)),
+				gauge("mem_percent", 12.5),
+				gauge("mem_used", int64(42)),
+			},
+		},
+		{
+			name: "untyped value field",
+			metric: testutil.MustMetric("temperature",
+				map[string]string{},
+				map[string]interface{}{"value": 21.5},
+				ts),
+			expected: []*otlp.Metric{
+				gauge("temperature", 21.5),
+			},
+		},
+		{
+			name: "counter",
+			metric: testutil.MustMetric("requests",
+				map[string]string{},
+				map[string]interface{}{"counter": int64(7)},
+				ts, telegraf.Counter),
+			expected: []*otlp.Metric{
+				{
+					Name: "requests_counter",
+					Sum: &otlp.Sum{
+						DataPoints: []*otlp.NumberDataPoint{
+							{Attributes: attributes, TimeUnixNano: uint64(ts.UnixNano()), Value: int64(7)},
+						},
+						AggregationTemporality: otlp.AggregationTemporalityCumulative,
+						IsMonotonic:            true,
+					},
+				},
+			},
+		},
+		{
+			name: "histogram",
+			metric: testutil.MustMetric("latency",
+				map[string]string{},
+				map[string]interface{}{
+					"count": 10.0,
+					"sum":   4.2,
+					"0.1":   2.0,
+					"0.5":   7.0,
+					"+Inf":  10.0,
+				},
+				ts, telegraf.Histogram),
+			expected: []*otlp.Metric{
+				{
+					Name: "latency",
+					Histogram: &otlp.Histogram{
+						DataPoints: []*otlp.HistogramDataPoint{
+							{
+								Attributes:     attributes,
+								TimeUnixNano:   uint64(ts.UnixNano()),
+								Count:          10,
+								Sum:            4.2,
+								BucketCounts:   []uint64{2, 5, 3},
+								ExplicitBounds: []float64{0.1, 0.5},
+							},
+						},
+						AggregationTemporality: otlp.AggregationTemporalityCumulative,
+					},
+				},
+			},
+		},
+		{
+			name: "summary",
+			metric: testutil.MustMetric("size",
+				map[string]string{},
+				map[string]interface{}{
+					"count": 3.0,
+					"sum":   300.0,
+					"0.99":  180.0,
+					"0.5":   100.0,
+				},
+				ts, telegraf.Summary),
+			expected: []*otlp.Metric{
+				{
+					Name: "size",
+					Summary: &otlp.Summary{
+						DataPoints: []*otlp.SummaryDataPoint{
+							{
+								Attributes:   attributes,
+								TimeUnixNano: uint64(ts.UnixNano()),
+								Count:        3,
+								Sum:          300,
+								QuantileValues: []otlp.ValueAtQuantile{
+									{Quantile: 0.5, Value: 100},
+									{Quantile: 0.99, Value: 180},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "histogram without buckets layout",
+			metric: testutil.MustMetric("latency",
+				map[string]string{},
+				map[string]interface{}{"p99": 1.5},
+				ts, telegraf.Histogram),
+			expected: []*otlp.Metric{
+				gauge("latency_p99", 1.5),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, convert(tt.metric, attributes))
+		})
+	}
+}
+
+func gauge(name string, value interface{}) *otlp.Metric {
+	return &otlp.Metric{
+		Name: name,
+		Gauge: &otlp.Gauge{
+			DataPoints: []*otlp.NumberDataPoint{
+				{
+					Attributes:   []otlp.KeyValue{{Key: "host", Value: "a"}},
+					TimeUnixNano: uint64(ts.UnixNano()),
+					Value:        value,
+				},
+			},
+		},
+	}
+}
+
+func TestResourceAttributes(t *testing.T) {
+	o := newOutput("grpc", "")
+	o.SetGlobalTags(map[string]string{"host": "server01", "dc": "us-east"})
+	o.ResourceAttributes = map[string]string{"service.name": "telegraf"}
+
+	req := o.request([]telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "server01", "dc": "us-east", "cpu": "cpu0"},
+			map[string]interface{}{"value": 1.0},
+			ts),
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "server01", "dc": "us-east", "cpu": "cpu1"},
+			map[string]interface{}{"value": 2.0},
+			ts),
+		// Overridden global tag
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "server02", "dc": "us-east", "cpu": "cpu0"},
+			map[string]interface{}{"value": 3.0},
+			ts),
+	})
+
+	require.Len(t, req.ResourceMetrics, 2)
+	require.Equal(t,
+		[]otlp.KeyValue{
+			{Key: "dc", Value: "us-east"},
+			{Key: "host", Value: "server01"},
+			{Key: "service.name", Value: "telegraf"},
+		},
+		req.ResourceMetrics[0].Resource.Attributes)
+	require.Len(t, req.ResourceMetrics[0].ScopeMetrics[0].Metrics, 2)
+	require.Equal(t, "telegraf", req.ResourceMetrics[0].ScopeMetrics[0].Scope.Name)
+	require.Equal(t,
+		[]otlp.KeyValue{{Key: "cpu", Value: "cpu0"}},
+		req.ResourceMetrics[0].ScopeMetrics[0].Metrics[0].Gauge.DataPoints[0].Attributes)
+
+	require.Equal(t,
+		[]otlp.KeyValue{
+			{Key: "dc", Value: "us-east"},
+			{Key: "service.name", Value: "telegraf"},
+		},
+		req.ResourceMetrics[1].Resource.Attributes)
+	require.Equal(t,
+		[]otlp.KeyValue{{Key: "cpu", Value: "cpu0"}, {Key: "host", Value: "server02"}},
+		req.ResourceMetrics[1].ScopeMetrics[0].Metrics[0].Gauge.DataPoints[0].Attributes)
+}
+
+func TestWriteGRPC(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	c := &collector{}
+	server := grpc.NewServer()
+	otlp.RegisterMetricsServiceServer(server, c)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	o := newOutput("grpc", listener.Addr().String())
+	o.Compression = "gzip"
+	o.Headers = map[string]string{"authorization": "Bearer secret"}
+	require.NoError(t, o.Init())
+	require.NoError(t, o.Connect())
+	defer o.Close()
+
+	require.NoError(t, o.Write([]telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"usage_idle": 42.5},
+			ts),
+	}))
+
+	c.Lock()
+	defer c.Unlock()
+	require.Len(t, c.requests, 1)
+	require.Equal(t, []string{"Bearer secret"}, c.metadata[0].Get("authorization"))
+	require.Equal(t, []*otlp.Metric{gauge("cpu_usage_idle", 42.5)},
+		c.requests[0].ResourceMetrics[0].ScopeMetrics[0].Metrics)
+}
+
+func TestWriteHTTP(t *testing.T) {
+	var req *otlp.ExportMetricsServiceRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1/metrics", r.URL.Path)
+		require.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		require.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+		require.Equal(t, "secret", r.Header.Get("X-Token"))
+
+		gz, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		body, err := ioutil.ReadAll(gz)
+		require.NoError(t, err)
+
+		req = &otlp.ExportMetricsServiceRequest{}
+		require.NoError(t, req.Unmarshal(body))
+
+		resp, err := (&otlp.ExportMetricsServiceResponse{}).Marshal()
+		require.NoError(t, err)
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.Write(resp)
+	}))
+	defer server.Close()
+
+	o := newOutput("http", server.URL+"/v1/metrics")
+	o.Compression = "gzip"
+	o.Headers = map[string]string{"X-Token": "secret"}
+	require.NoError(t, o.Init())
+	require.NoError(t, o.Connect())
+	defer o.Close()
+
+	require.NoError(t, o.Write([]telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"usage_idle": 42.5},
+			ts),
+	}))
+
+	require.NotNil(t, req)
+	require.Equal(t, []*otlp.Metric{gauge("cpu_usage_idle", 42.5)},
+		req.ResourceMetrics[0].ScopeMetrics[0].Metrics)
+}
+
+func TestWriteHTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	o := newOutput("http", server.URL+"/v1/metrics")
+	require.NoError(t, o.Init())
+	require.NoError(t, o.Connect())
+
+	require.Error(t, o.Write([]telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{},
+			map[string]interface{}{"value": 1.0},
+			ts),
+	}))
+}
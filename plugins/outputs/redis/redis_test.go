@@ -0,0 +1,276 @@
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/serializers/influx"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func newRedis(mode, key string) *Redis {
+	r := &Redis{
+		Mode:        mode,
+		Key:         key,
+		StreamField: defaultStreamField,
+		Log:         testutil.Logger{},
+	}
+	r.SetSerializer(influx.NewSerializer())
+	return r
+}
+
+func testMetrics() []telegraf.Metric {
+	return []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"usage_idle": 42.5},
+			time.Unix(1, 500000000)),
+		testutil.MustMetric("mem",
+			map[string]string{"host": "b"},
+			map[string]interface{}{"used": int64(10)},
+			time.Unix(2, 0)),
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "b"},
+			map[string]interface{}{"usage_idle": 50.0},
+			time.Unix(3, 0)),
+	}
+}
+
+func TestStreamCommands(t *testing.T) {
+	r := newRedis("", `telegraf:{{.Name}}`)
+	r.StreamMaxLen = 1000
+	require.NoError(t, r.Init())
+	require.Equal(t, modeStream, r.Mode)
+
+	cmds := r.commands(testMetrics())
+	require.Equal(t, [][]interface{}{
+		{"XADD", "telegraf:cpu", "MAXLEN", "~", int64(1000), "*", "metric",
+			[]byte("cpu,host=a usage_idle=42.5 1500000000\n")},
+		{"XADD", "telegraf:cpu", "MAXLEN", "~", int64(1000), "*", "metric",
+			[]byte("cpu,host=b usage_idle=50 3000000000\n")},
+		{"XADD", "telegraf:mem", "MAXLEN", "~", int64(1000), "*", "metric",
+			[]byte("mem,host=b used=10i 2000000000\n")},
+	}, cmds)
+}
+
+func TestPublishBatchCommands(t *testing.T) {
+	r := newRedis(modePublish, `{{.Tag "host"}}`)
+	r.Batch = true
+	require.NoError(t, r.Init())
+
+	cmds := r.commands(testMetrics())
+	require.Equal(t, [][]interface{}{
+		{"PUBLISH", "a",
+			[]byte("cpu,host=a usage_idle=42.5 1500000000\n")},
+		{"PUBLISH", "b",
+			[]byte("mem,host=b used=10i 2000000000\ncpu,host=b usage_idle=50 3000000000\n")},
+	}, cmds)
+}
+
+func TestTimeSeriesCommands(t *testing.T) {
+	r := newRedis(modeTimeSeries, `telegraf:{{.Tag "host"}}`)
+	r.Retention = internal.Duration{Duration: time.Hour}
+	require.NoError(t, r.Init())
+	require.Equal(t, defaultDuplicate, r.Duplicate)
+
+	cmds := r.commands(testMetrics())
+	require.Equal(t, [][]interface{}{
+		{"TS.ADD", "telegraf:a:cpu,host=a:usage_idle", int64(1500), "42.5", "RETENTION", int64(3600000),
+			"ON_DUPLICATE", "LAST", "LABELS", "measurement", "cpu", "field", "usage_idle", "host", "a"},
+		{"TS.ADD", "telegraf:b:mem,host=b:used", int64(2000), "10", "RETENTION", int64(3600000),
+			"ON_DUPLICATE", "LAST", "LABELS", "measurement", "mem", "field", "used", "host", "b"},
+		{"TS.ADD", "telegraf:b:cpu,host=b:usage_idle", int64(3000), "50", "RETENTION", int64(3600000),
+			"ON_DUPLICATE", "LAST", "LABELS", "measurement", "cpu", "field", "usage_idle", "host", "b"},
+	}, cmds)
+}
+
+func TestTimeSeriesKeyPerSeries(t *testing.T) {
+	r := newRedis(modeTimeSeries, defaultKey)
+	r.Duplicate = "block"
+	require.NoError(t, r.Init())
+
+	cmds := r.commands([]telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "a", "cpu": "cpu0"},
+			map[string]interface{}{"usage_idle": 1.0},
+			time.Unix(0, 0)),
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "a", "cpu": "cpu1"},
+			map[string]interface{}{"usage_idle": 2.0},
+			time.Unix(0, 0)),
+		testutil.MustMetric("mem",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"usage_idle": 3.0},
+			time.Unix(0, 0)),
+	})
+	require.Len(t, cmds, 3)
+	require.Equal(t, "telegraf:cpu,cpu=cpu0,host=a:usage_idle", cmds[0][1])
+	require.Equal(t, "telegraf:cpu,cpu=cpu1,host=a:usage_idle", cmds[1][1])
+	require.Equal(t, "telegraf:mem,host=a:usage_idle", cmds[2][1])
+	require.Equal(t, "BLOCK", cmds[0][5])
+}
+
+func TestTimeSeriesSkipsNonNumeric(t *testing.T) {
+	r := newRedis(modeTimeSeries, defaultKey)
+	require.NoError(t, r.Init())
+
+	cmds := r.commands([]telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{},
+			map[string]interface{}{"state": "ok", "nan": math.NaN()},
+			time.Unix(0, 0)),
+	})
+	require.Empty(t, cmds)
+}
+
+func TestKeyTemplateError(t *testing.T) {
+	r := newRedis(modePublish, `{{.Tag "site"}}`)
+	require.NoError(t, r.Init())
+	require.Empty(t, r.commands(testMetrics()))
+}
+
+func TestInit(t *testing.T) {
+	r := newRedis("lpush", defaultKey)
+	require.Error(t, r.Init())
+
+	r = newRedis(modeStream, `{{.Name`)
+	require.Error(t, r.Init())
+
+	r = newRedis(modeTimeSeries, defaultKey)
+	r.Duplicate = "replace"
+	require.Error(t, r.Init())
+}
+
+// fakeServer answers the commands sent by the output with the replies
+// returned by reply, encoded in the Redis protocol.
+func fakeServer(t *testing.T, reply func(args []string) string) (string, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				rd := bufio.NewReader(conn)
+				for {
+					args, err := readCommand(rd)
+					if err != nil {
+						return
+					}
+					if _, err := conn.Write([]byte(reply(args))); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return "tcp://" + listener.Addr().String(), func() { listener.Close() }
+}
+
+// readCommand reads a command sent as an array of bulk strings.
+func readCommand(rd *bufio.Reader) ([]string, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+func TestWriteSkipsDuplicates(t *testing.T) {
+	var mu sync.Mutex
+	var written []string
+	server, closer := fakeServer(t, func(args []string) string {
+		mu.Lock()
+		defer mu.Unlock()
+		if args[0] != "TS.ADD" {
+			return "+OK\r\n"
+		}
+		if args[2] == "2000" {
+			return "-ERR TSDB: Error at upsert, update is not supported when DUPLICATE_POLICY is set to BLOCK mode\r\n"
+		}
+		written = append(written, args[1])
+		return ":1\r\n"
+	})
+
+	r := newRedis(modeTimeSeries, defaultKey)
+	defer closer()
+	r.Server = server
+	r.Duplicate = "block"
+	require.NoError(t, r.Init())
+	require.NoError(t, r.Connect())
+	defer r.Close()
+
+	require.NoError(t, r.Write(testMetrics()))
+	mu.Lock()
+	require.Equal(t, []string{
+		"telegraf:cpu,host=a:usage_idle",
+		"telegraf:cpu,host=b:usage_idle",
+	}, written)
+	mu.Unlock()
+}
+
+func TestWriteError(t *testing.T) {
+	server, closer := fakeServer(t, func(args []string) string {
+		if args[0] != "TS.ADD" {
+			return "+OK\r\n"
+		}
+		return "-ERR TSDB: the key is not a TSDB key\r\n"
+	})
+
+	r := newRedis(modeTimeSeries, defaultKey)
+	defer closer()
+	r.Server = server
+	require.NoError(t, r.Init())
+	require.NoError(t, r.Connect())
+	defer r.Close()
+
+	require.Error(t, r.Write(testMetrics()))
+}
+
+func TestConnectAndWrite(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	r := newRedis(modeStream, `telegraf:{{.Name}}`)
+	r.Server = fmt.Sprintf("tcp://%s:6379", testutil.GetLocalHost())
+	require.NoError(t, r.Init())
+	require.NoError(t, r.Connect())
+	require.NoError(t, r.Write(testMetrics()))
+	require.NoError(t, r.Close())
+}
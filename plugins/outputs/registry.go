@@ -11,3 +11,11 @@ var Outputs = map[string]Creator{}
 func Add(name string, creator Creator) {
 	Outputs[name] = creator
 }
+
+// GlobalTagsOutput is implemented by outputs that handle the global tags of
+// the agent differently than the tags added by the inputs.
+type GlobalTagsOutput interface {
+	// SetGlobalTags is called with the global tags before the output is
+	// connected.  The map must not be modified.
+	SetGlobalTags(tags map[string]string)
+}
@@ -10,18 +10,26 @@ import (
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/internal"
 	tlsint "github.com/influxdata/telegraf/internal/tls"
+	"github.com/influxdata/telegraf/plugins/common/shard"
 	"github.com/influxdata/telegraf/plugins/outputs"
 	"github.com/influxdata/telegraf/plugins/serializers"
 )
 
 type SocketWriter struct {
 	Address         string
+	Addresses       []string `toml:"addresses"`
 	KeepAlivePeriod *internal.Duration
 	tlsint.ClientConfig
+	shard.Config
 
 	serializers.Serializer
 
 	net.Conn
+
+	// writers holds one writer for each address when multiple addresses
+	// are configured.
+	writers []*SocketWriter
+	sharder *shard.Sharder
 }
 
 func (sw *SocketWriter) Description() string {
@@ -42,6 +50,19 @@ func (sw *SocketWriter) SampleConfig() string {
   # address = "unix:///tmp/telegraf.sock"
   # address = "unixgram:///tmp/telegraf.sock"
 
+  ## Multiple URLs to distribute the metrics across, used together with
+  ## address.
+  # addresses = ["tcp://10.0.0.1:8094", "tcp://10.0.0.2:8094"]
+
+  ## How metrics are distributed across multiple addresses:
+  ##   ""                - write to a random address, fail over to the others
+  ##   "round-robin"     - write to the next address, fail over to the others
+  ##   "consistent-hash" - write each series to a stable address
+  # shard_mode = ""
+  ## Tag identifying the series in consistent-hash mode; metrics without the
+  ## tag are sharded by measurement name and tag set.
+  # shard_tag = ""
+
   ## Optional TLS Config
   # tls_ca = "/etc/telegraf/ca.pem"
   # tls_cert = "/etc/telegraf/cert.pem"
@@ -67,7 +88,20 @@ func (sw *SocketWriter) SetSerializer(s serializers.Serializer) {
 	sw.Serializer = s
 }
 
+// addresses returns all configured addresses.
+func (sw *SocketWriter) addresses() []string {
+	var addresses []string
+	if sw.Address != "" {
+		addresses = append(addresses, sw.Address)
+	}
+	return append(addresses, sw.Addresses...)
+}
+
 func (sw *SocketWriter) Connect() error {
+	if len(sw.Addresses) > 0 {
+		return sw.connectAll()
+	}
+
 	spl := strings.SplitN(sw.Address, "://", 2)
 	if len(spl) != 2 {
 		return fmt.Errorf("invalid address: %s", sw.Address)
@@ -96,6 +130,45 @@ func (sw *SocketWriter) Connect() error {
 	return nil
 }
 
+// connectAll creates and connects a writer for each address.  Addresses
+// that cannot be reached are connected again on the next write to them.
+func (sw *SocketWriter) connectAll() error {
+	addresses := sw.addresses()
+	if sw.writers == nil {
+		sharder, err := sw.Config.NewSharder(addresses)
+		if err != nil {
+			return err
+		}
+		sw.sharder = sharder
+
+		for _, address := range addresses {
+			sw.writers = append(sw.writers, &SocketWriter{
+				Address:         address,
+				KeepAlivePeriod: sw.KeepAlivePeriod,
+				ClientConfig:    sw.ClientConfig,
+				Serializer:      sw.Serializer,
+			})
+		}
+	}
+
+	var connected int
+	for _, w := range sw.writers {
+		if w.Conn != nil {
+			connected++
+			continue
+		}
+		if err := w.Connect(); err != nil {
+			log.Printf("E! [outputs.socket_writer] Could not connect to %s: %v", w.Address, err)
+			continue
+		}
+		connected++
+	}
+	if connected == 0 {
+		return fmt.Errorf("could not connect to any of %s", strings.Join(addresses, ", "))
+	}
+	return nil
+}
+
 func (sw *SocketWriter) setKeepAlive(c net.Conn) error {
 	if sw.KeepAlivePeriod == nil {
 		return nil
@@ -117,6 +190,10 @@ func (sw *SocketWriter) setKeepAlive(c net.Conn) error {
 // If an error is encountered, it is up to the caller to retry the same write again later.
 // Not parallel safe.
 func (sw *SocketWriter) Write(metrics []telegraf.Metric) error {
+	if sw.writers != nil {
+		return sw.writeAll(metrics)
+	}
+
 	if sw.Conn == nil {
 		// previous write failed with permanent error and socket was closed.
 		if err := sw.Connect(); err != nil {
@@ -145,8 +222,47 @@ func (sw *SocketWriter) Write(metrics []telegraf.Metric) error {
 	return nil
 }
 
+// writeAll writes the metrics to the writer of each address according to
+// the shard mode.
+func (sw *SocketWriter) writeAll(metrics []telegraf.Metric) error {
+	if sw.sharder.Mode() == shard.ModeConsistentHash {
+		// Only the series of the addresses that failed are retried.
+		var failed []telegraf.Metric
+		var firstErr error
+		for n, part := range sw.sharder.Partition(metrics) {
+			if len(part) == 0 {
+				continue
+			}
+			if err := sw.writers[n].Write(part); err != nil {
+				log.Printf("E! [outputs.socket_writer] When writing to %s: %v", sw.writers[n].Address, err)
+				failed = append(failed, part...)
+				if firstErr == nil {
+					firstErr = err
+				}
+			}
+		}
+		if firstErr != nil && len(failed) < len(metrics) {
+			return &telegraf.PartialWriteError{Err: firstErr, Failed: failed}
+		}
+		return firstErr
+	}
+
+	for _, n := range sw.sharder.Order() {
+		err := sw.writers[n].Write(metrics)
+		if err == nil {
+			return nil
+		}
+		log.Printf("E! [outputs.socket_writer] When writing to %s: %v", sw.writers[n].Address, err)
+	}
+	return fmt.Errorf("could not write to any address")
+}
+
 // Close closes the connection. Noop if already closed.
 func (sw *SocketWriter) Close() error {
+	for _, w := range sw.writers {
+		w.Close()
+	}
+
 	if sw.Conn == nil {
 		return nil
 	}
@@ -3,6 +3,7 @@ package socket_writer
 import (
 	"bufio"
 	"bytes"
+	"fmt"
 	"io/ioutil"
 	"net"
 	"os"
@@ -11,6 +12,7 @@ import (
 	"testing"
 
 	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/plugins/common/shard"
 	"github.com/influxdata/telegraf/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -195,3 +197,112 @@ func TestSocketWriter_Write_reconnect(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, string(mbsout), string(buf[:n]))
 }
+
+func TestSocketWriter_roundRobin(t *testing.T) {
+	var listeners []net.Listener
+	sw := newSocketWriter()
+	sw.Config = shard.Config{ShardMode: shard.ModeRoundRobin}
+	for i := 0; i < 2; i++ {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer listener.Close()
+		listeners = append(listeners, listener)
+		sw.Addresses = append(sw.Addresses, "tcp://"+listener.Addr().String())
+	}
+
+	require.NoError(t, sw.Connect())
+
+	var lconns []net.Conn
+	for _, listener := range listeners {
+		lconn, err := listener.Accept()
+		require.NoError(t, err)
+		lconns = append(lconns, lconn)
+	}
+
+	metrics := []telegraf.Metric{testutil.TestMetric(1, "first"), testutil.TestMetric(2, "second")}
+	for _, m := range metrics {
+		require.NoError(t, sw.Write([]telegraf.Metric{m}))
+	}
+	require.NoError(t, sw.Close())
+
+	for i, lconn := range lconns {
+		expected, _ := sw.Serialize(metrics[i])
+		actual, err := ioutil.ReadAll(lconn)
+		require.NoError(t, err)
+		assert.Equal(t, string(expected), string(actual))
+	}
+}
+
+func TestSocketWriter_consistentHash(t *testing.T) {
+	var listeners []net.Listener
+	sw := newSocketWriter()
+	sw.Config = shard.Config{ShardMode: shard.ModeConsistentHash}
+	for i := 0; i < 2; i++ {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer listener.Close()
+		listeners = append(listeners, listener)
+		sw.Addresses = append(sw.Addresses, "tcp://"+listener.Addr().String())
+	}
+
+	require.NoError(t, sw.Connect())
+
+	var lconns []net.Conn
+	for _, listener := range listeners {
+		lconn, err := listener.Accept()
+		require.NoError(t, err)
+		lconns = append(lconns, lconn)
+	}
+
+	var metrics []telegraf.Metric
+	expected := make([]string, len(listeners))
+	for i := 0; i < 10; i++ {
+		m := testutil.TestMetric(i, fmt.Sprintf("series%d", i))
+		metrics = append(metrics, m)
+		bs, _ := sw.Serialize(m)
+		expected[sw.sharder.Endpoint(m)] += string(bs)
+	}
+	require.NoError(t, sw.Write(metrics))
+	require.NoError(t, sw.Close())
+
+	for i, lconn := range lconns {
+		actual, err := ioutil.ReadAll(lconn)
+		require.NoError(t, err)
+		assert.Equal(t, expected[i], string(actual))
+	}
+}
+
+func TestSocketWriter_consistentHashPartialWrite(t *testing.T) {
+	sw := newSocketWriter()
+	sw.Config = shard.Config{ShardMode: shard.ModeConsistentHash}
+	for i := 0; i < 2; i++ {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer listener.Close()
+		sw.Addresses = append(sw.Addresses, "tcp://"+listener.Addr().String())
+	}
+
+	require.NoError(t, sw.Connect())
+	defer sw.Close()
+
+	// close the socket of the second address to generate an error
+	sw.writers[1].Conn.Close()
+
+	var metrics []telegraf.Metric
+	var expected []telegraf.Metric
+	for i := 0; i < 10; i++ {
+		m := testutil.TestMetric(i, fmt.Sprintf("series%d", i))
+		metrics = append(metrics, m)
+		if sw.sharder.Endpoint(m) == 1 {
+			expected = append(expected, m)
+		}
+	}
+	require.NotEmpty(t, expected)
+	require.NotEqual(t, len(metrics), len(expected))
+
+	err := sw.Write(metrics)
+	require.Error(t, err)
+	partial, ok := err.(*telegraf.PartialWriteError)
+	require.True(t, ok, "expected partial write error")
+	assert.Equal(t, expected, partial.Failed)
+}
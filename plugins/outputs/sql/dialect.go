@@ -0,0 +1,100 @@
+package sql
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Column kinds used to look up the SQL type of a column.
+const (
+	kindInteger   = "integer"
+	kindUnsigned  = "unsigned"
+	kindFloat     = "float"
+	kindString    = "string"
+	kindBoolean   = "boolean"
+	kindTimestamp = "timestamp"
+)
+
+// dialect holds the differences in SQL syntax between the supported drivers.
+type dialect struct {
+	quoteChar   string
+	numbered    bool
+	columnTypes map[string]string
+}
+
+var dialects = map[string]dialect{
+	"pgx": {
+		quoteChar: `"`,
+		numbered:  true,
+		columnTypes: map[string]string{
+			kindInteger:   "BIGINT",
+			kindUnsigned:  "NUMERIC(20,0)",
+			kindFloat:     "DOUBLE PRECISION",
+			kindString:    "TEXT",
+			kindBoolean:   "BOOLEAN",
+			kindTimestamp: "TIMESTAMPTZ",
+		},
+	},
+	"mysql": {
+		quoteChar: "`",
+		columnTypes: map[string]string{
+			kindInteger:   "BIGINT",
+			kindUnsigned:  "BIGINT UNSIGNED",
+			kindFloat:     "DOUBLE",
+			kindString:    "TEXT",
+			kindBoolean:   "BOOLEAN",
+			kindTimestamp: "DATETIME(6)",
+		},
+	},
+	"sqlite3": {
+		quoteChar: `"`,
+		columnTypes: map[string]string{
+			kindInteger:   "INTEGER",
+			kindUnsigned:  "INTEGER",
+			kindFloat:     "REAL",
+			kindString:    "TEXT",
+			kindBoolean:   "BOOLEAN",
+			kindTimestamp: "TIMESTAMP",
+		},
+	},
+}
+
+// quote returns the identifier quoted for use in a statement.
+func (d *dialect) quote(ident string) string {
+	escaped := strings.Replace(ident, d.quoteChar, d.quoteChar+d.quoteChar, -1)
+	return d.quoteChar + escaped + d.quoteChar
+}
+
+// placeholder returns the bind parameter for the n-th (1-based) value.
+func (d *dialect) placeholder(n int) string {
+	if d.numbered {
+		return "$" + strconv.Itoa(n)
+	}
+	return "?"
+}
+
+func (d *dialect) createTable(table string, columns []column) string {
+	defs := make([]string, 0, len(columns))
+	for _, c := range columns {
+		defs = append(defs, d.quote(c.name)+" "+d.columnTypes[c.kind])
+	}
+	return "CREATE TABLE " + d.quote(table) + " (" + strings.Join(defs, ", ") + ")"
+}
+
+func (d *dialect) addColumn(table string, c column) string {
+	return "ALTER TABLE " + d.quote(table) + " ADD COLUMN " + d.quote(c.name) + " " + d.columnTypes[c.kind]
+}
+
+func (d *dialect) selectNone(table string) string {
+	return "SELECT * FROM " + d.quote(table) + " WHERE 1=0"
+}
+
+func (d *dialect) insert(table string, columns []string) string {
+	names := make([]string, 0, len(columns))
+	params := make([]string, 0, len(columns))
+	for i, name := range columns {
+		names = append(names, d.quote(name))
+		params = append(params, d.placeholder(i+1))
+	}
+	return "INSERT INTO " + d.quote(table) + " (" + strings.Join(names, ", ") + ") VALUES (" + strings.Join(params, ", ") + ")"
+}
@@ -0,0 +1,90 @@
+package sql
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInit(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(s *SQL)
+	}{
+		{
+			name:   "unknown driver",
+			modify: func(s *SQL) { s.Driver = "oracle" },
+		},
+		{
+			name:   "unknown table mode",
+			modify: func(s *SQL) { s.TableMode = "tall" },
+		},
+		{
+			name: "wide mode without table",
+			modify: func(s *SQL) {
+				s.TableMode = modeWide
+				s.Table = ""
+			},
+		},
+		{
+			name: "copy without pgx",
+			modify: func(s *SQL) {
+				s.Driver = "mysql"
+				s.UseCopy = true
+			},
+		},
+		{
+			name:   "unknown column type",
+			modify: func(s *SQL) { s.ColumnTypes = map[string]string{"decimal": "DECIMAL"} },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &SQL{
+				Driver:          "pgx",
+				TableMode:       modeMeasurement,
+				TimestampColumn: "time",
+			}
+			require.NoError(t, s.Init())
+
+			tt.modify(s)
+			require.Error(t, s.Init())
+		})
+	}
+}
+
+func TestDriverRegistered(t *testing.T) {
+	require.True(t, driverRegistered("pgx"))
+	require.True(t, driverRegistered("mysql"))
+	require.False(t, driverRegistered("oracle"))
+}
+
+func TestStatements(t *testing.T) {
+	pg := dialects["pgx"]
+	require.Equal(t,
+		`INSERT INTO "cpu" ("time", "host") VALUES ($1, $2)`,
+		pg.insert("cpu", []string{"time", "host"}))
+	require.Equal(t,
+		`CREATE TABLE "cpu" ("time" TIMESTAMPTZ, "usage" DOUBLE PRECISION)`,
+		pg.createTable("cpu", []column{{"time", kindTimestamp}, {"usage", kindFloat}}))
+
+	my := dialects["mysql"]
+	require.Equal(t,
+		"INSERT INTO `cpu` (`time`, `host`) VALUES (?, ?)",
+		my.insert("cpu", []string{"time", "host"}))
+	require.Equal(t,
+		"ALTER TABLE `cpu` ADD COLUMN `free` BIGINT UNSIGNED",
+		my.addColumn("cpu", column{"free", kindUnsigned}))
+	require.Equal(t, "`we``ird`", my.quote("we`ird"))
+}
+
+func TestConvertUnsigned(t *testing.T) {
+	kind, v := convert(uint64(42))
+	require.Equal(t, kindUnsigned, kind)
+	require.Equal(t, int64(42), v)
+
+	kind, v = convert(uint64(math.MaxUint64))
+	require.Equal(t, kindUnsigned, kind)
+	require.Equal(t, "18446744073709551615", v)
+}
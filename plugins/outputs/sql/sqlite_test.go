@@ -0,0 +1,256 @@
+// +build sqlite
+
+package sql
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func newSQLite(t *testing.T) (*SQL, func()) {
+	dir, err := ioutil.TempDir("", "telegraf-sql")
+	require.NoError(t, err)
+
+	s := &SQL{
+		Driver:          "sqlite3",
+		DataSourceName:  filepath.Join(dir, "metrics.db"),
+		TableMode:       modeMeasurement,
+		Table:           "metrics",
+		TimestampColumn: "time",
+		TableCreate:     true,
+		ColumnAdd:       true,
+		Timeout:         internal.Duration{Duration: 5 * time.Second},
+		Log:             testutil.Logger{},
+	}
+	return s, func() { os.RemoveAll(dir) }
+}
+
+func start(t *testing.T, s *SQL) *sql.DB {
+	require.NoError(t, s.Init())
+	require.NoError(t, s.Connect())
+	return s.db
+}
+
+func query(t *testing.T, db *sql.DB, stmt string) [][]interface{} {
+	rows, err := db.Query(stmt)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	require.NoError(t, err)
+
+	var result [][]interface{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		require.NoError(t, rows.Scan(ptrs...))
+		result = append(result, values)
+	}
+	require.NoError(t, rows.Err())
+	return result
+}
+
+func columnNames(t *testing.T, db *sql.DB, table string) []string {
+	rows, err := db.Query(`SELECT * FROM "` + table + `" WHERE 1=0`)
+	require.NoError(t, err)
+	defer rows.Close()
+	names, err := rows.Columns()
+	require.NoError(t, err)
+	return names
+}
+
+func TestWriteMeasurementMode(t *testing.T) {
+	s, cleanup := newSQLite(t)
+	defer cleanup()
+	db := start(t, s)
+	defer s.Close()
+
+	now := time.Unix(1577836800, 0)
+	require.NoError(t, s.Write([]telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"usage": 42.5, "cores": int64(4)},
+			now),
+		testutil.MustMetric("mem",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"free": uint64(1024), "ok": true},
+			now),
+	}))
+
+	require.Equal(t, []string{"time", "host", "cores", "usage"}, columnNames(t, db, "cpu"))
+	require.Equal(t, []string{"time", "host", "free", "ok"}, columnNames(t, db, "mem"))
+	require.Equal(t,
+		[][]interface{}{{"a", int64(4), 42.5}},
+		query(t, db, `SELECT host, cores, usage FROM cpu`))
+	require.Equal(t,
+		[][]interface{}{{"a", int64(1024), true}},
+		query(t, db, `SELECT host, free, ok FROM mem`))
+
+	// New tags and fields are added as columns
+	require.NoError(t, s.Write([]telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "b", "cpu": "cpu0"},
+			map[string]interface{}{"usage": 1.5, "state": "idle"},
+			now.Add(time.Second)),
+	}))
+	require.Equal(t,
+		[]string{"time", "host", "cores", "usage", "cpu", "state"},
+		columnNames(t, db, "cpu"))
+	require.Equal(t,
+		[][]interface{}{
+			{"a", nil, nil, int64(4), 42.5},
+			{"b", "cpu0", "idle", nil, 1.5},
+		},
+		query(t, db, `SELECT host, cpu, state, cores, usage FROM cpu ORDER BY time`))
+}
+
+func TestWriteExistingTable(t *testing.T) {
+	s, cleanup := newSQLite(t)
+	defer cleanup()
+	s.TablePrefix = "telegraf_"
+	s.TableCreate = false
+	s.ColumnAdd = false
+	db := start(t, s)
+	defer s.Close()
+
+	m := testutil.MustMetric("cpu",
+		map[string]string{"host": "a"},
+		map[string]interface{}{"usage": 42.5, "cores": int64(4)},
+		time.Unix(1577836800, 0))
+
+	require.Error(t, s.Write([]telegraf.Metric{m}))
+
+	_, err := db.Exec(`CREATE TABLE telegraf_cpu (time TIMESTAMP, host TEXT, usage REAL)`)
+	require.NoError(t, err)
+
+	// Values without a column are dropped
+	require.NoError(t, s.Write([]telegraf.Metric{m}))
+	require.Equal(t, []string{"time", "host", "usage"}, columnNames(t, db, "telegraf_cpu"))
+	require.Equal(t,
+		[][]interface{}{{"a", 42.5}},
+		query(t, db, `SELECT host, usage FROM telegraf_cpu`))
+}
+
+func TestWriteWideMode(t *testing.T) {
+	s, cleanup := newSQLite(t)
+	defer cleanup()
+	s.TableMode = modeWide
+	db := start(t, s)
+	defer s.Close()
+
+	now := time.Unix(1577836800, 0)
+	require.NoError(t, s.Write([]telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"usage": 42.5},
+			now),
+		testutil.MustMetric("mem",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"free": int64(1024)},
+			now.Add(time.Second)),
+	}))
+
+	require.Equal(t,
+		[]string{"time", "measurement", "host", "free", "usage"},
+		columnNames(t, db, "metrics"))
+	require.Equal(t,
+		[][]interface{}{
+			{"cpu", "a", nil, 42.5},
+			{"mem", "a", int64(1024), nil},
+		},
+		query(t, db, `SELECT measurement, host, free, usage FROM metrics ORDER BY time`))
+}
+
+func TestWriteNameCollisions(t *testing.T) {
+	s, cleanup := newSQLite(t)
+	defer cleanup()
+	s.TableMode = modeWide
+	db := start(t, s)
+	defer s.Close()
+
+	require.NoError(t, s.Write([]telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "a", "measurement": "m"},
+			map[string]interface{}{"host": 1.5, "time": int64(2)},
+			time.Unix(1577836800, 0)),
+	}))
+
+	require.Equal(t,
+		[]string{"time", "measurement", "host", "measurement_tag", "host_field", "time_field"},
+		columnNames(t, db, "metrics"))
+	require.Equal(t,
+		[][]interface{}{{"cpu", "a", "m", 1.5, int64(2)}},
+		query(t, db, `SELECT measurement, host, measurement_tag, host_field, time_field FROM metrics`))
+}
+
+func TestWriteSingleTransaction(t *testing.T) {
+	s, cleanup := newSQLite(t)
+	defer cleanup()
+	db := start(t, s)
+	defer s.Close()
+
+	_, err := db.Exec(`CREATE TABLE mem (time TIMESTAMP, free INTEGER CHECK (free >= 0))`)
+	require.NoError(t, err)
+
+	now := time.Unix(1577836800, 0)
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{},
+			map[string]interface{}{"usage": 42.5},
+			now),
+		testutil.MustMetric("mem",
+			map[string]string{},
+			map[string]interface{}{"free": int64(-1)},
+			now),
+	}
+
+	// The rows written to cpu are rolled back when writing to mem fails
+	require.Error(t, s.Write(metrics))
+	require.Empty(t, query(t, db, `SELECT usage FROM cpu`))
+}
+
+func TestWriteNarrowMode(t *testing.T) {
+	s, cleanup := newSQLite(t)
+	defer cleanup()
+	s.TableMode = modeNarrow
+	s.Table = "points"
+	db := start(t, s)
+	defer s.Close()
+
+	require.NoError(t, s.Write([]telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "a", "cpu": "cpu0"},
+			map[string]interface{}{
+				"usage": 42.5,
+				"cores": uint64(math.MaxUint64),
+				"ok":    true,
+				"state": "idle",
+			},
+			time.Unix(1577836800, 0)),
+	}))
+
+	require.Equal(t,
+		[]string{"time", "measurement", "tags", "field", "value", "string_value"},
+		columnNames(t, db, "points"))
+	require.Equal(t,
+		[][]interface{}{
+			{"cpu", `{"cpu":"cpu0","host":"a"}`, "cores", float64(math.MaxUint64), nil},
+			{"cpu", `{"cpu":"cpu0","host":"a"}`, "ok", 1.0, nil},
+			{"cpu", `{"cpu":"cpu0","host":"a"}`, "state", nil, "idle"},
+			{"cpu", `{"cpu":"cpu0","host":"a"}`, "usage", 42.5, nil},
+		},
+		query(t, db, `SELECT measurement, tags, field, value, string_value FROM points ORDER BY field`))
+}
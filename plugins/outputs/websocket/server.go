@@ -0,0 +1,264 @@
+package websocket
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal/models"
+	tlsint "github.com/influxdata/telegraf/internal/tls"
+	"github.com/influxdata/telegraf/plugins/serializers"
+	"golang.org/x/net/websocket"
+)
+
+// sendQueueSize is the number of batches queued for a client, further batches
+// are dropped until the client catches up.
+const sendQueueSize = 16
+
+// Subscription is the message sent by clients to only receive some of the
+// metrics.  It uses the same rules as the metric filtering of the plugins.
+type Subscription struct {
+	NamePass []string            `json:"namepass"`
+	NameDrop []string            `json:"namedrop"`
+	TagPass  map[string][]string `json:"tagpass"`
+	TagDrop  map[string][]string `json:"tagdrop"`
+}
+
+// filter compiles the subscription into a metric filter.
+func (s *Subscription) filter() (*models.Filter, error) {
+	f := &models.Filter{
+		NamePass: s.NamePass,
+		NameDrop: s.NameDrop,
+	}
+	for name, values := range s.TagPass {
+		f.TagPass = append(f.TagPass, models.TagFilter{Name: name, Filter: values})
+	}
+	for name, values := range s.TagDrop {
+		f.TagDrop = append(f.TagDrop, models.TagFilter{Name: name, Filter: values})
+	}
+	if err := f.Compile(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// server streams the metrics to the clients of the websocket endpoint.
+type server struct {
+	log          telegraf.Logger
+	writeTimeout time.Duration
+	http         *http.Server
+	addr         net.Addr
+	wg           sync.WaitGroup
+	handlers     sync.WaitGroup
+
+	mu      sync.Mutex
+	clients map[*client]struct{}
+}
+
+type client struct {
+	conn *websocket.Conn
+	send chan []byte
+
+	mu     sync.Mutex
+	filter *models.Filter
+}
+
+func (c *client) setFilter(f *models.Filter) {
+	c.mu.Lock()
+	c.filter = f
+	c.mu.Unlock()
+}
+
+func (c *client) getFilter() *models.Filter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.filter
+}
+
+func (w *WebSocket) listen() error {
+	tlsConfig, err := (&tlsint.ServerConfig{
+		TLSCert:           w.TLSCert,
+		TLSKey:            w.TLSKey,
+		TLSAllowedCACerts: w.TLSAllowedCACerts,
+	}).TLSConfig()
+	if err != nil {
+		return err
+	}
+
+	w.server = &server{
+		log:          w.Log,
+		writeTimeout: w.WriteTimeout.Duration,
+		clients:      make(map[*client]struct{}),
+	}
+	w.server.http = &http.Server{
+		Handler:   w.handler(),
+		TLSConfig: tlsConfig,
+	}
+
+	var listener net.Listener
+	if tlsConfig != nil {
+		listener, err = tls.Listen("tcp", w.ServiceAddress, tlsConfig)
+	} else {
+		listener, err = net.Listen("tcp", w.ServiceAddress)
+	}
+	if err != nil {
+		return err
+	}
+	w.server.addr = listener.Addr()
+	w.Log.Infof("Listening on %s", listener.Addr())
+
+	w.server.wg.Add(1)
+	go func() {
+		defer w.server.wg.Done()
+		err := w.server.http.Serve(listener)
+		if err != http.ErrServerClosed {
+			w.Log.Errorf("Serve error on %s: %v", w.ServiceAddress, err)
+		}
+	}()
+	return nil
+}
+
+// checkOrigin accepts the websocket handshake if the origin of the request is
+// allowed.
+func (w *WebSocket) checkOrigin(config *websocket.Config, req *http.Request) error {
+	if len(w.AllowedOrigins) == 0 {
+		return nil
+	}
+
+	origin := req.Header.Get("Origin")
+	for _, allowed := range w.AllowedOrigins {
+		if origin == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("origin %q not allowed", origin)
+}
+
+// serve handles a client connection, the subscriptions sent by the client
+// are read until the connection is closed.
+func (s *server) serve(conn *websocket.Conn) {
+	c := &client{
+		conn: conn,
+		send: make(chan []byte, sendQueueSize),
+	}
+
+	s.handlers.Add(1)
+	defer s.handlers.Done()
+
+	s.mu.Lock()
+	s.clients[c] = struct{}{}
+	s.mu.Unlock()
+	s.log.Debugf("Client %s connected", conn.Request().RemoteAddr)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.writeLoop(c)
+	}()
+
+	for {
+		var msg []byte
+		if err := websocket.Message.Receive(conn, &msg); err != nil {
+			break
+		}
+
+		var sub Subscription
+		err := json.Unmarshal(msg, &sub)
+		if err != nil {
+			s.log.Debugf("Invalid subscription from %s: %v", conn.Request().RemoteAddr, err)
+			continue
+		}
+
+		f, err := sub.filter()
+		if err != nil {
+			s.log.Debugf("Invalid subscription from %s: %v", conn.Request().RemoteAddr, err)
+			continue
+		}
+		c.setFilter(f)
+	}
+
+	s.mu.Lock()
+	delete(s.clients, c)
+	s.mu.Unlock()
+	close(c.send)
+	<-done
+	s.log.Debugf("Client %s disconnected", conn.Request().RemoteAddr)
+}
+
+func (s *server) writeLoop(c *client) {
+	for buf := range c.send {
+		c.conn.SetWriteDeadline(time.Now().Add(s.writeTimeout))
+		if err := websocket.Message.Send(c.conn, string(buf)); err != nil {
+			// Closing the connection ends the read loop of the client.
+			c.conn.Close()
+			break
+		}
+	}
+
+	// Drain the queue until the read loop stops the client.
+	for range c.send {
+	}
+}
+
+// broadcast queues the metrics matching the subscription of each client.
+func (s *server) broadcast(metrics []telegraf.Metric, serializer serializers.Serializer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var all []byte
+	for c := range s.clients {
+		var buf []byte
+		var err error
+		if f := c.getFilter(); f != nil && f.IsActive() {
+			selected := make([]telegraf.Metric, 0, len(metrics))
+			for _, m := range metrics {
+				if f.Select(m) {
+					selected = append(selected, m)
+				}
+			}
+			if len(selected) == 0 {
+				continue
+			}
+			buf, err = serializer.SerializeBatch(selected)
+		} else {
+			if all == nil {
+				all, err = serializer.SerializeBatch(metrics)
+			}
+			buf = all
+		}
+		if err != nil {
+			s.log.Errorf("Could not serialize metrics: %v", err)
+			continue
+		}
+
+		select {
+		case c.send <- buf:
+		default:
+			s.log.Warnf("Client %s is too slow, dropping metrics", c.conn.Request().RemoteAddr)
+		}
+	}
+}
+
+func (s *server) close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := s.http.Shutdown(ctx)
+
+	// Websocket connections are hijacked and not closed by the shutdown.
+	s.mu.Lock()
+	for c := range s.clients {
+		c.conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	s.handlers.Wait()
+	return err
+}
@@ -0,0 +1,287 @@
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/internal/tls"
+	"github.com/influxdata/telegraf/plugins/outputs"
+	"github.com/influxdata/telegraf/plugins/serializers"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	defaultPath                 = "/telegraf"
+	defaultConnectTimeout       = 30 * time.Second
+	defaultWriteTimeout         = 30 * time.Second
+	defaultReconnectInterval    = time.Second
+	defaultMaxReconnectInterval = time.Minute
+)
+
+var sampleConfig = `
+  ## URL of the websocket server to dial, the output writes to this server
+  ## when set.
+  ##   ex: url = "wss://dashboard.example.com/telegraf"
+  # url = "ws://localhost:8080/telegraf"
+
+  ## Address to serve a websocket endpoint on, the output streams the
+  ## metrics to all connected clients when set.  Only one of url and
+  ## service_address can be set.
+  ##   ex: service_address = ":8081"
+  # service_address = ""
+
+  ## Path of the served websocket endpoint.
+  # path = "/telegraf"
+
+  ## Timeout for dialing the server and for writing a message.
+  # connect_timeout = "30s"
+  # write_timeout = "30s"
+
+  ## Delay before reconnecting after the connection to the server is lost.
+  ## The delay doubles after each failed attempt, up to the maximum.
+  # reconnect_interval = "1s"
+  # max_reconnect_interval = "1m"
+
+  ## Additional HTTP headers sent when dialing the server.
+  # [outputs.websocket.headers]
+  #   Authorization = "Bearer token"
+
+  ## Username and password to accept for HTTP basic authentication on the
+  ## served endpoint.
+  # basic_username = "user1"
+  # basic_password = "secret"
+
+  ## Origins allowed to connect to the served endpoint, all origins are
+  ## allowed when empty.
+  # allowed_origins = ["https://dashboard.example.com"]
+
+  ## Optional TLS Config.  When serving, the certificate and key are used as
+  ## the server certificate and tls_allowed_cacerts enables client
+  ## certificate authentication.
+  # tls_ca = "/etc/telegraf/ca.pem"
+  # tls_cert = "/etc/telegraf/cert.pem"
+  # tls_key = "/etc/telegraf/key.pem"
+  # tls_allowed_cacerts = ["/etc/telegraf/clientca.pem"]
+  ## Use TLS but skip chain & host verification
+  # insecure_skip_verify = false
+
+  ## Data format to output.
+  ## Each data format has its own unique set of configuration options, read
+  ## more about them here:
+  ## https://github.com/influxdata/telegraf/blob/master/docs/DATA_FORMATS_OUTPUT.md
+  data_format = "json"
+`
+
+type WebSocket struct {
+	URL                  string            `toml:"url"`
+	ServiceAddress       string            `toml:"service_address"`
+	Path                 string            `toml:"path"`
+	ConnectTimeout       internal.Duration `toml:"connect_timeout"`
+	WriteTimeout         internal.Duration `toml:"write_timeout"`
+	ReconnectInterval    internal.Duration `toml:"reconnect_interval"`
+	MaxReconnectInterval internal.Duration `toml:"max_reconnect_interval"`
+	Headers              map[string]string `toml:"headers"`
+	BasicUsername        string            `toml:"basic_username"`
+	BasicPassword        string            `toml:"basic_password"`
+	AllowedOrigins       []string          `toml:"allowed_origins"`
+	TLSAllowedCACerts    []string          `toml:"tls_allowed_cacerts"`
+	tls.ClientConfig
+
+	Log telegraf.Logger `toml:"-"`
+
+	serializer serializers.Serializer
+
+	// client mode
+	config   *websocket.Config
+	conn     *websocket.Conn
+	backoff  time.Duration
+	nextDial time.Time
+
+	// server mode
+	server *server
+}
+
+func (w *WebSocket) SampleConfig() string {
+	return sampleConfig
+}
+
+func (w *WebSocket) Description() string {
+	return "Send metrics to a websocket server or to the clients of a websocket endpoint"
+}
+
+func (w *WebSocket) SetSerializer(serializer serializers.Serializer) {
+	w.serializer = serializer
+}
+
+func (w *WebSocket) Init() error {
+	if (w.URL == "") == (w.ServiceAddress == "") {
+		return errors.New("exactly one of url and service_address must be set")
+	}
+	if w.ReconnectInterval.Duration <= 0 {
+		w.ReconnectInterval.Duration = defaultReconnectInterval
+	}
+	if w.MaxReconnectInterval.Duration < w.ReconnectInterval.Duration {
+		w.MaxReconnectInterval.Duration = w.ReconnectInterval.Duration
+	}
+	if w.Path == "" {
+		w.Path = defaultPath
+	}
+	return nil
+}
+
+func (w *WebSocket) Connect() error {
+	if w.ServiceAddress != "" {
+		return w.listen()
+	}
+
+	u, err := url.Parse(w.URL)
+	if err != nil {
+		return err
+	}
+
+	config, err := websocket.NewConfig(w.URL, origin(u))
+	if err != nil {
+		return err
+	}
+
+	config.TlsConfig, err = w.ClientConfig.TLSConfig()
+	if err != nil {
+		return err
+	}
+	config.Dialer = &net.Dialer{Timeout: w.ConnectTimeout.Duration}
+	for k, v := range w.Headers {
+		config.Header.Set(k, v)
+	}
+	w.config = config
+
+	// The server may not be up yet, metrics are kept in the buffer until the
+	// connection can be established.
+	if err := w.dial(); err != nil {
+		w.Log.Warnf("Could not connect to %s, will retry: %v", w.URL, err)
+	}
+	return nil
+}
+
+func (w *WebSocket) Close() error {
+	if w.server != nil {
+		return w.server.close()
+	}
+	if w.conn != nil {
+		err := w.conn.Close()
+		w.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (w *WebSocket) Write(metrics []telegraf.Metric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	if w.server != nil {
+		w.server.broadcast(metrics, w.serializer)
+		return nil
+	}
+
+	if w.conn == nil {
+		if err := w.dial(); err != nil {
+			return err
+		}
+	}
+
+	buf, err := w.serializer.SerializeBatch(metrics)
+	if err != nil {
+		return err
+	}
+
+	w.conn.SetWriteDeadline(time.Now().Add(w.WriteTimeout.Duration))
+	if err := websocket.Message.Send(w.conn, string(buf)); err != nil {
+		w.conn.Close()
+		w.conn = nil
+		w.retryLater()
+		return fmt.Errorf("error writing to %s: %v", w.URL, err)
+	}
+	return nil
+}
+
+// dial connects to the server unless the reconnect delay after a failure has
+// not passed yet.
+func (w *WebSocket) dial() error {
+	if now := time.Now(); now.Before(w.nextDial) {
+		return fmt.Errorf("not connected to %s, reconnecting in %s",
+			w.URL, w.nextDial.Sub(now).Round(time.Millisecond))
+	}
+
+	conn, err := websocket.DialConfig(w.config)
+	if err != nil {
+		w.retryLater()
+		return err
+	}
+	w.conn = conn
+	w.backoff = 0
+	w.Log.Debugf("Connected to %s", w.URL)
+
+	// Messages from the server are discarded, reading is still needed to
+	// answer pings and to notice when the server closes the connection.
+	go io.Copy(ioutil.Discard, conn)
+	return nil
+}
+
+// retryLater delays the next connection attempt, doubling the delay after
+// each consecutive failure.
+func (w *WebSocket) retryLater() {
+	if w.backoff == 0 {
+		w.backoff = w.ReconnectInterval.Duration
+	} else {
+		w.backoff *= 2
+	}
+	if w.backoff > w.MaxReconnectInterval.Duration {
+		w.backoff = w.MaxReconnectInterval.Duration
+	}
+	w.nextDial = time.Now().Add(w.backoff)
+}
+
+// origin returns the origin sent when dialing, the http or https URL of the
+// server.
+func origin(u *url.URL) string {
+	scheme := "http"
+	if u.Scheme == "wss" {
+		scheme = "https"
+	}
+	return scheme + "://" + u.Host
+}
+
+func (w *WebSocket) handler() http.Handler {
+	authHandler := internal.AuthHandler(w.BasicUsername, w.BasicPassword, onAuthError)
+	mux := http.NewServeMux()
+	mux.Handle(w.Path, authHandler(websocket.Server{
+		Handshake: w.checkOrigin,
+		Handler:   w.server.serve,
+	}))
+	return mux
+}
+
+func onAuthError(rw http.ResponseWriter, code int) {
+	http.Error(rw, http.StatusText(code), code)
+}
+
+func init() {
+	outputs.Add("websocket", func() telegraf.Output {
+		return &WebSocket{
+			Path:                 defaultPath,
+			ConnectTimeout:       internal.Duration{Duration: defaultConnectTimeout},
+			WriteTimeout:         internal.Duration{Duration: defaultWriteTimeout},
+			ReconnectInterval:    internal.Duration{Duration: defaultReconnectInterval},
+			MaxReconnectInterval: internal.Duration{Duration: defaultMaxReconnectInterval},
+		}
+	})
+}
@@ -0,0 +1,165 @@
+package websocket
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/serializers/influx"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+func newWebSocket() *WebSocket {
+	w := &WebSocket{
+		ConnectTimeout:       internal.Duration{Duration: time.Second},
+		WriteTimeout:         internal.Duration{Duration: time.Second},
+		ReconnectInterval:    internal.Duration{Duration: time.Second},
+		MaxReconnectInterval: internal.Duration{Duration: 4 * time.Second},
+		Log:                  testutil.Logger{},
+	}
+	w.SetSerializer(influx.NewSerializer())
+	return w
+}
+
+func testMetrics() []telegraf.Metric {
+	return []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"usage_idle": 42.0},
+			time.Unix(0, 0)),
+		testutil.MustMetric("mem",
+			map[string]string{"host": "b"},
+			map[string]interface{}{"used": int64(10)},
+			time.Unix(0, 0)),
+	}
+}
+
+func TestInit(t *testing.T) {
+	w := newWebSocket()
+	require.Error(t, w.Init())
+
+	w = newWebSocket()
+	w.URL = "ws://localhost:8080"
+	w.ServiceAddress = ":8081"
+	require.Error(t, w.Init())
+
+	w = newWebSocket()
+	w.URL = "ws://localhost:8080"
+	require.NoError(t, w.Init())
+	require.Equal(t, defaultPath, w.Path)
+}
+
+func TestClientWrite(t *testing.T) {
+	received := make(chan string, 1)
+	ts := httptest.NewServer(websocket.Handler(func(conn *websocket.Conn) {
+		var msg string
+		require.NoError(t, websocket.Message.Receive(conn, &msg))
+		received <- msg
+	}))
+	defer ts.Close()
+
+	w := newWebSocket()
+	w.URL = "ws" + strings.TrimPrefix(ts.URL, "http")
+	require.NoError(t, w.Init())
+	require.NoError(t, w.Connect())
+	require.NoError(t, w.Write(testMetrics()))
+
+	select {
+	case msg := <-received:
+		require.Equal(t, "cpu,host=a usage_idle=42 0\nmem,host=b used=10i 0\n", msg)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+	require.NoError(t, w.Close())
+}
+
+func TestClientReconnectBackoff(t *testing.T) {
+	ts := httptest.NewServer(websocket.Handler(func(conn *websocket.Conn) {}))
+	url := "ws" + strings.TrimPrefix(ts.URL, "http")
+	ts.Close()
+
+	w := newWebSocket()
+	w.URL = url
+	require.NoError(t, w.Init())
+
+	// The output starts even if the server is down.
+	require.NoError(t, w.Connect())
+	require.Nil(t, w.conn)
+	require.Equal(t, time.Second, w.backoff)
+
+	// Writes fail without dialing until the delay has passed.
+	err := w.Write(testMetrics())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "reconnecting in")
+	require.Equal(t, time.Second, w.backoff)
+
+	for _, expected := range []time.Duration{2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		w.nextDial = time.Time{}
+		require.Error(t, w.Write(testMetrics()))
+		require.Equal(t, expected, w.backoff)
+	}
+}
+
+func TestServerSubscription(t *testing.T) {
+	w := newWebSocket()
+	w.ServiceAddress = "127.0.0.1:0"
+	require.NoError(t, w.Init())
+	require.NoError(t, w.Connect())
+	defer w.Close()
+
+	location := "ws://" + w.server.addr.String() + defaultPath
+	all, err := websocket.Dial(location, "", "http://localhost/")
+	require.NoError(t, err)
+	defer all.Close()
+
+	subscribed, err := websocket.Dial(location, "", "http://localhost/")
+	require.NoError(t, err)
+	defer subscribed.Close()
+	require.NoError(t, websocket.Message.Send(subscribed, `{"namepass": ["c*"], "tagpass": {"host": ["a"]}}`))
+
+	// Wait for both clients and the subscription to be registered.
+	require.Eventually(t, func() bool {
+		w.server.mu.Lock()
+		defer w.server.mu.Unlock()
+		if len(w.server.clients) != 2 {
+			return false
+		}
+		for c := range w.server.clients {
+			if c.getFilter() != nil {
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, w.Write(testMetrics()))
+
+	var msg string
+	require.NoError(t, websocket.Message.Receive(all, &msg))
+	require.Equal(t, "cpu,host=a usage_idle=42 0\nmem,host=b used=10i 0\n", msg)
+
+	require.NoError(t, websocket.Message.Receive(subscribed, &msg))
+	require.Equal(t, "cpu,host=a usage_idle=42 0\n", msg)
+}
+
+func TestServerAllowedOrigins(t *testing.T) {
+	w := newWebSocket()
+	w.ServiceAddress = "127.0.0.1:0"
+	w.AllowedOrigins = []string{"https://dashboard.example.com"}
+	require.NoError(t, w.Init())
+	require.NoError(t, w.Connect())
+	defer w.Close()
+
+	location := "ws://" + w.server.addr.String() + defaultPath
+	_, err := websocket.Dial(location, "", "http://localhost/")
+	require.Error(t, err)
+
+	conn, err := websocket.Dial(location, "", "https://dashboard.example.com")
+	require.NoError(t, err)
+	conn.Close()
+}
@@ -0,0 +1,486 @@
+package alert
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/filter"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/plugins/common/stats"
+	"github.com/influxdata/telegraf/plugins/processors"
+)
+
+const sampleConfig = `
+  ## Name of the measurement used for the emitted alert metrics.
+  # measurement = "alert"
+
+  ## Series not seen for this duration are forgotten.  Must be longer than
+  ## the time needed for the absence rules to reach their thresholds.
+  # expire_after = "1h"
+
+  ## Each rule is evaluated separately for every series and field it matches.
+  [[processors.alert.rule]]
+    ## Name of the rule, added to the alert as the "rule" tag.
+    name = "cpu_busy"
+
+    ## Measurement and field names to evaluate, glob patterns are supported.
+    measurement = "cpu"
+    field = "usage_user"
+
+    ## Type of the rule:
+    ##   threshold - compare the field value against the thresholds
+    ##   rate      - compare the rate of change per second of the field
+    ##   zscore    - compare the z-score of the field against the mean and
+    ##               standard deviation of the previous "window" values
+    ##   absence   - compare the number of "interval"s since the series was
+    ##               last seen
+    type = "threshold"
+
+    ## Direction in which the thresholds are crossed, one of "above",
+    ## "below" or "both" (compare the absolute value).  Absence rules are
+    ## always "above".
+    # direction = "above"
+
+    ## Thresholds for the warning and critical states, either may be omitted.
+    warning = 80.0
+    critical = 95.0
+
+    ## Amount by which the value must recover past a threshold before the
+    ## state is lowered, preventing flapping around the threshold.
+    # hysteresis = 5.0
+
+    ## Number of previous values used by zscore rules.
+    # window = 30
+
+    ## Expected reporting interval of the series for absence rules.
+    # interval = "10s"
+`
+
+const (
+	levelOK = iota
+	levelWarning
+	levelCritical
+)
+
+var levelNames = []string{"ok", "warning", "critical"}
+
+// Alert evaluates rules against the metrics passing through and emits a
+// metric whenever the state of a rule changes for a series.
+type Alert struct {
+	Measurement string            `toml:"measurement"`
+	ExpireAfter internal.Duration `toml:"expire_after"`
+	Rules       []*Rule           `toml:"rule"`
+	Log         telegraf.Logger   `toml:"-"`
+
+	sync.Mutex
+	states map[stateKey]*seriesState
+	now    func() time.Time
+
+	// period at which the absence rules are checked and the states expired
+	period time.Duration
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// Rule describes a single alerting condition.
+type Rule struct {
+	Name        string            `toml:"name"`
+	Measurement string            `toml:"measurement"`
+	Field       string            `toml:"field"`
+	Type        string            `toml:"type"`
+	Direction   string            `toml:"direction"`
+	Warning     *float64          `toml:"warning"`
+	Critical    *float64          `toml:"critical"`
+	Hysteresis  float64           `toml:"hysteresis"`
+	Window      int               `toml:"window"`
+	Interval    internal.Duration `toml:"interval"`
+
+	measurementFilter filter.Filter
+	fieldFilter       filter.Filter
+}
+
+type stateKey struct {
+	rule   int
+	series uint64
+	field  string
+}
+
+type seriesState struct {
+	name  string
+	tags  map[string]string
+	level int
+
+	lastValue float64
+	lastTime  time.Time
+	lastSeen  time.Time
+	hasLast   bool
+	window    []float64
+}
+
+func NewAlert() *Alert {
+	return &Alert{
+		Measurement: "alert",
+		ExpireAfter: internal.Duration{Duration: time.Hour},
+		states:      make(map[stateKey]*seriesState),
+		now:         time.Now,
+	}
+}
+
+func (a *Alert) SampleConfig() string {
+	return sampleConfig
+}
+
+func (a *Alert) Description() string {
+	return "Evaluate alerting rules and emit metrics on state transitions."
+}
+
+func (a *Alert) Init() error {
+	if a.ExpireAfter.Duration <= 0 {
+		return fmt.Errorf("expire_after must be positive")
+	}
+
+	a.period = a.ExpireAfter.Duration
+	for i, r := range a.Rules {
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule%d", i)
+		}
+		if err := r.init(); err != nil {
+			return fmt.Errorf("rule %q: %v", r.Name, err)
+		}
+		if r.Type != "absence" {
+			continue
+		}
+
+		limit := r.Warning
+		if r.Critical != nil {
+			limit = r.Critical
+		}
+		if (*limit+1)*float64(r.Interval.Duration) > float64(a.ExpireAfter.Duration) {
+			return fmt.Errorf("rule %q: expire_after must be longer than %v intervals",
+				r.Name, *limit+1)
+		}
+		if r.Interval.Duration < a.period {
+			a.period = r.Interval.Duration
+		}
+	}
+	return nil
+}
+
+// Start checks the absence rules and expires the states periodically, even
+// when no metrics pass through the processor.
+func (a *Alert) Start(acc telegraf.Accumulator) error {
+	a.done = make(chan struct{})
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		ticker := time.NewTicker(a.period)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-a.done:
+				return
+			case <-ticker.C:
+				for _, m := range a.check() {
+					acc.AddMetric(m)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+func (a *Alert) Stop() {
+	if a.done == nil {
+		return
+	}
+	close(a.done)
+	a.wg.Wait()
+}
+
+// check evaluates the absence rules and removes the states of the series
+// not seen for expire_after, returning the alerts.  The series expiring in a
+// warning or critical state are reported in the "expired" state.
+func (a *Alert) check() []telegraf.Metric {
+	a.Lock()
+	defer a.Unlock()
+
+	now := a.now()
+	var alerts []telegraf.Metric
+	for key, st := range a.states {
+		if now.Sub(st.lastSeen) >= a.ExpireAfter.Duration {
+			if st.level != levelOK {
+				fields := map[string]interface{}{
+					"state":          "expired",
+					"previous_state": levelNames[st.level],
+					"level":          int64(levelOK),
+				}
+				if alert := a.newAlert(a.Rules[key.rule], st, key.field, fields, now); alert != nil {
+					alerts = append(alerts, alert)
+				}
+			}
+			delete(a.states, key)
+			continue
+		}
+
+		r := a.Rules[key.rule]
+		if r.Type != "absence" {
+			continue
+		}
+		missed := float64(now.Sub(st.lastSeen)) / float64(r.Interval.Duration)
+		if alert := a.evaluate(r, st, key.field, math.Floor(missed), now); alert != nil {
+			alerts = append(alerts, alert)
+		}
+	}
+	return alerts
+}
+
+func (r *Rule) init() error {
+	switch r.Type {
+	case "", "threshold":
+		r.Type = "threshold"
+	case "rate":
+	case "zscore":
+		if r.Window == 0 {
+			r.Window = 30
+		}
+		if r.Window < 2 {
+			return fmt.Errorf("window must be at least 2")
+		}
+	case "absence":
+		if r.Interval.Duration <= 0 {
+			return fmt.Errorf("interval must be set for absence rules")
+		}
+		r.Direction = "above"
+	default:
+		return fmt.Errorf("unknown rule type %q", r.Type)
+	}
+
+	switch r.Direction {
+	case "":
+		r.Direction = "above"
+	case "above", "below", "both":
+	default:
+		return fmt.Errorf("unknown direction %q", r.Direction)
+	}
+
+	if r.Warning == nil && r.Critical == nil {
+		return fmt.Errorf("at least one of warning or critical must be set")
+	}
+	if r.Hysteresis < 0 {
+		return fmt.Errorf("hysteresis must not be negative")
+	}
+
+	var err error
+	if r.Measurement == "" {
+		r.Measurement = "*"
+	}
+	r.measurementFilter, err = filter.Compile([]string{r.Measurement})
+	if err != nil {
+		return err
+	}
+	if r.Field == "" {
+		r.Field = "*"
+	}
+	r.fieldFilter, err = filter.Compile([]string{r.Field})
+	return err
+}
+
+func (a *Alert) Apply(in ...telegraf.Metric) []telegraf.Metric {
+	a.Lock()
+	defer a.Unlock()
+
+	now := a.now()
+
+	var alerts []telegraf.Metric
+	for _, m := range in {
+		for i, r := range a.Rules {
+			if !r.measurementFilter.Match(m.Name()) {
+				continue
+			}
+
+			for _, field := range m.FieldList() {
+				if !r.fieldFilter.Match(field.Key) {
+					continue
+				}
+				v, ok := convert(field.Value)
+				if !ok {
+					continue
+				}
+
+				key := stateKey{rule: i, series: m.HashID(), field: field.Key}
+				st, ok := a.states[key]
+				if !ok {
+					st = &seriesState{name: m.Name(), tags: m.Tags()}
+					a.states[key] = st
+				}
+				st.lastSeen = now
+
+				value, ok := r.observe(st, v, m.Time())
+				if !ok {
+					continue
+				}
+				if alert := a.evaluate(r, st, field.Key, value, m.Time()); alert != nil {
+					alerts = append(alerts, alert)
+				}
+			}
+		}
+	}
+
+	return append(in, alerts...)
+}
+
+// evaluate updates the state of the series and returns an alert metric if
+// the state changed.
+func (a *Alert) evaluate(r *Rule, st *seriesState, field string, value float64, tm time.Time) telegraf.Metric {
+	level := r.level(value, st.level)
+	if level == st.level {
+		return nil
+	}
+
+	fields := map[string]interface{}{
+		"state":          levelNames[level],
+		"previous_state": levelNames[st.level],
+		"level":          int64(level),
+		"value":          value,
+	}
+	st.level = level
+
+	return a.newAlert(r, st, field, fields, tm)
+}
+
+// newAlert returns an alert metric for the field of the series.
+func (a *Alert) newAlert(r *Rule, st *seriesState, field string, fields map[string]interface{}, tm time.Time) telegraf.Metric {
+	tags := make(map[string]string, len(st.tags)+3)
+	for k, v := range st.tags {
+		tags[k] = v
+	}
+	tags["rule"] = r.Name
+	tags["name"] = st.name
+	tags["field"] = field
+
+	m, err := metric.New(a.Measurement, tags, fields, tm)
+	if err != nil {
+		a.Log.Errorf("Creating alert metric: %v", err)
+		return nil
+	}
+	return m
+}
+
+// observe records the value in the series state and returns the value the
+// thresholds of the rule are compared against, or false if there is not yet
+// enough data to evaluate the rule.
+func (r *Rule) observe(st *seriesState, v float64, tm time.Time) (float64, bool) {
+	switch r.Type {
+	case "rate":
+		defer func() {
+			st.lastValue, st.lastTime, st.hasLast = v, tm, true
+		}()
+		if !st.hasLast {
+			return 0, false
+		}
+		dt := tm.Sub(st.lastTime).Seconds()
+		if dt <= 0 {
+			return 0, false
+		}
+		return (v - st.lastValue) / dt, true
+	case "zscore":
+		defer func() {
+			st.window = append(st.window, v)
+			if len(st.window) > r.Window {
+				st.window = st.window[1:]
+			}
+		}()
+		if len(st.window) < 2 {
+			return 0, false
+		}
+		mean, stddev := meanStddev(st.window)
+		if stddev == 0 {
+			return 0, false
+		}
+		return (v - mean) / stddev, true
+	case "absence":
+		return 0, true
+	default:
+		return v, true
+	}
+}
+
+// level returns the state for the value given the current state, only
+// lowering the state once the value has recovered by the hysteresis.
+func (r *Rule) level(v float64, current int) int {
+	switch r.Direction {
+	case "below":
+		v = -v
+	case "both":
+		v = math.Abs(v)
+	}
+
+	lvl := r.rawLevel(v, 0)
+	if lvl >= current {
+		return lvl
+	}
+
+	held := r.rawLevel(v, r.Hysteresis)
+	if held > current {
+		held = current
+	}
+	if held > lvl {
+		return held
+	}
+	return lvl
+}
+
+func (r *Rule) rawLevel(v float64, offset float64) int {
+	if r.Critical != nil && v >= r.threshold(*r.Critical)-offset {
+		return levelCritical
+	}
+	if r.Warning != nil && v >= r.threshold(*r.Warning)-offset {
+		return levelWarning
+	}
+	return levelOK
+}
+
+func (r *Rule) threshold(t float64) float64 {
+	switch r.Direction {
+	case "below":
+		return -t
+	case "both":
+		return math.Abs(t)
+	}
+	return t
+}
+
+func meanStddev(values []float64) (float64, float64) {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+
+	var sq float64
+	for _, v := range values {
+		sq += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(sq / float64(len(values)-1))
+}
+
+// convert returns the value of numeric and boolean fields.
+func convert(in interface{}) (float64, bool) {
+	if v, ok := in.(bool); ok {
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	return stats.ToFloat(in)
+}
+
+func init() {
+	processors.Add("alert", func() telegraf.Processor {
+		return NewAlert()
+	})
+}
@@ -0,0 +1,264 @@
+package alert
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/influxdata/toml"
+	"github.com/stretchr/testify/require"
+)
+
+func float(v float64) *float64 {
+	return &v
+}
+
+func newCPU(value float64, tm time.Time) telegraf.Metric {
+	return testutil.MustMetric("cpu",
+		map[string]string{"host": "a"},
+		map[string]interface{}{"usage": value},
+		tm,
+	)
+}
+
+// states returns the state field of the alerts in the metrics.
+func states(metrics []telegraf.Metric) []string {
+	var s []string
+	for _, m := range metrics {
+		if m.Name() != "alert" {
+			continue
+		}
+		v, _ := m.GetField("state")
+		s = append(s, v.(string))
+	}
+	return s
+}
+
+func TestParseConfig(t *testing.T) {
+	a := NewAlert()
+	err := toml.Unmarshal([]byte(`
+		[[rule]]
+			name = "high"
+			measurement = "cpu"
+			field = "usage"
+			warning = 80.0
+			interval = "10s"
+	`), a)
+	require.NoError(t, err)
+	require.NoError(t, a.Init())
+	require.Len(t, a.Rules, 1)
+	require.Nil(t, a.Rules[0].Critical)
+	require.Equal(t, 80.0, *a.Rules[0].Warning)
+	require.Equal(t, "threshold", a.Rules[0].Type)
+}
+
+func TestInitErrors(t *testing.T) {
+	tests := []*Rule{
+		{Type: "unknown", Warning: float(1)},
+		{Type: "threshold"},
+		{Type: "absence", Warning: float(1)},
+		{Type: "threshold", Direction: "sideways", Warning: float(1)},
+		{Type: "zscore", Window: 1, Warning: float(1)},
+	}
+	for _, r := range tests {
+		a := NewAlert()
+		a.Rules = []*Rule{r}
+		require.Error(t, a.Init())
+	}
+}
+
+func TestThresholdHysteresis(t *testing.T) {
+	a := NewAlert()
+	a.Rules = []*Rule{{
+		Name:       "busy",
+		Field:      "usage",
+		Warning:    float(80),
+		Critical:   float(90),
+		Hysteresis: 5,
+	}}
+	require.NoError(t, a.Init())
+
+	now := time.Unix(0, 0)
+	var actual []string
+	for _, v := range []float64{50, 85, 95, 88, 86, 84, 79, 76, 74} {
+		actual = append(actual, states(a.Apply(newCPU(v, now)))...)
+	}
+	require.Equal(t, []string{"warning", "critical", "warning", "ok"}, actual)
+}
+
+func TestAlertMetric(t *testing.T) {
+	a := NewAlert()
+	a.Rules = []*Rule{{
+		Name:      "idle",
+		Field:     "usage",
+		Direction: "below",
+		Critical:  float(10),
+	}}
+	require.NoError(t, a.Init())
+
+	now := time.Unix(42, 0)
+	metrics := a.Apply(newCPU(5, now))
+
+	expected := []telegraf.Metric{
+		newCPU(5, now),
+		testutil.MustMetric("alert",
+			map[string]string{
+				"host":  "a",
+				"rule":  "idle",
+				"name":  "cpu",
+				"field": "usage",
+			},
+			map[string]interface{}{
+				"state":          "critical",
+				"previous_state": "ok",
+				"level":          int64(2),
+				"value":          5.0,
+			},
+			now,
+		),
+	}
+	testutil.RequireMetricsEqual(t, expected, metrics)
+}
+
+func TestRate(t *testing.T) {
+	a := NewAlert()
+	a.Rules = []*Rule{{
+		Type:     "rate",
+		Field:    "usage",
+		Warning:  float(10),
+		Critical: float(20),
+	}}
+	require.NoError(t, a.Init())
+
+	var actual []string
+	for i, v := range []float64{0, 5, 20, 45, 50} {
+		tm := time.Unix(int64(i), 0)
+		actual = append(actual, states(a.Apply(newCPU(v, tm)))...)
+	}
+	require.Equal(t, []string{"warning", "critical", "ok"}, actual)
+}
+
+func TestZScore(t *testing.T) {
+	a := NewAlert()
+	a.Rules = []*Rule{{
+		Type:      "zscore",
+		Field:     "usage",
+		Direction: "both",
+		Critical:  float(3),
+		Window:    10,
+	}}
+	require.NoError(t, a.Init())
+
+	var actual []string
+	for _, v := range []float64{10, 11, 9, 10, 11, 9, 10, 50, 10} {
+		actual = append(actual, states(a.Apply(newCPU(v, time.Unix(0, 0))))...)
+	}
+	require.Equal(t, []string{"critical", "ok"}, actual)
+}
+
+func TestAbsence(t *testing.T) {
+	now := time.Unix(0, 0)
+	a := NewAlert()
+	a.now = func() time.Time { return now }
+	a.Rules = []*Rule{{
+		Type:     "absence",
+		Field:    "usage",
+		Warning:  float(2),
+		Critical: float(4),
+		Interval: internal.Duration{Duration: 10 * time.Second},
+	}}
+	require.NoError(t, a.Init())
+	require.Equal(t, 10*time.Second, a.period)
+
+	require.Empty(t, states(a.Apply(newCPU(1, now))))
+	require.Empty(t, states(a.check()))
+
+	now = now.Add(25 * time.Second)
+	require.Equal(t, []string{"warning"}, states(a.check()))
+
+	now = now.Add(20 * time.Second)
+	require.Equal(t, []string{"critical"}, states(a.check()))
+	require.Empty(t, states(a.check()))
+
+	now = now.Add(5 * time.Second)
+	require.Equal(t, []string{"ok"}, states(a.Apply(newCPU(1, now))))
+}
+
+func TestExpire(t *testing.T) {
+	now := time.Unix(0, 0)
+	a := NewAlert()
+	a.now = func() time.Time { return now }
+	a.ExpireAfter = internal.Duration{Duration: time.Minute}
+	a.Rules = []*Rule{{
+		Field:   "usage",
+		Warning: float(80),
+	}, {
+		Type:     "absence",
+		Field:    "usage",
+		Warning:  float(2),
+		Interval: internal.Duration{Duration: 10 * time.Second},
+	}}
+	require.NoError(t, a.Init())
+
+	a.Apply(newCPU(90, now))
+	require.Len(t, a.states, 2)
+
+	now = now.Add(59 * time.Second)
+	require.Equal(t, []string{"warning"}, states(a.check()))
+	require.Len(t, a.states, 2)
+
+	// both rules are in the warning state when the series expires
+	now = now.Add(time.Second)
+	alerts := a.check()
+	require.Equal(t, []string{"expired", "expired"}, states(alerts))
+	for _, m := range alerts {
+		previous, _ := m.GetField("previous_state")
+		require.Equal(t, "warning", previous)
+		require.False(t, m.HasField("value"))
+	}
+	require.Empty(t, a.states)
+
+	// series expiring in the ok state are forgotten silently
+	a.Apply(newCPU(10, now))
+	now = now.Add(time.Minute)
+	require.Empty(t, a.check())
+	require.Empty(t, a.states)
+}
+
+func TestStopWithoutStart(t *testing.T) {
+	a := NewAlert()
+	require.NoError(t, a.Init())
+	a.Stop()
+}
+
+func TestExpireTooShort(t *testing.T) {
+	a := NewAlert()
+	a.ExpireAfter = internal.Duration{Duration: time.Minute}
+	a.Rules = []*Rule{{
+		Type:     "absence",
+		Critical: float(6),
+		Interval: internal.Duration{Duration: 10 * time.Second},
+	}}
+	require.Error(t, a.Init())
+}
+
+func TestStartAbsence(t *testing.T) {
+	a := NewAlert()
+	a.Rules = []*Rule{{
+		Type:     "absence",
+		Field:    "usage",
+		Critical: float(1),
+		Interval: internal.Duration{Duration: 10 * time.Millisecond},
+	}}
+	require.NoError(t, a.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, a.Start(&acc))
+	defer a.Stop()
+
+	a.Apply(newCPU(1, time.Now()))
+	acc.Wait(1)
+	require.Equal(t, []string{"critical"}, states(acc.GetTelegrafMetrics()))
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/filter"
 	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/internal/persister"
 	"github.com/influxdata/telegraf/metric"
 	"github.com/influxdata/telegraf/plugins/processors"
 )
@@ -25,6 +26,8 @@ type TopK struct {
 	AddRankFields      []string `toml:"add_rank_fields"`
 	AddAggregateFields []string `toml:"add_aggregate_fields"`
 
+	Log telegraf.Logger `toml:"-"`
+
 	cache           map[string][]telegraf.Metric
 	tagsGlobs       filter.Filter
 	rankFieldSet    map[string]bool
@@ -242,6 +245,53 @@ func (t *TopK) Apply(in ...telegraf.Metric) []telegraf.Metric {
 	return []telegraf.Metric{}
 }
 
+// topkState is the persisted form of the cache
+type topkState struct {
+	Cache           map[string][]persister.Metric `json:"cache"`
+	LastAggregation time.Time                     `json:"last_aggregation"`
+}
+
+// GetState returns the cached metrics of the current period so they can be
+// persisted.
+func (t *TopK) GetState() interface{} {
+	state := topkState{
+		Cache:           make(map[string][]persister.Metric, len(t.cache)),
+		LastAggregation: t.lastAggregation,
+	}
+	for key, ms := range t.cache {
+		for _, m := range ms {
+			s, err := persister.FromMetric(m)
+			if err != nil {
+				t.Log.Warnf("Metric %q is not persisted: %v", m.Name(), err)
+				continue
+			}
+			state.Cache[key] = append(state.Cache[key], s)
+		}
+	}
+	return state
+}
+
+// SetState restores the cached metrics of the current period.
+func (t *TopK) SetState(state interface{}) error {
+	s, ok := state.(topkState)
+	if !ok {
+		return fmt.Errorf("invalid state type %T", state)
+	}
+
+	t.cache = make(map[string][]telegraf.Metric, len(s.Cache))
+	for key, sms := range s.Cache {
+		for _, sm := range sms {
+			m, err := sm.ToMetric()
+			if err != nil {
+				return err
+			}
+			t.cache[key] = append(t.cache[key], m)
+		}
+	}
+	t.lastAggregation = s.LastAggregation
+	return nil
+}
+
 func min(a, b int) int {
 	if a > b {
 		return b
@@ -1,12 +1,14 @@
 package topk
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
 
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/internal"
 	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
 )
 
 // Key, value pair that represents a telegraf.Metric Field
@@ -530,3 +532,33 @@ func TestTopkGroupByKeyTag(t *testing.T) {
 	// Run the test
 	runAndCompare(&topk, input, answer, "GroupByKeyTag test", t)
 }
+
+// Test that the cached metrics are restored from the persisted state
+func TestTopkState(t *testing.T) {
+	topk := New()
+	topk.Period = createDuration(3600)
+	topk.Fields = []string{"a"}
+	topk.GroupBy = []string{"tag_name"}
+
+	input := deepCopy(MetricsSet1)
+	if ret := topk.Apply(input...); len(ret) != 0 {
+		t.Fatal("Expected no metrics before the period elapsed, got", ret)
+	}
+
+	buf, err := json.Marshal(topk.GetState())
+	require.NoError(t, err)
+	var state topkState
+	require.NoError(t, json.Unmarshal(buf, &state))
+
+	restored := New()
+	restored.Period = createDuration(1)
+	restored.Fields = []string{"a"}
+	restored.GroupBy = []string{"tag_name"}
+	require.NoError(t, restored.SetState(state))
+
+	time.Sleep(restored.Period.Duration)
+	ret := restored.Apply()
+	if !equalSets(ret, MetricsSet1) {
+		t.Error("\nExpected metrics:\n", MetricsSet1, "\nReturned metrics:\n", ret)
+	}
+}
@@ -10,3 +10,18 @@ type Processor interface {
 	// Apply the filter to the given metric.
 	Apply(in ...Metric) []Metric
 }
+
+// ServiceProcessor is a Processor that also emits metrics on its own, such
+// as on a timer, independently of the metrics passing through it.
+type ServiceProcessor interface {
+	Processor
+
+	// Start the ServiceProcessor.  Metrics added to the Accumulator are
+	// passed to the processors following it.  The Accumulator may be
+	// retained and used until Stop returns.
+	Start(Accumulator) error
+
+	// Stop stops the processor, it is called once no more metrics are
+	// applied.
+	Stop()
+}